@@ -0,0 +1,199 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admin provides the admin server, which serves the pprof, the runtime
+// log level and the component status. It should be only exposed to operators.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/health"
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+// LogLevel is the body of the log level API.
+type LogLevel struct {
+	// Level is the global level.
+	Level string `json:"level,omitempty"`
+	// Components is the levels of components which override the global
+	// level, empty level means following the global level.
+	Components map[string]string `json:"components,omitempty"`
+}
+
+func currentLogLevel() *LogLevel {
+	return &LogLevel{
+		Level:      logger.GetLevel(),
+		Components: logger.ComponentLevels(),
+	}
+}
+
+// ReloadResult is the result of reloading the bootstrap.
+type ReloadResult struct {
+	// Applied is the fields which have been applied in place.
+	Applied []string `json:"applied"`
+	// RestartRequired is the fields which take effect after restarting.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// ReloadFunc reloads the bootstrap.
+type ReloadFunc func() (*ReloadResult, error)
+
+// Option is the option of admin server.
+type Option func(s *Server)
+
+// Reload enables the reload API.
+func Reload(fn ReloadFunc) Option {
+	return func(s *Server) {
+		s.reload = fn
+	}
+}
+
+// Server is the admin server.
+type Server struct {
+	l       net.Listener
+	hs      *http.Server
+	checker *health.Checker
+	reload  ReloadFunc
+}
+
+// New creates an admin server, the component status is empty if the checker
+// is nil.
+func New(l net.Listener, checker *health.Checker, opts ...Option) *Server {
+	s := &Server{
+		l:       l,
+		hs:      new(http.Server),
+		checker: checker,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.hs.Handler = s.genRouter()
+	return s
+}
+
+func (s *Server) genRouter() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	router.HandleFunc("/log-level", s.handleGetLogLevel).Methods(http.MethodGet)
+	router.HandleFunc("/log-level", s.handleSetLogLevel).Methods(http.MethodPut)
+	router.HandleFunc("/status", s.handleGetStatus).Methods(http.MethodGet)
+	if s.reload != nil {
+		router.HandleFunc("/reload", s.handleReload).Methods(http.MethodPost)
+	}
+	return router
+}
+
+// Addr returns the listening address.
+func (s *Server) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Serve serves until the server is shut down.
+func (s *Server) Serve() error {
+	logger.Infof("Admin server listening on %s...", s.Addr())
+	switch err := s.hs.Serve(s.l); err {
+	case nil, http.ErrServerClosed:
+		return nil
+	default:
+		logger.Warnf("Admin server got an unexpected error: %v", err)
+		return err
+	}
+}
+
+// Shutdown shuts down the server.
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	if err := s.hs.Shutdown(ctx); err != nil {
+		logger.Warnf("Error when shutdowning the admin server: %v", err)
+	}
+}
+
+func writeMsg(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(msg))
+}
+
+func writeJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	b, err := json.Marshal(obj)
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	_, _ = w.Write(b)
+}
+
+func (s *Server) handleGetLogLevel(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, currentLogLevel())
+}
+
+func (s *Server) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	l := new(LogLevel)
+	if err := json.NewDecoder(r.Body).Decode(l); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if l.Level == "" && len(l.Components) == 0 {
+		writeMsg(w, http.StatusBadRequest, "level or components is required")
+		return
+	}
+	if l.Level != "" && !logger.IsValidLevel(l.Level) {
+		writeMsg(w, http.StatusBadRequest, "invalid log level: "+l.Level)
+		return
+	}
+	for name, level := range l.Components {
+		if level != "" && !logger.IsValidLevel(level) {
+			writeMsg(w, http.StatusBadRequest, "invalid log level of "+name+": "+level)
+			return
+		}
+	}
+
+	for name, level := range l.Components {
+		_ = logger.SetComponentLevel(name, level)
+	}
+	if l.Level != "" {
+		logger.SetLevel(l.Level)
+	}
+	writeJSON(w, currentLogLevel())
+}
+
+func (s *Server) handleGetStatus(w http.ResponseWriter, _ *http.Request) {
+	if s.checker == nil {
+		writeJSON(w, &health.Status{Ready: true, Components: []*health.ComponentStatus{}})
+		return
+	}
+	writeJSON(w, s.checker.Status())
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, _ *http.Request) {
+	res, err := s.reload()
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/health"
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+type fakeSyncer time.Time
+
+func (s fakeSyncer) LastSyncTime() time.Time { return time.Time(s) }
+
+func testHandler(req *http.Request, s *Server) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	s.hs.Handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestLogLevel(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+	s := New(nil, nil)
+
+	resp := testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level": "warn"}`)), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"level": "warn"}`, resp.Body.String())
+
+	resp = testHandler(httptest.NewRequest(http.MethodGet, "/log-level", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"level": "warn"}`, resp.Body.String())
+
+	resp = testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"components": {"discovery": "debug"}}`)), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"level": "warn", "components": {"discovery": "debug"}}`, resp.Body.String())
+	assert.Equal(t, logger.DebugLevel, logger.Component("discovery").Level())
+
+	resp = testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"components": {"discovery": ""}}`)), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"level": "warn"}`, resp.Body.String())
+
+	resp = testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"level": "foo"}`)), s)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{"components": {"api": "foo"}}`)), s)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{}`)), s)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = testHandler(httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(`{`)), s)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "warn", logger.GetLevel())
+}
+
+func TestStatus(t *testing.T) {
+	c := health.NewChecker()
+	c.Register("registry", fakeSyncer(time.Now()))
+	c.Register("config", fakeSyncer(time.Time{}))
+	s := New(nil, c)
+
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/status", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	status := new(health.Status)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), status))
+	assert.False(t, status.Ready)
+	assert.Len(t, status.Components, 2)
+	assert.True(t, status.Components[0].Ready)
+	assert.Equal(t, "never synced", status.Components[1].Reason)
+}
+
+func TestPprof(t *testing.T) {
+	s := New(nil, nil)
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = testHandler(httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestReload(t *testing.T) {
+	s := New(nil, nil)
+	resp := testHandler(httptest.NewRequest(http.MethodPost, "/reload", nil), s)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	var err error
+	s = New(nil, nil, Reload(func() (*ReloadResult, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &ReloadResult{Applied: []string{"log"}, RestartRequired: []string{"api.bind"}}, nil
+	}))
+	resp = testHandler(httptest.NewRequest(http.MethodPost, "/reload", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"applied": ["log"], "restart_required": ["api.bind"]}`, resp.Body.String())
+
+	err = errors.New("api.bind: address is empty")
+	resp = testHandler(httptest.NewRequest(http.MethodPost, "/reload", nil), s)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "api.bind: address is empty", resp.Body.String())
+}
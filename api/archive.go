@@ -0,0 +1,138 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/utils"
+)
+
+const (
+	paramFormat = "format"
+	paramDryRun = "dry_run"
+	paramMode   = "mode"
+	paramPrune  = "prune"
+
+	formatJSON = "json"
+	formatYAML = "yaml"
+
+	contentTypeYAML = "application/x-yaml"
+)
+
+func parseFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get(paramFormat); format {
+	case "", formatJSON:
+		return formatJSON, nil
+	case formatYAML, "yml":
+		return formatYAML, nil
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func parseBool(r *http.Request, param string) (bool, error) {
+	v := r.URL.Query().Get(param)
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format, err := parseFormat(r)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	archive, err := s.rawCtl.Export()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	b, err := json.Marshal(archive)
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ct := contentTypeJSON
+	if format == formatYAML {
+		if b, err = utils.JSONToYAML(b); err != nil {
+			writeMsg(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		ct = contentTypeYAML
+	}
+	w.Header().Set(contentType, ct)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=sash-export.%s", format))
+	_, _ = w.Write(b)
+}
+
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	var (
+		opts    config.ImportOptions
+		archive = new(config.Archive)
+	)
+	format, err := parseFormat(r)
+	if err != nil {
+		goto BadRequest
+	}
+	if opts.DryRun, err = parseBool(r, paramDryRun); err != nil {
+		goto BadRequest
+	}
+	if opts.Prune, err = parseBool(r, paramPrune); err != nil {
+		goto BadRequest
+	}
+	opts.Mode = config.ImportMode(r.URL.Query().Get(paramMode))
+	if err = decodeArchive(r, format, archive); err != nil {
+		goto BadRequest
+	}
+
+	{
+		res, err := s.rawCtl.Import(archive, opts)
+		switch err {
+		case nil:
+			writeJSON(w, res)
+		case config.ErrImportAborted:
+			w.Header().Set(contentType, contentTypeJSON)
+			w.WriteHeader(http.StatusConflict)
+			writeJSON(w, res)
+		default:
+			writeMsg(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+BadRequest:
+	writeMsg(w, http.StatusBadRequest, err.Error())
+}
+
+func decodeArchive(r *http.Request, format string, archive *config.Archive) error {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if format == formatYAML {
+		if b, err = utils.YAMLToJSON(b); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(b, archive)
+}
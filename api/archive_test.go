@@ -0,0 +1,104 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestHandleExport(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	assert.NoError(t, s.depsCtl.Add(&config.Dependency{ServiceName: "svc", Dependencies: []string{"dep"}}))
+
+	t.Run("bad format", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/export?format=xml", nil)
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, contentTypeJSON, resp.Header().Get(contentType))
+		archive := new(config.Archive)
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), archive))
+		assert.Equal(t, config.ArchiveVersion, archive.Version)
+		assert.Len(t, archive.Dependencies, 1)
+		assert.Equal(t, []string{"dep"}, archive.Dependencies[0].Dependencies)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/export?format=yaml", nil)
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, contentTypeYAML, resp.Header().Get(contentType))
+		assert.Contains(t, resp.Body.String(), "service_name: svc")
+	})
+}
+
+func TestHandleImport(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	t.Run("bad request", func(t *testing.T) {
+		for _, url := range []string{
+			"/api/import?format=xml",
+			"/api/import?dry_run=foo",
+			"/api/import?mode=foo",
+			"/api/import",
+		} {
+			req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(`{"version": 0}`)))
+			resp := testHandler(req, s)
+			assert.Equal(t, http.StatusBadRequest, resp.Code, url)
+		}
+	})
+
+	body := `
+version: 1
+dependencies:
+- service_name: svc
+  dependencies: [dep]
+`
+	t.Run("dry run", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/import?format=yaml&dry_run=true", bytes.NewReader([]byte(body)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		res := new(config.ImportResult)
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), res))
+		assert.True(t, res.DryRun)
+		assert.Len(t, res.Changes, 1)
+		assert.Equal(t, config.ChangeAdd, res.Changes[0].Op)
+		assert.False(t, s.depsCtl.Exist("svc"))
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/import?format=yaml", bytes.NewReader([]byte(body)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		dep, err := s.depsCtl.Get("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"dep"}, dep.Dependencies)
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/samaritan-proxy/sash/audit"
+)
+
+const paramRefresh = "refresh"
+
+func (s *Server) handleGetAuditReport(w http.ResponseWriter, r *http.Request) {
+	refresh, err := parseBool(r, paramRefresh)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var report *audit.Report
+	switch a := s.options.Auditor; {
+	case a == nil:
+		report, err = audit.Generate(s.reg, s.rawCtl)
+	case refresh || a.Report() == nil:
+		report, err = a.Refresh()
+	default:
+		report = a.Report()
+	}
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, report)
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/audit"
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+	regmem "github.com/samaritan-proxy/sash/registry/memory"
+)
+
+// staticRegistry is a synchronized registry cache backed by the memory registry.
+type staticRegistry struct {
+	*regmem.Registry
+}
+
+func newStaticRegistry(svcs ...string) *staticRegistry {
+	r := regmem.NewRegistry()
+	for _, svc := range svcs {
+		r.Register(model.NewService(svc))
+	}
+	return &staticRegistry{r}
+}
+
+func (r *staticRegistry) Exists(name string) bool {
+	svc, _ := r.Get(name)
+	return svc != nil
+}
+
+func (r *staticRegistry) LastSyncTime() time.Time { return time.Now() }
+
+func (r *staticRegistry) SetSyncFreq(time.Duration, float64) {}
+
+func (r *staticRegistry) RegisterServiceEventHandler(registry.ServiceEventHandler) {}
+
+func (r *staticRegistry) RegisterInstanceEventHandler(registry.InstanceEventHandler) {}
+
+func TestDependencyValidation(t *testing.T) {
+	options := new(serverOptions)
+	DependencyValidation(audit.ModeReject)(options)
+	assert.Equal(t, audit.ModeReject, options.DependencyValidation)
+}
+
+func TestHandleDependencyValidation(t *testing.T) {
+	add := func(s *Server, dep *config.Dependency) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(dep)
+		return testHandler(httptest.NewRequest(http.MethodPost, "/api/dependencies", bytes.NewReader(b)), s)
+	}
+	update := func(s *Server, dep *config.Dependency) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(dep)
+		return testHandler(httptest.NewRequest(http.MethodPut, "/api/dependencies/"+dep.ServiceName, bytes.NewReader(b)), s)
+	}
+
+	t.Run("off", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.rawCtl.Stop()
+		s.reg = newStaticRegistry("b")
+		resp := add(s, &config.Dependency{ServiceName: "a", Dependencies: []string{"b", "x"}})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("Warning"))
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		s := newTestServer(t, DependencyValidation(audit.ModeWarn))
+		defer s.rawCtl.Stop()
+		s.reg = newStaticRegistry("b")
+		resp := add(s, &config.Dependency{ServiceName: "a", Dependencies: []string{"b", "x"}})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, `299 sash "unknown dependencies: x"`, resp.Header().Get("Warning"))
+		assert.True(t, s.depsCtl.Exist("a"))
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		s := newTestServer(t, DependencyValidation(audit.ModeReject))
+		defer s.rawCtl.Stop()
+		s.reg = newStaticRegistry("b")
+		resp := add(s, &config.Dependency{ServiceName: "a", Dependencies: []string{"b", "x", "y"}})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "unknown dependencies: x,y")
+		assert.False(t, s.depsCtl.Exist("a"))
+
+		assert.Equal(t, http.StatusOK, add(s, &config.Dependency{ServiceName: "a", Dependencies: []string{"b"}}).Code)
+		assert.Equal(t, http.StatusBadRequest, update(s, &config.Dependency{ServiceName: "a", Dependencies: []string{"x"}}).Code)
+		assert.Equal(t, http.StatusOK, update(s, &config.Dependency{ServiceName: "a", Dependencies: []string{}}).Code)
+	})
+
+	t.Run("registry not synchronized", func(t *testing.T) {
+		s := newTestServer(t, DependencyValidation(audit.ModeReject))
+		defer s.rawCtl.Stop()
+		resp := add(s, &config.Dependency{ServiceName: "a", Dependencies: []string{"x"}})
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+}
+
+func TestHandleGetAuditReport(t *testing.T) {
+	get := func(s *Server, uri string) *httptest.ResponseRecorder {
+		return testHandler(httptest.NewRequest(http.MethodGet, uri, nil), s)
+	}
+	decode := func(t *testing.T, resp *httptest.ResponseRecorder) *audit.Report {
+		assert.Equal(t, http.StatusOK, resp.Code)
+		r := new(audit.Report)
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), r))
+		return r
+	}
+
+	t.Run("on demand", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.rawCtl.Stop()
+		s.reg = newStaticRegistry("a", "b")
+		assert.NoError(t, s.depsCtl.Add(&config.Dependency{ServiceName: "a", Dependencies: []string{"b", "x"}}))
+		time.Sleep(time.Millisecond * 20)
+
+		r := decode(t, get(s, "/api/audit"))
+		assert.Equal(t, 2, r.RegistryServices)
+		assert.Equal(t, []*audit.DanglingDependency{{ServiceName: "a", Dependencies: []string{"x"}}}, r.DanglingDependencies)
+		assert.Equal(t, []string{"a", "b"}, r.UnconfiguredServices)
+		assert.Equal(t, []string{"a"}, r.OrphanServices)
+
+		assert.Equal(t, http.StatusBadRequest, get(s, "/api/audit?refresh=foo").Code)
+	})
+
+	t.Run("auditor", func(t *testing.T) {
+		s := newTestServer(t)
+		defer s.rawCtl.Stop()
+		s.reg = newStaticRegistry("a")
+		a := audit.NewAuditor(s.reg, s.rawCtl)
+		s.options.Auditor = a
+
+		// generated if there is no report.
+		r := decode(t, get(s, "/api/audit"))
+		assert.Equal(t, []string{"a"}, r.OrphanServices)
+		assert.NotNil(t, a.Report())
+
+		// the latest report is served until refreshed.
+		assert.NoError(t, s.depsCtl.Add(&config.Dependency{ServiceName: "b", Dependencies: []string{"a"}}))
+		time.Sleep(time.Millisecond * 20)
+		r = decode(t, get(s, "/api/audit"))
+		assert.Equal(t, []string{"a"}, r.OrphanServices)
+		r = decode(t, get(s, "/api/audit?refresh=true"))
+		assert.Empty(t, r.OrphanServices)
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+const contentTypeOctetStream = "application/octet-stream"
+
+// maxSnapshotSize is the max size of the snapshot to restore from.
+var maxSnapshotSize int64 = 1 << 30
+
+func (s *Server) handleBackup(w http.ResponseWriter, _ *http.Request) {
+	// buffer the snapshot to make sure the status code is correct.
+	buf := new(bytes.Buffer)
+	switch err := s.rawCtl.Backup(buf); err {
+	case nil:
+	case config.ErrNotSupported:
+		writeMsg(w, http.StatusNotImplemented, err.Error())
+		return
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set(contentType, contentTypeOctetStream)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	err := s.rawCtl.Restore(http.MaxBytesReader(w, r.Body, maxSnapshotSize))
+	switch {
+	case err == nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case err == config.ErrNotSupported:
+		writeMsg(w, http.StatusNotImplemented, err.Error())
+	case errors.Is(err, config.ErrInvalidSnapshot):
+		writeMsg(w, http.StatusBadRequest, err.Error())
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
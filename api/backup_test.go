@@ -0,0 +1,129 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/bolt"
+	cfgmem "github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/registry"
+	regmem "github.com/samaritan-proxy/sash/registry/memory"
+)
+
+func TestHandleBackupNotSupported(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/backup", nil)
+	resp := testHandler(req, s)
+	assert.Equal(t, http.StatusNotImplemented, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/backup", bytes.NewReader(nil))
+	resp = testHandler(req, s)
+	assert.Equal(t, http.StatusNotImplemented, resp.Code)
+}
+
+func TestHandleBackupAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sash-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := bolt.New(&bolt.Config{Path: filepath.Join(dir, "sash.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := config.NewController(store, config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(l, registry.NewCache(regmem.NewRegistry()), ctl)
+
+	assert.NoError(t, ctl.Add("ns", "type", "key", []byte("value")))
+	req := httptest.NewRequest(http.MethodGet, "/api/backup", nil)
+	resp := testHandler(req, s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/octet-stream", resp.Header().Get("Content-Type"))
+	snapshot := resp.Body.Bytes()
+
+	assert.NoError(t, ctl.Del("ns", "type", "key"))
+
+	t.Run("bad snapshot", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/backup", bytes.NewReader([]byte("foo")))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		maxSnapshotSize = int64(len(snapshot))
+		defer func() { maxSnapshotSize = 1 << 30 }()
+		req := httptest.NewRequest(http.MethodPut, "/api/backup", bytes.NewReader(append(snapshot, 0)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/backup", bytes.NewReader(snapshot))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		b, err := ctl.Get("ns", "type", "key")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("value"), b)
+	})
+}
+
+// failedRestoreStore fails to restore as failing to replace the database file.
+type failedRestoreStore struct {
+	config.Store
+}
+
+func (failedRestoreStore) Backup(io.Writer) error { return nil }
+
+func (failedRestoreStore) Restore(r io.Reader) error {
+	_, _ = io.Copy(ioutil.Discard, r)
+	return errors.New("rename failed")
+}
+
+func TestHandleRestoreFailed(t *testing.T) {
+	ctl := config.NewController(failedRestoreStore{cfgmem.NewStore()}, config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(l, registry.NewCache(regmem.NewRegistry()), ctl)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/backup", bytes.NewReader([]byte("foo")))
+	resp := testHandler(req, s)
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
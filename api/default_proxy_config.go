@@ -0,0 +1,66 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func (s *Server) handleGetDefaultProxyConfig(w http.ResponseWriter, _ *http.Request) {
+	cfg, err := s.defCfgCtl.Get()
+	switch err {
+	case nil:
+		writeJSON(w, &DefaultProxyConfig{Config: cfg})
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, "default proxy config not found")
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleSetDefaultProxyConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := new(DefaultProxyConfig)
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if cfg.Config == nil {
+		writeMsg(w, http.StatusBadRequest, "config is null")
+		return
+	}
+	if err := cfg.Config.Validate(); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.defCfgCtl.SetContext(r.Context(), cfg.Config); err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeMsg(w, http.StatusOK, "OK")
+}
+
+func (s *Server) handleDeleteDefaultProxyConfig(w http.ResponseWriter, r *http.Request) {
+	switch err := s.defCfgCtl.DeleteContext(r.Context()); err {
+	case nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, "default proxy config not found")
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
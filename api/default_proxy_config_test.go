@@ -0,0 +1,56 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleDefaultProxyConfig(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/default-proxy-config", bytes.NewReader([]byte(body)))
+		return testHandler(req, s)
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "foo").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, `{"config": {"protocol": "TCP"}}`).Code)
+
+	body := `{"config": {"protocol": "TCP", "listener": {"address": {"ip": "0.0.0.0", "port": 80}}}}`
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, body).Code)
+	resp := do(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, body, resp.Body.String())
+
+	// the services without proxy config fallback to the default one.
+	req := httptest.NewRequest(http.MethodGet, "/api/proxy-configs/svc/effective", nil)
+	resp = testHandler(req, s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"protocol":"TCP"`)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "").Code)
+}
@@ -16,11 +16,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 
+	"github.com/samaritan-proxy/sash/audit"
 	"github.com/samaritan-proxy/sash/config"
 )
 
@@ -49,7 +52,10 @@ func (s *Server) handleAddDependency(w http.ResponseWriter, r *http.Request) {
 	if err = dep.Verify(); err != nil {
 		goto BadRequest
 	}
-	switch err = s.depsCtl.Add(dep); err {
+	if err = s.checkDependency(w, dep); err != nil {
+		goto BadRequest
+	}
+	switch err = s.depsCtl.AddContext(r.Context(), dep); err {
 	case nil:
 		writeMsg(w, http.StatusOK, "OK")
 		return
@@ -60,6 +66,7 @@ func (s *Server) handleAddDependency(w http.ResponseWriter, r *http.Request) {
 	}
 BadRequest:
 	writeMsg(w, http.StatusBadRequest, err.Error())
+	return
 InternalError:
 	writeMsg(w, http.StatusInternalServerError, err.Error())
 }
@@ -85,9 +92,14 @@ func (s *Server) handleUpdateDependency(w http.ResponseWriter, r *http.Request)
 	)
 	if err != nil {
 		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
 	}
 	dep.ServiceName = service
-	switch err = s.depsCtl.Update(dep); err {
+	if err = s.checkDependency(w, dep); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch err = s.depsCtl.UpdateContext(r.Context(), dep); err {
 	case nil:
 		writeMsg(w, http.StatusOK, "OK")
 	case config.ErrNotExist:
@@ -99,7 +111,7 @@ func (s *Server) handleUpdateDependency(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) handleDeleteDependency(w http.ResponseWriter, r *http.Request) {
 	service := mux.Vars(r)[paramService]
-	switch err := s.depsCtl.Delete(service); err {
+	switch err := s.depsCtl.DeleteContext(r.Context(), service); err {
 	case nil:
 		writeMsg(w, http.StatusOK, "OK")
 	case config.ErrNotExist:
@@ -108,3 +120,24 @@ func (s *Server) handleDeleteDependency(w http.ResponseWriter, r *http.Request)
 		writeMsg(w, http.StatusInternalServerError, err.Error())
 	}
 }
+
+// checkDependency checks the dependencies against the service registry,
+// the unknown ones are rejected or warned through the Warning header
+// according to the validation mode.
+func (s *Server) checkDependency(w http.ResponseWriter, dep *config.Dependency) error {
+	mode := s.options.DependencyValidation
+	if mode == "" || mode == audit.ModeOff {
+		return nil
+	}
+	unknown := audit.UnknownDependencies(s.reg, dep)
+	if len(unknown) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("unknown dependencies: %s", strings.Join(unknown, ","))
+	if mode == audit.ModeReject {
+		return errors.New(msg)
+	}
+	log.With("service", dep.ServiceName).Warn(msg)
+	w.Header().Add("Warning", fmt.Sprintf("299 sash %q", msg))
+	return nil
+}
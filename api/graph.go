@@ -0,0 +1,180 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/graph"
+)
+
+const (
+	paramDirection  = "direction"
+	paramTransitive = "transitive"
+
+	formatDOT     = "dot"
+	formatMermaid = "mermaid"
+
+	directionBoth         = "both"
+	directionDependencies = "dependencies"
+	directionDependents   = "dependents"
+
+	contentTypeDOT  = "text/vnd.graphviz"
+	contentTypeText = "text/plain; charset=utf-8"
+)
+
+func parseGraphFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get(paramFormat); format {
+	case "", formatJSON:
+		return formatJSON, nil
+	case formatDOT, "gv":
+		return formatDOT, nil
+	case formatMermaid:
+		return formatMermaid, nil
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// loadGraph builds the dependency graph from cache.
+func (s *Server) loadGraph() (*graph.Graph, error) {
+	deps, err := s.depsCtl.GetAllCache()
+	switch err {
+	case nil, config.ErrNotExist:
+	default:
+		return nil, err
+	}
+	return graph.New(deps), nil
+}
+
+func writeGraph(w http.ResponseWriter, g *graph.Graph, format string) {
+	switch format {
+	case formatDOT:
+		w.Header().Set(contentType, contentTypeDOT)
+		_, _ = w.Write(g.DOT())
+	case formatMermaid:
+		w.Header().Set(contentType, contentTypeText)
+		_, _ = w.Write(g.Mermaid())
+	default:
+		writeJSON(w, g.Model())
+	}
+}
+
+func (s *Server) handleGetGraph(w http.ResponseWriter, r *http.Request) {
+	format, err := parseGraphFormat(r)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	g, err := s.loadGraph()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeGraph(w, g, format)
+}
+
+func (s *Server) handleGetGraphCycles(w http.ResponseWriter, _ *http.Request) {
+	g, err := s.loadGraph()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cycles := g.Cycles()
+	if cycles == nil {
+		cycles = [][]string{}
+	}
+	writeJSON(w, cycles)
+}
+
+// handleGetServiceGraph returns the subgraph of the service and the ones
+// it depends on or depended by transitively.
+func (s *Server) handleGetServiceGraph(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)[paramService]
+	format, err := parseGraphFormat(r)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	g, err := s.loadGraph()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !g.Has(service) {
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("service[%s] not found", service))
+		return
+	}
+	svcs := []string{service}
+	switch direction := r.URL.Query().Get(paramDirection); direction {
+	case "", directionBoth:
+		svcs = append(svcs, g.Closure(service, false)...)
+		svcs = append(svcs, g.Closure(service, true)...)
+	case directionDependencies:
+		svcs = append(svcs, g.Closure(service, false)...)
+	case directionDependents:
+		svcs = append(svcs, g.Closure(service, true)...)
+	default:
+		writeMsg(w, http.StatusBadRequest, fmt.Sprintf("unsupported direction: %s", direction))
+		return
+	}
+	writeGraph(w, g.Subgraph(svcs), format)
+}
+
+func (s *Server) handleGetServiceDependencies(w http.ResponseWriter, r *http.Request) {
+	s.handleGetRelatedServices(w, r, false)
+}
+
+func (s *Server) handleGetServiceDependents(w http.ResponseWriter, r *http.Request) {
+	s.handleGetRelatedServices(w, r, true)
+}
+
+func (s *Server) handleGetRelatedServices(w http.ResponseWriter, r *http.Request, reverse bool) {
+	service := mux.Vars(r)[paramService]
+	transitive, err := parseBool(r, paramTransitive)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var svcs []string
+	if reverse && !transitive {
+		// lookup the reverse index directly.
+		svcs = s.depsCtl.Dependents(service)
+	} else {
+		g, err := s.loadGraph()
+		if err != nil {
+			writeMsg(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if transitive {
+			svcs = g.Closure(service, reverse)
+		} else {
+			svcs = g.Dependencies(service)
+		}
+	}
+	if svcs == nil {
+		svcs = []string{}
+	}
+	resp := &RelatedServicesResponse{
+		ServiceName: service,
+		Transitive:  transitive,
+		Services:    svcs,
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestHandleGraph(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return testHandler(httptest.NewRequest(http.MethodGet, "/api/graph"+path, nil), s)
+	}
+
+	// empty
+	resp := get("")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"nodes": [], "edges": [], "cycles": []}`, resp.Body.String())
+
+	// a -> b -> c -> a, c -> d
+	for _, dep := range []*config.Dependency{
+		{ServiceName: "a", Dependencies: []string{"b"}},
+		{ServiceName: "b", Dependencies: []string{"c"}},
+		{ServiceName: "c", Dependencies: []string{"a", "d"}},
+	} {
+		assert.NoError(t, s.depsCtl.Add(dep))
+	}
+	time.Sleep(time.Millisecond * 20)
+
+	t.Run("whole graph", func(t *testing.T) {
+		resp := get("")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"nodes":["a","b","c","d"]`)
+		assert.Contains(t, resp.Body.String(), `"cycles":[["a","b","c"]]`)
+
+		resp = get("?format=dot")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, contentTypeDOT, resp.Header().Get(contentType))
+		assert.Contains(t, resp.Body.String(), `"c" -> "d";`)
+
+		resp = get("?format=mermaid")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), "graph LR")
+
+		assert.Equal(t, http.StatusBadRequest, get("?format=png").Code)
+	})
+
+	t.Run("cycles", func(t *testing.T) {
+		resp := get("/cycles")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `[["a", "b", "c"]]`, resp.Body.String())
+	})
+
+	t.Run("service graph", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/services/foo").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/services/d?direction=foo").Code)
+
+		resp := get("/services/d?direction=dependencies")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"nodes": ["d"], "edges": [], "cycles": []}`, resp.Body.String())
+
+		resp = get("/services/d")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"nodes":["a","b","c","d"]`)
+	})
+
+	t.Run("related services", func(t *testing.T) {
+		related := func(path string) *RelatedServicesResponse {
+			resp := get(path)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			res := new(RelatedServicesResponse)
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), res))
+			return res
+		}
+		assert.Equal(t, []string{"a", "d"}, related("/services/c/dependencies").Services)
+		assert.Equal(t, []string{"a", "b", "c", "d"}, related("/services/c/dependencies?transitive=true").Services)
+		assert.Equal(t, []string{"c"}, related("/services/d/dependents").Services)
+		assert.Equal(t, []string{"a", "b", "c"}, related("/services/d/dependents?transitive=true").Services)
+		assert.Equal(t, []string{}, related("/services/foo/dependents").Services)
+		assert.Equal(t, http.StatusBadRequest, get("/services/d/dependents?transitive=foo").Code)
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+)
+
+// handleHealthz reports whether the process is alive.
+func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeMsg(w, http.StatusOK, "ok")
+}
+
+// handleReadyz reports whether the server is ready to serve, it holds until
+// the first sync of the service registry and the config store.
+func (s *Server) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	checker := s.options.HealthChecker
+	if checker == nil {
+		writeMsg(w, http.StatusOK, "ok")
+		return
+	}
+	if err := checker.Ready(); err != nil {
+		writeMsg(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeMsg(w, http.StatusOK, "ok")
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/health"
+)
+
+type fakeSyncer time.Time
+
+func (s fakeSyncer) LastSyncTime() time.Time { return time.Time(s) }
+
+func TestHandleHealthz(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/healthz", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "ok", resp.Body.String())
+}
+
+func TestHandleReadyz(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	// without checker
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/readyz", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	c := health.NewChecker()
+	c.Register("registry", fakeSyncer(time.Time{}))
+	s.options.HealthChecker = c
+	resp = testHandler(httptest.NewRequest(http.MethodGet, "/readyz", nil), s)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "registry is not ready: never synced", resp.Body.String())
+
+	c = health.NewChecker()
+	c.Register("registry", fakeSyncer(time.Now()))
+	s.options.HealthChecker = c
+	resp = testHandler(httptest.NewRequest(http.MethodGet, "/readyz", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
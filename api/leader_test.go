@@ -0,0 +1,54 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/leader"
+)
+
+func TestHandleGetLeader(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/api/leader", nil), s)
+	assert.Equal(t, http.StatusNotImplemented, resp.Code)
+
+	e := leader.NewElector("sash-1", leader.NewLocalLock())
+	s.options.LeaderElector = e
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	for i := 0; i < 100 && !e.IsLeader(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	resp = testHandler(httptest.NewRequest(http.MethodGet, "/api/leader", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	status := new(leader.Status)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), status))
+	assert.Equal(t, "sash-1", status.ID)
+	assert.Equal(t, "sash-1", status.Leader)
+	assert.True(t, status.IsLeader)
+	assert.NotNil(t, status.Since)
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentRequests(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	s.reg = newStaticRegistry()
+
+	route := "/api/services/{service}/instances"
+	notFound := requestsTotal.WithLabelValues(route, http.MethodGet, "404")
+	before := testutil.ToFloat64(notFound)
+
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/api/services/foo/instances", nil), s)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(notFound))
+
+	ping := requestsTotal.WithLabelValues("/api/ping", http.MethodGet, "200")
+	before = testutil.ToFloat64(ping)
+	resp = testHandler(httptest.NewRequest(http.MethodGet, "/api/ping", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(ping))
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	var rw http.ResponseWriter = &statusRecorder{ResponseWriter: w}
+	f, ok := rw.(http.Flusher)
+	assert.True(t, ok)
+	f.Flush()
+	assert.True(t, w.Flushed)
+}
+
+func TestHandleMetrics(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	testHandler(httptest.NewRequest(http.MethodGet, "/api/ping", nil), s)
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/metrics", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	body := resp.Body.String()
+	assert.True(t, strings.Contains(body, "sash_api_requests_total"))
+	assert.True(t, strings.Contains(body, "sash_config_fetch_duration_seconds"))
+}
@@ -14,6 +14,12 @@
 
 package api
 
+import (
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
 type PageRequest struct {
 	PageNum  int
 	PageSize int
@@ -25,3 +31,66 @@ type PagedResponse struct {
 	Total    int         `json:"total"`
 	Data     interface{} `json:"data"`
 }
+
+type ValidateResponse struct {
+	Valid  bool                 `json:"valid"`
+	Errors []*config.FieldError `json:"errors"`
+}
+
+type DiffResponse struct {
+	ServiceName string              `json:"service_name"`
+	Exist       bool                `json:"exist"`
+	Diffs       []*config.FieldDiff `json:"diffs"`
+}
+
+type DefaultProxyConfig struct {
+	Config *service.Config `json:"config"`
+}
+
+type HaltRolloutRequest struct {
+	Reason string `json:"reason"`
+}
+
+type RolloutFailuresRequest struct {
+	Instances []string `json:"instances"`
+}
+
+type RelatedServicesResponse struct {
+	ServiceName string   `json:"service_name"`
+	Transitive  bool     `json:"transitive"`
+	Services    []string `json:"services"`
+}
+
+type Service struct {
+	Name             string `json:"name"`
+	Instances        int    `json:"instances"`
+	HealthyInstances int    `json:"healthy_instances"`
+}
+
+type Services []*Service
+
+func (s Services) Len() int { return len(s) }
+
+func (s Services) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s Services) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type ServiceInstance struct {
+	IP    string            `json:"ip"`
+	Port  uint16            `json:"port"`
+	State string            `json:"state"`
+	Meta  map[string]string `json:"meta"`
+}
+
+type ServiceInstances []*ServiceInstance
+
+func (s ServiceInstances) Len() int { return len(s) }
+
+func (s ServiceInstances) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s ServiceInstances) Less(i, j int) bool {
+	if s[i].IP != s[j].IP {
+		return s[i].IP < s[j].IP
+	}
+	return s[i].Port < s[j].Port
+}
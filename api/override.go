@@ -0,0 +1,69 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func (s *Server) handleGetOverrides(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)[paramService]
+	ovrs, err := s.ovrCtl.Get(service)
+	switch err {
+	case nil:
+		writeJSON(w, ovrs)
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("overrides of service[%s] not found", service))
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleSetOverrides(w http.ResponseWriter, r *http.Request) {
+	ovrs := new(config.ProxyConfigOverrides)
+	if err := json.NewDecoder(r.Body).Decode(ovrs); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ovrs.ServiceName = mux.Vars(r)[paramService]
+	if err := ovrs.Verify(); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.ovrCtl.SetContext(r.Context(), ovrs); err != nil {
+		// the merged configs are invalid
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeMsg(w, http.StatusOK, "OK")
+}
+
+func (s *Server) handleDeleteOverrides(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)[paramService]
+	switch err := s.ovrCtl.DeleteContext(r.Context(), service); err {
+	case nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("overrides of service[%s] not found", service))
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
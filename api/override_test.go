@@ -0,0 +1,73 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestHandleOverrides(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/proxy-configs/svc"+path, bytes.NewReader([]byte(body)))
+		return testHandler(req, s)
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/overrides", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/overrides", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/overrides", "foo").Code)
+	// no scope
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/overrides", `{"overrides": [{"name": "canary", "config": {}}]}`).Code)
+
+	assert.NoError(t, s.proxyCfgCtl.Add(&config.ProxyConfig{
+		ServiceName: "svc",
+		Config: &service.Config{
+			Listener: &service.Listener{Address: &common.Address{Ip: "1.1.1.1", Port: 6379}},
+			Protocol: protocol.TCP,
+		},
+	}))
+	// invalid merged config
+	body := `{"overrides": [{"name": "canary", "instances": ["inst_1"], "config": {"listener": {"address": {"ip": "foo"}}}}]}`
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/overrides", body).Code)
+
+	body = `{"service_name": "svc", "overrides": [{"name": "canary", "instances": ["inst_1"], "config": {"listener": {"address": {"ip": "1.1.1.1", "port": 8080}}}}]}`
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/overrides", body).Code)
+	resp := do(http.MethodGet, "/overrides", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"instances":["inst_1"]`)
+
+	resp = do(http.MethodGet, "/effective?instance=inst_1", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"port":8080`)
+	resp = do(http.MethodGet, "/effective?instance=inst_2", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), `"port":8080`)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/overrides", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/overrides", "").Code)
+}
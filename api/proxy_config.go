@@ -46,14 +46,15 @@ func (s *Server) handleAddProxyConfig(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		goto BadRequest
 	}
-	if err = cfg.Verify(); err != nil {
+	if errs := s.proxyCfgCtl.Validate(cfg); len(errs) > 0 {
+		err = errs[0]
 		goto BadRequest
 	}
-	switch err = s.proxyCfgCtl.Add(cfg); err {
+	switch err = s.proxyCfgCtl.AddContext(r.Context(), cfg); err {
 	case nil:
 		writeMsg(w, http.StatusOK, "OK")
 		return
-	case config.ErrExist:
+	case config.ErrExist, config.ErrTemplateNotExist:
 		goto BadRequest
 	default:
 		goto InternalError
@@ -88,11 +89,13 @@ func (s *Server) handleUpdateProxyConfig(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	cfg.ServiceName = service
-	switch err = s.proxyCfgCtl.Update(cfg); err {
+	switch err = s.proxyCfgCtl.UpdateContext(r.Context(), cfg); err {
 	case nil:
 		writeMsg(w, http.StatusOK, "OK")
 	case config.ErrNotExist:
 		writeMsg(w, http.StatusNotFound, fmt.Sprintf("service[%s] not found", service))
+	case config.ErrTemplateNotExist:
+		writeMsg(w, http.StatusBadRequest, err.Error())
 	default:
 		writeMsg(w, http.StatusInternalServerError, err.Error())
 	}
@@ -100,7 +103,7 @@ func (s *Server) handleUpdateProxyConfig(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) handleDeleteProxyConfig(w http.ResponseWriter, r *http.Request) {
 	service := mux.Vars(r)[paramService]
-	switch err := s.proxyCfgCtl.Delete(service); err {
+	switch err := s.proxyCfgCtl.DeleteContext(r.Context(), service); err {
 	case nil:
 		writeMsg(w, http.StatusOK, "OK")
 	case config.ErrNotExist:
@@ -109,3 +112,87 @@ func (s *Server) handleDeleteProxyConfig(w http.ResponseWriter, r *http.Request)
 		writeMsg(w, http.StatusInternalServerError, err.Error())
 	}
 }
+
+func (s *Server) handleValidateProxyConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := new(config.ProxyConfig)
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg.ServiceName = mux.Vars(r)[paramService]
+	errs := s.proxyCfgCtl.Validate(cfg)
+	if errs == nil {
+		errs = []*config.FieldError{}
+	}
+	writeJSON(w, &ValidateResponse{
+		Valid:  len(errs) == 0,
+		Errors: errs,
+	})
+}
+
+func (s *Server) handleDiffProxyConfig(w http.ResponseWriter, r *http.Request) {
+	var (
+		service = mux.Vars(r)[paramService]
+		cfg     = new(config.ProxyConfig)
+		err     = json.NewDecoder(r.Body).Decode(&cfg)
+	)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg.ServiceName = service
+	// compare the effective configs which are pushed to proxies.
+	if cfg, err = s.proxyCfgCtl.Effective(cfg); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := &DiffResponse{
+		ServiceName: service,
+		Exist:       s.proxyCfgCtl.Exist(service),
+	}
+	cur, err := s.proxyCfgCtl.GetEffective(service)
+	switch err {
+	case nil:
+	case config.ErrNotExist:
+		cur = &config.ProxyConfig{ServiceName: service}
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if resp.Diffs, err = config.DiffServiceConfig(cur.Config, cfg.Config); err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleGetEffectiveProxyConfig(w http.ResponseWriter, r *http.Request) {
+	service := mux.Vars(r)[paramService]
+	var (
+		cfg *config.ProxyConfig
+		err error
+	)
+	if id := r.URL.Query().Get(paramInstance); len(id) > 0 {
+		// resolve the overrides for the instance
+		inst, _err := s.instCtl.Get(id)
+		switch _err {
+		case nil:
+		case config.ErrNotExist:
+			inst = &config.Instance{ID: id}
+		default:
+			writeMsg(w, http.StatusInternalServerError, _err.Error())
+			return
+		}
+		cfg, err = s.ovrCtl.Resolve(service, inst)
+	} else {
+		cfg, err = s.proxyCfgCtl.GetEffective(service)
+	}
+	switch err {
+	case nil:
+		writeJSON(w, cfg)
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("service[%s] not found", service))
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
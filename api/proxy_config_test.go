@@ -287,3 +287,77 @@ func TestHandleDeleteProxyConfig(t *testing.T) {
 		assert.False(t, s.depsCtl.Exist("svc_1"))
 	})
 }
+
+func TestHandleValidateProxyConfig(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	t.Run("bad request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy-configs/svc:validate", bytes.NewReader([]byte("foo")))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		body := `{"config": {"protocol": "TCP", "listener": {"address": {"ip": "foo", "port": 80}}}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy-configs/svc:validate", bytes.NewReader([]byte(body)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{
+			"valid": false,
+			"errors": [{"field": "listener.address.ip", "reason": "value must be a valid IP address"}]
+		}`, resp.Body.String())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		body := `{"config": {"protocol": "TCP", "listener": {"address": {"ip": "0.0.0.0", "port": 80}}}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy-configs/svc:validate", bytes.NewReader([]byte(body)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"valid": true, "errors": []}`, resp.Body.String())
+	})
+}
+
+func TestHandleDiffProxyConfig(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	assert.NoError(t, s.proxyCfgCtl.Add(&config.ProxyConfig{
+		ServiceName: "svc",
+		Config: &service.Config{
+			Protocol: protocol.TCP,
+			Listener: &service.Listener{
+				Address: &common.Address{Ip: "0.0.0.0", Port: 80},
+			},
+		},
+	}))
+
+	t.Run("bad request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy-configs/svc:diff", bytes.NewReader([]byte("foo")))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		body := `{"config": {"protocol": "TCP"}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy-configs/foo:diff", bytes.NewReader([]byte(body)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{
+			"service_name": "foo",
+			"exist": false,
+			"diffs": [{"field": "protocol", "op": "add", "new": "TCP"}]
+		}`, resp.Body.String())
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		body := `{"config": {"protocol": "TCP", "listener": {"address": {"ip": "0.0.0.0", "port": 8080}}}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/proxy-configs/svc:diff", bytes.NewReader([]byte(body)))
+		resp := testHandler(req, s)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{
+			"service_name": "svc",
+			"exist": true,
+			"diffs": [{"field": "listener.address.port", "op": "change", "old": 80, "new": 8080}]
+		}`, resp.Body.String())
+	})
+}
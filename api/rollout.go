@@ -0,0 +1,140 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/rollout"
+)
+
+// rolloutsEnabled writes 501 if the rollout manager is not configured.
+func (s *Server) rolloutsEnabled(w http.ResponseWriter) bool {
+	if s.options.RolloutManager == nil {
+		writeMsg(w, http.StatusNotImplemented, "rollout is not enabled")
+		return false
+	}
+	return true
+}
+
+func writeRolloutErr(w http.ResponseWriter, id string, err error) {
+	switch err {
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("rollout[%s] not found", id))
+	case rollout.ErrFinished:
+		writeMsg(w, http.StatusConflict, err.Error())
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleGetAllRollouts(w http.ResponseWriter, r *http.Request) {
+	if !s.rolloutsEnabled(w) {
+		return
+	}
+	rollouts, err := s.options.RolloutManager.List()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result, err := filterItemsByRequestParams(r, rollouts)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writePagedResp(w, r, result)
+}
+
+func (s *Server) handleAddRollout(w http.ResponseWriter, r *http.Request) {
+	if !s.rolloutsEnabled(w) {
+		return
+	}
+	ro := new(rollout.Rollout)
+	if err := json.NewDecoder(r.Body).Decode(ro); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ro, err := s.options.RolloutManager.Create(ro)
+	switch err {
+	case nil:
+		writeJSON(w, ro)
+	case rollout.ErrInProgress:
+		writeMsg(w, http.StatusConflict, err.Error())
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusBadRequest, "service has no proxy config")
+	default:
+		writeMsg(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+func (s *Server) handleGetRollout(w http.ResponseWriter, r *http.Request) {
+	if !s.rolloutsEnabled(w) {
+		return
+	}
+	id := mux.Vars(r)[paramRollout]
+	ro, err := s.options.RolloutManager.Get(id)
+	if err != nil {
+		writeRolloutErr(w, id, err)
+		return
+	}
+	writeJSON(w, ro)
+}
+
+func (s *Server) handleHaltRollout(w http.ResponseWriter, r *http.Request) {
+	if !s.rolloutsEnabled(w) {
+		return
+	}
+	id := mux.Vars(r)[paramRollout]
+	req := new(HaltRolloutRequest)
+	// the body is optional
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeMsg(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if len(req.Reason) == 0 {
+		req.Reason = "halted manually"
+	}
+	ro, err := s.options.RolloutManager.Halt(id, req.Reason)
+	if err != nil {
+		writeRolloutErr(w, id, err)
+		return
+	}
+	writeJSON(w, ro)
+}
+
+func (s *Server) handleReportRolloutFailures(w http.ResponseWriter, r *http.Request) {
+	if !s.rolloutsEnabled(w) {
+		return
+	}
+	id := mux.Vars(r)[paramRollout]
+	req := new(RolloutFailuresRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ro, err := s.options.RolloutManager.ReportFailures(id, req.Instances)
+	if err != nil {
+		writeRolloutErr(w, id, err)
+		return
+	}
+	writeJSON(w, ro)
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/rollout"
+)
+
+func TestHandleRolloutsNotEnabled(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/api/rollouts", nil), s)
+	assert.Equal(t, http.StatusNotImplemented, resp.Code)
+}
+
+func TestHandleRollouts(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	s.options.RolloutManager = rollout.NewManager(s.rawCtl)
+	assert.NoError(t, s.proxyCfgCtl.Add(&config.ProxyConfig{
+		ServiceName: "svc",
+		Config: &service.Config{
+			Listener: &service.Listener{Address: &common.Address{Ip: "1.1.1.1", Port: 6379}},
+			Protocol: protocol.TCP,
+		},
+	}))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/rollouts"+path, bytes.NewReader([]byte(body)))
+		return testHandler(req, s)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "", "foo").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "", `{"service_name": "svc"}`).Code)
+	body := `{"service_name": "foo", "config": {"connectTimeout": "2s"}, "waves": [{"count": 1, "delay": "1m"}]}`
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "", body).Code)
+
+	body = `{"service_name": "svc", "config": {"connectTimeout": "2s"}, "waves": [{"count": 1, "delay": "1m"}, {"percent": 100}]}`
+	resp := do(http.MethodPost, "", body)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	ro := new(rollout.Rollout)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), ro))
+	assert.Equal(t, rollout.StateRunning, ro.State)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "", body).Code)
+
+	resp = do(http.MethodGet, "?service_name=svc", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"total":1`)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/"+ro.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/foo", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/"+ro.ID+"/failures", "foo").Code)
+	resp = do(http.MethodPost, "/"+ro.ID+"/failures", `{"instances": ["inst_3"]}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"failures":["inst_3"]`)
+
+	resp = do(http.MethodPost, "/"+ro.ID+"/halt", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), ro))
+	assert.Equal(t, rollout.StateHalted, ro.State)
+	assert.Equal(t, "halted manually", ro.Reason)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/"+ro.ID+"/halt", `{"reason": "foo"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/foo/halt", "").Code)
+}
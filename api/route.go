@@ -19,8 +19,11 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
@@ -28,22 +31,83 @@ const (
 	routeDependencies = "/dependencies"
 	routeInstances    = "/instances"
 	routeProxyConfigs = "/proxy-configs"
+	routeTemplates    = "/proxy-config-templates"
+	routeDefaultCfg   = "/default-proxy-config"
+	routeRollouts     = "/rollouts"
+	routeGraph        = "/graph"
+	routeAudit        = "/audit"
+	routeServices     = "/services"
+	routeWatch        = "/watch"
+	routeWebhooks     = "/webhooks"
+	routeLeader       = "/leader"
 	routePing         = "/ping"
+	routeBackup       = "/backup"
+	routeExport       = "/export"
+	routeImport       = "/import"
+	routeMetrics      = "/metrics"
+	routeHealthz      = "/healthz"
+	routeReadyz       = "/readyz"
 
 	paramPageNum  = "page_num"
 	paramPageSize = "page_size"
 	paramService  = "service"
 	paramInstance = "instance"
+	paramTemplate = "template"
+	paramRollout  = "rollout"
+	paramWebhook  = "webhook"
+	paramDelivery = "delivery"
 )
 
 func (s *Server) genProxyConfigsRouter(r *mux.Router) {
 	r.HandleFunc("", s.handleGetAllProxyConfigs).Methods(http.MethodGet)
 	r.HandleFunc("", s.handleAddProxyConfig).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}:validate", paramService), s.handleValidateProxyConfig).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}:diff", paramService), s.handleDiffProxyConfig).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}/effective", paramService), s.handleGetEffectiveProxyConfig).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}/overrides", paramService), s.handleGetOverrides).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}/overrides", paramService), s.handleSetOverrides).Methods(http.MethodPut)
+	r.HandleFunc(fmt.Sprintf("/{%s}/overrides", paramService), s.handleDeleteOverrides).Methods(http.MethodDelete)
 	r.HandleFunc(fmt.Sprintf("/{%s}", paramService), s.handleGetProxyConfig).Methods(http.MethodGet)
 	r.HandleFunc(fmt.Sprintf("/{%s}", paramService), s.handleUpdateProxyConfig).Methods(http.MethodPut)
 	r.HandleFunc(fmt.Sprintf("/{%s}", paramService), s.handleDeleteProxyConfig).Methods(http.MethodDelete)
 }
 
+func (s *Server) genTemplatesRouter(r *mux.Router) {
+	r.HandleFunc("", s.handleGetAllTemplates).Methods(http.MethodGet)
+	r.HandleFunc("", s.handleAddTemplate).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramTemplate), s.handleGetTemplate).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramTemplate), s.handleUpdateTemplate).Methods(http.MethodPut)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramTemplate), s.handleDeleteTemplate).Methods(http.MethodDelete)
+	r.HandleFunc(fmt.Sprintf("/{%s}/services", paramTemplate), s.handleGetTemplateServices).Methods(http.MethodGet)
+}
+
+func (s *Server) genRolloutsRouter(r *mux.Router) {
+	r.HandleFunc("", s.handleGetAllRollouts).Methods(http.MethodGet)
+	r.HandleFunc("", s.handleAddRollout).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramRollout), s.handleGetRollout).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}/halt", paramRollout), s.handleHaltRollout).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}/failures", paramRollout), s.handleReportRolloutFailures).Methods(http.MethodPost)
+}
+
+func (s *Server) genWebhooksRouter(r *mux.Router) {
+	r.HandleFunc("", s.handleGetAllWebhooks).Methods(http.MethodGet)
+	r.HandleFunc("", s.handleAddWebhook).Methods(http.MethodPost)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramWebhook), s.handleGetWebhook).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramWebhook), s.handleUpdateWebhook).Methods(http.MethodPut)
+	r.HandleFunc(fmt.Sprintf("/{%s}", paramWebhook), s.handleDeleteWebhook).Methods(http.MethodDelete)
+	r.HandleFunc(fmt.Sprintf("/{%s}/dead-letters", paramWebhook), s.handleGetDeadLetters).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}/dead-letters", paramWebhook), s.handleClearDeadLetters).Methods(http.MethodDelete)
+	r.HandleFunc(fmt.Sprintf("/{%s}/dead-letters/{%s}:redeliver", paramWebhook, paramDelivery), s.handleRedeliver).Methods(http.MethodPost)
+}
+
+func (s *Server) genGraphRouter(r *mux.Router) {
+	r.HandleFunc("", s.handleGetGraph).Methods(http.MethodGet)
+	r.HandleFunc("/cycles", s.handleGetGraphCycles).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/services/{%s}", paramService), s.handleGetServiceGraph).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/services/{%s}/dependencies", paramService), s.handleGetServiceDependencies).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/services/{%s}/dependents", paramService), s.handleGetServiceDependents).Methods(http.MethodGet)
+}
+
 func (s *Server) genDependenciesRouter(r *mux.Router) {
 	r.HandleFunc("", s.handleGetAllDependencies).Methods(http.MethodGet)
 	r.HandleFunc("", s.handleAddDependency).Methods(http.MethodPost)
@@ -52,6 +116,11 @@ func (s *Server) genDependenciesRouter(r *mux.Router) {
 	r.HandleFunc(fmt.Sprintf("/{%s}", paramService), s.handleDeleteDependency).Methods(http.MethodDelete)
 }
 
+func (s *Server) genServicesRouter(r *mux.Router) {
+	r.HandleFunc("", s.handleGetAllServices).Methods(http.MethodGet)
+	r.HandleFunc(fmt.Sprintf("/{%s}/instances", paramService), s.handleGetServiceInstances).Methods(http.MethodGet)
+}
+
 func (s *Server) genInstancesRouter(r *mux.Router) {
 	r.HandleFunc("", s.handleGetAllInstances).Methods(http.MethodGet)
 	r.HandleFunc(fmt.Sprintf("/{%s}", paramInstance), s.handleGetInstance).Methods(http.MethodGet)
@@ -61,6 +130,35 @@ func (s *Server) handlePing(w http.ResponseWriter, _ *http.Request) {
 	writeMsg(w, http.StatusOK, "PONG")
 }
 
+// isDryRun returns true if the request doesn't change any configs, only the
+// import honours the dry_run parameter.
+func isDryRun(r *http.Request) bool {
+	if strings.HasSuffix(r.URL.Path, ":validate") || strings.HasSuffix(r.URL.Path, ":diff") {
+		return true
+	}
+	if r.URL.Path != apiRoute+routeImport {
+		return false
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get(paramDryRun))
+	return dryRun
+}
+
+// rejectWritesIfReadOnly rejects all write requests when the config store
+// is read-only, the configs should be changed at the source of truth.
+func (s *Server) rejectWritesIfReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if s.rawCtl.ReadOnly() && !isDryRun(r) {
+				writeMsg(w, http.StatusMethodNotAllowed, "config store is read-only, please change the configs at the source")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func handleSubRoute(baseRouter *mux.Router, path string, fn func(router *mux.Router)) {
 	fn(baseRouter.PathPrefix(path).Subrouter())
 }
@@ -68,11 +166,30 @@ func handleSubRoute(baseRouter *mux.Router, path string, fn func(router *mux.Rou
 func (s *Server) genRouter() http.Handler {
 	router := mux.NewRouter()
 	apiRoute := router.PathPrefix(apiRoute).Subrouter()
+	apiRoute.Use(instrumentRequests, traceRequests, s.rejectWritesIfReadOnly)
 	apiRoute.HandleFunc(routePing, s.handlePing)
+	apiRoute.HandleFunc(routeBackup, s.handleBackup).Methods(http.MethodGet)
+	apiRoute.HandleFunc(routeBackup, s.handleRestore).Methods(http.MethodPut)
+	apiRoute.HandleFunc(routeExport, s.handleExport).Methods(http.MethodGet)
+	apiRoute.HandleFunc(routeImport, s.handleImport).Methods(http.MethodPost)
 	handleSubRoute(apiRoute, routeDependencies, s.genDependenciesRouter)
 	handleSubRoute(apiRoute, routeInstances, s.genInstancesRouter)
+	handleSubRoute(apiRoute, routeServices, s.genServicesRouter)
 	handleSubRoute(apiRoute, routeProxyConfigs, s.genProxyConfigsRouter)
+	handleSubRoute(apiRoute, routeTemplates, s.genTemplatesRouter)
+	handleSubRoute(apiRoute, routeRollouts, s.genRolloutsRouter)
+	handleSubRoute(apiRoute, routeGraph, s.genGraphRouter)
+	handleSubRoute(apiRoute, routeWebhooks, s.genWebhooksRouter)
+	apiRoute.HandleFunc(routeWatch, s.handleWatch).Methods(http.MethodGet)
+	apiRoute.HandleFunc(routeAudit, s.handleGetAuditReport).Methods(http.MethodGet)
+	apiRoute.HandleFunc(routeLeader, s.handleGetLeader).Methods(http.MethodGet)
+	apiRoute.HandleFunc(routeDefaultCfg, s.handleGetDefaultProxyConfig).Methods(http.MethodGet)
+	apiRoute.HandleFunc(routeDefaultCfg, s.handleSetDefaultProxyConfig).Methods(http.MethodPut)
+	apiRoute.HandleFunc(routeDefaultCfg, s.handleDeleteDefaultProxyConfig).Methods(http.MethodDelete)
 
+	router.Handle(routeMetrics, promhttp.Handler()).Methods(http.MethodGet)
+	router.HandleFunc(routeHealthz, s.handleHealthz).Methods(http.MethodGet)
+	router.HandleFunc(routeReadyz, s.handleReadyz).Methods(http.MethodGet)
 	router.PathPrefix("/").Handler(staticFileHandler())
 	return router
 }
@@ -16,20 +16,40 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/samaritan-proxy/sash/audit"
 	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/health"
+	"github.com/samaritan-proxy/sash/leader"
 	"github.com/samaritan-proxy/sash/logger"
 	"github.com/samaritan-proxy/sash/registry"
+	"github.com/samaritan-proxy/sash/rollout"
+	"github.com/samaritan-proxy/sash/watch"
+	"github.com/samaritan-proxy/sash/webhook"
 )
 
+var log = logger.Component("api")
+
 type serverOptions struct {
 	ReadTimeout       time.Duration
 	ReadHeaderTimeout time.Duration
 	WriteTimeout      time.Duration
 	IdleTimeout       time.Duration
+	TLSConfig         *tls.Config
+	RolloutManager    *rollout.Manager
+
+	DependencyValidation audit.Mode
+	Auditor              *audit.Auditor
+	WatchHub             *watch.Hub
+	WebhookDispatcher    *webhook.Dispatcher
+	HealthChecker        *health.Checker
+	LeaderElector        *leader.Elector
 }
 
 type ServerOption func(o *serverOptions)
@@ -58,16 +78,97 @@ func IdleTimeout(d time.Duration) ServerOption {
 	}
 }
 
+// TLSConfig enables TLS, the certificates could be rotated without restarting
+// by setting GetCertificate.
+func TLSConfig(c *tls.Config) ServerOption {
+	return func(o *serverOptions) {
+		o.TLSConfig = c
+	}
+}
+
+// RolloutManager enables the rollout APIs.
+func RolloutManager(m *rollout.Manager) ServerOption {
+	return func(o *serverOptions) {
+		o.RolloutManager = m
+	}
+}
+
+// DependencyValidation sets how to handle the dependencies on the services
+// which are not in the service registry, the check is disabled by default.
+func DependencyValidation(mode audit.Mode) ServerOption {
+	return func(o *serverOptions) {
+		o.DependencyValidation = mode
+	}
+}
+
+// Auditor sets the auditor which serves the audit report, the report is
+// generated on demand if not set.
+func Auditor(a *audit.Auditor) ServerOption {
+	return func(o *serverOptions) {
+		o.Auditor = a
+	}
+}
+
+// WatchHub enables the watch API.
+func WatchHub(h *watch.Hub) ServerOption {
+	return func(o *serverOptions) {
+		o.WatchHub = h
+	}
+}
+
+// WebhookDispatcher enables the webhook APIs.
+func WebhookDispatcher(d *webhook.Dispatcher) ServerOption {
+	return func(o *serverOptions) {
+		o.WebhookDispatcher = d
+	}
+}
+
+// HealthChecker sets the checker used by the readiness probe, the server is
+// always ready if not set.
+func HealthChecker(c *health.Checker) ServerOption {
+	return func(o *serverOptions) {
+		o.HealthChecker = c
+	}
+}
+
+// LeaderElector enables the leader API.
+func LeaderElector(e *leader.Elector) ServerOption {
+	return func(o *serverOptions) {
+		o.LeaderElector = e
+	}
+}
+
+// Timeouts is the timeouts of the http server, zero means no timeout.
+type Timeouts struct {
+	Read       time.Duration
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
 type Server struct {
 	l       net.Listener
-	hs      *http.Server
 	options *serverOptions
+	handler http.Handler
+	closed  chan struct{}
+
+	mu      sync.Mutex
+	serving bool
+	// hs serves the new connections which are fed through cl, it's replaced
+	// when the timeouts are changed, and the retired ones are shut down once
+	// their connections become idle.
+	hs      *http.Server
+	cl      *connListener
+	retired map[*http.Server]struct{}
 
 	reg         registry.Cache
 	rawCtl      *config.Controller
 	depsCtl     *config.DependenciesController
 	proxyCfgCtl *config.ProxyConfigsController
 	instCtl     *config.InstancesController
+	tplCtl      *config.ProxyConfigTemplatesController
+	defCfgCtl   *config.DefaultProxyConfigController
+	ovrCtl      *config.ProxyConfigOverridesController
 }
 
 func New(l net.Listener, reg registry.Cache, ctl *config.Controller, opts ...ServerOption) *Server {
@@ -75,6 +176,9 @@ func New(l net.Listener, reg registry.Cache, ctl *config.Controller, opts ...Ser
 	for _, opt := range opts {
 		opt(options)
 	}
+	if options.TLSConfig != nil {
+		l = tls.NewListener(l, options.TLSConfig)
+	}
 	s := &Server{
 		l:           l,
 		reg:         reg,
@@ -82,36 +186,180 @@ func New(l net.Listener, reg registry.Cache, ctl *config.Controller, opts ...Ser
 		depsCtl:     ctl.Dependencies(),
 		proxyCfgCtl: ctl.ProxyConfigs(),
 		instCtl:     ctl.Instances(),
+		tplCtl:      ctl.Templates(),
+		defCfgCtl:   ctl.DefaultProxyConfig(),
+		ovrCtl:      ctl.ProxyConfigOverrides(),
 		options:     options,
-		hs: &http.Server{
-			ReadTimeout:       options.ReadTimeout,
-			ReadHeaderTimeout: options.ReadHeaderTimeout,
-			WriteTimeout:      options.WriteTimeout,
-			IdleTimeout:       options.IdleTimeout,
-		},
-	}
-	s.hs.Handler = s.genRouter()
+		closed:      make(chan struct{}),
+		retired:     make(map[*http.Server]struct{}),
+	}
+	s.handler = s.genRouter()
+	s.hs = s.newHTTPServer(Timeouts{
+		Read:       options.ReadTimeout,
+		ReadHeader: options.ReadHeaderTimeout,
+		Write:      options.WriteTimeout,
+		Idle:       options.IdleTimeout,
+	})
+	s.cl = newConnListener(l.Addr())
 	return s
 }
 
+func (s *Server) newHTTPServer(t Timeouts) *http.Server {
+	return &http.Server{
+		Handler:           s.handler,
+		ReadTimeout:       t.Read,
+		ReadHeaderTimeout: t.ReadHeader,
+		WriteTimeout:      t.Write,
+		IdleTimeout:       t.Idle,
+	}
+}
+
 func (s *Server) Addr() string {
 	return s.l.Addr().String()
 }
 
+func (s *Server) serveHTTP(hs *http.Server, cl *connListener) {
+	go func() {
+		if err := hs.Serve(cl); err != nil && err != http.ErrServerClosed {
+			log.Warnf("http.Server.Serve got a unexpected error: %v", err)
+		}
+	}()
+}
+
 func (s *Server) Serve() error {
-	logger.Infof("API server listening on %s...", s.Addr())
-	switch err := s.hs.Serve(s.l); err {
-	case nil, http.ErrServerClosed:
-		return nil
-	default:
-		logger.Warnf("http.Server.ListenAndServe got a unexpected error: %s")
-		return err
+	log.Infof("API server listening on %s...", s.Addr())
+	s.mu.Lock()
+	s.serving = true
+	s.serveHTTP(s.hs, s.cl)
+	s.mu.Unlock()
+
+	var tempDelay time.Duration
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			select {
+			case <-s.closed:
+				return nil
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else if tempDelay *= 2; tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				log.Warnf("Accept error: %v; retrying in %v", err, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			log.Warnf("API server got a unexpected error: %v", err)
+			return err
+		}
+		tempDelay = 0
+		// Feed under the lock, so the connection won't be fed to a retired
+		// server which doesn't accept any more.
+		s.mu.Lock()
+		s.cl.feed(conn)
+		s.mu.Unlock()
 	}
 }
 
+// SetTimeouts changes the timeouts of the server. The new connections are
+// served with the new timeouts, and the existing ones are closed once idle.
+func (s *Server) SetTimeouts(t Timeouts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.hs
+	s.hs, s.cl = s.newHTTPServer(t), newConnListener(s.l.Addr())
+	if !s.serving {
+		return
+	}
+	s.serveHTTP(s.hs, s.cl)
+	s.retired[old] = struct{}{}
+	go func() {
+		// the fed listener is closed by Shutdown as well.
+		if err := old.Shutdown(context.Background()); err != nil {
+			log.Warnf("Error when shutdowning the retired http server: %v", err)
+		}
+		s.mu.Lock()
+		delete(s.retired, old)
+		s.mu.Unlock()
+	}()
+}
+
 func (s *Server) Shutdown() {
-	ctx, _ := context.WithTimeout(context.TODO(), time.Second) //nolint:lostcancel
-	if err := s.hs.Shutdown(ctx); err != nil {
-		logger.Warnf("Error when shutdowning the api server: %v", err)
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+		close(s.closed)
+	}
+	servers := []*http.Server{s.hs}
+	for hs := range s.retired {
+		servers = append(servers, hs)
+	}
+	s.mu.Unlock()
+
+	if err := s.l.Close(); err != nil {
+		log.Warnf("Error when closing the api listener: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	for _, hs := range servers {
+		if err := hs.Shutdown(ctx); err != nil {
+			log.Warnf("Error when shutdowning the api server: %v", err)
+		}
+	}
+}
+
+var errListenerClosed = errors.New("listener closed")
+
+// connListener is a net.Listener which accepts the connections fed by the
+// server, so the http server could be replaced without closing the
+// underlying listener.
+type connListener struct {
+	addr   net.Addr
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// feed hands over the connection to the acceptor, it's closed if the
+// listener has been closed.
+func (l *connListener) feed(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
 	}
 }
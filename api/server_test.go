@@ -1,16 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/file"
 	cfgmem "github.com/samaritan-proxy/sash/config/memory"
 	"github.com/samaritan-proxy/sash/registry"
 	regmem "github.com/samaritan-proxy/sash/registry/memory"
@@ -89,3 +94,113 @@ func TestServer(t *testing.T) {
 
 	assertDoNotTimeout(t, s.Shutdown, time.Second)
 }
+
+func TestServerSetTimeouts(t *testing.T) {
+	s := newTestServer(t, ReadTimeout(time.Second))
+	defer s.rawCtl.Stop()
+	assert.Equal(t, time.Second, s.hs.ReadTimeout)
+
+	// it takes effect even if the server is not serving yet.
+	s.SetTimeouts(Timeouts{Read: time.Second * 2})
+	assert.Equal(t, time.Second*2, s.hs.ReadTimeout)
+
+	go func() {
+		assert.NoError(t, s.Serve())
+	}()
+	// a spare connection dialed by the client stays in StateNew, which blocks
+	// shutdown for a while, so close the idle ones before shutdown.
+	tr := &http.Transport{}
+	client := &http.Client{Transport: tr}
+	url := fmt.Sprintf("http://%s/api/ping", s.Addr())
+	resp, err := client.Get(url)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	s.SetTimeouts(Timeouts{Read: time.Second * 3, Idle: time.Second})
+	s.mu.Lock()
+	assert.Equal(t, time.Second*3, s.hs.ReadTimeout)
+	assert.Equal(t, time.Second, s.hs.IdleTimeout)
+	s.mu.Unlock()
+	// the idle connection of the retired server is closed.
+	for i := 0; i < 3; i++ {
+		resp, err = client.Get(url)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	tr.CloseIdleConnections()
+	assertDoNotTimeout(t, s.Shutdown, time.Second)
+	// shutdown again is no-op.
+	s.Shutdown()
+	_, err = client.Get(url)
+	assert.Error(t, err)
+}
+
+func TestServerTLS(t *testing.T) {
+	// borrow the certificate of httptest.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	s := newTestServer(t, TLSConfig(ts.TLS))
+	defer s.rawCtl.Stop()
+	go func() {
+		assert.NoError(t, s.Serve())
+	}()
+	defer s.Shutdown()
+
+	resp, err := ts.Client().Get(fmt.Sprintf("https://%s/api/ping", s.Addr()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, resp.TLS)
+}
+
+func TestRejectWritesIfReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sash-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.MkdirAll(filepath.Join(dir, "service", "dependency"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "service", "dependency", "svc.yaml"), []byte("[dep]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := file.New(&file.Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := config.NewController(store)
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(l, registry.NewCache(regmem.NewRegistry()), ctl)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dependencies/svc", nil)
+	resp := testHandler(req, s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/proxy-configs", bytes.NewReader([]byte(`{"service_name": "svc"}`)))
+	resp = testHandler(req, s)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	assert.Contains(t, resp.Body.String(), "read-only")
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/dependencies/svc", nil)
+	resp = testHandler(req, s)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	// only the import honours dry_run.
+	req = httptest.NewRequest(http.MethodPut, "/api/proxy-configs/svc?dry_run=true", bytes.NewReader([]byte(`{"service_name": "svc"}`)))
+	resp = testHandler(req, s)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/import?dry_run=true", bytes.NewReader([]byte(`{}`)))
+	resp = testHandler(req, s)
+	assert.NotEqual(t, http.StatusMethodNotAllowed, resp.Code)
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/model"
+)
+
+func (s *Server) handleGetAllServices(w http.ResponseWriter, r *http.Request) {
+	names, err := s.reg.List()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	svcs := make(Services, 0, len(names))
+	for _, name := range names {
+		svc, err := s.reg.Get(name)
+		if err != nil {
+			writeMsg(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// deregistered in the meantime
+		if svc == nil {
+			continue
+		}
+		item := &Service{
+			Name:      name,
+			Instances: len(svc.Instances),
+		}
+		for _, inst := range svc.Instances {
+			if inst.State == model.StateHealthy {
+				item.HealthyInstances++
+			}
+		}
+		svcs = append(svcs, item)
+	}
+	result, err := filterItemsByRequestParams(r, svcs)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writePagedResp(w, r, result)
+}
+
+func (s *Server) handleGetServiceInstances(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)[paramService]
+	svc, err := s.reg.Get(name)
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if svc == nil {
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("service[%s] not found", name))
+		return
+	}
+	insts := make(ServiceInstances, 0, len(svc.Instances))
+	for _, inst := range svc.Instances {
+		insts = append(insts, &ServiceInstance{
+			IP:    inst.IP,
+			Port:  inst.Port,
+			State: inst.State.String(),
+			Meta:  inst.Meta,
+		})
+	}
+	result, err := filterItemsByRequestParams(r, insts)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writePagedResp(w, r, result)
+}
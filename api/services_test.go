@@ -0,0 +1,162 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/model"
+)
+
+func newTestServiceInstance(ip string, port uint16, state model.ServiceInstanceState) *model.ServiceInstance {
+	inst := model.NewServiceInstance(ip, port)
+	inst.State = state
+	return inst
+}
+
+func TestHandleGetAllServices(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	reg := newStaticRegistry()
+	reg.Register(model.NewService("svc_b",
+		newTestServiceInstance("10.0.0.1", 80, model.StateHealthy),
+		newTestServiceInstance("10.0.0.2", 80, model.StateUnhealthy),
+	))
+	reg.Register(model.NewService("svc_a"))
+	reg.Register(model.NewService("foo", newTestServiceInstance("10.0.0.3", 80, model.StateHealthy)))
+	s.reg = reg
+
+	cases := []struct {
+		ReqURI string
+		Code   int
+		Resp   string
+	}{
+		{
+			ReqURI: "/api/services",
+			Code:   http.StatusOK,
+			Resp: `{
+				"data": [
+					{"name": "foo", "instances": 1, "healthy_instances": 1},
+					{"name": "svc_a", "instances": 0, "healthy_instances": 0},
+					{"name": "svc_b", "instances": 2, "healthy_instances": 1}
+				],
+				"page_num": 0,
+				"page_size": 10,
+				"total": 3
+			}`,
+		},
+		{
+			ReqURI: "/api/services?name=re%3Asvc_.*&page_size=1&page_num=1", // re:svc_.*
+			Code:   http.StatusOK,
+			Resp: `{
+				"data": [
+					{"name": "svc_b", "instances": 2, "healthy_instances": 1}
+				],
+				"page_num": 1,
+				"page_size": 1,
+				"total": 2
+			}`,
+		},
+		{
+			ReqURI: "/api/services?instances=0",
+			Code:   http.StatusOK,
+			Resp: `{
+				"data": [
+					{"name": "svc_a", "instances": 0, "healthy_instances": 0}
+				],
+				"page_num": 0,
+				"page_size": 10,
+				"total": 1
+			}`,
+		},
+		{
+			ReqURI: "/api/services?name=re%3A%28", // re:(
+			Code:   http.StatusBadRequest,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.ReqURI, func(t *testing.T) {
+			resp := testHandler(httptest.NewRequest(http.MethodGet, c.ReqURI, nil), s)
+			assert.Equal(t, c.Code, resp.Code)
+			if c.Code == http.StatusOK {
+				assert.JSONEq(t, c.Resp, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleGetServiceInstances(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	reg := newStaticRegistry()
+	inst := newTestServiceInstance("10.0.0.2", 80, model.StateUnhealthy)
+	inst.Meta["zone"] = "z1"
+	reg.Register(model.NewService("svc",
+		newTestServiceInstance("10.0.0.1", 8080, model.StateHealthy),
+		newTestServiceInstance("10.0.0.1", 80, model.StateHealthy),
+		inst,
+	))
+	s.reg = reg
+
+	cases := []struct {
+		ReqURI string
+		Code   int
+		Resp   string
+	}{
+		{
+			ReqURI: "/api/services/svc/instances",
+			Code:   http.StatusOK,
+			Resp: `{
+				"data": [
+					{"ip": "10.0.0.1", "port": 80, "state": "healthy", "meta": {}},
+					{"ip": "10.0.0.1", "port": 8080, "state": "healthy", "meta": {}},
+					{"ip": "10.0.0.2", "port": 80, "state": "unhealthy", "meta": {"zone": "z1"}}
+				],
+				"page_num": 0,
+				"page_size": 10,
+				"total": 3
+			}`,
+		},
+		{
+			ReqURI: "/api/services/svc/instances?state=unhealthy",
+			Code:   http.StatusOK,
+			Resp: `{
+				"data": [
+					{"ip": "10.0.0.2", "port": 80, "state": "unhealthy", "meta": {"zone": "z1"}}
+				],
+				"page_num": 0,
+				"page_size": 10,
+				"total": 1
+			}`,
+		},
+		{
+			ReqURI: "/api/services/foo/instances",
+			Code:   http.StatusNotFound,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.ReqURI, func(t *testing.T) {
+			resp := testHandler(httptest.NewRequest(http.MethodGet, c.ReqURI, nil), s)
+			assert.Equal(t, c.Code, resp.Code)
+			if c.Code == http.StatusOK {
+				assert.JSONEq(t, c.Resp, resp.Body.String())
+			}
+		})
+	}
+}
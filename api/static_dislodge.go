@@ -4,11 +4,9 @@ package api
 
 import (
 	"net/http"
-
-	"github.com/samaritan-proxy/sash/logger"
 )
 
 func staticFileHandler() http.Handler {
-	logger.Infof("use external mode")
+	log.Infof("use external mode")
 	return http.FileServer(http.Dir("./dist"))
 }
@@ -8,14 +8,13 @@ import (
 	"github.com/rakyll/statik/fs"
 
 	_ "github.com/samaritan-proxy/sash/api/statik"
-	"github.com/samaritan-proxy/sash/logger"
 )
 
 func staticFileHandler() http.Handler {
-	logger.Infof("Embeded the static files of front")
+	log.Infof("Embeded the static files of front")
 	statikFS, err := fs.New()
 	if err != nil {
-		logger.Fatal(err)
+		log.Fatal(err)
 	}
 	return http.FileServer(statikFS)
 }
@@ -0,0 +1,127 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func (s *Server) handleGetAllTemplates(w http.ResponseWriter, r *http.Request) {
+	tpls, err := s.tplCtl.GetAll()
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result, err := filterItemsByRequestParams(r, tpls)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writePagedResp(w, r, result)
+}
+
+func (s *Server) handleAddTemplate(w http.ResponseWriter, r *http.Request) {
+	var (
+		tpl = new(config.ProxyConfigTemplate)
+		err = json.NewDecoder(r.Body).Decode(&tpl)
+	)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = tpl.Verify(); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch err = s.tplCtl.AddContext(r.Context(), tpl); err {
+	case nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case config.ErrExist:
+		writeMsg(w, http.StatusBadRequest, err.Error())
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)[paramTemplate]
+	tpl, err := s.tplCtl.Get(name)
+	switch err {
+	case nil:
+		writeJSON(w, tpl)
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("template[%s] not found", name))
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	var (
+		name = mux.Vars(r)[paramTemplate]
+		tpl  = new(config.ProxyConfigTemplate)
+		err  = json.NewDecoder(r.Body).Decode(&tpl)
+	)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tpl.Name = name
+	switch err = s.tplCtl.UpdateContext(r.Context(), tpl); err {
+	case nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("template[%s] not found", name))
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)[paramTemplate]
+	switch err := s.tplCtl.DeleteContext(r.Context(), name); err {
+	case nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("template[%s] not found", name))
+	case config.ErrTemplateInUse:
+		writeMsg(w, http.StatusConflict, err.Error())
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleGetTemplateServices(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)[paramTemplate]
+	if !s.tplCtl.Exist(name) {
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("template[%s] not found", name))
+		return
+	}
+	svcs, err := s.tplCtl.Services(name)
+	if err != nil {
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if svcs == nil {
+		svcs = []string{}
+	}
+	writeJSON(w, svcs)
+}
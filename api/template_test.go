@@ -0,0 +1,78 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleTemplates(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		return testHandler(req, s)
+	}
+
+	tpl := `{"name": "tpl", "config": {"protocol": "TCP", "listener": {"address": {"ip": "0.0.0.0", "port": 80}}}}`
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/proxy-config-templates", "foo").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/proxy-config-templates", `{}`).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/proxy-config-templates", tpl).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/proxy-config-templates", tpl).Code)
+
+	resp := do(http.MethodGet, "/api/proxy-config-templates", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"total":1`)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/proxy-config-templates/foo", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/api/proxy-config-templates/foo", `{}`).Code)
+
+	t.Run("reference", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/proxy-configs", `{"service_name": "svc", "template": "foo"}`).Code)
+		resp := do(http.MethodPost, "/api/proxy-configs", `{"service_name": "svc", "template": "tpl", "config": {"lbPolicy": "RANDOM"}}`)
+		assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		resp = do(http.MethodGet, "/api/proxy-config-templates/tpl/services", "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `["svc"]`, resp.Body.String())
+
+		assert.Equal(t, http.StatusConflict, do(http.MethodDelete, "/api/proxy-config-templates/tpl", "").Code)
+	})
+
+	t.Run("effective", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/proxy-config-templates/tpl", `{"config": {"protocol": "Redis", "listener": {"address": {"ip": "0.0.0.0", "port": 80}}}}`).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/proxy-configs/foo/effective", "").Code)
+		resp := do(http.MethodGet, "/api/proxy-configs/svc/effective", "")
+		assert.Equal(t, http.StatusOK, resp.Code)
+		cfg, err := s.proxyCfgCtl.GetEffective("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, protocol.Redis, cfg.Config.Protocol)
+		assert.Contains(t, resp.Body.String(), `"lbPolicy":"RANDOM"`)
+		assert.Contains(t, resp.Body.String(), `"protocol":"Redis"`)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/proxy-configs/svc", "").Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/proxy-config-templates/tpl", "").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/proxy-config-templates/tpl", "").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/proxy-config-templates/tpl/services", "").Code)
+	})
+}
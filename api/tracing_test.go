@@ -0,0 +1,97 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestTraceRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+	events := make(chan *config.DependencyEvent, 1)
+	s.depsCtl.RegisterEventHandler(func(event *config.DependencyEvent) {
+		events <- event
+	})
+
+	// read requests are not traced.
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/api/ping", nil), s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("traceresponse"))
+
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	req := httptest.NewRequest(http.MethodPost, "/api/dependencies",
+		bytes.NewReader([]byte(`{"service_name":"svc_1","dependencies":["dep_1"]}`)))
+	req.Header.Set("traceparent", parent)
+	resp = testHandler(req, s)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	h := http.Header{"Traceparent": []string{resp.Header().Get("traceresponse")}}
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(h)))
+	assert.True(t, sc.IsValid())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", sc.TraceID().String())
+
+	// the trace is continued by the config controller.
+	select {
+	case event := <-events:
+		assert.Equal(t, sc.TraceID(), event.Trace.TraceID())
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	resp = testHandler(httptest.NewRequest(http.MethodPost, "/api/dependencies", bytes.NewReader([]byte("?"))), s)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	time.Sleep(time.Millisecond * 10)
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			spans = append(spans, span)
+		}
+	}
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "POST /api/dependencies", spans[0].Name())
+	assert.Equal(t, sc.SpanID(), spans[0].SpanContext().SpanID())
+	assert.Equal(t, "b7ad6b7169203331", spans[0].Parent().SpanID().String())
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+	code, _ := attrs.Value("http.status_code")
+	assert.EqualValues(t, http.StatusOK, code.AsInt64())
+	route, _ := attrs.Value("http.route")
+	assert.Equal(t, "/api/dependencies", route.AsString())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	attrs = attribute.NewSet(spans[1].Attributes()...)
+	code, _ = attrs.Value("http.status_code")
+	assert.EqualValues(t, http.StatusBadRequest, code.AsInt64())
+	assert.False(t, spans[1].Parent().IsValid())
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samaritan-proxy/sash/watch"
+)
+
+const (
+	paramResources   = "resources"
+	paramServices    = "services"
+	paramLastEventID = "last_event_id"
+
+	headerLastEventID = "Last-Event-ID"
+
+	contentTypeEventStream = "text/event-stream"
+)
+
+// watchKeepAliveInterval is the interval of sending comments to keep the
+// idle stream alive through the proxies.
+var watchKeepAliveInterval = 15 * time.Second
+
+// splitParam splits the comma separated values of query parameter.
+func splitParam(r *http.Request, param string) []string {
+	var values []string
+	for _, v := range r.URL.Query()[param] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+func parseWatchFilter(r *http.Request) (*watch.Filter, error) {
+	filter := &watch.Filter{
+		Services: splitParam(r, paramServices),
+	}
+	for _, v := range splitParam(r, paramResources) {
+		res, err := watch.ParseResource(v)
+		if err != nil {
+			return nil, err
+		}
+		filter.Resources = append(filter.Resources, res)
+	}
+	return filter, nil
+}
+
+func writeSSE(w http.ResponseWriter, id, event string, data []byte) error {
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+	_, err := w.Write([]byte(b.String()))
+	return err
+}
+
+// handleWatch streams the changes as Server-Sent Events. The stream could be
+// resumed from the last seen event by the Last-Event-ID header or the
+// last_event_id parameter, a reset event is sent if it's expired, then the
+// client should list the resources again.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	hub := s.options.WatchHub
+	if hub == nil {
+		writeMsg(w, http.StatusNotImplemented, "watch is not enabled")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeMsg(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	filter, err := parseWatchFilter(r)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	lastEventID := r.Header.Get(headerLastEventID)
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get(paramLastEventID)
+	}
+
+	reset := false
+	sub, err := hub.Subscribe(filter, lastEventID)
+	if err == watch.ErrEventExpired {
+		reset = true
+		sub, err = hub.Subscribe(filter, "")
+	}
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set(contentType, contentTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if reset {
+		if err := writeSSE(w, "", "reset", []byte("{}")); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(watchKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		case evt, ok := <-sub.Events():
+			// fell behind, the client will reconnect with the last event id.
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(evt)
+			if err != nil {
+				continue
+			}
+			if err := writeSSE(w, evt.ID, "", b); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
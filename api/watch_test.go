@@ -0,0 +1,144 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/watch"
+)
+
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readSSE reads a message from the stream, the comments are skipped.
+func readSSE(t *testing.T, r *bufio.Reader) *sseMessage {
+	msg := new(sseMessage)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if msg.Data != "" {
+				return msg
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			msg.ID = line[len("id: "):]
+		case strings.HasPrefix(line, "event: "):
+			msg.Event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			msg.Data = line[len("data: "):]
+		}
+	}
+}
+
+func TestHandleWatch(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	resp := testHandler(httptest.NewRequest(http.MethodGet, "/api/watch", nil), s)
+	assert.Equal(t, http.StatusNotImplemented, resp.Code)
+
+	hub := watch.NewHub(watch.BufferSize(2))
+	s.options.WatchHub = hub
+	hs := httptest.NewServer(s.hs.Handler)
+	defer hs.Close()
+
+	open := func(uri string, lastEventID string) (*http.Response, *bufio.Reader, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequest(http.MethodGet, hs.URL+uri, nil)
+		req = req.WithContext(ctx)
+		if lastEventID != "" {
+			req.Header.Set(headerLastEventID, lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, bufio.NewReader(resp.Body), cancel
+	}
+
+	resp2, _, cancel := open("/api/watch?resources=foo", "")
+	assert.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+	cancel()
+
+	var lastID string
+	t.Run("filter", func(t *testing.T) {
+		resp, r, cancel := open("/api/watch?resources=dependency,proxy-config&services=a", "")
+		defer cancel()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, contentTypeEventStream, resp.Header.Get(contentType))
+
+		hub.Publish(&watch.Event{Type: watch.EventAdd, Resource: watch.ResourceInstance, ServiceName: "a", Key: "inst"})
+		hub.Publish(&watch.Event{Type: watch.EventAdd, Resource: watch.ResourceDependency, ServiceName: "b", Key: "b"})
+		hub.Publish(&watch.Event{Type: watch.EventAdd, Resource: watch.ResourceDependency, ServiceName: "a", Key: "a"})
+		msg := readSSE(t, r)
+		evt := new(watch.Event)
+		assert.NoError(t, json.Unmarshal([]byte(msg.Data), evt))
+		assert.Equal(t, msg.ID, evt.ID)
+		assert.Equal(t, watch.ResourceDependency, evt.Resource)
+		assert.Equal(t, "a", evt.ServiceName)
+		lastID = msg.ID
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		hub.Publish(&watch.Event{Type: watch.EventDelete, Resource: watch.ResourceDependency, ServiceName: "a", Key: "a"})
+		_, r, cancel := open("/api/watch?last_event_id="+lastID, "")
+		defer cancel()
+		msg := readSSE(t, r)
+		assert.Empty(t, msg.Event)
+		assert.Contains(t, msg.Data, `"type":"delete"`)
+		lastID = msg.ID
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		_, r, cancel := open("/api/watch", "foo-1")
+		defer cancel()
+		msg := readSSE(t, r)
+		assert.Equal(t, "reset", msg.Event)
+
+		hub.Publish(&watch.Event{Type: watch.EventAdd, Resource: watch.ResourceService, ServiceName: "c", Key: "c"})
+		msg = readSSE(t, r)
+		assert.Contains(t, msg.Data, `"resource":"service"`)
+	})
+
+	t.Run("keep alive", func(t *testing.T) {
+		old := watchKeepAliveInterval
+		watchKeepAliveInterval = time.Millisecond * 10
+		defer func() { watchKeepAliveInterval = old }()
+
+		_, r, cancel := open("/api/watch", "")
+		defer cancel()
+		line, err := r.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, ": keep-alive\n", line)
+	})
+}
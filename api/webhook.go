@@ -0,0 +1,173 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/webhook"
+)
+
+// webhooksEnabled writes 501 if the webhook dispatcher is not configured.
+func (s *Server) webhooksEnabled(w http.ResponseWriter) bool {
+	if s.options.WebhookDispatcher == nil {
+		writeMsg(w, http.StatusNotImplemented, "webhook is not enabled")
+		return false
+	}
+	return true
+}
+
+func writeWebhookErr(w http.ResponseWriter, name string, err error) {
+	switch err {
+	case config.ErrExist:
+		writeMsg(w, http.StatusBadRequest, err.Error())
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("webhook[%s] not found", name))
+	case webhook.ErrStatic:
+		writeMsg(w, http.StatusForbidden, err.Error())
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (s *Server) handleGetAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	targets := s.options.WebhookDispatcher.Targets()
+	redacted := make(webhook.Targets, 0, len(targets))
+	for _, t := range targets {
+		redacted = append(redacted, t.Redacted())
+	}
+	result, err := filterItemsByRequestParams(r, redacted)
+	if err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writePagedResp(w, r, result)
+}
+
+func (s *Server) handleAddWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	t := new(webhook.Target)
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := t.Verify(); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.options.WebhookDispatcher.Add(t); err != nil {
+		writeWebhookErr(w, t.Name, err)
+		return
+	}
+	writeJSON(w, t.Redacted())
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	name := mux.Vars(r)[paramWebhook]
+	t, err := s.options.WebhookDispatcher.Get(name)
+	if err != nil {
+		writeWebhookErr(w, name, err)
+		return
+	}
+	writeJSON(w, t.Redacted())
+}
+
+func (s *Server) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	name := mux.Vars(r)[paramWebhook]
+	t := new(webhook.Target)
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t.Name = name
+	if err := t.Verify(); err != nil {
+		writeMsg(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.options.WebhookDispatcher.Update(t); err != nil {
+		writeWebhookErr(w, name, err)
+		return
+	}
+	writeJSON(w, t.Redacted())
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	name := mux.Vars(r)[paramWebhook]
+	if err := s.options.WebhookDispatcher.Delete(name); err != nil {
+		writeWebhookErr(w, name, err)
+		return
+	}
+	writeMsg(w, http.StatusOK, "OK")
+}
+
+func (s *Server) handleGetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	name := mux.Vars(r)[paramWebhook]
+	if _, err := s.options.WebhookDispatcher.Get(name); err != nil {
+		writeWebhookErr(w, name, err)
+		return
+	}
+	writeJSON(w, s.options.WebhookDispatcher.DeadLetters(name))
+}
+
+func (s *Server) handleClearDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	name := mux.Vars(r)[paramWebhook]
+	s.options.WebhookDispatcher.ClearDeadLetters(name)
+	writeMsg(w, http.StatusOK, "OK")
+}
+
+func (s *Server) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	if !s.webhooksEnabled(w) {
+		return
+	}
+	var (
+		name     = mux.Vars(r)[paramWebhook]
+		delivery = mux.Vars(r)[paramDelivery]
+	)
+	switch err := s.options.WebhookDispatcher.Redeliver(name, delivery); err {
+	case nil:
+		writeMsg(w, http.StatusOK, "OK")
+	case config.ErrNotExist:
+		writeMsg(w, http.StatusNotFound, fmt.Sprintf("dead letter[%s] not found", delivery))
+	case webhook.ErrStopped, webhook.ErrQueueFull:
+		writeMsg(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeMsg(w, http.StatusInternalServerError, err.Error())
+	}
+}
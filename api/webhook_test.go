@@ -0,0 +1,115 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/webhook"
+)
+
+func TestHandleWebhooks(t *testing.T) {
+	s := newTestServer(t)
+	defer s.rawCtl.Stop()
+
+	do := func(method, uri string, body interface{}) *httptest.ResponseRecorder {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		return testHandler(httptest.NewRequest(method, uri, bytes.NewReader(b)), s)
+	}
+
+	assert.Equal(t, http.StatusNotImplemented, do(http.MethodGet, "/api/webhooks", nil).Code)
+
+	d := webhook.NewDispatcher(s.rawCtl,
+		webhook.StaticTargets(&webhook.Target{Name: "static", URL: "http://a", Secret: "s", Events: []string{"*"}}),
+		webhook.Retry(time.Millisecond, time.Millisecond, 0),
+	)
+	d.Start()
+	defer d.Stop()
+	s.options.WebhookDispatcher = d
+
+	t.Run("add", func(t *testing.T) {
+		resp := do(http.MethodPost, "/api/webhooks", &webhook.Target{Name: "chat", URL: "http://b", Secret: "s", Events: []string{"proxy-config.*"}})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.NotContains(t, resp.Body.String(), "secret")
+
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/webhooks", &webhook.Target{Name: "chat", URL: "http://b", Events: []string{"*"}}).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/webhooks", &webhook.Target{Name: "foo", URL: "http://b", Events: []string{"foo"}}).Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		resp := do(http.MethodGet, "/api/webhooks?static=true", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"name":"static"`)
+		assert.Contains(t, resp.Body.String(), `"total":1`)
+		assert.NotContains(t, resp.Body.String(), "secret")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		resp := do(http.MethodGet, "/api/webhooks/chat", nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"url":"http://b"`)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/webhooks/foo", nil).Code)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		resp := do(http.MethodPut, "/api/webhooks/chat", &webhook.Target{URL: "http://c", Events: []string{"*"}})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Contains(t, resp.Body.String(), `"url":"http://c"`)
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/api/webhooks/static", &webhook.Target{URL: "http://c", Events: []string{"*"}}).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/api/webhooks/foo", &webhook.Target{URL: "http://c", Events: []string{"*"}}).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/webhooks/chat", &webhook.Target{URL: "foo"}).Code)
+	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+		assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/webhooks/chat", &webhook.Target{URL: srv.URL, Events: []string{"*"}}).Code)
+		d.Dispatch(&webhook.Payload{ID: "1", Event: "dependency.add"})
+
+		var dls []*webhook.DeadLetter
+		for i := 0; i < 100 && len(dls) == 0; i++ {
+			time.Sleep(time.Millisecond * 10)
+			resp := do(http.MethodGet, "/api/webhooks/chat/dead-letters", nil)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &dls))
+		}
+		if assert.Len(t, dls, 1) {
+			assert.Equal(t, "1", dls[0].Payload.ID)
+		}
+		assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/webhooks/foo/dead-letters", nil).Code)
+
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/webhooks/chat/dead-letters/2:redeliver", nil).Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/webhooks/chat/dead-letters/1:redeliver", nil).Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/webhooks/chat/dead-letters", nil).Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/api/webhooks/static", nil).Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/webhooks/chat", nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/webhooks/chat", nil).Code)
+	})
+}
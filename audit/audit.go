@@ -0,0 +1,149 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit checks the configs against the service registry, and
+// reports the dependencies on unknown services, the services without proxy
+// config and the services no one depends on.
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+// Mode indicates how to handle the dependencies on unknown services.
+type Mode string
+
+// The following shows the available modes.
+const (
+	// ModeOff disables the check.
+	ModeOff Mode = "off"
+	// ModeWarn accepts the dependencies, but warns the caller.
+	ModeWarn Mode = "warn"
+	// ModeReject rejects the dependencies.
+	ModeReject Mode = "reject"
+)
+
+// Verify this mode is valid.
+func (m Mode) Verify() error {
+	switch m {
+	case ModeOff, ModeWarn, ModeReject:
+		return nil
+	default:
+		return fmt.Errorf("unknown dependency validation mode: %s", m)
+	}
+}
+
+// UnknownDependencies returns the dependencies which are not in the service
+// registry. An empty registry is regarded as not synchronized yet, nothing
+// is returned in this case.
+func UnknownDependencies(reg registry.Cache, dep *config.Dependency) []string {
+	if !registrySynced(reg) {
+		return nil
+	}
+	var unknown []string
+	for _, svc := range dep.Dependencies {
+		if !reg.Exists(svc) {
+			unknown = append(unknown, svc)
+		}
+	}
+	return unknown
+}
+
+func registrySynced(reg registry.Cache) bool {
+	svcs, err := reg.List()
+	return err == nil && len(svcs) > 0
+}
+
+// DanglingDependency represents the dependencies of a service which are not
+// in the service registry.
+type DanglingDependency struct {
+	ServiceName  string   `json:"service_name"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// Report is the result of an audit.
+type Report struct {
+	GenerateTime time.Time `json:"generate_time"`
+	// RegistryServices is the number of services in the registry.
+	RegistryServices int `json:"registry_services"`
+	// DanglingDependencies lists the dependencies on unknown services.
+	DanglingDependencies []*DanglingDependency `json:"dangling_dependencies"`
+	// UnconfiguredServices lists the services in the registry which don't
+	// have their own proxy config.
+	UnconfiguredServices []string `json:"unconfigured_services"`
+	// OrphanServices lists the services in the registry which no one depends on.
+	OrphanServices []string `json:"orphan_services"`
+}
+
+// Generate audits the configs in cache against the service registry.
+func Generate(reg registry.Cache, ctl *config.Controller) (*Report, error) {
+	svcs, err := reg.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(svcs)
+	r := &Report{
+		GenerateTime:         time.Now(),
+		RegistryServices:     len(svcs),
+		DanglingDependencies: []*DanglingDependency{},
+		UnconfiguredServices: []string{},
+		OrphanServices:       []string{},
+	}
+	// nothing could be judged before the registry is synchronized.
+	if len(svcs) == 0 {
+		return r, nil
+	}
+
+	depsCtl := ctl.Dependencies()
+	deps, err := depsCtl.GetAllCache()
+	switch err {
+	case nil, config.ErrNotExist:
+	default:
+		return nil, err
+	}
+	sort.Sort(deps)
+	for _, dep := range deps {
+		if unknown := UnknownDependencies(reg, dep); len(unknown) > 0 {
+			r.DanglingDependencies = append(r.DanglingDependencies, &DanglingDependency{
+				ServiceName:  dep.ServiceName,
+				Dependencies: unknown,
+			})
+		}
+	}
+
+	configured, err := ctl.KeysCached(config.NamespaceService, config.TypeServiceProxyConfig)
+	switch err {
+	case nil, config.ErrNotExist:
+	default:
+		return nil, err
+	}
+	configuredSet := make(map[string]struct{}, len(configured))
+	for _, svc := range configured {
+		configuredSet[svc] = struct{}{}
+	}
+	for _, svc := range svcs {
+		if _, ok := configuredSet[svc]; !ok {
+			r.UnconfiguredServices = append(r.UnconfiguredServices, svc)
+		}
+		if len(depsCtl.Dependents(svc)) == 0 {
+			r.OrphanServices = append(r.OrphanServices, svc)
+		}
+	}
+	return r, nil
+}
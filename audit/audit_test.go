@@ -0,0 +1,103 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+func newTestRegistry(ctrl *gomock.Controller, svcs ...string) registry.Cache {
+	reg := registry.NewMockCache(ctrl)
+	reg.EXPECT().List().Return(svcs, nil).AnyTimes()
+	reg.EXPECT().Exists(gomock.Any()).DoAndReturn(func(name string) bool {
+		for _, svc := range svcs {
+			if svc == name {
+				return true
+			}
+		}
+		return false
+	}).AnyTimes()
+	return reg
+}
+
+func newTestController(t *testing.T) *config.Controller {
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	return ctl
+}
+
+func TestMode_Verify(t *testing.T) {
+	for _, m := range []Mode{ModeOff, ModeWarn, ModeReject} {
+		assert.NoError(t, m.Verify())
+	}
+	assert.Error(t, Mode("foo").Verify())
+}
+
+func TestUnknownDependencies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dep := &config.Dependency{ServiceName: "a", Dependencies: []string{"b", "c", "d"}}
+	// the empty registry is regarded as not synchronized.
+	assert.Nil(t, UnknownDependencies(newTestRegistry(ctrl), dep))
+	assert.Equal(t, []string{"c", "d"}, UnknownDependencies(newTestRegistry(ctrl, "a", "b"), dep))
+	assert.Nil(t, UnknownDependencies(newTestRegistry(ctrl, "b", "c", "d"), dep))
+}
+
+func TestGenerate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctl := newTestController(t)
+	defer ctl.Stop()
+
+	// nothing is reported before the registry is synchronized.
+	r, err := Generate(newTestRegistry(ctrl), ctl)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.RegistryServices)
+	assert.Empty(t, r.DanglingDependencies)
+	assert.Empty(t, r.UnconfiguredServices)
+	assert.Empty(t, r.OrphanServices)
+
+	assert.NoError(t, ctl.Dependencies().Add(&config.Dependency{ServiceName: "a", Dependencies: []string{"b", "x"}}))
+	assert.NoError(t, ctl.Dependencies().Add(&config.Dependency{ServiceName: "b", Dependencies: []string{"c"}}))
+	timeout := time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "b",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	time.Sleep(time.Millisecond * 20)
+
+	r, err = Generate(newTestRegistry(ctrl, "c", "b", "a"), ctl)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, r.RegistryServices)
+	assert.Equal(t, []*DanglingDependency{{ServiceName: "a", Dependencies: []string{"x"}}}, r.DanglingDependencies)
+	assert.Equal(t, []string{"a", "c"}, r.UnconfiguredServices)
+	assert.Equal(t, []string{"a"}, r.OrphanServices)
+}
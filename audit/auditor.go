@@ -0,0 +1,164 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+var log = logger.Component("audit")
+
+type auditorOptions struct {
+	interval time.Duration
+}
+
+func defaultAuditorOptions() *auditorOptions {
+	return &auditorOptions{
+		interval: time.Minute,
+	}
+}
+
+type AuditorOption func(o *auditorOptions)
+
+// Interval sets the interval of generating the report.
+func Interval(interval time.Duration) AuditorOption {
+	return func(o *auditorOptions) {
+		o.interval = interval
+	}
+}
+
+// Auditor generates the audit report periodically, and keeps the latest one.
+type Auditor struct {
+	options *auditorOptions
+	reg     registry.Cache
+	ctl     *config.Controller
+
+	mu     sync.Mutex   // serializes the refreshes
+	report atomic.Value // *Report
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAuditor creates an auditor.
+func NewAuditor(reg registry.Cache, ctl *config.Controller, opts ...AuditorOption) *Auditor {
+	o := defaultAuditorOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Auditor{
+		options: o,
+		reg:     reg,
+		ctl:     ctl,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start starts the auditor.
+func (a *Auditor) Start() {
+	a.wg.Add(1)
+	go a.loop()
+}
+
+// Stop stops the auditor.
+func (a *Auditor) Stop() {
+	close(a.stop)
+	a.wg.Wait()
+}
+
+func (a *Auditor) loop() {
+	ticker := time.NewTicker(a.options.interval)
+	defer func() {
+		ticker.Stop()
+		a.wg.Done()
+	}()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+		if _, err := a.Refresh(); err != nil {
+			log.Warnf("Failed to generate the audit report: %v", err)
+		}
+	}
+}
+
+// Refresh generates a new report and keeps it as the latest one.
+func (a *Auditor) Refresh() (*Report, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, err := Generate(a.reg, a.ctl)
+	if err != nil {
+		return nil, err
+	}
+	changed, resolved := danglingChanges(a.Report(), r)
+	for _, d := range changed {
+		log.Warnf("Service[%s] depends on unknown services: %v", d.ServiceName, d.Dependencies)
+	}
+	for _, svc := range resolved {
+		log.Infof("Service[%s] no longer depends on unknown services", svc)
+	}
+	a.report.Store(r)
+	return r, nil
+}
+
+// danglingChanges returns the dangling dependencies which are new or changed
+// in cur, and the services whose dangling dependencies are all resolved.
+func danglingChanges(prev, cur *Report) (changed []*DanglingDependency, resolved []string) {
+	last := make(map[string][]string)
+	if prev != nil {
+		for _, d := range prev.DanglingDependencies {
+			last[d.ServiceName] = d.Dependencies
+		}
+	}
+	for _, d := range cur.DanglingDependencies {
+		deps, ok := last[d.ServiceName]
+		delete(last, d.ServiceName)
+		if ok && equalStrings(deps, d.Dependencies) {
+			continue
+		}
+		changed = append(changed, d)
+	}
+	for svc := range last {
+		resolved = append(resolved, svc)
+	}
+	sort.Strings(resolved)
+	return changed, resolved
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Report returns the latest report, nil if no report has been generated.
+func (a *Auditor) Report() *Report {
+	r, _ := a.report.Load().(*Report)
+	return r
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctl := newTestController(t)
+	defer ctl.Stop()
+
+	a := NewAuditor(newTestRegistry(ctrl, "a"), ctl, Interval(time.Millisecond*10))
+	assert.Nil(t, a.Report())
+
+	a.Start()
+	time.Sleep(time.Millisecond * 50)
+	a.Stop()
+	r := a.Report()
+	if assert.NotNil(t, r) {
+		assert.Equal(t, []string{"a"}, r.OrphanServices)
+	}
+
+	r2, err := a.Refresh()
+	assert.NoError(t, err)
+	assert.True(t, r2.GenerateTime.After(r.GenerateTime))
+	assert.Equal(t, r2, a.Report())
+}
+
+func TestDanglingChanges(t *testing.T) {
+	prev := &Report{DanglingDependencies: []*DanglingDependency{
+		{ServiceName: "a", Dependencies: []string{"x"}},
+		{ServiceName: "b", Dependencies: []string{"x"}},
+		{ServiceName: "c", Dependencies: []string{"x"}},
+	}}
+	cur := &Report{DanglingDependencies: []*DanglingDependency{
+		{ServiceName: "a", Dependencies: []string{"x"}},
+		{ServiceName: "b", Dependencies: []string{"x", "y"}},
+		{ServiceName: "d", Dependencies: []string{"x"}},
+	}}
+
+	changed, resolved := danglingChanges(nil, prev)
+	assert.Equal(t, prev.DanglingDependencies, changed)
+	assert.Empty(t, resolved)
+
+	changed, resolved = danglingChanges(prev, cur)
+	assert.Equal(t, cur.DanglingDependencies[1:], changed)
+	assert.Equal(t, []string{"c"}, resolved)
+
+	changed, resolved = danglingChanges(cur, cur)
+	assert.Empty(t, changed)
+	assert.Empty(t, resolved)
+}
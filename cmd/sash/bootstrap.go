@@ -15,9 +15,25 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/go-yaml/yaml"
+
+	"github.com/samaritan-proxy/sash/api"
+	"github.com/samaritan-proxy/sash/audit"
+	"github.com/samaritan-proxy/sash/config/bolt"
+	"github.com/samaritan-proxy/sash/config/file"
 	"github.com/samaritan-proxy/sash/internal/zk"
+	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/webhook"
 )
 
 type RawMessage struct {
@@ -39,12 +55,30 @@ type ConfigStore struct {
 	SyncFreq time.Duration `yaml:"sync_freq"`
 }
 
+// newConfigStoreSpec returns the spec of the given config store type, nil if
+// the type has no spec.
+func newConfigStoreSpec(typ string) interface{} {
+	switch typ {
+	case "zk":
+		return new(zk.ConnConfig)
+	case "bolt":
+		return new(bolt.Config)
+	case "file":
+		return new(file.Config)
+	default:
+		return nil
+	}
+}
+
 func (c *ConfigStore) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s := struct {
 		Type     string        `yaml:"type"`
 		Spec     *RawMessage   `yaml:"spec"`
 		SyncFreq time.Duration `yaml:"sync_freq"`
-	}{}
+	}{
+		Type:     c.Type,
+		SyncFreq: c.SyncFreq,
+	}
 	if err := unmarshal(&s); err != nil {
 		return err
 	}
@@ -54,17 +88,29 @@ func (c *ConfigStore) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	// TODO: To improve the maintainability, we should unmarshal spec to
 	// the actual structure when intializes the corresponding config store.
-	switch s.Type {
+	c.Spec = newConfigStoreSpec(s.Type)
+	if c.Spec != nil && s.Spec != nil {
+		return s.Spec.Unmarshal(c.Spec)
+	}
+	return nil
+}
+
+// Verify verifies the config store.
+func (c *ConfigStore) Verify() error {
+	switch c.Type {
+	case "":
+		return errors.New("type is empty")
 	case "memory":
-		c.Spec = nil
-	case "zk":
-		conf := new(zk.ConnConfig)
-		if err := s.Spec.Unmarshal(conf); err != nil {
-			return err
-		}
-		c.Spec = conf
-	default:
-		c.Spec = nil
+		return errors.New("memory config store should only be used in tests")
+	}
+	if c.Spec == nil {
+		return fmt.Errorf("unsupported type %q", c.Type)
+	}
+	if err := c.Spec.(verifier).Verify(); err != nil {
+		return fmt.Errorf("spec: %v", err)
+	}
+	if c.SyncFreq <= 0 {
+		return errors.New("sync_freq should be positive")
 	}
 	return nil
 }
@@ -76,13 +122,28 @@ type Registry struct {
 	SyncJitter float64       `yaml:"sync_jitter"`
 }
 
+// newRegistrySpec returns the spec of the given service registry type, nil
+// if the type has no spec.
+func newRegistrySpec(typ string) interface{} {
+	switch typ {
+	case "zk":
+		return new(zk.ConnConfig)
+	default:
+		return nil
+	}
+}
+
 func (r *Registry) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s := struct {
 		Type       string        `yaml:"type"`
 		Spec       *RawMessage   `yaml:"spec"`
 		SyncFreq   time.Duration `yaml:"sync_freq"`
 		SyncJitter float64       `yaml:"sync_jitter"`
-	}{}
+	}{
+		Type:       r.Type,
+		SyncFreq:   r.SyncFreq,
+		SyncJitter: r.SyncJitter,
+	}
 	if err := unmarshal(&s); err != nil {
 		return err
 	}
@@ -93,33 +154,404 @@ func (r *Registry) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	// TODO: To improve the maintainability, we should unmarshal spec to
 	// the actual structure when intializes the corresponding service registry.
-	switch s.Type {
+	r.Spec = newRegistrySpec(s.Type)
+	if r.Spec != nil && s.Spec != nil {
+		return s.Spec.Unmarshal(r.Spec)
+	}
+	return nil
+}
+
+// Verify verifies the service registry.
+func (r *Registry) Verify() error {
+	switch r.Type {
+	case "":
+		return errors.New("type is empty")
 	case "memory":
-		r.Spec = nil
+		return errors.New("memory service registry should only be used in tests")
+	}
+	if r.Spec == nil {
+		return fmt.Errorf("unsupported type %q", r.Type)
+	}
+	if err := r.Spec.(verifier).Verify(); err != nil {
+		return fmt.Errorf("spec: %v", err)
+	}
+	if r.SyncFreq <= 0 {
+		return errors.New("sync_freq should be positive")
+	}
+	if r.SyncJitter < 0 || r.SyncJitter >= 1 {
+		return fmt.Errorf("invalid sync_jitter %v, should be in [0, 1)", r.SyncJitter)
+	}
+	return nil
+}
+
+type LeaderElection struct {
+	// Type is the backend of the election, the replica is always the leader
+	// with "local", which is only suitable for a single replica.
+	Type string      `yaml:"type"`
+	Spec interface{} `yaml:"spec"`
+	// ID identifies the replica, it's the hostname by default.
+	ID string `yaml:"id"`
+}
+
+// newLeaderElectionSpec returns the spec of the given leader election type,
+// nil if the type has no spec.
+func newLeaderElectionSpec(typ string) interface{} {
+	switch typ {
 	case "zk":
-		conf := new(zk.ConnConfig)
-		if err := s.Spec.Unmarshal(conf); err != nil {
-			return err
-		}
-		r.Spec = conf
+		return new(zk.ConnConfig)
 	default:
-		r.Spec = nil
+		return nil
+	}
+}
+
+func (e *LeaderElection) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	s := struct {
+		Type string      `yaml:"type"`
+		Spec *RawMessage `yaml:"spec"`
+		ID   string      `yaml:"id"`
+	}{
+		Type: e.Type,
+		ID:   e.ID,
+	}
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	e.Type = s.Type
+	e.ID = s.ID
+	e.Spec = newLeaderElectionSpec(s.Type)
+	if e.Spec != nil && s.Spec != nil {
+		return s.Spec.Unmarshal(e.Spec)
+	}
+	return nil
+}
+
+// Verify verifies the leader election.
+func (e *LeaderElection) Verify() error {
+	switch e.Type {
+	case "":
+		return errors.New("type is empty")
+	case "local":
+		return nil
+	}
+	if e.Spec == nil {
+		return fmt.Errorf("unsupported type %q", e.Type)
+	}
+	if err := e.Spec.(verifier).Verify(); err != nil {
+		return fmt.Errorf("spec: %v", err)
 	}
 	return nil
 }
 
 type API struct {
 	Bind string `yaml:"bind"`
+	// The timeouts of the http server, zero means no timeout. Note that the
+	// write timeout breaks the watch API if it's set.
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	TLS               TLS           `yaml:"tls"`
+}
+
+// Timeouts returns the timeouts of the http server.
+func (a *API) Timeouts() api.Timeouts {
+	return api.Timeouts{
+		Read:       a.ReadTimeout,
+		ReadHeader: a.ReadHeaderTimeout,
+		Write:      a.WriteTimeout,
+		Idle:       a.IdleTimeout,
+	}
+}
+
+// Verify verifies the api config.
+func (a *API) Verify() error {
+	if err := verifyBind(a.Bind); err != nil {
+		return fmt.Errorf("bind: %v", err)
+	}
+	if a.ReadTimeout < 0 || a.ReadHeaderTimeout < 0 || a.WriteTimeout < 0 || a.IdleTimeout < 0 {
+		return errors.New("timeouts should not be negative")
+	}
+	if err := a.TLS.Verify(); err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+	return nil
+}
+
+type TLS struct {
+	// CertFile and KeyFile are the PEM encoded certificate and key, TLS is
+	// disabled if both are empty. They are reloaded on SIGHUP.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled returns whether TLS is enabled.
+func (t *TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// Verify verifies the certificate could be loaded.
+func (t *TLS) Verify() error {
+	if !t.Enabled() {
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return errors.New("both cert_file and key_file are required")
+	}
+	_, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	return err
 }
 
 type Discovery struct {
 	Bind string `yaml:"bind"`
+	// DrainPeriod is how long to spread the closing of the discovery
+	// streams over on shutdown, zero means closing them at once.
+	DrainPeriod time.Duration `yaml:"drain_period"`
+	// Debounce is how long to merge the endpoint and config events before
+	// pushing them to the proxies, zero means pushing every event at once,
+	// which is the default.
+	Debounce time.Duration `yaml:"debounce"`
+	// Limits protects sash from the misbehaving proxies, zero means unlimited.
+	Limits DiscoveryLimits `yaml:"limits"`
+}
+
+type DiscoveryLimits struct {
+	// MaxStreams is the maximum number of concurrent streams.
+	MaxStreams int `yaml:"max_streams"`
+	// MaxStreamsPerIP is the maximum number of concurrent streams of a
+	// remote ip.
+	MaxStreamsPerIP int `yaml:"max_streams_per_ip"`
+	// MaxSubscriptions is the maximum number of services a stream could
+	// subscribe.
+	MaxSubscriptions int `yaml:"max_subscriptions"`
+	// SubscribeRate is the number of services a stream could subscribe per
+	// second, and SubscribeBurst is how many could be subscribed at once.
+	SubscribeRate  float64 `yaml:"subscribe_rate"`
+	SubscribeBurst int     `yaml:"subscribe_burst"`
+}
+
+// Verify verifies the limits.
+func (l *DiscoveryLimits) Verify() error {
+	if l.MaxStreams < 0 || l.MaxStreamsPerIP < 0 || l.MaxSubscriptions < 0 || l.SubscribeRate < 0 || l.SubscribeBurst < 0 {
+		return errors.New("should not be negative")
+	}
+	if l.SubscribeRate > 0 && l.SubscribeBurst < 1 {
+		return errors.New("subscribe_burst should be positive if subscribe_rate is set")
+	}
+	return nil
+}
+
+type XDS struct {
+	// Bind is the address of the envoy xDS server, it's disabled if empty.
+	Bind string `yaml:"bind"`
+}
+
+type Admin struct {
+	// Bind is the address of the admin server, it's disabled if empty.
+	Bind string `yaml:"bind"`
+}
+
+type Health struct {
+	// MaxStaleness is how long the service registry and the config store
+	// could be not synced before sash becomes unready, zero means no limit.
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+}
+
+type Tracing struct {
+	// Endpoint is the base url of the OTLP/HTTP collector, such as
+	// http://localhost:4318, tracing is disabled if empty.
+	Endpoint    string            `yaml:"endpoint"`
+	ServiceName string            `yaml:"service_name"`
+	SampleRatio float64           `yaml:"sample_ratio"`
+	Headers     map[string]string `yaml:"headers"`
+	Timeout     time.Duration     `yaml:"timeout"`
+}
+
+// Verify verifies the tracing config.
+func (t *Tracing) Verify() error {
+	if t.Endpoint != "" {
+		u, err := url.Parse(t.Endpoint)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid endpoint: %s", t.Endpoint)
+		}
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("invalid sample_ratio %v, should be in [0, 1]", t.SampleRatio)
+	}
+	return nil
+}
+
+type Validation struct {
+	// Dependencies is how to handle the dependencies on the services which
+	// are not in the service registry, could be off, warn or reject.
+	Dependencies   audit.Mode    `yaml:"dependencies"`
+	ReportInterval time.Duration `yaml:"report_interval"`
+}
+
+type Webhooks struct {
+	Targets    []*webhook.Target `yaml:"targets"`
+	Timeout    time.Duration     `yaml:"timeout"`
+	MaxRetries uint64            `yaml:"max_retries"`
 }
 
 type Bootstrap struct {
-	LogLevel    string      `yaml:"log_level"`
-	API         API         `yaml:"api"`
-	Discovery   Discovery   `yaml:"discovery"`
-	ConfigStore ConfigStore `yaml:"config_store"`
-	Registry    Registry    `yaml:"service_registry"`
+	// LogLevel is deprecated, use Log.Level instead.
+	LogLevel    string         `yaml:"log_level"`
+	Log         logger.Config  `yaml:"log"`
+	API         API            `yaml:"api"`
+	Discovery   Discovery      `yaml:"discovery"`
+	XDS         XDS            `yaml:"xds"`
+	Admin       Admin          `yaml:"admin"`
+	Health      Health         `yaml:"health"`
+	Tracing     Tracing        `yaml:"tracing"`
+	ConfigStore ConfigStore    `yaml:"config_store"`
+	Registry    Registry       `yaml:"service_registry"`
+	Leader      LeaderElection `yaml:"leader_election"`
+	Validation  Validation     `yaml:"validation"`
+	Webhooks    Webhooks       `yaml:"webhooks"`
+}
+
+func newBootstrap() *Bootstrap {
+	return &Bootstrap{
+		ConfigStore: ConfigStore{
+			SyncFreq: time.Second * 5,
+		},
+		Registry: Registry{
+			SyncFreq:   time.Second * 5,
+			SyncJitter: 0.1,
+		},
+		API:       API{Bind: ":8882"},
+		Discovery: Discovery{Bind: ":9090", DrainPeriod: time.Second * 10},
+		Admin:     Admin{Bind: "127.0.0.1:8883"},
+		Health:    Health{MaxStaleness: time.Minute},
+		Leader:    LeaderElection{Type: "local"},
+		Tracing: Tracing{
+			ServiceName: "sash",
+			SampleRatio: 1,
+			Timeout:     time.Second * 10,
+		},
+		Validation: Validation{
+			Dependencies:   audit.ModeWarn,
+			ReportInterval: time.Minute,
+		},
+		Webhooks: Webhooks{
+			Timeout:    time.Second * 10,
+			MaxRetries: 5,
+		},
+		LogLevel: "info",
+	}
+}
+
+// loadBootstrap loads the bootstrap from the file, which is overridden by the
+// SASH_* environment variables then. The unknown fields are rejected.
+func loadBootstrap(path string, environ []string) (*Bootstrap, error) {
+	b := newBootstrap()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.SetStrict(true)
+	// io.EOF means the file is empty.
+	if err = dec.Decode(b); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	if err = applyEnv(b, environ); err != nil {
+		return nil, err
+	}
+	if b.Log.Level == "" {
+		b.Log.Level = b.LogLevel
+	}
+	if err = b.Verify(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type verifier interface {
+	Verify() error
+}
+
+// verifyErrors is the problems of bootstrap, each one is prefixed with the
+// path of the field.
+type verifyErrors []error
+
+func (errs verifyErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func verifyBind(addr string) error {
+	if addr == "" {
+		return errors.New("address is empty")
+	}
+	_, _, err := net.SplitHostPort(addr)
+	return err
+}
+
+// Verify verifies the bootstrap, all the problems are reported at once.
+func (b *Bootstrap) Verify() error {
+	var errs verifyErrors
+	check := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", field, err))
+		}
+	}
+
+	check("log", b.Log.Verify())
+	check("api", b.API.Verify())
+	check("discovery.bind", verifyBind(b.Discovery.Bind))
+	if b.Discovery.DrainPeriod < 0 {
+		check("discovery.drain_period", errors.New("should not be negative"))
+	}
+	if b.Discovery.Debounce < 0 {
+		check("discovery.debounce", errors.New("should not be negative"))
+	}
+	check("discovery.limits", b.Discovery.Limits.Verify())
+	if b.XDS.Bind != "" {
+		check("xds.bind", verifyBind(b.XDS.Bind))
+	}
+	if b.Admin.Bind != "" {
+		check("admin.bind", verifyBind(b.Admin.Bind))
+	}
+	if b.Health.MaxStaleness < 0 {
+		check("health.max_staleness", errors.New("should not be negative"))
+	}
+	check("tracing", b.Tracing.Verify())
+	check("config_store", b.ConfigStore.Verify())
+	check("service_registry", b.Registry.Verify())
+	check("leader_election", b.Leader.Verify())
+	check("validation.dependencies", b.Validation.Dependencies.Verify())
+	if b.Validation.ReportInterval <= 0 {
+		check("validation.report_interval", errors.New("should be positive"))
+	}
+	names := make(map[string]struct{}, len(b.Webhooks.Targets))
+	for i, t := range b.Webhooks.Targets {
+		field := fmt.Sprintf("webhooks.targets[%d]", i)
+		if t == nil {
+			check(field, errors.New("is null"))
+			continue
+		}
+		if _, ok := names[t.Name]; ok {
+			check(field, fmt.Errorf("duplicate name: %s", t.Name))
+		}
+		names[t.Name] = struct{}{}
+		check(field, t.Verify())
+	}
+	if b.Webhooks.Timeout <= 0 {
+		check("webhooks.timeout", errors.New("should be positive"))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
 }
@@ -0,0 +1,258 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config/bolt"
+	"github.com/samaritan-proxy/sash/internal/zk"
+)
+
+const testBootstrap = `
+log:
+  level: debug
+api:
+  bind: ":8080"
+config_store:
+  type: zk
+  spec:
+    hosts: ["zk1:2181"]
+    base_path: /sash/config
+service_registry:
+  type: zk
+  spec:
+    hosts: ["zk1:2181"]
+    base_path: /service
+  sync_jitter: 0.2
+`
+
+func writeBootstrap(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "sash")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadBootstrap(t *testing.T) {
+	path, clean := writeBootstrap(t, testBootstrap)
+	defer clean()
+
+	b, err := loadBootstrap(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", b.Log.Level)
+	assert.Equal(t, ":8080", b.API.Bind)
+	assert.Equal(t, ":9090", b.Discovery.Bind)
+	assert.Equal(t, time.Second*10, b.Discovery.DrainPeriod)
+	assert.Equal(t, time.Duration(0), b.Discovery.Debounce)
+	assert.Equal(t, DiscoveryLimits{}, b.Discovery.Limits)
+	assert.Equal(t, "", b.XDS.Bind)
+	assert.Equal(t, "local", b.Leader.Type)
+	assert.Equal(t, &zk.ConnConfig{Hosts: []string{"zk1:2181"}, BasePath: "/sash/config"}, b.ConfigStore.Spec)
+	// the defaults are kept if not specified.
+	assert.Equal(t, time.Second*5, b.ConfigStore.SyncFreq)
+	assert.Equal(t, time.Second*5, b.Registry.SyncFreq)
+	assert.Equal(t, 0.2, b.Registry.SyncJitter)
+}
+
+func TestLoadBootstrapDeprecatedLogLevel(t *testing.T) {
+	path, clean := writeBootstrap(t, strings.Replace(testBootstrap, "log:\n  level: debug", "log_level: warn", 1))
+	defer clean()
+
+	b, err := loadBootstrap(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", b.Log.Level)
+}
+
+func TestLoadBootstrapUnknownField(t *testing.T) {
+	cases := []struct {
+		content string
+		field   string
+	}{
+		{content: testBootstrap + "foo: bar\n", field: "foo"},
+		{content: strings.Replace(testBootstrap, "bind:", "bnd:", 1), field: "bnd"},
+		{content: strings.Replace(testBootstrap, "base_path: /sash/config", "basepath: /sash/config", 1), field: "basepath"},
+	}
+	for _, c := range cases {
+		t.Run(c.field, func(t *testing.T) {
+			path, clean := writeBootstrap(t, c.content)
+			defer clean()
+
+			_, err := loadBootstrap(path, nil)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), c.field)
+		})
+	}
+}
+
+func TestLoadBootstrapInvalid(t *testing.T) {
+	content := `
+log:
+  level: verbose
+api:
+  bind: "8080"
+discovery:
+  drain_period: -1s
+  debounce: -1s
+  limits:
+    max_streams: -1
+xds:
+  bind: "9091"
+config_store:
+  type: zk
+  spec:
+    hosts: []
+service_registry:
+  type: etcd
+leader_election:
+  type: zk
+  spec:
+    hosts: ["zk1:2181"]
+tracing:
+  sample_ratio: 2
+webhooks:
+  targets:
+    - name: foo
+      url: http://example.com
+      events: ["*"]
+    - name: foo
+      url: http://example.com
+      events: ["*"]
+`
+	path, clean := writeBootstrap(t, content)
+	defer clean()
+
+	_, err := loadBootstrap(path, nil)
+	errs, ok := err.(verifyErrors)
+	assert.True(t, ok)
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		`log: invalid log level: "verbose"`,
+		"api: bind: address 8080: missing port in address",
+		"discovery.drain_period: should not be negative",
+		"discovery.debounce: should not be negative",
+		"discovery.limits: should not be negative",
+		"xds.bind: address 9091: missing port in address",
+		"tracing: invalid sample_ratio 2, should be in [0, 1]",
+		"config_store: spec: hosts is empty",
+		`service_registry: unsupported type "etcd"`,
+		"leader_election: spec: base_path is empty",
+		"webhooks.targets[1]: duplicate name: foo",
+	}, msgs)
+}
+
+func TestLoadBootstrapEmptyBasePath(t *testing.T) {
+	path, clean := writeBootstrap(t, strings.Replace(testBootstrap, "base_path: /service", "base_path: \"\"", 1))
+	defer clean()
+
+	_, err := loadBootstrap(path, nil)
+	assert.EqualError(t, err, "service_registry: spec: base_path is empty")
+}
+
+func TestDiscoveryLimitsVerify(t *testing.T) {
+	cases := []struct {
+		limits DiscoveryLimits
+		err    string
+	}{
+		{limits: DiscoveryLimits{}},
+		{limits: DiscoveryLimits{MaxStreams: 100, MaxStreamsPerIP: 4, MaxSubscriptions: 1000, SubscribeRate: 10, SubscribeBurst: 100}},
+		{limits: DiscoveryLimits{MaxSubscriptions: -1}, err: "should not be negative"},
+		{limits: DiscoveryLimits{SubscribeRate: -1}, err: "should not be negative"},
+		{limits: DiscoveryLimits{SubscribeRate: 10}, err: "subscribe_burst should be positive if subscribe_rate is set"},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case %d", i+1), func(t *testing.T) {
+			err := c.limits.Verify()
+			if c.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestLoadBootstrapEnv(t *testing.T) {
+	path, clean := writeBootstrap(t, testBootstrap)
+	defer clean()
+
+	b, err := loadBootstrap(path, []string{
+		"HOME=/root",
+		"SASH_API_BIND=:9000",
+		"SASH_ADMIN_BIND=",
+		"SASH_XDS_BIND=:9091",
+		"SASH_DISCOVERY_LIMITS_MAX_STREAMS_PER_IP=8",
+		"SASH_LOG_COMPONENTS={api: debug}",
+		"SASH_SERVICE_REGISTRY_SYNC_FREQ=10s",
+		"SASH_SERVICE_REGISTRY_SPEC_HOSTS=zk2:2181, zk3:2181",
+		"SASH_CONFIG_STORE_TYPE=bolt",
+		"SASH_CONFIG_STORE_SPEC_PATH=/data/sash.db",
+		"SASH_TRACING_SAMPLE_RATIO=0.5",
+		"SASH_LEADER_ELECTION_TYPE=zk",
+		"SASH_LEADER_ELECTION_SPEC={hosts: [zk1:2181], base_path: /sash/leader}",
+		"SASH_WEBHOOKS_TARGETS=[{name: foo, url: 'http://example.com', events: ['*']}]",
+		"SASH_UNKNOWN=foo",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", b.API.Bind)
+	assert.Equal(t, "", b.Admin.Bind)
+	assert.Equal(t, ":9091", b.XDS.Bind)
+	assert.Equal(t, 8, b.Discovery.Limits.MaxStreamsPerIP)
+	assert.Equal(t, map[string]string{"api": "debug"}, b.Log.Components)
+	assert.Equal(t, time.Second*10, b.Registry.SyncFreq)
+	assert.Equal(t, []string{"zk2:2181", "zk3:2181"}, b.Registry.Spec.(*zk.ConnConfig).Hosts)
+	assert.Equal(t, "/service", b.Registry.Spec.(*zk.ConnConfig).BasePath)
+	assert.Equal(t, &bolt.Config{Path: "/data/sash.db"}, b.ConfigStore.Spec)
+	assert.Equal(t, 0.5, b.Tracing.SampleRatio)
+	assert.Equal(t, &zk.ConnConfig{Hosts: []string{"zk1:2181"}, BasePath: "/sash/leader"}, b.Leader.Spec)
+	assert.Len(t, b.Webhooks.Targets, 1)
+	assert.Equal(t, "foo", b.Webhooks.Targets[0].Name)
+
+	_, err = loadBootstrap(path, []string{"SASH_REGISTRY_SYNC_FREQ=10s", "SASH_SERVICE_REGISTRY_SYNC_FREQ=soon"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SASH_SERVICE_REGISTRY_SYNC_FREQ")
+}
+
+func TestRunValidate(t *testing.T) {
+	path, clean := writeBootstrap(t, testBootstrap)
+	defer clean()
+
+	out := new(bytes.Buffer)
+	assert.Equal(t, 0, runValidate([]string{"-c", path}, nil, out))
+	assert.Equal(t, path+" is valid\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, runValidate([]string{"-c", path}, []string{"SASH_API_BIND=", "SASH_CONFIG_STORE_SYNC_FREQ=0s"}, out))
+	assert.Equal(t, path+" is invalid:\n  api: bind: address is empty\n  config_store: sync_freq should be positive\n", out.String())
+
+	out.Reset()
+	assert.Equal(t, 1, runValidate([]string{"-c", filepath.Join(filepath.Dir(path), "missing.yaml")}, nil, out))
+	assert.Contains(t, out.String(), "no such file or directory")
+
+	assert.Equal(t, 2, runValidate([]string{"-x"}, nil, ioutil.Discard))
+}
@@ -20,6 +20,8 @@ import (
 	"log"
 
 	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/bolt"
+	"github.com/samaritan-proxy/sash/config/file"
 	"github.com/samaritan-proxy/sash/config/zk"
 )
 
@@ -34,6 +36,10 @@ func initConfigController(b *Bootstrap) *config.Controller {
 		err = errors.New("memory config should only be used in tests")
 	case "zk":
 		store, err = zk.New(b.ConfigStore.Spec.(*zk.ConnConfig))
+	case "bolt":
+		store, err = bolt.New(b.ConfigStore.Spec.(*bolt.Config))
+	case "file":
+		store, err = file.New(b.ConfigStore.Spec.(*file.Config))
 	default:
 		err = fmt.Errorf("unsupported config store '%s'", typ)
 	}
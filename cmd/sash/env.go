@@ -0,0 +1,140 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+const envPrefix = "SASH"
+
+// applyEnv overrides the bootstrap with the SASH_* environment variables.
+// The name is the upper-cased path of the yaml keys joined by underscore,
+// such as SASH_API_BIND and SASH_CONFIG_STORE_SPEC_HOSTS. The value is in
+// YAML, the list of strings could also be comma separated.
+func applyEnv(b *Bootstrap, environ []string) error {
+	vars := make(map[string]string)
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv[:i], envPrefix+"_") {
+			continue
+		}
+		vars[kv[:i]] = kv[i+1:]
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	// The spec depends on the type, so the type is overridden first.
+	if typ, ok := vars["SASH_CONFIG_STORE_TYPE"]; ok && typ != b.ConfigStore.Type {
+		b.ConfigStore.Type, b.ConfigStore.Spec = typ, newConfigStoreSpec(typ)
+	}
+	if typ, ok := vars["SASH_SERVICE_REGISTRY_TYPE"]; ok && typ != b.Registry.Type {
+		b.Registry.Type, b.Registry.Spec = typ, newRegistrySpec(typ)
+	}
+	if typ, ok := vars["SASH_LEADER_ELECTION_TYPE"]; ok && typ != b.Leader.Type {
+		b.Leader.Type, b.Leader.Spec = typ, newLeaderElectionSpec(typ)
+	}
+
+	used := make(map[string]bool, len(vars))
+	if err := applyEnvTo(reflect.ValueOf(b).Elem(), envPrefix, vars, used); err != nil {
+		return err
+	}
+	var unknown []string
+	for name := range vars {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		logger.Warnf("Unknown environment variable %s is ignored", name)
+	}
+	return nil
+}
+
+func applyEnvTo(v reflect.Value, prefix string, vars map[string]string, used map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.PkgPath != "" || key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		fv := v.Field(i)
+		if s, ok := vars[name]; ok {
+			used[name] = true
+			if err := setEnvValue(fv, s); err != nil {
+				return fmt.Errorf("invalid environment variable %s: %v", name, err)
+			}
+			continue
+		}
+
+		// Descend into the struct, and the spec whose actual type is known.
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := applyEnvTo(fv, name, vars, used); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Interface && !fv.IsNil() &&
+			fv.Elem().Kind() == reflect.Ptr && fv.Elem().Elem().Kind() == reflect.Struct:
+			if err := applyEnvTo(fv.Elem().Elem(), name, vars, used); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setEnvValue(v reflect.Value, s string) error {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String &&
+		!strings.HasPrefix(strings.TrimSpace(s), "["):
+		items := reflect.MakeSlice(v.Type(), 0, 4)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(items)
+		return nil
+	}
+
+	// The spec is merged into its actual type.
+	if v.Kind() == reflect.Interface && !v.IsNil() && v.Elem().Kind() == reflect.Ptr {
+		return yaml.UnmarshalStrict([]byte(s), v.Elem().Interface())
+	}
+	ptr := reflect.New(v.Type())
+	// The struct is merged, e.g. the spec of the config store.
+	if v.Kind() == reflect.Struct {
+		ptr.Elem().Set(v)
+	}
+	if err := yaml.UnmarshalStrict([]byte(s), ptr.Interface()); err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/samaritan-proxy/sash/internal/zk"
+	"github.com/samaritan-proxy/sash/leader"
+)
+
+// initLeaderElector returns the elector and a function to release the
+// resources after the election stops.
+func initLeaderElector(b *Bootstrap) (*leader.Elector, func()) {
+	id := b.Leader.ID
+	if id == "" {
+		var err error
+		if id, err = os.Hostname(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var (
+		lock    leader.Lock
+		release = func() {}
+	)
+	switch typ := b.Leader.Type; typ {
+	case "local":
+		lock = leader.NewLocalLock()
+	case "zk":
+		cfg := b.Leader.Spec.(*zk.ConnConfig)
+		conn, err := zk.CreateConn(cfg, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lock, release = leader.NewZKLock(conn, cfg.BasePath), conn.Close
+	default:
+		log.Fatal(fmt.Errorf("unsupported leader election '%s'", typ))
+	}
+	return leader.NewElector(id, lock), release
+}
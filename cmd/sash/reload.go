@@ -0,0 +1,169 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/samaritan-proxy/sash/admin"
+	"github.com/samaritan-proxy/sash/api"
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+// reloader reloads the bootstrap file, and applies the changes which are
+// safe to be made in place. The others are reported, which take effect after
+// restarting.
+type reloader struct {
+	mu      sync.Mutex
+	path    string
+	environ func() []string
+	// cur is the bootstrap in effect.
+	cur *Bootstrap
+
+	reg  registry.Cache
+	cfg  *config.Controller
+	api  *api.Server
+	cert *certificate // nil if TLS is disabled.
+}
+
+func newReloader(path string, b *Bootstrap, reg registry.Cache, cfg *config.Controller, as *api.Server, cert *certificate) *reloader {
+	return &reloader{
+		path:    path,
+		environ: os.Environ,
+		cur:     b,
+		reg:     reg,
+		cfg:     cfg,
+		api:     as,
+		cert:    cert,
+	}
+}
+
+// Reload reloads the bootstrap, nothing is changed if it's invalid.
+func (r *reloader) Reload() (*admin.ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := loadBootstrap(r.path, r.environ())
+	if err != nil {
+		return nil, err
+	}
+	cur := *r.cur
+	res := &admin.ReloadResult{
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+	applied := func(field string) {
+		res.Applied = append(res.Applied, field)
+	}
+	changed := func(field string, old, new interface{}) bool {
+		if reflect.DeepEqual(old, new) {
+			return false
+		}
+		res.RestartRequired = append(res.RestartRequired, field)
+		return true
+	}
+
+	// The fallible ones go first, so nothing is changed if they fail. The
+	// key pair is loaded before reloading the logger, which is the last
+	// fallible one, and takes effect after that.
+	var cert *tls.Certificate
+	if r.cert != nil && b.API.TLS.Enabled() {
+		c, err := tls.LoadX509KeyPair(b.API.TLS.CertFile, b.API.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cert = &c
+	} else {
+		changed("api.tls", cur.API.TLS.Enabled(), b.API.TLS.Enabled())
+	}
+	if !reflect.DeepEqual(cur.Log, b.Log) {
+		if err := reloadLogger(&b.Log); err != nil {
+			return nil, err
+		}
+		cur.Log, cur.LogLevel = b.Log, b.LogLevel
+		applied("log")
+	}
+	if cert != nil {
+		if r.cert.Set(cert) {
+			applied("api.tls")
+		}
+		cur.API.TLS = b.API.TLS
+	}
+
+	if cur.Registry.SyncFreq != b.Registry.SyncFreq || cur.Registry.SyncJitter != b.Registry.SyncJitter {
+		r.reg.SetSyncFreq(b.Registry.SyncFreq, b.Registry.SyncJitter)
+		cur.Registry.SyncFreq, cur.Registry.SyncJitter = b.Registry.SyncFreq, b.Registry.SyncJitter
+		applied("service_registry.sync_freq")
+	}
+	if cur.ConfigStore.SyncFreq != b.ConfigStore.SyncFreq {
+		r.cfg.SetSyncInterval(b.ConfigStore.SyncFreq)
+		cur.ConfigStore.SyncFreq = b.ConfigStore.SyncFreq
+		applied("config_store.sync_freq")
+	}
+	if cur.API.Timeouts() != b.API.Timeouts() {
+		r.api.SetTimeouts(b.API.Timeouts())
+		cur.API.ReadTimeout, cur.API.ReadHeaderTimeout = b.API.ReadTimeout, b.API.ReadHeaderTimeout
+		cur.API.WriteTimeout, cur.API.IdleTimeout = b.API.WriteTimeout, b.API.IdleTimeout
+		applied("api.timeouts")
+	}
+
+	changed("api.bind", cur.API.Bind, b.API.Bind)
+	changed("discovery", cur.Discovery, b.Discovery)
+	changed("xds", cur.XDS, b.XDS)
+	changed("admin", cur.Admin, b.Admin)
+	changed("health", cur.Health, b.Health)
+	changed("tracing", cur.Tracing, b.Tracing)
+	changed("config_store.type", cur.ConfigStore.Type, b.ConfigStore.Type)
+	if cur.ConfigStore.Type == b.ConfigStore.Type {
+		changed("config_store.spec", cur.ConfigStore.Spec, b.ConfigStore.Spec)
+	}
+	changed("service_registry.type", cur.Registry.Type, b.Registry.Type)
+	if cur.Registry.Type == b.Registry.Type {
+		changed("service_registry.spec", cur.Registry.Spec, b.Registry.Spec)
+	}
+	changed("leader_election", cur.Leader, b.Leader)
+	changed("validation", cur.Validation, b.Validation)
+	changed("webhooks", cur.Webhooks, b.Webhooks)
+
+	r.cur = &cur
+	if len(res.Applied) > 0 {
+		logger.Infof("Bootstrap reloaded, applied: %v", res.Applied)
+	} else {
+		logger.Info("Bootstrap reloaded, nothing is applied")
+	}
+	if len(res.RestartRequired) > 0 {
+		logger.Warnf("Bootstrap changes which require restarting: %v", res.RestartRequired)
+	}
+	return res, nil
+}
+
+// reloadLogger applies the log config, the components which are not in the
+// config follow the global level again. Nothing is changed if it fails.
+func reloadLogger(c *logger.Config) error {
+	if err := logger.Init(c); err != nil {
+		return err
+	}
+	for name := range logger.ComponentLevels() {
+		if _, ok := c.Components[name]; !ok {
+			_ = logger.SetComponentLevel(name, "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/api"
+	"github.com/samaritan-proxy/sash/config"
+	cfgmem "github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/registry"
+	regmem "github.com/samaritan-proxy/sash/registry/memory"
+)
+
+func newTestReloader(t *testing.T, path string) *reloader {
+	b, err := loadBootstrap(path, nil)
+	assert.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	reg := registry.NewCache(regmem.NewRegistry())
+	ctl := config.NewController(cfgmem.NewStore())
+	r := newReloader(path, b, reg, ctl, api.New(l, reg, ctl), nil)
+	r.environ = func() []string { return nil }
+	return r
+}
+
+func TestReloaderReload(t *testing.T) {
+	path, clean := writeBootstrap(t, testBootstrap)
+	defer clean()
+	r := newTestReloader(t, path)
+	defer logger.SetLevel("info")
+
+	// nothing changed
+	res, err := r.Reload()
+	assert.NoError(t, err)
+	assert.Empty(t, res.Applied)
+	assert.Empty(t, res.RestartRequired)
+
+	content := strings.NewReplacer(
+		"level: debug", "level: warn",
+		`bind: ":8080"`, "bind: \":8081\"\n  read_timeout: 10s",
+		"base_path: /service", "base_path: /service2",
+		"sync_jitter: 0.2", "sync_jitter: 0.3",
+	).Replace(testBootstrap)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	res, err = r.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log", "service_registry.sync_freq", "api.timeouts"}, res.Applied)
+	assert.Equal(t, []string{"api.bind", "service_registry.spec"}, res.RestartRequired)
+	assert.Equal(t, "warn", logger.GetLevel())
+	assert.Equal(t, time.Second*10, r.cur.API.ReadTimeout)
+	// the restart-required ones are kept.
+	assert.Equal(t, ":8080", r.cur.API.Bind)
+
+	// reload again, the applied ones are not reported twice.
+	res, err = r.Reload()
+	assert.NoError(t, err)
+	assert.Empty(t, res.Applied)
+	assert.Equal(t, []string{"api.bind", "service_registry.spec"}, res.RestartRequired)
+}
+
+func TestReloaderReloadInvalid(t *testing.T) {
+	path, clean := writeBootstrap(t, testBootstrap)
+	defer clean()
+	r := newTestReloader(t, path)
+	cur := r.cur
+
+	content := strings.Replace(testBootstrap, "sync_jitter: 0.2", "sync_jitter: 2", 1)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	_, err := r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, cur, r.cur)
+}
+
+func TestReloaderReloadLoggerFailed(t *testing.T) {
+	path, clean := writeBootstrap(t, "")
+	defer clean()
+	certFile, keyFile := writeCertificate(t, filepath.Dir(path))
+	content := strings.Replace(testBootstrap, `bind: ":8080"`,
+		fmt.Sprintf("bind: \":8080\"\n  tls:\n    cert_file: %s\n    key_file: %s", certFile, keyFile), 1)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	r := newTestReloader(t, path)
+	cert, err := newCertificate(certFile, keyFile)
+	assert.NoError(t, err)
+	r.cert = cert
+	old, _ := cert.GetCertificate(nil)
+	cur := r.cur
+
+	// rotate the certificate, and break the log output.
+	writeCertificate(t, filepath.Dir(path))
+	content = strings.Replace(content, "level: debug", "level: debug\n  output: syslog\n  syslog:\n    addr: 127.0.0.1:99999", 1)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, cur, r.cur)
+	latest, _ := cert.GetCertificate(nil)
+	assert.Equal(t, old, latest)
+}
+
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "sash"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	assert.NoError(t, ioutil.WriteFile(certFile, certPem, 0644))
+	assert.NoError(t, ioutil.WriteFile(keyFile, keyPem, 0600))
+	return certFile, keyFile
+}
+
+func TestCertificateLoad(t *testing.T) {
+	path, clean := writeBootstrap(t, "")
+	defer clean()
+	dir := filepath.Dir(path)
+
+	certFile, keyFile := writeCertificate(t, dir)
+	c, err := newCertificate(certFile, keyFile)
+	assert.NoError(t, err)
+	old, err := c.GetCertificate(nil)
+	assert.NoError(t, err)
+
+	changed, err := c.Load(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// rotate
+	writeCertificate(t, dir)
+	changed, err = c.Load(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	cur, _ := c.GetCertificate(nil)
+	assert.NotEqual(t, old.Certificate[0], cur.Certificate[0])
+
+	// the current one is kept if failed.
+	_, err = c.Load(certFile, filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+	latest, _ := c.GetCertificate(nil)
+	assert.Equal(t, cur, latest)
+}
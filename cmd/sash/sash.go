@@ -17,102 +17,265 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/go-yaml/yaml"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/samaritan-proxy/sash/admin"
 	"github.com/samaritan-proxy/sash/api"
+	"github.com/samaritan-proxy/sash/audit"
 	"github.com/samaritan-proxy/sash/config"
 	"github.com/samaritan-proxy/sash/discovery"
+	"github.com/samaritan-proxy/sash/health"
+	"github.com/samaritan-proxy/sash/leader"
 	"github.com/samaritan-proxy/sash/logger"
 	"github.com/samaritan-proxy/sash/registry"
+	"github.com/samaritan-proxy/sash/rollout"
+	"github.com/samaritan-proxy/sash/tracing"
+	"github.com/samaritan-proxy/sash/watch"
+	"github.com/samaritan-proxy/sash/webhook"
+	"github.com/samaritan-proxy/sash/xds"
 )
 
 var (
-	b = &Bootstrap{
-		ConfigStore: ConfigStore{
-			SyncFreq: time.Second * 5,
-		},
-		Registry: Registry{
-			SyncFreq:   time.Second * 5,
-			SyncJitter: 0.1,
-		},
-		API:       API{Bind: ":8882"},
-		Discovery: Discovery{Bind: ":9090"},
-		LogLevel:  "info",
-	}
-
+	b          *Bootstrap
 	configFile string
 )
 
 func parseFlags() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage:\n  %[1]s [-c config.yaml]\n  %[1]s validate [-c config.yaml]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.StringVar(&configFile, "c", "./config.yaml", "config file")
 	flag.Parse()
 
-	f, err := os.Open(configFile)
+	var err error
+	if b, err = loadBootstrap(configFile, os.Environ()); err != nil {
+		logger.Fatalf("invalid bootstrap: %v", err)
+	}
+}
+
+func initTracer(b *Bootstrap) *sdktrace.TracerProvider {
+	if b.Tracing.Endpoint == "" {
+		return nil
+	}
+	tp, err := tracing.NewProvider(b.Tracing.Endpoint,
+		tracing.ServiceName(b.Tracing.ServiceName),
+		tracing.SampleRatio(b.Tracing.SampleRatio),
+		tracing.Headers(b.Tracing.Headers),
+		tracing.Timeout(b.Tracing.Timeout),
+	)
 	if err != nil {
-		logger.Fatal(err)
+		log.Fatal(err)
 	}
+	otel.SetTracerProvider(tp)
+	return tp
+}
 
-	if err = yaml.NewDecoder(f).Decode(&b); err != nil {
-		logger.Fatal(err)
+func initDiscoveryServer(b *Bootstrap, reg registry.Cache, cfg *config.Controller) *discovery.Server {
+	l, err := net.Listen("tcp", b.Discovery.Bind)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limits := b.Discovery.Limits
+	s := discovery.NewServer(l, reg, cfg,
+		discovery.Debounce(b.Discovery.Debounce),
+		discovery.MaxStreams(limits.MaxStreams, limits.MaxStreamsPerIP),
+		discovery.MaxSubscriptions(limits.MaxSubscriptions),
+		discovery.SubscribeRate(limits.SubscribeRate, limits.SubscribeBurst),
+	)
+	return s
+}
+
+func initXDSServer(b *Bootstrap, reg registry.Cache, cfg *config.Controller) *xds.Server {
+	if b.XDS.Bind == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", b.XDS.Bind)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return xds.NewServer(l, reg, cfg)
+}
 
-	// TODO: verify and fix the bootstrap info.
+func initWebhookDispatcher(b *Bootstrap, reg registry.Cache, cfg *config.Controller) *webhook.Dispatcher {
+	d := webhook.NewDispatcher(cfg,
+		webhook.StaticTargets(b.Webhooks.Targets...),
+		webhook.Client(&http.Client{Timeout: b.Webhooks.Timeout}),
+		webhook.Retry(time.Second, time.Minute, b.Webhooks.MaxRetries),
+	)
+	d.WatchConfig(cfg)
+	d.WatchRegistry(reg)
+	return d
 }
 
-func init() {
-	parseFlags()
+func initHealthChecker(b *Bootstrap, reg registry.Cache, cfg *config.Controller) *health.Checker {
+	c := health.NewChecker(health.MaxStaleness(b.Health.MaxStaleness))
+	c.Register("service_registry", reg)
+	c.Register("config_store", cfg)
+	return c
 }
 
-func initDiscoveryServer(b *Bootstrap, reg registry.Cache, cfg *config.Controller) *discovery.Server {
-	l, err := net.Listen("tcp", b.Discovery.Bind)
+func initAdminServer(b *Bootstrap, c *health.Checker, r *reloader) *admin.Server {
+	if b.Admin.Bind == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", b.Admin.Bind)
 	if err != nil {
 		log.Fatal(err)
 	}
-	s := discovery.NewServer(l, reg, cfg)
-	return s
+	return admin.New(l, c, admin.Reload(r.Reload))
 }
 
-func initAPIServer(b *Bootstrap, reg registry.Cache, cfg *config.Controller) *api.Server {
+func initAPIServer(b *Bootstrap, reg registry.Cache, cfg *config.Controller, rm *rollout.Manager, a *audit.Auditor, hub *watch.Hub, wd *webhook.Dispatcher, hc *health.Checker, le *leader.Elector, cert *certificate) *api.Server {
 	l, err := net.Listen("tcp", b.API.Bind)
 	if err != nil {
 		log.Fatal(err)
 	}
-	s := api.New(l, reg, cfg)
-	return s
+	opts := []api.ServerOption{
+		api.ReadTimeout(b.API.ReadTimeout),
+		api.ReadHeaderTimeout(b.API.ReadHeaderTimeout),
+		api.WriteTimeout(b.API.WriteTimeout),
+		api.IdleTimeout(b.API.IdleTimeout),
+		api.RolloutManager(rm),
+		api.DependencyValidation(b.Validation.Dependencies),
+		api.Auditor(a),
+		api.WatchHub(hub),
+		api.WebhookDispatcher(wd),
+		api.HealthChecker(hc),
+		api.LeaderElector(le),
+	}
+	if cert != nil {
+		opts = append(opts, api.TLSConfig(cert.TLSConfig()))
+	}
+	return api.New(l, reg, cfg, opts...)
+}
+
+func initCertificate(b *Bootstrap) *certificate {
+	if !b.API.TLS.Enabled() {
+		return nil
+	}
+	cert, err := newCertificate(b.API.TLS.CertFile, b.API.TLS.KeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cert
 }
 
 func main() {
-	logger.SetLevel(b.LogLevel)
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Environ(), os.Stdout))
+	}
+	parseFlags()
+
+	if err := logger.Init(&b.Log); err != nil {
+		logger.Fatal(err)
+	}
 	// TODO: make the print info more pretty
 	logger.Debugf("bootstrap: %+v", b)
 
+	if tp := initTracer(b); tp != nil {
+		// export the remaining spans.
+		defer func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				logger.Warnf("Failed to shutdown the tracer provider: %v", err)
+			}
+		}()
+	}
+
 	regCtl := initRegistryController(b)
 	cfgCtl := initConfigController(b)
 	ds := initDiscoveryServer(b, regCtl, cfgCtl)
-	as := initAPIServer(b, regCtl, cfgCtl)
+	xs := initXDSServer(b, regCtl, cfgCtl)
+	rm := rollout.NewManager(cfgCtl)
+	auditor := audit.NewAuditor(regCtl, cfgCtl, audit.Interval(b.Validation.ReportInterval))
+	// must watch before starting the config controller and registry cache.
+	hub := watch.NewHub()
+	hub.WatchConfig(cfgCtl)
+	hub.WatchRegistry(regCtl)
+	wd := initWebhookDispatcher(b, regCtl, cfgCtl)
+	hc := initHealthChecker(b, regCtl, cfgCtl)
+	// the rollouts and webhooks must run on exactly one replica.
+	le, closeElection := initLeaderElector(b)
+	le.Register("rollout", rm)
+	le.Register("webhook", wd)
+	cert := initCertificate(b)
+	as := initAPIServer(b, regCtl, cfgCtl, rm, auditor, hub, wd, hc, le, cert)
+	rl := newReloader(configFile, b, regCtl, cfgCtl, as, cert)
+	adm := initAdminServer(b, hc, rl)
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if err := cfgCtl.Start(); err != nil {
 		log.Fatal(err)
 	}
-	defer cfgCtl.Stop()
-	go regCtl.Run(ctx)
+	auditor.Start()
+	leCtx, stopElection := context.WithCancel(context.Background())
+	leDone := make(chan struct{})
+	go func() {
+		defer close(leDone)
+		le.Run(leCtx)
+	}()
+	regDone := make(chan struct{})
+	go func() {
+		defer close(regDone)
+		regCtl.Run(ctx)
+	}()
 	go ds.Serve()
+	if xs != nil {
+		go xs.Serve()
+	}
 	go as.Serve()
-	defer func() {
-		ds.Stop()
-		as.Shutdown()
-	}()
+	if adm != nil {
+		go adm.Serve()
+	}
 
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
-	s := <-signalCh
-	logger.Info("Signal received: ", s)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range signalCh {
+		logger.Info("Signal received: ", s)
+		if s != syscall.SIGHUP {
+			break
+		}
+		if _, err := rl.Reload(); err != nil {
+			logger.Warnf("Failed to reload the bootstrap: %v", err)
+		}
+	}
+
+	// Become unready and hand over the leadership first, then close the
+	// discovery streams gracefully while the API and admin servers still
+	// report the readiness. The consumers of the config controller and
+	// registry cache are stopped before them.
+	logger.Info("Shutting down...")
+	hc.Drain()
+	// the leader-only tasks are stopped before resigning.
+	stopElection()
+	<-leDone
+	closeElection()
+	if b.Discovery.DrainPeriod > 0 {
+		ds.Drain(b.Discovery.DrainPeriod)
+	} else {
+		ds.Stop()
+	}
+	if xs != nil {
+		xs.Stop()
+	}
+	as.Shutdown()
+	if adm != nil {
+		adm.Shutdown()
+	}
+	auditor.Stop()
+	cfgCtl.Stop()
 	cancel()
+	<-regDone
+	logger.Info("Shutdown completed")
 }
@@ -0,0 +1,63 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"sync/atomic"
+)
+
+// certificate holds the certificate which could be reloaded at runtime.
+type certificate struct {
+	cert atomic.Value // *tls.Certificate
+}
+
+func newCertificate(certFile, keyFile string) (*certificate, error) {
+	c := new(certificate)
+	if _, err := c.Load(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load loads the certificate from the files, and returns whether it has
+// changed. The current one is kept if failed.
+func (c *certificate) Load(certFile, keyFile string) (bool, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false, err
+	}
+	return c.Set(&cert), nil
+}
+
+// Set replaces the certificate, and returns whether it has changed.
+func (c *certificate) Set(cert *tls.Certificate) bool {
+	old, _ := c.cert.Load().(*tls.Certificate)
+	c.cert.Store(cert)
+	return old == nil || !bytes.Equal(old.Certificate[0], cert.Certificate[0])
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load().(*tls.Certificate), nil
+}
+
+// TLSConfig returns the tls config which always uses the latest certificate.
+func (c *certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: c.GetCertificate,
+	}
+}
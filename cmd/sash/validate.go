@@ -0,0 +1,46 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+)
+
+// runValidate implements `sash validate`, which checks the bootstrap without
+// starting any server, and returns the exit code.
+func runValidate(args, environ []string, w io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(w)
+	file := fs.String("c", "./config.yaml", "config file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := loadBootstrap(*file, environ); err != nil {
+		fmt.Fprintf(w, "%s is invalid:\n", *file)
+		errs, ok := err.(verifyErrors)
+		if !ok {
+			errs = verifyErrors{err}
+		}
+		for _, err := range errs {
+			fmt.Fprintf(w, "  %v\n", err)
+		}
+		return 1
+	}
+	fmt.Fprintf(w, "%s is valid\n", *file)
+	return 0
+}
@@ -0,0 +1,408 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+)
+
+// ArchiveVersion is the version of archive format.
+const ArchiveVersion = 1
+
+// Archive is a snapshot of all configs managed by sash, it's used to
+// migrate configs between config stores.
+type Archive struct {
+	Version    int       `json:"version"`
+	ExportTime time.Time `json:"export_time"`
+	// DefaultProxyConfig is the global default proxy config, nil if it's not set.
+	DefaultProxyConfig *service.Config         `json:"default_proxy_config,omitempty"`
+	Templates          ProxyConfigTemplates    `json:"templates"`
+	ProxyConfigs       ProxyConfigs            `json:"proxy_configs"`
+	Overrides          []*ProxyConfigOverrides `json:"overrides"`
+	Dependencies       Dependencies            `json:"dependencies"`
+	Instances          Instances               `json:"instances"`
+}
+
+// Verify this Archive.
+func (a *Archive) Verify() error {
+	if a.Version != ArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+	if a.DefaultProxyConfig != nil {
+		if err := a.DefaultProxyConfig.Validate(); err != nil {
+			return fmt.Errorf("default proxy config: %v", err)
+		}
+	}
+	for _, tpl := range a.Templates {
+		if err := tpl.Verify(); err != nil {
+			return fmt.Errorf("template %s: %v", tpl.Name, err)
+		}
+	}
+	for _, cfg := range a.ProxyConfigs {
+		if err := cfg.Verify(); err != nil {
+			return fmt.Errorf("proxy config %s: %v", cfg.ServiceName, err)
+		}
+	}
+	for _, ovrs := range a.Overrides {
+		if err := ovrs.Verify(); err != nil {
+			return fmt.Errorf("overrides %s: %v", ovrs.ServiceName, err)
+		}
+	}
+	for _, dep := range a.Dependencies {
+		if err := dep.Verify(); err != nil {
+			return fmt.Errorf("dependency %s: %v", dep.ServiceName, err)
+		}
+	}
+	for _, inst := range a.Instances {
+		if err := inst.Verify(); err != nil {
+			return fmt.Errorf("instance %s: %v", inst.ID, err)
+		}
+	}
+	return nil
+}
+
+// toCache converts the archive into the raw configs.
+func (a *Archive) toCache(c *Controller) (*Cache, error) {
+	cache := NewCache()
+	if a.DefaultProxyConfig != nil {
+		b, err := a.DefaultProxyConfig.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(c.defcfg.getNamespace(), c.defcfg.getType(), DefaultProxyConfigKey, b)
+	}
+	for _, tpl := range a.Templates {
+		b, err := c.proxycfg.marshallSvcCfg(tpl.Config)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(c.tpl.getNamespace(), c.tpl.getType(), tpl.Name, b)
+	}
+	for _, cfg := range a.ProxyConfigs {
+		b, err := c.proxycfg.marshallSvcCfg(cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(c.proxycfg.getNamespace(), c.proxycfg.getType(), cfg.ServiceName, b)
+		if len(cfg.Template) == 0 {
+			continue
+		}
+		if b, err = marshalTemplateName(cfg.Template); err != nil {
+			return nil, err
+		}
+		cache.Set(c.proxycfg.getNamespace(), TypeServiceProxyConfigTemplate, cfg.ServiceName, b)
+	}
+	for _, ovrs := range a.Overrides {
+		b, err := c.ovr.marshalOverrides(ovrs.Overrides)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(c.ovr.getNamespace(), c.ovr.getType(), ovrs.ServiceName, b)
+	}
+	for _, dep := range a.Dependencies {
+		b, err := c.dep.marshallDependency(dep.Dependencies)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(c.dep.getNamespace(), c.dep.getType(), dep.ServiceName, b)
+	}
+	for _, inst := range a.Instances {
+		b, err := c.inst.marshalInstance(inst)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(c.inst.getNamespace(), c.inst.getType(), inst.ID, b)
+	}
+	return cache, nil
+}
+
+// ImportMode represents how to apply the changes of import.
+type ImportMode string
+
+const (
+	// ImportTransactional rolls back all applied changes once any change fails.
+	ImportTransactional ImportMode = "transactional"
+	// ImportBestEffort applies as many changes as possible, and reports the failed ones.
+	ImportBestEffort ImportMode = "best-effort"
+)
+
+// ErrImportAborted is returned when a transactional import fails, all applied
+// changes have been rolled back.
+var ErrImportAborted = errors.New("import aborted, all changes have been rolled back")
+
+// ImportOptions contains the options of import.
+type ImportOptions struct {
+	// DryRun only computes the changes without applying them.
+	DryRun bool
+	// Mode is the way to apply the changes, defaults to ImportTransactional.
+	Mode ImportMode
+	// Prune deletes the configs which don't exist in the archive.
+	Prune bool
+}
+
+// ChangeOp is the operation of a change.
+type ChangeOp string
+
+const (
+	ChangeAdd    ChangeOp = "add"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// Change is a change of a single config performed by import.
+type Change struct {
+	Op        ChangeOp `json:"op"`
+	Namespace string   `json:"namespace"`
+	Type      string   `json:"type"`
+	Key       string   `json:"key"`
+	Error     string   `json:"error,omitempty"`
+
+	value []byte
+	prev  []byte
+}
+
+// ImportResult is the result of import.
+type ImportResult struct {
+	DryRun     bool       `json:"dry_run"`
+	Mode       ImportMode `json:"mode"`
+	Changes    []*Change  `json:"changes"`
+	Failed     int        `json:"failed"`
+	RolledBack bool       `json:"rolled_back,omitempty"`
+}
+
+// Export returns an archive of all configs in the store.
+func (c *Controller) Export() (*Archive, error) {
+	cache, err := c.fetchAll()
+	if err != nil {
+		return nil, err
+	}
+	archive := &Archive{
+		Version:      ArchiveVersion,
+		ExportTime:   time.Now(),
+		Templates:    ProxyConfigTemplates{},
+		ProxyConfigs: ProxyConfigs{},
+		Overrides:    []*ProxyConfigOverrides{},
+		Dependencies: Dependencies{},
+		Instances:    Instances{},
+	}
+	from := func(ns, typ string) func(string) ([]byte, error) {
+		return func(key string) ([]byte, error) { return cache.Get(ns, typ, key) }
+	}
+	keys := func(ns, typ string) []string {
+		keys, _ := cache.Keys(ns, typ)
+		sort.Strings(keys)
+		return keys
+	}
+
+	switch cfg, err := c.defcfg.get(cache.Get); err {
+	case nil:
+		archive.DefaultProxyConfig = cfg
+	case ErrNotExist:
+	default:
+		return nil, err
+	}
+	for _, name := range keys(c.tpl.getNamespace(), c.tpl.getType()) {
+		tpl, err := c.tpl.get(name, cache.Get)
+		if err != nil {
+			return nil, err
+		}
+		archive.Templates = append(archive.Templates, tpl)
+	}
+	for _, svc := range keys(c.proxycfg.getNamespace(), c.proxycfg.getType()) {
+		cfg, err := c.proxycfg.get(svc, cache.Get)
+		if err != nil {
+			return nil, err
+		}
+		archive.ProxyConfigs = append(archive.ProxyConfigs, cfg)
+	}
+	for _, svc := range keys(c.ovr.getNamespace(), c.ovr.getType()) {
+		ovrs, err := c.ovr.get(svc, cache.Get)
+		if err != nil {
+			return nil, err
+		}
+		archive.Overrides = append(archive.Overrides, ovrs)
+	}
+	for _, svc := range keys(c.dep.getNamespace(), c.dep.getType()) {
+		dep, err := c.dep.get(svc, from(c.dep.getNamespace(), c.dep.getType()))
+		if err != nil {
+			return nil, err
+		}
+		archive.Dependencies = append(archive.Dependencies, dep)
+	}
+	for _, id := range keys(c.inst.getNamespace(), c.inst.getType()) {
+		b, _ := cache.Get(c.inst.getNamespace(), c.inst.getType(), id)
+		inst, err := c.inst.unmarshalInstance(b)
+		if err != nil {
+			return nil, err
+		}
+		archive.Instances = append(archive.Instances, inst)
+	}
+	return archive, nil
+}
+
+// Import makes the store consistent with the archive. The changes are
+// computed by diffing the current configs with the archive, and are only
+// returned without applying if DryRun is set.
+func (c *Controller) Import(archive *Archive, opts ImportOptions) (*ImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportTransactional
+	}
+	switch opts.Mode {
+	case ImportTransactional, ImportBestEffort:
+	default:
+		return nil, fmt.Errorf("unknown import mode %s", opts.Mode)
+	}
+	if err := archive.Verify(); err != nil {
+		return nil, err
+	}
+	target, err := archive.toCache(c)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := c.fetchAll()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{
+		DryRun:  opts.DryRun,
+		Mode:    opts.Mode,
+		Changes: diffChanges(cur, target, opts.Prune),
+	}
+	if opts.DryRun || len(res.Changes) == 0 {
+		return res, nil
+	}
+	defer c.triggerUpdate()
+
+	for i, change := range res.Changes {
+		err := c.applyChange(change)
+		if err == nil {
+			continue
+		}
+		change.Error = err.Error()
+		res.Failed++
+		if opts.Mode == ImportBestEffort {
+			continue
+		}
+		c.rollback(res.Changes[:i])
+		res.RolledBack = true
+		return res, ErrImportAborted
+	}
+	return res, nil
+}
+
+// diffChanges returns the changes in order: adds, updates and deletes,
+// which are sorted by namespace, type and key respectively. Like
+// ProxyConfigsController.put, the templates are bound before writing the
+// proxy configs and unbound after that, so a partial proxy config is never
+// taken as a complete one in between. The unbinds of the proxy configs in
+// the archive are not pruning, so they are always applied.
+func diffChanges(cur, target *Cache, prune bool) []*Change {
+	add, update, del := cur.Diff(target)
+	var changes []*Change
+	appendChanges := func(op ChangeOp, cfgs []*RawConf) {
+		start := len(changes)
+		for _, cfg := range cfgs {
+			change := &Change{
+				Op:        op,
+				Namespace: cfg.Namespace,
+				Type:      cfg.Type,
+				Key:       cfg.Key,
+			}
+			switch op {
+			case ChangeAdd:
+				change.value = cfg.Value
+			case ChangeUpdate:
+				change.value = cfg.Value
+				change.prev, _ = cur.Get(cfg.Namespace, cfg.Type, cfg.Key)
+			case ChangeDelete:
+				change.prev = cfg.Value
+			}
+			changes = append(changes, change)
+		}
+		part := changes[start:]
+		sort.Slice(part, func(i, j int) bool {
+			a, b := part[i], part[j]
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			return a.Key < b.Key
+		})
+	}
+	appendChanges(ChangeAdd, add)
+	appendChanges(ChangeUpdate, update)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return isTemplateBinding(changes[i]) && !isTemplateBinding(changes[j])
+	})
+	if !prune {
+		var unbinds []*RawConf
+		for _, cfg := range del {
+			if cfg.Namespace != NamespaceService || cfg.Type != TypeServiceProxyConfigTemplate {
+				continue
+			}
+			if _, err := target.Get(NamespaceService, TypeServiceProxyConfig, cfg.Key); err == nil {
+				unbinds = append(unbinds, cfg)
+			}
+		}
+		del = unbinds
+	}
+	appendChanges(ChangeDelete, del)
+	return changes
+}
+
+// isTemplateBinding returns true if the change binds a template to a service.
+func isTemplateBinding(change *Change) bool {
+	return change.Op != ChangeDelete && change.Namespace == NamespaceService && change.Type == TypeServiceProxyConfigTemplate
+}
+
+func (c *Controller) applyChange(change *Change) error {
+	switch change.Op {
+	case ChangeAdd:
+		return c.store.Add(change.Namespace, change.Type, change.Key, change.value)
+	case ChangeUpdate:
+		return c.store.Update(change.Namespace, change.Type, change.Key, change.value)
+	case ChangeDelete:
+		return c.store.Del(change.Namespace, change.Type, change.Key)
+	default:
+		return fmt.Errorf("unknown change op %s", change.Op)
+	}
+}
+
+// rollback reverts the applied changes in reverse order.
+func (c *Controller) rollback(applied []*Change) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		change := applied[i]
+		var err error
+		switch change.Op {
+		case ChangeAdd:
+			err = c.store.Del(change.Namespace, change.Type, change.Key)
+		case ChangeUpdate:
+			err = c.store.Update(change.Namespace, change.Type, change.Key, change.prev)
+		case ChangeDelete:
+			err = c.store.Add(change.Namespace, change.Type, change.Key, change.prev)
+		}
+		if err != nil {
+			log.Warnf("Rollback %s %s/%s/%s failed: %v", change.Op, change.Namespace, change.Type, change.Key, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController_Export(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	deps := Dependencies{{ServiceName: "svc_1", Dependencies: []string{"svc_2"}}}
+	cfgs := ProxyConfigs{{ServiceName: "svc_2"}}
+	insts := Instances{{ID: "inst_1", BelongService: "svc_1"}}
+	c := NewController(genMockStore(t, ctrl, deps, cfgs, insts))
+
+	archive, err := c.Export()
+	assert.NoError(t, err)
+	assert.Equal(t, ArchiveVersion, archive.Version)
+	assert.Equal(t, deps, archive.Dependencies)
+	assert.Equal(t, cfgs, archive.ProxyConfigs)
+	assert.Equal(t, insts, archive.Instances)
+}
+
+func TestController_Import(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newController := func() *Controller {
+		return NewController(genMockStore(t, ctrl,
+			Dependencies{
+				{ServiceName: "svc_1", Dependencies: []string{"svc_2"}},
+				{ServiceName: "svc_2", Dependencies: []string{"svc_3"}},
+			},
+			nil,
+			Instances{{ID: "inst_1"}},
+		))
+	}
+	archive := &Archive{
+		Version: ArchiveVersion,
+		Dependencies: Dependencies{
+			{ServiceName: "svc_1", Dependencies: []string{"svc_3"}},
+			{ServiceName: "svc_3"},
+		},
+		Instances: Instances{{ID: "inst_1"}},
+	}
+	expectedChanges := []*Change{
+		{Op: ChangeAdd, Namespace: NamespaceService, Type: TypeServiceDependency, Key: "svc_3"},
+		{Op: ChangeUpdate, Namespace: NamespaceService, Type: TypeServiceDependency, Key: "svc_1"},
+		{Op: ChangeDelete, Namespace: NamespaceService, Type: TypeServiceDependency, Key: "svc_2"},
+	}
+	assertChanges := func(t *testing.T, expected, actual []*Change) {
+		assert.Len(t, actual, len(expected))
+		for i := range expected {
+			assert.Equal(t, expected[i].Op, actual[i].Op)
+			assert.Equal(t, expected[i].Key, actual[i].Key)
+		}
+	}
+
+	t.Run("invalid archive", func(t *testing.T) {
+		c := newController()
+		_, err := c.Import(&Archive{Version: 0}, ImportOptions{})
+		assert.Error(t, err)
+		_, err = c.Import(archive, ImportOptions{Mode: "foo"})
+		assert.Error(t, err)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		c := newController()
+		res, err := c.Import(archive, ImportOptions{DryRun: true, Prune: true})
+		assert.NoError(t, err)
+		assert.True(t, res.DryRun)
+		assertChanges(t, expectedChanges, res.Changes)
+		// nothing is changed
+		assert.False(t, c.Exist(NamespaceService, TypeServiceDependency, "svc_3"))
+		assert.True(t, c.Exist(NamespaceService, TypeServiceDependency, "svc_2"))
+	})
+
+	t.Run("without prune", func(t *testing.T) {
+		c := newController()
+		res, err := c.Import(archive, ImportOptions{})
+		assert.NoError(t, err)
+		assertChanges(t, expectedChanges[:2], res.Changes)
+		assert.True(t, c.Exist(NamespaceService, TypeServiceDependency, "svc_2"))
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		c := newController()
+		res, err := c.Import(archive, ImportOptions{Prune: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, res.Failed)
+		dep, err := c.Dependencies().Get("svc_1")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"svc_3"}, dep.Dependencies)
+		assert.True(t, c.Exist(NamespaceService, TypeServiceDependency, "svc_3"))
+		assert.False(t, c.Exist(NamespaceService, TypeServiceDependency, "svc_2"))
+	})
+}
+
+func TestController_ImportTemplateBindings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewController(genMockStore(t, ctrl, nil, nil, nil))
+	tpl := newTestTemplate()
+	assert.NoError(t, c.Templates().Add(tpl))
+	assert.NoError(t, c.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc_1", Config: tpl.Config}))
+	assert.NoError(t, c.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc_2", Template: "tpl"}))
+
+	archive := &Archive{
+		Version:   ArchiveVersion,
+		Templates: ProxyConfigTemplates{tpl},
+		ProxyConfigs: ProxyConfigs{
+			{ServiceName: "svc_1", Template: "tpl"},
+			{ServiceName: "svc_2", Config: tpl.Config},
+			{ServiceName: "svc_3", Template: "tpl"},
+		},
+	}
+	res, err := c.Import(archive, ImportOptions{})
+	assert.NoError(t, err)
+	// bind svc_1 and svc_3 before writing their partial configs, unbind
+	// svc_2 after writing its complete config.
+	expected := []*Change{
+		{Op: ChangeAdd, Type: TypeServiceProxyConfigTemplate, Key: "svc_1"},
+		{Op: ChangeAdd, Type: TypeServiceProxyConfigTemplate, Key: "svc_3"},
+		{Op: ChangeAdd, Type: TypeServiceProxyConfig, Key: "svc_3"},
+		{Op: ChangeUpdate, Type: TypeServiceProxyConfig, Key: "svc_1"},
+		{Op: ChangeUpdate, Type: TypeServiceProxyConfig, Key: "svc_2"},
+		{Op: ChangeDelete, Type: TypeServiceProxyConfigTemplate, Key: "svc_2"},
+	}
+	assert.Len(t, res.Changes, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].Op, res.Changes[i].Op)
+		assert.Equal(t, expected[i].Type, res.Changes[i].Type)
+		assert.Equal(t, expected[i].Key, res.Changes[i].Key)
+	}
+
+	cfg, err := c.ProxyConfigs().Get("svc_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "tpl", cfg.Template)
+	cfg, err = c.ProxyConfigs().Get("svc_2")
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Template)
+}
+
+func TestController_ImportWithError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	archive := &Archive{
+		Version: ArchiveVersion,
+		Dependencies: Dependencies{
+			{ServiceName: "svc_1"},
+			{ServiceName: "svc_2"},
+		},
+	}
+	newStore := func() *MockStore {
+		s := NewMockStore(ctrl)
+		s.EXPECT().GetKeys(gomock.Any(), gomock.Any()).Return(nil, ErrNotExist).AnyTimes()
+		s.EXPECT().Add(NamespaceService, TypeServiceDependency, "svc_1", gomock.Any()).Return(nil)
+		s.EXPECT().Add(NamespaceService, TypeServiceDependency, "svc_2", gomock.Any()).Return(errors.New("err"))
+		return s
+	}
+
+	t.Run("transactional", func(t *testing.T) {
+		s := newStore()
+		s.EXPECT().Del(NamespaceService, TypeServiceDependency, "svc_1").Return(nil)
+		c := NewController(s)
+		res, err := c.Import(archive, ImportOptions{Mode: ImportTransactional})
+		assert.Equal(t, ErrImportAborted, err)
+		assert.True(t, res.RolledBack)
+		assert.Equal(t, 1, res.Failed)
+		assert.Equal(t, "err", res.Changes[1].Error)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		c := NewController(newStore())
+		res, err := c.Import(archive, ImportOptions{Mode: ImportBestEffort})
+		assert.NoError(t, err)
+		assert.False(t, res.RolledBack)
+		assert.Equal(t, 1, res.Failed)
+		assert.Empty(t, res.Changes[0].Error)
+		assert.Equal(t, "err", res.Changes[1].Error)
+	})
+}
@@ -0,0 +1,335 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+const defaultOpenTimeout = time.Second
+
+// Config contains all configurations of the bolt store.
+type Config struct {
+	// Path is the location of the database file, it will be created if not exist.
+	Path string `yaml:"path"`
+	// Timeout is the amount of time to wait to obtain the file lock.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Verify verifies the config.
+func (c *Config) Verify() error {
+	if c.Path == "" {
+		return errors.New("path is empty")
+	}
+	return nil
+}
+
+// Store is an implementation of config.SubscribableStore which persists
+// all configs into a local bolt database file. It's designed for the
+// single-node deployment, the data can't be shared between multiple processes.
+//
+// Configs are stored in nested buckets: namespace -> type -> key.
+type Store struct {
+	sync.RWMutex
+	cfg *Config
+	db  *bbolt.DB
+
+	evtCh       chan struct{}
+	subscribeNS map[string]struct{}
+}
+
+// New opens the database file and returns a new Store.
+func New(cfg *Config) (*Store, error) {
+	if cfg == nil || cfg.Path == "" {
+		return nil, errors.New("empty database path")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOpenTimeout
+	}
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		cfg:         cfg,
+		db:          db,
+		evtCh:       make(chan struct{}, 1),
+		subscribeNS: make(map[string]struct{}),
+	}, nil
+}
+
+// rename is replaceable for testing.
+var rename = os.Rename
+
+func open(cfg *Config) (*bbolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, err
+	}
+	return bbolt.Open(cfg.Path, 0600, &bbolt.Options{Timeout: cfg.Timeout})
+}
+
+// typeBucket returns the bucket of given namespace and type, nil if not exist.
+func typeBucket(tx *bbolt.Tx, namespace, typ string) *bbolt.Bucket {
+	ns := tx.Bucket([]byte(namespace))
+	if ns == nil {
+		return nil
+	}
+	return ns.Bucket([]byte(typ))
+}
+
+func (s *Store) Get(namespace, typ, key string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var value []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := typeBucket(tx, namespace, typ)
+		if b == nil {
+			return config.ErrNotExist
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return config.ErrNotExist
+		}
+		// The returned value is only valid in the life of transaction.
+		if len(v) > 0 {
+			value = make([]byte, len(v))
+			copy(value, v)
+		}
+		return nil
+	})
+	return value, err
+}
+
+func (s *Store) put(namespace, typ, key string, value []byte, expectExist bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		ns, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		if err != nil {
+			return err
+		}
+		b, err := ns.CreateBucketIfNotExists([]byte(typ))
+		if err != nil {
+			return err
+		}
+		exist := b.Get([]byte(key)) != nil
+		switch {
+		case exist && !expectExist:
+			return config.ErrExist
+		case !exist && expectExist:
+			return config.ErrNotExist
+		}
+		// bolt treats nil value as non-existent key, so store an empty one.
+		if value == nil {
+			value = []byte{}
+		}
+		return b.Put([]byte(key), value)
+	})
+	if err != nil {
+		return err
+	}
+	s.notify(namespace)
+	return nil
+}
+
+func (s *Store) Add(namespace, typ, key string, value []byte) error {
+	return s.put(namespace, typ, key, value, false)
+}
+
+func (s *Store) Update(namespace, typ, key string, value []byte) error {
+	return s.put(namespace, typ, key, value, true)
+}
+
+func (s *Store) Del(namespace, typ, key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		ns := tx.Bucket([]byte(namespace))
+		if ns == nil {
+			return config.ErrNotExist
+		}
+		b := ns.Bucket([]byte(typ))
+		if b == nil || b.Get([]byte(key)) == nil {
+			return config.ErrNotExist
+		}
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		// remove the empty buckets to keep consistent with config.Cache
+		if k, _ := b.Cursor().First(); k != nil {
+			return nil
+		}
+		if err := ns.DeleteBucket([]byte(typ)); err != nil {
+			return err
+		}
+		if k, _ := ns.Cursor().First(); k != nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(namespace))
+	})
+	if err != nil {
+		return err
+	}
+	s.notify(namespace)
+	return nil
+}
+
+func (s *Store) Exist(namespace, typ, key string) bool {
+	_, err := s.Get(namespace, typ, key)
+	return err == nil
+}
+
+func (s *Store) GetKeys(namespace, typ string) ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var keys []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := typeBucket(tx, namespace, typ)
+		if b == nil {
+			return config.ErrNotExist
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// notify must be called with the lock held.
+func (s *Store) notify(namespace string) {
+	if _, ok := s.subscribeNS[namespace]; !ok {
+		return
+	}
+	// The event only indicates there are some changes, merge it if
+	// the previous one is not consumed.
+	select {
+	case s.evtCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Store) Subscribe(namespace string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.subscribeNS[namespace] = struct{}{}
+	return nil
+}
+
+func (s *Store) UnSubscribe(namespace string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.subscribeNS, namespace)
+	return nil
+}
+
+func (s *Store) Event() <-chan struct{} {
+	return s.evtCh
+}
+
+// Backup writes a consistent snapshot of the database into w, it could
+// be executed while the store is serving.
+func (s *Store) Backup(w io.Writer) error {
+	s.RLock()
+	defer s.RUnlock()
+	return s.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+// Restore replaces the whole database with the snapshot read from r,
+// the snapshot must be produced by Backup.
+func (s *Store) Restore(r io.Reader) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// write to a temporary file in the same directory to make sure the
+	// rename is atomic.
+	f, err := ioutil.TempFile(filepath.Dir(s.cfg.Path), filepath.Base(s.cfg.Path)+".restore-")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+	sr := &snapshotReader{r: r}
+	_, err = io.Copy(f, sr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if sr.err != nil {
+		return fmt.Errorf("%w: %v", config.ErrInvalidSnapshot, sr.err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// open the snapshot before replacing, which verifies it as well. The
+	// handle follows the file after renaming, so the original one is kept
+	// serving until the new file is in place.
+	db, err := bbolt.Open(tmpPath, 0600, &bbolt.Options{Timeout: s.cfg.Timeout})
+	if err != nil {
+		return fmt.Errorf("%w: %v", config.ErrInvalidSnapshot, err)
+	}
+	if err = rename(tmpPath, s.cfg.Path); err != nil {
+		_ = db.Close()
+		return err
+	}
+	_ = s.db.Close()
+	s.db = db
+
+	for ns := range s.subscribeNS {
+		s.notify(ns)
+	}
+	return nil
+}
+
+// snapshotReader records the error of reading the snapshot, to tell it
+// from the one of writing the temporary file.
+type snapshotReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (s *Store) Start() error { return nil }
+
+func (s *Store) Stop() {
+	s.Lock()
+	defer s.Unlock()
+	_ = s.db.Close()
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "sash-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(&Config{Path: filepath.Join(dir, "sash.db")})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Start())
+	return s, func() {
+		s.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+	_, err = New(&Config{})
+	assert.Error(t, err)
+}
+
+func TestGetAndAdd(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Add("a", "b", "c", []byte("hello")))
+	assert.Equal(t, config.ErrExist, s.Add("a", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Add("a", "b", "empty", nil))
+
+	b, err := s.Get("a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), b)
+
+	b, err = s.Get("a", "b", "empty")
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+
+	assert.True(t, s.Exist("a", "b", "c"))
+	assert.False(t, s.Exist("a", "d", "c"))
+
+	t.Run("bad key", func(t *testing.T) {
+		_, err := s.Get("a", "b", "foo")
+		assert.Equal(t, config.ErrNotExist, err)
+	})
+
+	t.Run("bad type", func(t *testing.T) {
+		_, err = s.Get("a", "foo", "c")
+		assert.Equal(t, config.ErrNotExist, err)
+	})
+
+	t.Run("bad namespace", func(t *testing.T) {
+		_, err = s.Get("foo", "b", "c")
+		assert.Equal(t, config.ErrNotExist, err)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.Equal(t, config.ErrNotExist, s.Update("a", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Add("a", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Update("a", "b", "c", []byte("hi")))
+	b, err := s.Get("a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hi"), b)
+}
+
+func TestDel(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.Equal(t, config.ErrNotExist, s.Del("a", "b", "c"))
+	assert.NoError(t, s.Add("a", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Add("a", "d", "c", []byte("hello")))
+	assert.NoError(t, s.Del("a", "b", "c"))
+	assert.False(t, s.Exist("a", "b", "c"))
+
+	// the empty type should be removed.
+	_, err := s.GetKeys("a", "b")
+	assert.Equal(t, config.ErrNotExist, err)
+	assert.True(t, s.Exist("a", "d", "c"))
+}
+
+func TestGetKeys(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		assert.NoError(t, s.Add("ns", "type", key, nil))
+	}
+	_, err := s.GetKeys("foo", "foo")
+	assert.Equal(t, config.ErrNotExist, err)
+	_, err = s.GetKeys("ns", "foo")
+	assert.Equal(t, config.ErrNotExist, err)
+	ks, err := s.GetKeys("ns", "type")
+	assert.NoError(t, err)
+	sort.Strings(ks)
+	assert.Equal(t, keys, ks)
+}
+
+func TestSubscribeAndUnSubscribe(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Add("ns1", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Add("ns2", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Subscribe("ns1"))
+	assert.NoError(t, s.Update("ns1", "b", "c", []byte("hi")))
+	assert.NoError(t, s.Update("ns1", "b", "c", []byte("hey")))
+	assert.NoError(t, s.Update("ns2", "b", "c", []byte("hi")))
+	// the events should be merged.
+	assert.Len(t, s.Event(), 1)
+	<-s.Event()
+	assert.Len(t, s.Event(), 0)
+
+	assert.NoError(t, s.UnSubscribe("ns1"))
+	assert.NoError(t, s.Update("ns1", "b", "c", []byte("hello")))
+	assert.NoError(t, s.Update("ns2", "b", "c", []byte("hello")))
+	assert.Len(t, s.Event(), 0)
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sash-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &Config{Path: filepath.Join(dir, "sash.db")}
+
+	s, err := New(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Add("a", "b", "c", []byte("hello")))
+	s.Stop()
+
+	s, err = New(cfg)
+	assert.NoError(t, err)
+	defer s.Stop()
+	b, err := s.Get("a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), b)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Add("a", "b", "c", []byte("hello")))
+	buf := new(bytes.Buffer)
+	assert.NoError(t, s.Backup(buf))
+
+	assert.NoError(t, s.Del("a", "b", "c"))
+	assert.NoError(t, s.Add("a", "b", "d", []byte("world")))
+	assert.NoError(t, s.Subscribe("a"))
+
+	t.Run("bad snapshot", func(t *testing.T) {
+		err := s.Restore(bytes.NewReader([]byte("foo")))
+		assert.True(t, errors.Is(err, config.ErrInvalidSnapshot))
+		// the original data should be kept.
+		assert.True(t, s.Exist("a", "b", "d"))
+	})
+
+	t.Run("read failed", func(t *testing.T) {
+		r := io.MultiReader(bytes.NewReader(buf.Bytes()), iotest.ErrReader(errors.New("read failed")))
+		err := s.Restore(r)
+		assert.True(t, errors.Is(err, config.ErrInvalidSnapshot))
+		assert.True(t, s.Exist("a", "b", "d"))
+	})
+
+	t.Run("rename failed", func(t *testing.T) {
+		rename = func(string, string) error { return errors.New("rename failed") }
+		defer func() { rename = os.Rename }()
+		assert.EqualError(t, s.Restore(bytes.NewReader(buf.Bytes())), "rename failed")
+		// the original one should be kept serving.
+		assert.True(t, s.Exist("a", "b", "d"))
+		assert.NoError(t, s.Add("a", "b", "e", []byte("foo")))
+		assert.NoError(t, s.Del("a", "b", "e"))
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		assert.NoError(t, s.Restore(buf))
+		b, err := s.Get("a", "b", "c")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hello"), b)
+		assert.False(t, s.Exist("a", "b", "d"))
+		assert.Len(t, s.Event(), 1)
+	})
+}
@@ -17,7 +17,6 @@ package config
 import (
 	"fmt"
 	"hash/fnv"
-	"log"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,7 +15,9 @@
 package config
 
 import (
+	"context"
 	"errors"
+	"io"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -26,18 +28,30 @@ import (
 	"github.com/samaritan-proxy/sash/utils"
 )
 
+var log = logger.Component("config")
+
 const (
-	NamespaceService       = "service"
-	TypeServiceProxyConfig = "proxy-config"
-	TypeServiceDependency  = "dependency"
+	NamespaceService               = "service"
+	TypeServiceProxyConfig         = "proxy-config"
+	TypeServiceProxyConfigTemplate = "proxy-config-template"
+	TypeServiceProxyConfigOverride = "proxy-config-override"
+	TypeServiceDependency          = "dependency"
 
 	NamespaceSamaritan    = "samaritan"
 	TypeSamaritanInstance = "instance"
+
+	NamespaceTemplate       = "template"
+	TypeTemplateProxyConfig = "proxy-config"
+
+	NamespaceGlobal       = "global"
+	TypeGlobalProxyConfig = "proxy-config"
 )
 
 var InterestedNSAndType = map[string][]string{
-	NamespaceService:   {TypeServiceProxyConfig, TypeServiceDependency},
+	NamespaceService:   {TypeServiceProxyConfig, TypeServiceProxyConfigTemplate, TypeServiceProxyConfigOverride, TypeServiceDependency},
 	NamespaceSamaritan: {TypeSamaritanInstance},
+	NamespaceTemplate:  {TypeTemplateProxyConfig},
+	NamespaceGlobal:    {TypeGlobalProxyConfig},
 }
 
 var (
@@ -74,13 +88,21 @@ type Controller struct {
 	options *controllerOptions
 	store   Store
 
-	cache    atomic.Value // *Config
-	updateCh chan struct{}
-	evtHdls  atomic.Value //[]EventHandler
+	cache      atomic.Value // *Config
+	updateCh   chan struct{}
+	intervalCh chan time.Duration
+	evtHdls    atomic.Value //[]EventHandler
+	lastSync   atomic.Value // time.Time
+
+	tracesMu sync.Mutex
+	traces   map[string]*pendingTrace
 
 	dep      *DependenciesController
 	inst     *InstancesController
 	proxycfg *ProxyConfigsController
+	tpl      *ProxyConfigTemplatesController
+	defcfg   *DefaultProxyConfigController
+	ovr      *ProxyConfigOverridesController
 
 	initFinish bool
 	stop       chan struct{}
@@ -95,15 +117,20 @@ func NewController(store Store, opts ...controllerOption) *Controller {
 	}
 
 	c := &Controller{
-		store:    store,
-		options:  o,
-		updateCh: make(chan struct{}, 1),
-		stop:     make(chan struct{}),
-		cache:    atomic.Value{},
+		store:      store,
+		options:    o,
+		updateCh:   make(chan struct{}, 1),
+		intervalCh: make(chan time.Duration, 1),
+		stop:       make(chan struct{}),
+		cache:      atomic.Value{},
+		traces:     make(map[string]*pendingTrace),
 	}
 	c.dep = newDependenciesController(c)
 	c.inst = newInstancesController(c)
 	c.proxycfg = newProxyConfigController(c)
+	c.tpl = newProxyConfigTemplatesController(c)
+	c.defcfg = newDefaultProxyConfigController(c)
+	c.ovr = newProxyConfigOverridesController(c)
 	return c
 }
 
@@ -119,6 +146,18 @@ func (c *Controller) ProxyConfigs() *ProxyConfigsController {
 	return c.proxycfg
 }
 
+func (c *Controller) Templates() *ProxyConfigTemplatesController {
+	return c.tpl
+}
+
+func (c *Controller) DefaultProxyConfig() *DefaultProxyConfigController {
+	return c.defcfg
+}
+
+func (c *Controller) ProxyConfigOverrides() *ProxyConfigOverridesController {
+	return c.ovr
+}
+
 func (c *Controller) loadCache() *Cache {
 	cache, _ := c.cache.Load().(*Cache)
 	return cache
@@ -276,6 +315,10 @@ func (c *Controller) triggerLoop() {
 		select {
 		case <-c.stop:
 			return
+		case interval := <-c.intervalCh:
+			ticker.Stop()
+			ticker = time.NewTicker(interval)
+			continue
 		case <-ticker.C:
 		case <-ch:
 		}
@@ -283,6 +326,29 @@ func (c *Controller) triggerLoop() {
 	}
 }
 
+// SetSyncInterval changes the interval of syncing from the store, it takes
+// effect immediately even if the controller is running.
+func (c *Controller) SetSyncInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for {
+		select {
+		case c.intervalCh <- interval:
+			return
+		default:
+		}
+		// drop the pending one which is stale.
+		select {
+		case <-c.intervalCh:
+		default:
+		}
+	}
+}
+
+// diffCache replaces the current cache with the new one, and dispatches
+// the differences. The handlers could read the new cache to resolve the
+// configs which depend on each other.
 func (c *Controller) diffCache(that *Cache) {
 	cur := c.loadCache()
 	if cur == nil {
@@ -290,7 +356,11 @@ func (c *Controller) diffCache(that *Cache) {
 	}
 
 	add, update, del := cur.Diff(that)
+	c.storeCache(that)
 	dispatchEvent := func(event *Event) {
+		eventsTotal.WithLabelValues(event.Config.Namespace, event.Config.Type, event.Type.String()).Inc()
+		span := c.startDispatchSpan(event)
+		defer span.End()
 		for _, hdl := range c.loadEvtHdls() {
 			hdl(event)
 		}
@@ -313,17 +383,28 @@ func (c *Controller) loop() {
 		case <-c.stop:
 			return
 		case <-c.updateCh:
+			startTime := time.Now()
 			newConf, err := c.fetchAll()
+			fetchDuration.Observe(time.Since(startTime).Seconds())
 			if err != nil {
-				logger.Warnf("failed to load config, err: %v", err)
+				fetchErrors.Inc()
+				log.Warnf("failed to load config, err: %v", err)
 				continue
 			}
+			lastFetchSuccess.SetToCurrentTime()
 			c.diffCache(newConf)
-			c.storeCache(newConf)
+			c.lastSync.Store(time.Now())
 		}
 	}
 }
 
+// LastSyncTime returns the time of the last successful load from the store,
+// it is zero if the configs have never been loaded.
+func (c *Controller) LastSyncTime() time.Time {
+	t, _ := c.lastSync.Load().(time.Time)
+	return t
+}
+
 // RegisterEventHandler registers a handler to handle config event.
 func (c *Controller) RegisterEventHandler(handler EventHandler) {
 	c.Lock()
@@ -342,22 +423,57 @@ func (c *Controller) Get(namespace, typ, key string) ([]byte, error) {
 
 // GetCache return config data by namespace, type and key from cache.
 func (c *Controller) GetCache(namespace, typ, key string) ([]byte, error) {
-	return c.loadCache().Get(namespace, typ, key)
+	cache := c.loadCache()
+	// the cache is not loaded yet.
+	if cache == nil {
+		return nil, ErrNotExist
+	}
+	return cache.Get(namespace, typ, key)
 }
 
 // Add add config data by namespace, type and key.
 func (c *Controller) Add(namespace, typ, key string, value []byte) error {
-	return c.store.Add(namespace, typ, key, value)
+	return c.AddContext(context.Background(), namespace, typ, key, value)
+}
+
+// AddContext is the same as Add, the span carried by ctx is continued by
+// the event of the change.
+func (c *Controller) AddContext(ctx context.Context, namespace, typ, key string, value []byte) error {
+	if err := c.store.Add(namespace, typ, key, value); err != nil {
+		return err
+	}
+	c.traceChange(ctx, namespace, typ, key)
+	return nil
 }
 
 // Update update config data by namespace, type and key.
 func (c *Controller) Update(namespace, typ, key string, value []byte) error {
-	return c.store.Update(namespace, typ, key, value)
+	return c.UpdateContext(context.Background(), namespace, typ, key, value)
+}
+
+// UpdateContext is the same as Update, the span carried by ctx is continued
+// by the event of the change.
+func (c *Controller) UpdateContext(ctx context.Context, namespace, typ, key string, value []byte) error {
+	if err := c.store.Update(namespace, typ, key, value); err != nil {
+		return err
+	}
+	c.traceChange(ctx, namespace, typ, key)
+	return nil
 }
 
 // Del del config data by namespace, type and key.
 func (c *Controller) Del(namespace, typ, key string) error {
-	return c.store.Del(namespace, typ, key)
+	return c.DelContext(context.Background(), namespace, typ, key)
+}
+
+// DelContext is the same as Del, the span carried by ctx is continued by
+// the event of the change.
+func (c *Controller) DelContext(ctx context.Context, namespace, typ, key string) error {
+	if err := c.store.Del(namespace, typ, key); err != nil {
+		return err
+	}
+	c.traceChange(ctx, namespace, typ, key)
+	return nil
 }
 
 // Exist return true if config data is exist.
@@ -373,5 +489,39 @@ func (c *Controller) Keys(namespace, typ string) ([]string, error) {
 
 // Keys return all key by namespace and type from cache.
 func (c *Controller) KeysCached(namespace, typ string) ([]string, error) {
-	return c.loadCache().Keys(namespace, typ)
+	cache := c.loadCache()
+	if cache == nil {
+		return nil, ErrNotExist
+	}
+	return cache.Keys(namespace, typ)
+}
+
+// ReadOnly returns true if the underlying store rejects all writes.
+func (c *Controller) ReadOnly() bool {
+	ros, ok := c.store.(ReadOnlyStore)
+	return ok && ros.ReadOnly()
+}
+
+// Backup dumps the whole config store into w, returns ErrNotSupported if
+// the underlying store doesn't implement BackupableStore.
+func (c *Controller) Backup(w io.Writer) error {
+	bs, ok := c.store.(BackupableStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	return bs.Backup(w)
+}
+
+// Restore restores the whole config store from the snapshot read from r,
+// returns ErrNotSupported if the underlying store doesn't implement BackupableStore.
+func (c *Controller) Restore(r io.Reader) error {
+	bs, ok := c.store.(BackupableStore)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := bs.Restore(r); err != nil {
+		return err
+	}
+	c.triggerUpdate()
+	return nil
 }
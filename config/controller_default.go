@@ -0,0 +1,116 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+)
+
+// DefaultProxyConfigKey is the key of the global default proxy config.
+const DefaultProxyConfigKey = "default"
+
+// DefaultProxyConfigController manages the global default proxy config,
+// which is pushed to the services without their own proxy config.
+type DefaultProxyConfigController struct {
+	ctl *Controller
+}
+
+func newDefaultProxyConfigController(ctl *Controller) *DefaultProxyConfigController {
+	return &DefaultProxyConfigController{ctl: ctl}
+}
+
+func (*DefaultProxyConfigController) getNamespace() string { return NamespaceGlobal }
+
+func (*DefaultProxyConfigController) getType() string { return TypeGlobalProxyConfig }
+
+func (c *DefaultProxyConfigController) get(getFn func(ns, typ, key string) ([]byte, error)) (*service.Config, error) {
+	b, err := getFn(c.getNamespace(), c.getType(), DefaultProxyConfigKey)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, ErrNotExist
+	}
+	cfg := new(service.Config)
+	if err := cfg.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Get returns the default proxy config, ErrNotExist if it's not set.
+func (c *DefaultProxyConfigController) Get() (*service.Config, error) {
+	return c.get(c.ctl.Get)
+}
+
+// GetCache is same as Get, but reads from cache.
+func (c *DefaultProxyConfigController) GetCache() (*service.Config, error) {
+	return c.get(c.ctl.GetCache)
+}
+
+// Set validates and saves the default proxy config.
+func (c *DefaultProxyConfigController) Set(cfg *service.Config) error {
+	return c.SetContext(context.Background(), cfg)
+}
+
+// SetContext is like Set, the change is traced if ctx carries a span.
+func (c *DefaultProxyConfigController) SetContext(ctx context.Context, cfg *service.Config) error {
+	if cfg == nil {
+		return ErrNotExist
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	b, err := cfg.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	err = c.ctl.UpdateContext(ctx, c.getNamespace(), c.getType(), DefaultProxyConfigKey, b)
+	if err == ErrNotExist {
+		err = c.ctl.AddContext(ctx, c.getNamespace(), c.getType(), DefaultProxyConfigKey, b)
+	}
+	return err
+}
+
+// Delete deletes the default proxy config.
+func (c *DefaultProxyConfigController) Delete() error {
+	return c.DeleteContext(context.Background())
+}
+
+// DeleteContext is like Delete, the change is traced if ctx carries a span.
+func (c *DefaultProxyConfigController) DeleteContext(ctx context.Context) error {
+	return c.ctl.DelContext(ctx, c.getNamespace(), c.getType(), DefaultProxyConfigKey)
+}
+
+// RegisterEventHandler registers a handler to handle the changes of default proxy config.
+func (c *DefaultProxyConfigController) RegisterEventHandler(handler DefaultProxyConfigEventHandler) {
+	c.ctl.RegisterEventHandler(func(event *Event) {
+		if event.Config.Namespace != c.getNamespace() || event.Config.Type != c.getType() ||
+			event.Config.Key != DefaultProxyConfigKey {
+			return
+		}
+		evt := &DefaultProxyConfigEvent{Type: event.Type, Trace: event.Trace}
+		if event.Type != EventDelete {
+			cfg, err := c.GetCache()
+			if err != nil {
+				return
+			}
+			evt.Config = cfg
+		}
+		handler(evt)
+	})
+}
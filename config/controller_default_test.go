@@ -0,0 +1,60 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultProxyConfigController(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctl := NewController(genMockStore(t, mockCtl, nil, nil, nil))
+	defCtl := ctl.DefaultProxyConfig()
+
+	_, err := defCtl.Get()
+	assert.Equal(t, ErrNotExist, err)
+	_, err = ctl.ProxyConfigs().GetEffective("svc")
+	assert.Equal(t, ErrNotExist, err)
+
+	assert.Error(t, defCtl.Set(nil))
+	assert.Error(t, defCtl.Set(&service.Config{Protocol: protocol.TCP}))
+
+	cfg := &service.Config{
+		Protocol: protocol.TCP,
+		Listener: &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+	}
+	assert.NoError(t, defCtl.Set(cfg))
+	cfg.Protocol = protocol.Redis
+	assert.NoError(t, defCtl.Set(cfg))
+	got, err := defCtl.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, got)
+
+	t.Run("fallback", func(t *testing.T) {
+		pc, err := ctl.ProxyConfigs().GetEffective("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, &ProxyConfig{ServiceName: "svc", Config: cfg}, pc)
+	})
+
+	assert.NoError(t, defCtl.Delete())
+	assert.Equal(t, ErrNotExist, defCtl.Delete())
+}
@@ -15,8 +15,10 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 )
@@ -49,13 +51,15 @@ type DependenciesController struct {
 	sync.RWMutex
 	ctl          *Controller
 	dependencies map[string]*Dependency
-	handlers     atomic.Value //[]DependencyEventHandler
+	dependents   map[string]map[string]struct{} // reverse index of dependencies
+	handlers     atomic.Value                   //[]DependencyEventHandler
 }
 
 func newDependenciesController(c *Controller) *DependenciesController {
 	depCtl := &DependenciesController{
 		ctl:          c,
 		dependencies: make(map[string]*Dependency),
+		dependents:   make(map[string]map[string]struct{}),
 		handlers:     atomic.Value{},
 	}
 	c.RegisterEventHandler(depCtl.handleRawEvent)
@@ -123,6 +127,11 @@ func (c *DependenciesController) GetCache(svc string) (*Dependency, error) {
 }
 
 func (c *DependenciesController) Add(dependency *Dependency) error {
+	return c.AddContext(context.Background(), dependency)
+}
+
+// AddContext is like Add, the change is traced if ctx carries a span.
+func (c *DependenciesController) AddContext(ctx context.Context, dependency *Dependency) error {
 	if dependency == nil {
 		return nil
 	}
@@ -133,10 +142,15 @@ func (c *DependenciesController) Add(dependency *Dependency) error {
 	if err != nil {
 		return err
 	}
-	return c.ctl.Add(c.getNamespace(), c.getType(), dependency.ServiceName, b)
+	return c.ctl.AddContext(ctx, c.getNamespace(), c.getType(), dependency.ServiceName, b)
 }
 
 func (c *DependenciesController) Update(dependency *Dependency) error {
+	return c.UpdateContext(context.Background(), dependency)
+}
+
+// UpdateContext is like Update, the change is traced if ctx carries a span.
+func (c *DependenciesController) UpdateContext(ctx context.Context, dependency *Dependency) error {
 	if dependency == nil {
 		return nil
 	}
@@ -147,7 +161,7 @@ func (c *DependenciesController) Update(dependency *Dependency) error {
 	if err != nil {
 		return err
 	}
-	return c.ctl.Update(c.getNamespace(), c.getType(), dependency.ServiceName, b)
+	return c.ctl.UpdateContext(ctx, c.getNamespace(), c.getType(), dependency.ServiceName, b)
 }
 
 func (c *DependenciesController) Exist(svc string) bool {
@@ -155,7 +169,12 @@ func (c *DependenciesController) Exist(svc string) bool {
 }
 
 func (c *DependenciesController) Delete(svc string) error {
-	return c.ctl.Del(c.getNamespace(), c.getType(), svc)
+	return c.DeleteContext(context.Background(), svc)
+}
+
+// DeleteContext is like Delete, the change is traced if ctx carries a span.
+func (c *DependenciesController) DeleteContext(ctx context.Context, svc string) error {
+	return c.ctl.DelContext(ctx, c.getNamespace(), c.getType(), svc)
 }
 
 func (c *DependenciesController) getAll(getKeysFn func(string, string) ([]string, error), getFn func(string) (*Dependency, error)) (Dependencies, error) {
@@ -182,6 +201,59 @@ func (c *DependenciesController) GetAllCache() (Dependencies, error) {
 	return c.getAll(c.ctl.KeysCached, c.GetCache)
 }
 
+func (c *DependenciesController) setCache(svc string, deps []string) {
+	c.Lock()
+	defer c.Unlock()
+	c.unindex(svc)
+	c.dependencies[svc] = &Dependency{
+		ServiceName:  svc,
+		Dependencies: deps,
+	}
+	for _, dep := range deps {
+		dependents, ok := c.dependents[dep]
+		if !ok {
+			dependents = make(map[string]struct{})
+			c.dependents[dep] = dependents
+		}
+		dependents[svc] = struct{}{}
+	}
+}
+
+func (c *DependenciesController) deleteCache(svc string) {
+	c.Lock()
+	defer c.Unlock()
+	c.unindex(svc)
+	delete(c.dependencies, svc)
+}
+
+// unindex removes the reverse edges of service, must be called with lock held.
+func (c *DependenciesController) unindex(svc string) {
+	dep, ok := c.dependencies[svc]
+	if !ok {
+		return
+	}
+	for _, d := range dep.Dependencies {
+		dependents := c.dependents[d]
+		delete(dependents, svc)
+		if len(dependents) == 0 {
+			delete(c.dependents, d)
+		}
+	}
+}
+
+// Dependents returns the services which depend on the given one directly,
+// sorted in ascending order. It reads from cache.
+func (c *DependenciesController) Dependents(svc string) []string {
+	c.RLock()
+	defer c.RUnlock()
+	res := make([]string, 0, len(c.dependents[svc]))
+	for dependent := range c.dependents[svc] {
+		res = append(res, dependent)
+	}
+	sort.Strings(res)
+	return res
+}
+
 func (c *DependenciesController) handleRawEvent(event *Event) {
 	if event.Config.Namespace != c.getNamespace() || event.Config.Type != c.getType() {
 		return
@@ -200,24 +272,13 @@ func (c *DependenciesController) handleRawEvent(event *Event) {
 			ServiceName: svcName,
 			Add:         rawDeps,
 		}
-		defer func() {
-			c.Lock()
-			defer c.Unlock()
-			c.dependencies[svcName] = &Dependency{
-				ServiceName:  svcName,
-				Dependencies: rawDeps,
-			}
-		}()
+		defer c.setCache(svcName, rawDeps)
 	case EventDelete:
 		depEvt = &DependencyEvent{
 			ServiceName: svcName,
 			Del:         rawDeps,
 		}
-		defer func() {
-			c.Lock()
-			defer c.Unlock()
-			delete(c.dependencies, svcName)
-		}()
+		defer c.deleteCache(svcName)
 	case EventUpdate:
 		var before, after, incr, decr []string
 		after = rawDeps
@@ -233,15 +294,9 @@ func (c *DependenciesController) handleRawEvent(event *Event) {
 			Add:         incr,
 			Del:         decr,
 		}
-		defer func() {
-			c.Lock()
-			defer c.Unlock()
-			c.dependencies[svcName] = &Dependency{
-				ServiceName:  "svcName",
-				Dependencies: rawDeps,
-			}
-		}()
+		defer c.setCache(svcName, rawDeps)
 	}
+	depEvt.Trace = event.Trace
 	for _, hdl := range c.loadHandlers() {
 		hdl(depEvt)
 	}
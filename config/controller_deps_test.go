@@ -15,6 +15,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"testing"
@@ -358,3 +359,28 @@ func TestDependenciesController_RegisterEventHandlerWithDel(t *testing.T) {
 	case <-done:
 	}
 }
+
+func TestDependenciesController_Dependents(t *testing.T) {
+	ctl := newDependenciesController(NewController(nil))
+	raw := func(typ EventType, svc string, deps ...string) {
+		b, _ := json.Marshal(deps)
+		ctl.handleRawEvent(NewEvent(typ, NewRawConf(NamespaceService, TypeServiceDependency, svc, b)))
+	}
+
+	raw(EventAdd, "svc_1", "dep_1", "dep_2")
+	raw(EventAdd, "svc_2", "dep_1")
+	assert.Equal(t, []string{"svc_1", "svc_2"}, ctl.Dependents("dep_1"))
+	assert.Equal(t, []string{"svc_1"}, ctl.Dependents("dep_2"))
+	assert.Empty(t, ctl.Dependents("svc_1"))
+
+	raw(EventUpdate, "svc_1", "dep_2", "dep_3")
+	assert.Equal(t, []string{"svc_2"}, ctl.Dependents("dep_1"))
+	assert.Equal(t, []string{"svc_1"}, ctl.Dependents("dep_3"))
+	dep, err := ctl.GetCache("svc_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "svc_1", dep.ServiceName)
+
+	raw(EventDelete, "svc_2", "dep_1")
+	assert.Empty(t, ctl.Dependents("dep_1"))
+	assert.Len(t, ctl.dependents, 2)
+}
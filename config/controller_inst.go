@@ -27,6 +27,9 @@ type Instance struct {
 	Port          int    `json:"port"`
 	Version       string `json:"version"`
 	BelongService string `json:"belong_service"`
+	// Labels is the extra attributes of instance, such as zone, which are
+	// used to select the proxy config overrides.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 func (i *Instance) Verify() error {
@@ -36,6 +39,26 @@ func (i *Instance) Verify() error {
 	return nil
 }
 
+// Label returns the value of label by key, the attributes version, hostname,
+// ip and belong_service are also treated as labels if not defined in Labels.
+func (i *Instance) Label(key string) (string, bool) {
+	if v, ok := i.Labels[key]; ok {
+		return v, true
+	}
+	switch key {
+	case "version":
+		return i.Version, true
+	case "hostname":
+		return i.Hostname, true
+	case "ip":
+		return i.IP, true
+	case "belong_service":
+		return i.BelongService, true
+	default:
+		return "", false
+	}
+}
+
 type Instances []*Instance
 
 func (i Instances) Len() int { return len(i) }
@@ -142,3 +165,22 @@ func (c *InstancesController) GetAll() (Instances, error) {
 func (c *InstancesController) GetAllCache() (Instances, error) {
 	return c.getAll(c.ctl.KeysCached, c.GetCache)
 }
+
+// RegisterEventHandler registers a handler to handle the changes of instances.
+// The deleted instance carries the id only.
+func (c *InstancesController) RegisterEventHandler(handler InstanceEventHandler) {
+	c.ctl.RegisterEventHandler(func(event *Event) {
+		if event.Config.Namespace != c.getNamespace() || event.Config.Type != c.getType() {
+			return
+		}
+		evt := &InstanceEvent{Type: event.Type, Instance: &Instance{ID: event.Config.Key}}
+		if event.Type != EventDelete {
+			inst, err := c.GetCache(event.Config.Key)
+			if err != nil {
+				return
+			}
+			evt.Instance = inst
+		}
+		handler(evt)
+	})
+}
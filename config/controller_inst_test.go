@@ -244,3 +244,38 @@ func TestInstancesController_GetAll(t *testing.T) {
 		assert.ElementsMatch(t, expectInstances, instances)
 	})
 }
+
+func TestInstancesController_RegisterEventHandler(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	ctl, cancel := genInstancesController(t, mockCtl)
+	defer cancel()
+
+	events := make(chan *InstanceEvent, 4)
+	ctl.RegisterEventHandler(func(event *InstanceEvent) {
+		events <- event
+	})
+
+	next := func() *InstanceEvent {
+		select {
+		case evt := <-events:
+			return evt
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+			return nil
+		}
+	}
+
+	inst := &Instance{ID: "foo", IP: "1.1.1.1", Labels: map[string]string{"zone": "a"}}
+	assert.NoError(t, ctl.Add(inst))
+	assert.Equal(t, &InstanceEvent{Type: EventAdd, Instance: inst}, next())
+
+	assert.NoError(t, ctl.ctl.Add(NamespaceService, TypeServiceDependency, "svc", []byte(`[]`)))
+	inst.Labels["zone"] = "b"
+	assert.NoError(t, ctl.Update(inst))
+	assert.Equal(t, &InstanceEvent{Type: EventUpdate, Instance: inst}, next())
+
+	assert.NoError(t, ctl.Delete("foo"))
+	assert.Equal(t, &InstanceEvent{Type: EventDelete, Instance: &Instance{ID: "foo"}}, next())
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+)
+
+// OverrideScope indicates which samaritan instances an override applies to.
+type OverrideScope string
+
+// The following shows the available override scopes, ordered from the most
+// specific to the least.
+const (
+	OverrideScopeInstance      OverrideScope = "instance"
+	OverrideScopeSelector      OverrideScope = "selector"
+	OverrideScopeBelongService OverrideScope = "belong_service"
+)
+
+func (s OverrideScope) priority() int {
+	switch s {
+	case OverrideScopeInstance:
+		return 3
+	case OverrideScopeSelector:
+		return 2
+	case OverrideScopeBelongService:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ProxyConfigOverride overrides the proxy config of a service for part of
+// the samaritan instances, it's used to canary a config before rolling out
+// fleet-wide. Exactly one of Instances, Selector and BelongServices must be set.
+type ProxyConfigOverride struct {
+	Name string `json:"name"`
+	// Instances is the ids of matched instances.
+	Instances []string `json:"instances,omitempty"`
+	// Selector matches the instances whose labels or attributes (version,
+	// hostname, ip, belong_service) equal to all the given values.
+	Selector map[string]string `json:"selector,omitempty"`
+	// BelongServices matches the instances which belong to these services.
+	BelongServices []string `json:"belong_services,omitempty"`
+	// Config is merged on the effective proxy config of the service.
+	Config *service.Config `json:"config"`
+}
+
+// Scope returns the scope of this override.
+func (o *ProxyConfigOverride) Scope() OverrideScope {
+	switch {
+	case len(o.Instances) > 0:
+		return OverrideScopeInstance
+	case len(o.Selector) > 0:
+		return OverrideScopeSelector
+	case len(o.BelongServices) > 0:
+		return OverrideScopeBelongService
+	default:
+		return ""
+	}
+}
+
+// Verify this ProxyConfigOverride.
+func (o *ProxyConfigOverride) Verify() error {
+	if len(o.Name) == 0 {
+		return fmt.Errorf("name is null")
+	}
+	n := 0
+	for _, set := range []bool{len(o.Instances) > 0, len(o.Selector) > 0, len(o.BelongServices) > 0} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("override %s: exactly one of instances, selector and belong_services must be set", o.Name)
+	}
+	if o.Config == nil {
+		return fmt.Errorf("override %s: config is null", o.Name)
+	}
+	return nil
+}
+
+// Match returns true if the override applies to the instance.
+func (o *ProxyConfigOverride) Match(inst *Instance) bool {
+	if inst == nil {
+		return false
+	}
+	switch o.Scope() {
+	case OverrideScopeInstance:
+		return containsString(o.Instances, inst.ID)
+	case OverrideScopeSelector:
+		for k, v := range o.Selector {
+			if val, ok := inst.Label(k); !ok || val != v {
+				return false
+			}
+		}
+		return true
+	case OverrideScopeBelongService:
+		return containsString(o.BelongServices, inst.BelongService)
+	default:
+		return false
+	}
+}
+
+// ProxyConfigOverrides is all the overrides of a service.
+type ProxyConfigOverrides struct {
+	Metadata
+	ServiceName string                 `json:"service_name"`
+	Overrides   []*ProxyConfigOverride `json:"overrides"`
+}
+
+// Verify this ProxyConfigOverrides.
+func (o *ProxyConfigOverrides) Verify() error {
+	if len(o.ServiceName) == 0 {
+		return fmt.Errorf("service_name is null")
+	}
+	names := make(map[string]struct{}, len(o.Overrides))
+	for _, ovr := range o.Overrides {
+		if ovr == nil {
+			return fmt.Errorf("override is null")
+		}
+		if err := ovr.Verify(); err != nil {
+			return err
+		}
+		if _, ok := names[ovr.Name]; ok {
+			return fmt.Errorf("duplicate override %s", ovr.Name)
+		}
+		names[ovr.Name] = struct{}{}
+	}
+	return nil
+}
+
+// MostSpecific returns the most specific override which matches the instance,
+// nil if there is no one. The instance scope wins over the selector scope,
+// which wins over the belong_service scope. Among the selectors, the one with
+// more terms wins. The first one wins if still tied.
+func (o *ProxyConfigOverrides) MostSpecific(inst *Instance) *ProxyConfigOverride {
+	if o == nil {
+		return nil
+	}
+	var res *ProxyConfigOverride
+	better := func(ovr *ProxyConfigOverride) bool {
+		if res == nil {
+			return true
+		}
+		p1, p2 := ovr.Scope().priority(), res.Scope().priority()
+		if p1 != p2 {
+			return p1 > p2
+		}
+		return ovr.Scope() == OverrideScopeSelector && len(ovr.Selector) > len(res.Selector)
+	}
+	for _, ovr := range o.Overrides {
+		if ovr.Match(inst) && better(ovr) {
+			res = ovr
+		}
+	}
+	return res
+}
+
+// Resolve returns a copy of cfg whose Config is merged with the most
+// specific override for the instance. The cfg is returned directly if
+// there is no matched override.
+func (o *ProxyConfigOverrides) Resolve(cfg *ProxyConfig, inst *Instance) *ProxyConfig {
+	if cfg == nil || cfg.Config == nil {
+		return cfg
+	}
+	ovr := o.MostSpecific(inst)
+	if ovr == nil {
+		return cfg
+	}
+	return &ProxyConfig{
+		Metadata:    cfg.Metadata,
+		ServiceName: cfg.ServiceName,
+		Template:    cfg.Template,
+		Config:      MergeServiceConfig(cfg.Config, ovr.Config),
+	}
+}
+
+// ProxyConfigOverridesController manages the per-instance overrides of proxy configs.
+type ProxyConfigOverridesController struct {
+	ctl *Controller
+}
+
+func newProxyConfigOverridesController(ctl *Controller) *ProxyConfigOverridesController {
+	return &ProxyConfigOverridesController{ctl: ctl}
+}
+
+func (*ProxyConfigOverridesController) getNamespace() string { return NamespaceService }
+
+func (*ProxyConfigOverridesController) getType() string { return TypeServiceProxyConfigOverride }
+
+func (*ProxyConfigOverridesController) unmarshalOverrides(b []byte) ([]*ProxyConfigOverride, error) {
+	var ovrs []*ProxyConfigOverride
+	if err := json.Unmarshal(b, &ovrs); err != nil {
+		return nil, err
+	}
+	return ovrs, nil
+}
+
+func (*ProxyConfigOverridesController) marshalOverrides(ovrs []*ProxyConfigOverride) ([]byte, error) {
+	return json.Marshal(ovrs)
+}
+
+func (c *ProxyConfigOverridesController) get(svc string, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfigOverrides, error) {
+	b, err := getFn(c.getNamespace(), c.getType(), svc)
+	if err != nil {
+		return nil, err
+	}
+	ovrs, err := c.unmarshalOverrides(b)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyConfigOverrides{
+		ServiceName: svc,
+		Overrides:   ovrs,
+	}, nil
+}
+
+func (c *ProxyConfigOverridesController) Get(svc string) (*ProxyConfigOverrides, error) {
+	return c.get(svc, c.ctl.Get)
+}
+
+func (c *ProxyConfigOverridesController) GetCache(svc string) (*ProxyConfigOverrides, error) {
+	return c.get(svc, c.ctl.GetCache)
+}
+
+// verify verifies the overrides, and the merged configs if the service has
+// an effective proxy config.
+func (c *ProxyConfigOverridesController) verify(o *ProxyConfigOverrides) error {
+	if err := o.Verify(); err != nil {
+		return err
+	}
+	base, err := c.ctl.proxycfg.GetEffective(o.ServiceName)
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return nil
+	default:
+		return err
+	}
+	for _, ovr := range o.Overrides {
+		if err := MergeServiceConfig(base.Config, ovr.Config).Validate(); err != nil {
+			return fmt.Errorf("override %s: %v", ovr.Name, err)
+		}
+	}
+	return nil
+}
+
+// Set validates and saves the overrides of a service, the existing ones are replaced.
+func (c *ProxyConfigOverridesController) Set(o *ProxyConfigOverrides) error {
+	return c.SetContext(context.Background(), o)
+}
+
+// SetContext is like Set, the change is traced if ctx carries a span.
+func (c *ProxyConfigOverridesController) SetContext(ctx context.Context, o *ProxyConfigOverrides) error {
+	if o == nil {
+		return nil
+	}
+	if err := c.verify(o); err != nil {
+		return err
+	}
+	b, err := c.marshalOverrides(o.Overrides)
+	if err != nil {
+		return err
+	}
+	err = c.ctl.UpdateContext(ctx, c.getNamespace(), c.getType(), o.ServiceName, b)
+	if err == ErrNotExist {
+		err = c.ctl.AddContext(ctx, c.getNamespace(), c.getType(), o.ServiceName, b)
+	}
+	return err
+}
+
+func (c *ProxyConfigOverridesController) Exist(svc string) bool {
+	return c.ctl.Exist(c.getNamespace(), c.getType(), svc)
+}
+
+func (c *ProxyConfigOverridesController) Delete(svc string) error {
+	return c.DeleteContext(context.Background(), svc)
+}
+
+// DeleteContext is like Delete, the change is traced if ctx carries a span.
+func (c *ProxyConfigOverridesController) DeleteContext(ctx context.Context, svc string) error {
+	return c.ctl.DelContext(ctx, c.getNamespace(), c.getType(), svc)
+}
+
+func (c *ProxyConfigOverridesController) resolve(svc string, inst *Instance, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfig, error) {
+	cfg, err := c.ctl.proxycfg.getEffective(svc, getFn)
+	if err != nil {
+		return nil, err
+	}
+	ovrs, err := c.get(svc, getFn)
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return cfg, nil
+	default:
+		return nil, err
+	}
+	return ovrs.Resolve(cfg, inst), nil
+}
+
+// Resolve returns the effective proxy config of the service for the
+// instance, which is merged with the most specific matched override.
+func (c *ProxyConfigOverridesController) Resolve(svc string, inst *Instance) (*ProxyConfig, error) {
+	return c.resolve(svc, inst, c.ctl.Get)
+}
+
+// ResolveCache is same as Resolve, but reads from cache.
+func (c *ProxyConfigOverridesController) ResolveCache(svc string, inst *Instance) (*ProxyConfig, error) {
+	return c.resolve(svc, inst, c.ctl.GetCache)
+}
+
+func (c *ProxyConfigOverridesController) getAll(getKeysFn func(string, string) ([]string, error), getFn func(ns, typ, key string) ([]byte, error)) ([]*ProxyConfigOverrides, error) {
+	svcs, err := getKeysFn(c.getNamespace(), c.getType())
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return []*ProxyConfigOverrides{}, nil
+	default:
+		return nil, err
+	}
+	res := make([]*ProxyConfigOverrides, 0, len(svcs))
+	for _, svc := range svcs {
+		ovrs, err := c.get(svc, getFn)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ovrs)
+	}
+	return res, nil
+}
+
+func (c *ProxyConfigOverridesController) GetAll() ([]*ProxyConfigOverrides, error) {
+	return c.getAll(c.ctl.Keys, c.ctl.Get)
+}
+
+func (c *ProxyConfigOverridesController) GetAllCache() ([]*ProxyConfigOverrides, error) {
+	return c.getAll(c.ctl.KeysCached, c.ctl.GetCache)
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOverride(name string, timeout time.Duration) *ProxyConfigOverride {
+	return &ProxyConfigOverride{
+		Name:   name,
+		Config: &service.Config{ConnectTimeout: &timeout},
+	}
+}
+
+func TestProxyConfigOverrideVerify(t *testing.T) {
+	ovr := newTestOverride("", time.Second)
+	assert.Error(t, ovr.Verify())
+
+	ovr.Name = "foo"
+	assert.Error(t, ovr.Verify())
+
+	ovr.Instances = []string{"inst"}
+	assert.NoError(t, ovr.Verify())
+	assert.Equal(t, OverrideScopeInstance, ovr.Scope())
+
+	ovr.BelongServices = []string{"svc"}
+	assert.Error(t, ovr.Verify())
+
+	ovr.BelongServices = nil
+	ovr.Config = nil
+	assert.Error(t, ovr.Verify())
+
+	ovrs := &ProxyConfigOverrides{
+		ServiceName: "svc",
+		Overrides:   []*ProxyConfigOverride{newTestOverride("foo", time.Second), newTestOverride("foo", time.Second)},
+	}
+	for _, ovr := range ovrs.Overrides {
+		ovr.Instances = []string{"inst"}
+	}
+	assert.Error(t, ovrs.Verify())
+	ovrs.Overrides[1].Name = "bar"
+	assert.NoError(t, ovrs.Verify())
+}
+
+func TestProxyConfigOverridesMostSpecific(t *testing.T) {
+	byBelong := newTestOverride("belong", time.Second)
+	byBelong.BelongServices = []string{"consumer"}
+	byZone := newTestOverride("zone", 2*time.Second)
+	byZone.Selector = map[string]string{"zone": "z1"}
+	byZoneAndVersion := newTestOverride("zone-version", 3*time.Second)
+	byZoneAndVersion.Selector = map[string]string{"zone": "z1", "version": "1.0"}
+	byInst := newTestOverride("inst", 4*time.Second)
+	byInst.Instances = []string{"inst_1"}
+
+	ovrs := &ProxyConfigOverrides{
+		ServiceName: "svc",
+		Overrides:   []*ProxyConfigOverride{byBelong, byZone, byZoneAndVersion, byInst},
+	}
+	cases := []struct {
+		inst   *Instance
+		expect *ProxyConfigOverride
+	}{
+		{nil, nil},
+		{&Instance{ID: "inst_2"}, nil},
+		{&Instance{ID: "inst_2", BelongService: "consumer"}, byBelong},
+		{&Instance{ID: "inst_2", BelongService: "consumer", Labels: map[string]string{"zone": "z1"}}, byZone},
+		{&Instance{ID: "inst_2", Version: "1.0", Labels: map[string]string{"zone": "z1"}}, byZoneAndVersion},
+		{&Instance{ID: "inst_2", Version: "1.0", Labels: map[string]string{"zone": "z1", "version": "2.0"}}, byZone},
+		{&Instance{ID: "inst_1", Version: "1.0", Labels: map[string]string{"zone": "z1"}}, byInst},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.expect, ovrs.MostSpecific(c.inst), "case %d", i)
+	}
+}
+
+func TestProxyConfigOverridesController(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctl := NewController(genMockStore(t, mockCtl, nil, nil, nil))
+	ovrCtl := ctl.ProxyConfigOverrides()
+
+	all, err := ovrCtl.GetAll()
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+
+	canary := newTestOverride("canary", 2*time.Second)
+	canary.Instances = []string{"inst_1"}
+	ovrs := &ProxyConfigOverrides{ServiceName: "svc", Overrides: []*ProxyConfigOverride{canary}}
+
+	// the service has no effective config, only the overrides are verified.
+	assert.NoError(t, ovrCtl.Set(ovrs))
+	assert.True(t, ovrCtl.Exist("svc"))
+	got, err := ovrCtl.Get("svc")
+	assert.NoError(t, err)
+	assert.Equal(t, ovrs, got)
+
+	_, err = ovrCtl.Resolve("svc", &Instance{ID: "inst_1"})
+	assert.Equal(t, ErrNotExist, err)
+
+	assert.NoError(t, ctl.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc", Config: newTestTemplate().Config}))
+	cfg, err := ovrCtl.Resolve("svc", &Instance{ID: "inst_1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, *cfg.Config.ConnectTimeout)
+	assert.Equal(t, uint32(80), cfg.Config.Listener.Address.Port)
+	cfg, err = ovrCtl.Resolve("svc", &Instance{ID: "inst_2"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, *cfg.Config.ConnectTimeout)
+
+	// the merged config is invalid
+	invalid := newTestOverride("invalid", -time.Second)
+	invalid.Instances = []string{"inst_2"}
+	ovrs.Overrides = append(ovrs.Overrides, invalid)
+	assert.Error(t, ovrCtl.Set(ovrs))
+
+	all, err = ovrCtl.GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	assert.NoError(t, ovrCtl.Delete("svc"))
+	assert.False(t, ovrCtl.Exist("svc"))
+}
+
+func TestProxyConfigsController_OverrideEvents(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctl := NewController(genMockStore(t, mockCtl, nil, nil, nil))
+	assert.NoError(t, ctl.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc", Config: newTestTemplate().Config}))
+	cache, err := ctl.fetchAll()
+	assert.NoError(t, err)
+	ctl.storeCache(cache)
+
+	cfgCtl := ctl.ProxyConfigs()
+	for _, typ := range []EventType{EventAdd, EventUpdate, EventDelete} {
+		events := cfgCtl.effectiveEvents(NewEvent(typ, NewRawConf(NamespaceService, TypeServiceProxyConfigOverride, "svc", nil)))
+		assert.Len(t, events, 1)
+		assert.Equal(t, EventUpdate, events[0].Type)
+		assert.Equal(t, "svc", events[0].ProxyConfig.ServiceName)
+	}
+
+	events := cfgCtl.effectiveEvents(NewEvent(EventAdd, NewRawConf(NamespaceService, TypeServiceProxyConfigOverride, "foo", nil)))
+	assert.Empty(t, events)
+}
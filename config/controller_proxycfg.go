@@ -15,7 +15,9 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"sort"
 
 	"github.com/samaritan-proxy/samaritan-api/go/config/service"
 )
@@ -23,15 +25,22 @@ import (
 // ProxyConfig is a wrapper of service.Config.
 type ProxyConfig struct {
 	Metadata
-	ServiceName string          `json:"service_name"`
-	Config      *service.Config `json:"config"`
+	ServiceName string `json:"service_name"`
+	// Template is the name of referenced template, the Config is treated as
+	// overrides of the template if it's set.
+	Template string          `json:"template,omitempty"`
+	Config   *service.Config `json:"config"`
 }
 
-// Verify this ProxyConfig.
+// Verify this ProxyConfig. If a template is referenced, the Config is
+// partial and will be validated after merging with the template.
 func (c *ProxyConfig) Verify() error {
 	if len(c.ServiceName) == 0 {
 		return fmt.Errorf("serivce_name is null")
 	}
+	if len(c.Template) > 0 {
+		return nil
+	}
 	if err := c.Config.Validate(); err != nil {
 		return err
 	}
@@ -77,8 +86,8 @@ func (*ProxyConfigsController) marshallSvcCfg(cfg *service.Config) ([]byte, erro
 	return cfg.MarshalJSON()
 }
 
-func (c *ProxyConfigsController) get(svc string, from func(svc string) ([]byte, error)) (*ProxyConfig, error) {
-	b, err := from(svc)
+func (c *ProxyConfigsController) get(svc string, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfig, error) {
+	b, err := getFn(c.getNamespace(), c.getType(), svc)
 	if err != nil {
 		return nil, err
 	}
@@ -90,50 +99,222 @@ func (c *ProxyConfigsController) get(svc string, from func(svc string) ([]byte,
 		}
 		cfg = _cfg
 	}
+	tpl, err := c.getTemplateName(svc, getFn)
+	if err != nil {
+		return nil, err
+	}
 	return &ProxyConfig{
 		ServiceName: svc,
+		Template:    tpl,
 		Config:      cfg,
 	}, nil
 }
 
+// getTemplateName returns the name of template referenced by the service,
+// empty if there is no one.
+func (c *ProxyConfigsController) getTemplateName(svc string, getFn func(ns, typ, key string) ([]byte, error)) (string, error) {
+	b, err := getFn(c.getNamespace(), TypeServiceProxyConfigTemplate, svc)
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return "", nil
+	default:
+		return "", err
+	}
+	return unmarshalTemplateName(b)
+}
+
 func (c *ProxyConfigsController) Get(svc string) (*ProxyConfig, error) {
-	return c.get(svc, func(svc string) (bytes []byte, err error) {
-		return c.ctl.Get(c.getNamespace(), c.getType(), svc)
-	})
+	return c.get(svc, c.ctl.Get)
 }
 
 func (c *ProxyConfigsController) GetCache(svc string) (*ProxyConfig, error) {
-	return c.get(svc, func(svc string) (bytes []byte, err error) {
-		return c.ctl.GetCache(c.getNamespace(), c.getType(), svc)
-	})
+	return c.get(svc, c.ctl.GetCache)
+}
+
+// Effective returns a copy of ProxyConfig whose Config is merged with the
+// referenced template, returns ErrTemplateNotExist if the template is missing.
+func (c *ProxyConfigsController) Effective(cfg *ProxyConfig) (*ProxyConfig, error) {
+	return c.effective(cfg, c.ctl.Get)
+}
+
+func (c *ProxyConfigsController) effective(cfg *ProxyConfig, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfig, error) {
+	if cfg == nil || len(cfg.Template) == 0 {
+		return cfg, nil
+	}
+	tpl, err := c.ctl.tpl.get(cfg.Template, getFn)
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return nil, ErrTemplateNotExist
+	default:
+		return nil, err
+	}
+	return &ProxyConfig{
+		Metadata:    cfg.Metadata,
+		ServiceName: cfg.ServiceName,
+		Template:    cfg.Template,
+		Config:      MergeServiceConfig(tpl.Config, cfg.Config),
+	}, nil
+}
+
+// GetEffective returns the proxy config which is merged with the referenced
+// template. If the service has no proxy config, the global default one is
+// returned, ErrNotExist if both don't exist.
+func (c *ProxyConfigsController) GetEffective(svc string) (*ProxyConfig, error) {
+	return c.getEffective(svc, c.ctl.Get)
+}
+
+// GetEffectiveCache is same as GetEffective, but reads from cache.
+func (c *ProxyConfigsController) GetEffectiveCache(svc string) (*ProxyConfig, error) {
+	return c.getEffective(svc, c.ctl.GetCache)
+}
+
+func (c *ProxyConfigsController) getEffective(svc string, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfig, error) {
+	cfg, err := c.get(svc, getFn)
+	switch err {
+	case nil:
+		return c.effective(cfg, getFn)
+	case ErrNotExist:
+		return c.getDefault(svc, getFn)
+	default:
+		return nil, err
+	}
+}
+
+// getDefault returns the global default proxy config for the service.
+func (c *ProxyConfigsController) getDefault(svc string, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfig, error) {
+	cfg, err := c.ctl.defcfg.get(getFn)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyConfig{
+		ServiceName: svc,
+		Config:      cfg,
+	}, nil
+}
+
+// verify verifies the config and the merged one if a template is referenced.
+func (c *ProxyConfigsController) verify(cfg *ProxyConfig) error {
+	if err := cfg.Verify(); err != nil {
+		return err
+	}
+	if len(cfg.Template) == 0 {
+		return nil
+	}
+	merged, err := c.Effective(cfg)
+	if err != nil {
+		return err
+	}
+	return merged.Config.Validate()
+}
+
+// setTemplate binds the service to the template, or unbinds if name is empty.
+func (c *ProxyConfigsController) setTemplate(ctx context.Context, svc, name string) error {
+	if len(name) == 0 {
+		if err := c.ctl.DelContext(ctx, c.getNamespace(), TypeServiceProxyConfigTemplate, svc); err != ErrNotExist {
+			return err
+		}
+		return nil
+	}
+	b, err := marshalTemplateName(name)
+	if err != nil {
+		return err
+	}
+	err = c.ctl.UpdateContext(ctx, c.getNamespace(), TypeServiceProxyConfigTemplate, svc, b)
+	if err == ErrNotExist {
+		err = c.ctl.AddContext(ctx, c.getNamespace(), TypeServiceProxyConfigTemplate, svc, b)
+	}
+	return err
+}
+
+// put writes the config by putFn and binds the referenced template. They are
+// two writes, so the order makes sure that a partial config is never taken as
+// a complete one in between: the template is bound before writing a partial
+// config, and unbound after writing a complete one. If the second write fails,
+// the first one is rolled back, the config by undoFn.
+func (c *ProxyConfigsController) put(ctx context.Context, cfg *ProxyConfig, putFn, undoFn func() error) error {
+	prev, err := c.getTemplateName(cfg.ServiceName, c.ctl.Get)
+	if err != nil {
+		return err
+	}
+	if prev == cfg.Template {
+		return putFn()
+	}
+
+	if len(cfg.Template) > 0 {
+		if err := c.setTemplate(ctx, cfg.ServiceName, cfg.Template); err != nil {
+			return err
+		}
+		if err := putFn(); err != nil {
+			if rerr := c.setTemplate(ctx, cfg.ServiceName, prev); rerr != nil {
+				log.Warnf("Failed to rollback the template of %s: %v", cfg.ServiceName, rerr)
+			}
+			return err
+		}
+		return nil
+	}
+
+	if err := putFn(); err != nil {
+		return err
+	}
+	if err := c.setTemplate(ctx, cfg.ServiceName, ""); err != nil {
+		if rerr := undoFn(); rerr != nil {
+			log.Warnf("Failed to rollback the proxy config of %s: %v", cfg.ServiceName, rerr)
+		}
+		return err
+	}
+	return nil
 }
 
 func (c *ProxyConfigsController) Add(cfg *ProxyConfig) error {
+	return c.AddContext(context.Background(), cfg)
+}
+
+// AddContext is like Add, the change is traced if ctx carries a span.
+func (c *ProxyConfigsController) AddContext(ctx context.Context, cfg *ProxyConfig) error {
 	if cfg == nil {
 		return nil
 	}
-	if err := cfg.Verify(); err != nil {
+	if err := c.verify(cfg); err != nil {
 		return err
 	}
 	b, err := c.marshallSvcCfg(cfg.Config)
 	if err != nil {
 		return err
 	}
-	return c.ctl.Add(c.getNamespace(), c.getType(), cfg.ServiceName, b)
+	return c.put(ctx, cfg, func() error {
+		return c.ctl.AddContext(ctx, c.getNamespace(), c.getType(), cfg.ServiceName, b)
+	}, func() error {
+		return c.ctl.DelContext(ctx, c.getNamespace(), c.getType(), cfg.ServiceName)
+	})
 }
 
 func (c *ProxyConfigsController) Update(cfg *ProxyConfig) error {
+	return c.UpdateContext(context.Background(), cfg)
+}
+
+// UpdateContext is like Update, the change is traced if ctx carries a span.
+func (c *ProxyConfigsController) UpdateContext(ctx context.Context, cfg *ProxyConfig) error {
 	if cfg == nil {
 		return nil
 	}
-	if err := cfg.Verify(); err != nil {
+	if err := c.verify(cfg); err != nil {
 		return err
 	}
 	b, err := c.marshallSvcCfg(cfg.Config)
 	if err != nil {
 		return err
 	}
-	return c.ctl.Update(c.getNamespace(), c.getType(), cfg.ServiceName, b)
+	prev, err := c.ctl.Get(c.getNamespace(), c.getType(), cfg.ServiceName)
+	if err != nil {
+		return err
+	}
+	return c.put(ctx, cfg, func() error {
+		return c.ctl.UpdateContext(ctx, c.getNamespace(), c.getType(), cfg.ServiceName, b)
+	}, func() error {
+		return c.ctl.UpdateContext(ctx, c.getNamespace(), c.getType(), cfg.ServiceName, prev)
+	})
 }
 
 func (c *ProxyConfigsController) Exist(svc string) bool {
@@ -141,7 +322,39 @@ func (c *ProxyConfigsController) Exist(svc string) bool {
 }
 
 func (c *ProxyConfigsController) Delete(svc string) error {
-	return c.ctl.Del(c.getNamespace(), c.getType(), svc)
+	return c.DeleteContext(context.Background(), svc)
+}
+
+// DeleteContext is like Delete, the change is traced if ctx carries a span.
+func (c *ProxyConfigsController) DeleteContext(ctx context.Context, svc string) error {
+	if err := c.ctl.DelContext(ctx, c.getNamespace(), c.getType(), svc); err != nil {
+		return err
+	}
+	return c.setTemplate(ctx, svc, "")
+}
+
+// servicesOfTemplate returns the services which reference the template.
+func (c *ProxyConfigsController) servicesOfTemplate(name string, getKeysFn func(string, string) ([]string, error), getFn func(ns, typ, key string) ([]byte, error)) ([]string, error) {
+	svcs, err := getKeysFn(c.getNamespace(), TypeServiceProxyConfigTemplate)
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return nil, nil
+	default:
+		return nil, err
+	}
+	var res []string
+	for _, svc := range svcs {
+		tpl, err := c.getTemplateName(svc, getFn)
+		if err != nil {
+			return nil, err
+		}
+		if tpl == name {
+			res = append(res, svc)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
 }
 
 func (c *ProxyConfigsController) getAll(getKeysFn func(string, string) ([]string, error), getFn func(string) (*ProxyConfig, error)) (ProxyConfigs, error) {
@@ -168,21 +381,83 @@ func (c *ProxyConfigsController) GetAllCache() (ProxyConfigs, error) {
 	return c.getAll(c.ctl.KeysCached, c.GetCache)
 }
 
+// RegisterEventHandler registers a handler to handle the changes of
+// effective proxy configs. Besides the changes of proxy config itself,
+// changing the template, the reference or the overrides will trigger an
+// update event of all the affected services.
 func (c *ProxyConfigsController) RegisterEventHandler(handler ProxyConfigEventHandler) {
 	c.ctl.RegisterEventHandler(func(event *Event) {
-		if event.Config.Namespace != c.getNamespace() || event.Config.Type != c.getType() {
-			return
+		for _, evt := range c.effectiveEvents(event) {
+			evt.Trace = event.Trace
+			handler(evt)
 		}
-		rawConf, err := c.unmarshalSvcCfg(event.Config.Value)
+	})
+}
+
+func (c *ProxyConfigsController) effectiveEvents(event *Event) []*ProxyConfigEvent {
+	var (
+		typ  = event.Type
+		svcs []string
+	)
+	switch {
+	case event.Config.Namespace == c.getNamespace() && event.Config.Type == c.getType():
+		if event.Type == EventDelete {
+			// fallback to the global default one.
+			if cfg, err := c.getDefault(event.Config.Key, c.ctl.GetCache); err == nil {
+				return []*ProxyConfigEvent{{
+					Type:        EventUpdate,
+					ProxyConfig: cfg,
+				}}
+			}
+			return []*ProxyConfigEvent{{
+				Type:        EventDelete,
+				ProxyConfig: &ProxyConfig{ServiceName: event.Config.Key},
+			}}
+		}
+		svcs = []string{event.Config.Key}
+	case event.Config.Namespace == c.getNamespace() && event.Config.Type == TypeServiceProxyConfigTemplate:
+		typ, svcs = EventUpdate, []string{event.Config.Key}
+	case event.Config.Namespace == NamespaceTemplate && event.Config.Type == TypeTemplateProxyConfig:
+		tplSvcs, err := c.servicesOfTemplate(event.Config.Key, c.ctl.KeysCached, c.ctl.GetCache)
 		if err != nil {
-			return
+			log.Warnf("Failed to get services of template %s: %v", event.Config.Key, err)
+			return nil
+		}
+		typ, svcs = EventUpdate, tplSvcs
+	case event.Config.Namespace == c.getNamespace() && event.Config.Type == TypeServiceProxyConfigOverride:
+		// the overrides are resolved by the subscribers, just notify them
+		// to resolve again.
+		cfg, err := c.getEffective(event.Config.Key, c.ctl.GetCache)
+		if err != nil {
+			return nil
+		}
+		return []*ProxyConfigEvent{{
+			Type:        EventUpdate,
+			ProxyConfig: cfg,
+		}}
+	default:
+		return nil
+	}
+
+	events := make([]*ProxyConfigEvent, 0, len(svcs))
+	for _, svc := range svcs {
+		// the service may have no proxy config but only a reference.
+		cfg, err := c.get(svc, c.ctl.GetCache)
+		if err == nil {
+			cfg, err = c.effective(cfg, c.ctl.GetCache)
 		}
-		handler(&ProxyConfigEvent{
-			Type: event.Type,
-			ProxyConfig: &ProxyConfig{
-				ServiceName: event.Config.Key,
-				Config:      rawConf,
-			},
+		switch err {
+		case nil:
+		case ErrNotExist:
+			continue
+		default:
+			log.Warnf("Failed to get effective proxy config of %s: %v", svc, err)
+			continue
+		}
+		events = append(events, &ProxyConfigEvent{
+			Type:        typ,
+			ProxyConfig: cfg,
 		})
-	})
+	}
+	return events
 }
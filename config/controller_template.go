@@ -0,0 +1,232 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+)
+
+var (
+	// ErrTemplateNotExist is returned when the template referenced by a proxy config doesn't exist.
+	ErrTemplateNotExist = errors.New("template doesn't exist")
+	// ErrTemplateInUse is returned when deleting a template which is still referenced.
+	ErrTemplateInUse = errors.New("template is in use")
+)
+
+// ProxyConfigTemplate is a named service.Config shared by multiple services.
+type ProxyConfigTemplate struct {
+	Metadata
+	Name   string          `json:"name"`
+	Config *service.Config `json:"config"`
+}
+
+// Verify this ProxyConfigTemplate. The template could be partial, so only
+// the name is checked, the merged config is validated when it's referenced.
+func (t *ProxyConfigTemplate) Verify() error {
+	if len(t.Name) == 0 {
+		return fmt.Errorf("name is null")
+	}
+	return nil
+}
+
+// ProxyConfigTemplates is a slice of ProxyConfigTemplate, impl the sort.Interface.
+type ProxyConfigTemplates []*ProxyConfigTemplate
+
+func (t ProxyConfigTemplates) Len() int { return len(t) }
+
+func (t ProxyConfigTemplates) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+
+func (t ProxyConfigTemplates) Less(i, j int) bool { return t[i].Name < t[j].Name }
+
+// MergeServiceConfig returns a new service.Config which is the result of
+// applying overrides on the template. Every top-level field which is set in
+// overrides replaces the one in template as a whole, the messages and the
+// repeated fields in them are not merged, so that a list could be shortened
+// and a nested field could be reset to zero by the overrides. The unset
+// fields, including the enums of zero value, are inherited from template.
+func MergeServiceConfig(tpl, overrides *service.Config) *service.Config {
+	if tpl == nil {
+		return overrides
+	}
+	merged := proto.Clone(tpl).(*service.Config)
+	if overrides == nil {
+		return merged
+	}
+	dst := reflect.ValueOf(merged).Elem()
+	src := reflect.ValueOf(proto.Clone(overrides)).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if strings.HasPrefix(src.Type().Field(i).Name, "XXX_") {
+			continue
+		}
+		if f := src.Field(i); !f.IsZero() {
+			dst.Field(i).Set(f)
+		}
+	}
+	return merged
+}
+
+type ProxyConfigTemplatesController struct {
+	ctl *Controller
+}
+
+func newProxyConfigTemplatesController(ctl *Controller) *ProxyConfigTemplatesController {
+	return &ProxyConfigTemplatesController{ctl: ctl}
+}
+
+func (*ProxyConfigTemplatesController) getNamespace() string { return NamespaceTemplate }
+
+func (*ProxyConfigTemplatesController) getType() string { return TypeTemplateProxyConfig }
+
+func (c *ProxyConfigTemplatesController) get(name string, getFn func(ns, typ, key string) ([]byte, error)) (*ProxyConfigTemplate, error) {
+	b, err := getFn(c.getNamespace(), c.getType(), name)
+	if err != nil {
+		return nil, err
+	}
+	var cfg *service.Config
+	if b != nil {
+		cfg = new(service.Config)
+		if err := cfg.UnmarshalJSON(b); err != nil {
+			return nil, err
+		}
+	}
+	return &ProxyConfigTemplate{
+		Name:   name,
+		Config: cfg,
+	}, nil
+}
+
+func (c *ProxyConfigTemplatesController) Get(name string) (*ProxyConfigTemplate, error) {
+	return c.get(name, c.ctl.Get)
+}
+
+func (c *ProxyConfigTemplatesController) GetCache(name string) (*ProxyConfigTemplate, error) {
+	return c.get(name, c.ctl.GetCache)
+}
+
+func (c *ProxyConfigTemplatesController) put(tpl *ProxyConfigTemplate, putFn func(ns, typ, key string, value []byte) error) error {
+	if tpl == nil {
+		return nil
+	}
+	if err := tpl.Verify(); err != nil {
+		return err
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if tpl.Config != nil {
+		if b, err = tpl.Config.MarshalJSON(); err != nil {
+			return err
+		}
+	}
+	return putFn(c.getNamespace(), c.getType(), tpl.Name, b)
+}
+
+func (c *ProxyConfigTemplatesController) Add(tpl *ProxyConfigTemplate) error {
+	return c.AddContext(context.Background(), tpl)
+}
+
+// AddContext is like Add, the change is traced if ctx carries a span.
+func (c *ProxyConfigTemplatesController) AddContext(ctx context.Context, tpl *ProxyConfigTemplate) error {
+	return c.put(tpl, func(ns, typ, key string, value []byte) error {
+		return c.ctl.AddContext(ctx, ns, typ, key, value)
+	})
+}
+
+func (c *ProxyConfigTemplatesController) Update(tpl *ProxyConfigTemplate) error {
+	return c.UpdateContext(context.Background(), tpl)
+}
+
+// UpdateContext is like Update, the change is traced if ctx carries a span.
+func (c *ProxyConfigTemplatesController) UpdateContext(ctx context.Context, tpl *ProxyConfigTemplate) error {
+	return c.put(tpl, func(ns, typ, key string, value []byte) error {
+		return c.ctl.UpdateContext(ctx, ns, typ, key, value)
+	})
+}
+
+func (c *ProxyConfigTemplatesController) Exist(name string) bool {
+	return c.ctl.Exist(c.getNamespace(), c.getType(), name)
+}
+
+// Delete deletes the template, returns ErrTemplateInUse if any service
+// still references it.
+func (c *ProxyConfigTemplatesController) Delete(name string) error {
+	return c.DeleteContext(context.Background(), name)
+}
+
+// DeleteContext is like Delete, the change is traced if ctx carries a span.
+func (c *ProxyConfigTemplatesController) DeleteContext(ctx context.Context, name string) error {
+	svcs, err := c.ctl.proxycfg.servicesOfTemplate(name, c.ctl.Keys, c.ctl.Get)
+	if err != nil {
+		return err
+	}
+	if len(svcs) > 0 {
+		return ErrTemplateInUse
+	}
+	return c.ctl.DelContext(ctx, c.getNamespace(), c.getType(), name)
+}
+
+// Services returns the services which reference the template.
+func (c *ProxyConfigTemplatesController) Services(name string) ([]string, error) {
+	return c.ctl.proxycfg.servicesOfTemplate(name, c.ctl.Keys, c.ctl.Get)
+}
+
+func (c *ProxyConfigTemplatesController) getAll(getKeysFn func(string, string) ([]string, error), getFn func(ns, typ, key string) ([]byte, error)) (ProxyConfigTemplates, error) {
+	names, err := getKeysFn(c.getNamespace(), c.getType())
+	switch err {
+	case nil:
+	case ErrNotExist:
+		return ProxyConfigTemplates{}, nil
+	default:
+		return nil, err
+	}
+	tpls := ProxyConfigTemplates{}
+	for _, name := range names {
+		tpl, err := c.get(name, getFn)
+		if err != nil {
+			return nil, err
+		}
+		tpls = append(tpls, tpl)
+	}
+	return tpls, nil
+}
+
+func (c *ProxyConfigTemplatesController) GetAll() (ProxyConfigTemplates, error) {
+	return c.getAll(c.ctl.Keys, c.ctl.Get)
+}
+
+func (c *ProxyConfigTemplatesController) GetAllCache() (ProxyConfigTemplates, error) {
+	return c.getAll(c.ctl.KeysCached, c.ctl.GetCache)
+}
+
+func unmarshalTemplateName(b []byte) (string, error) {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func marshalTemplateName(name string) ([]byte, error) {
+	return json.Marshal(name)
+}
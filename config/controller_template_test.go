@@ -0,0 +1,259 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/hc"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTemplate() *ProxyConfigTemplate {
+	timeout := time.Second
+	return &ProxyConfigTemplate{
+		Name: "tpl",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}
+}
+
+func TestMergeServiceConfig(t *testing.T) {
+	tpl := newTestTemplate().Config
+	assert.Equal(t, tpl, MergeServiceConfig(tpl, nil))
+	assert.Nil(t, MergeServiceConfig(nil, nil))
+
+	timeout := 2 * time.Second
+	merged := MergeServiceConfig(tpl, &service.Config{
+		Listener:       &service.Listener{Address: &common.Address{Port: 8080}},
+		ConnectTimeout: &timeout,
+	})
+	assert.Equal(t, protocol.TCP, merged.Protocol)
+	// the listener is replaced as a whole.
+	assert.Equal(t, &service.Listener{Address: &common.Address{Port: 8080}}, merged.Listener)
+	assert.Equal(t, timeout, *merged.ConnectTimeout)
+	// the template is untouched.
+	assert.Equal(t, uint32(80), tpl.Listener.Address.Port)
+	assert.Equal(t, time.Second, *tpl.ConnectTimeout)
+}
+
+func TestMergeServiceConfigRepeated(t *testing.T) {
+	checker := func(actions ...*hc.ATCPChecker_Action) *hc.HealthCheck {
+		return &hc.HealthCheck{
+			Interval: time.Second,
+			Timeout:  time.Second,
+			Checker: &hc.HealthCheck_AtcpChecker{
+				AtcpChecker: &hc.ATCPChecker{Action: actions},
+			},
+		}
+	}
+	ping := &hc.ATCPChecker_Action{Send: []byte("ping"), Expect: []byte("pong")}
+	info := &hc.ATCPChecker_Action{Send: []byte("info"), Expect: []byte("ok")}
+	tpl := newTestTemplate().Config
+	tpl.HealthCheck = checker(ping, info)
+
+	merged := MergeServiceConfig(tpl, &service.Config{HealthCheck: checker(ping)})
+	// the actions are replaced instead of appended.
+	assert.Equal(t, checker(ping), merged.HealthCheck)
+	assert.Equal(t, checker(ping, info), tpl.HealthCheck)
+}
+
+func TestProxyConfigTemplatesController(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctl := NewController(genMockStore(t, mockCtl, nil, nil, nil))
+	tplCtl := ctl.Templates()
+
+	all, err := tplCtl.GetAll()
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+
+	assert.Error(t, tplCtl.Add(&ProxyConfigTemplate{}))
+	tpl := newTestTemplate()
+	assert.NoError(t, tplCtl.Add(tpl))
+	assert.Equal(t, ErrExist, tplCtl.Add(tpl))
+	assert.True(t, tplCtl.Exist("tpl"))
+
+	got, err := tplCtl.Get("tpl")
+	assert.NoError(t, err)
+	assert.Equal(t, tpl, got)
+
+	tpl.Config.Protocol = protocol.Redis
+	assert.NoError(t, tplCtl.Update(tpl))
+	got, err = tplCtl.Get("tpl")
+	assert.NoError(t, err)
+	assert.Equal(t, protocol.Redis, got.Config.Protocol)
+
+	all, err = tplCtl.GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	assert.NoError(t, ctl.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc", Template: "tpl"}))
+	svcs, err := tplCtl.Services("tpl")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"svc"}, svcs)
+	assert.Equal(t, ErrTemplateInUse, tplCtl.Delete("tpl"))
+
+	assert.NoError(t, ctl.ProxyConfigs().Delete("svc"))
+	assert.NoError(t, tplCtl.Delete("tpl"))
+	assert.False(t, tplCtl.Exist("tpl"))
+}
+
+func TestProxyConfigsController_Effective(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctl := NewController(genMockStore(t, mockCtl, nil, nil, nil))
+	assert.NoError(t, ctl.Templates().Add(newTestTemplate()))
+	cfgCtl := ctl.ProxyConfigs()
+
+	t.Run("template not exist", func(t *testing.T) {
+		err := cfgCtl.Add(&ProxyConfig{ServiceName: "svc", Template: "foo"})
+		assert.Equal(t, ErrTemplateNotExist, err)
+	})
+
+	t.Run("invalid merged config", func(t *testing.T) {
+		err := cfgCtl.Add(&ProxyConfig{
+			ServiceName: "svc",
+			Template:    "tpl",
+			Config:      &service.Config{Listener: &service.Listener{Address: &common.Address{Ip: "foo"}}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		overrides := &service.Config{LbPolicy: service.LoadBalancePolicy_RANDOM}
+		assert.NoError(t, cfgCtl.Add(&ProxyConfig{ServiceName: "svc", Template: "tpl", Config: overrides}))
+
+		cfg, err := cfgCtl.Get("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, "tpl", cfg.Template)
+		assert.Equal(t, overrides, cfg.Config)
+
+		cfg, err = cfgCtl.GetEffective("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, protocol.TCP, cfg.Config.Protocol)
+		assert.Equal(t, service.LoadBalancePolicy_RANDOM, cfg.Config.LbPolicy)
+	})
+
+	t.Run("unbind", func(t *testing.T) {
+		tpl := newTestTemplate()
+		assert.NoError(t, cfgCtl.Update(&ProxyConfig{ServiceName: "svc", Config: tpl.Config}))
+		cfg, err := cfgCtl.Get("svc")
+		assert.NoError(t, err)
+		assert.Empty(t, cfg.Template)
+		assert.False(t, ctl.Exist(NamespaceService, TypeServiceProxyConfigTemplate, "svc"))
+	})
+}
+
+// faultyStore fails the writes of the given type.
+type faultyStore struct {
+	Store
+	failType string
+}
+
+func (s *faultyStore) Add(ns, typ, key string, value []byte) error {
+	if typ == s.failType {
+		return errors.New("store failure")
+	}
+	return s.Store.Add(ns, typ, key, value)
+}
+
+func (s *faultyStore) Update(ns, typ, key string, value []byte) error {
+	if typ == s.failType {
+		return errors.New("store failure")
+	}
+	return s.Store.Update(ns, typ, key, value)
+}
+
+func (s *faultyStore) Del(ns, typ, key string) error {
+	if typ == s.failType {
+		return errors.New("store failure")
+	}
+	return s.Store.Del(ns, typ, key)
+}
+
+func TestProxyConfigsController_TemplateRollback(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	complete := newTestTemplate().Config
+	store := &faultyStore{Store: genMockStore(t, mockCtl, nil, ProxyConfigs{{ServiceName: "svc", Config: complete}}, nil)}
+	ctl := NewController(store)
+	assert.NoError(t, ctl.Templates().Add(newTestTemplate()))
+	cfgCtl := ctl.ProxyConfigs()
+	overrides := &service.Config{LbPolicy: service.LoadBalancePolicy_RANDOM}
+
+	t.Run("add existing", func(t *testing.T) {
+		assert.Equal(t, ErrExist, cfgCtl.Add(&ProxyConfig{ServiceName: "svc", Template: "tpl", Config: overrides}))
+		assert.False(t, ctl.Exist(NamespaceService, TypeServiceProxyConfigTemplate, "svc"))
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		store.failType = TypeServiceProxyConfig
+		defer func() { store.failType = "" }()
+		assert.Error(t, cfgCtl.Update(&ProxyConfig{ServiceName: "svc", Template: "tpl", Config: overrides}))
+		cfg, err := cfgCtl.Get("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, &ProxyConfig{ServiceName: "svc", Config: complete}, cfg)
+	})
+
+	t.Run("unbind", func(t *testing.T) {
+		assert.NoError(t, cfgCtl.Update(&ProxyConfig{ServiceName: "svc", Template: "tpl", Config: overrides}))
+		store.failType = TypeServiceProxyConfigTemplate
+		defer func() { store.failType = "" }()
+		assert.Error(t, cfgCtl.Update(&ProxyConfig{ServiceName: "svc", Config: complete}))
+		cfg, err := cfgCtl.Get("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, &ProxyConfig{ServiceName: "svc", Template: "tpl", Config: overrides}, cfg)
+	})
+}
+
+func TestProxyConfigsController_EffectiveEvents(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	ctl := NewController(genMockStore(t, mockCtl, nil, nil, nil))
+	assert.NoError(t, ctl.Templates().Add(newTestTemplate()))
+	assert.NoError(t, ctl.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc_1", Template: "tpl"}))
+	assert.NoError(t, ctl.ProxyConfigs().Add(&ProxyConfig{ServiceName: "svc_2", Template: "tpl"}))
+	cache, err := ctl.fetchAll()
+	assert.NoError(t, err)
+	ctl.storeCache(cache)
+
+	cfgCtl := ctl.ProxyConfigs()
+	events := cfgCtl.effectiveEvents(NewEvent(EventUpdate, NewRawConf(NamespaceTemplate, TypeTemplateProxyConfig, "tpl", nil)))
+	assert.Len(t, events, 2)
+	for _, evt := range events {
+		assert.Equal(t, EventUpdate, evt.Type)
+		assert.Equal(t, protocol.TCP, evt.ProxyConfig.Config.Protocol)
+	}
+
+	events = cfgCtl.effectiveEvents(NewEvent(EventAdd, NewRawConf(NamespaceService, TypeServiceProxyConfigTemplate, "svc_1", nil)))
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventUpdate, events[0].Type)
+
+	events = cfgCtl.effectiveEvents(NewEvent(EventDelete, NewRawConf(NamespaceService, TypeServiceProxyConfig, "svc_1", nil)))
+	assert.Equal(t, []*ProxyConfigEvent{{Type: EventDelete, ProxyConfig: &ProxyConfig{ServiceName: "svc_1"}}}, events)
+
+	events = cfgCtl.effectiveEvents(NewEvent(EventAdd, NewRawConf(NamespaceService, TypeServiceDependency, "svc_1", nil)))
+	assert.Empty(t, events)
+}
@@ -15,8 +15,10 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -153,7 +155,8 @@ func TestController_FetchAllWithError(t *testing.T) {
 	t.Run("Get", func(t *testing.T) {
 		s := NewMockStore(ctrl)
 		s.EXPECT().GetKeys(gomock.Any(), gomock.Any()).Return([]string{"key"}, nil)
-		s.EXPECT().Get(NamespaceService, TypeServiceProxyConfig, "key").Return(nil, errors.New("err")).AnyTimes()
+		// the order of fetching is random
+		s.EXPECT().Get(gomock.Any(), gomock.Any(), "key").Return(nil, errors.New("err")).AnyTimes()
 		c := NewController(s)
 		_, err := c.fetchAll()
 		assert.Error(t, err)
@@ -386,3 +389,74 @@ func TestController_KeysCached(t *testing.T) {
 		assert.ElementsMatch(t, []string{"k", "k1"}, keys)
 	})
 }
+
+func TestController_BackupAndRestore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("not supported", func(t *testing.T) {
+		c := NewController(NewMockStore(ctrl))
+		assert.Equal(t, ErrNotSupported, c.Backup(new(bytes.Buffer)))
+		assert.Equal(t, ErrNotSupported, c.Restore(new(bytes.Buffer)))
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		s := NewMockBackupableStore(ctrl)
+		s.EXPECT().Backup(gomock.Any()).DoAndReturn(func(w io.Writer) error {
+			_, err := w.Write([]byte("snapshot"))
+			return err
+		})
+		s.EXPECT().Restore(gomock.Any()).Return(nil)
+		c := NewController(s)
+
+		buf := new(bytes.Buffer)
+		assert.NoError(t, c.Backup(buf))
+		assert.Equal(t, "snapshot", buf.String())
+		assert.NoError(t, c.Restore(buf))
+		// should trigger a reload
+		assert.Len(t, c.updateCh, 1)
+	})
+}
+
+func TestController_ReadOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewController(NewMockStore(ctrl))
+	assert.False(t, c.ReadOnly())
+
+	s := NewMockReadOnlyStore(ctrl)
+	s.EXPECT().ReadOnly().Return(true)
+	c = NewController(s)
+	assert.True(t, c.ReadOnly())
+}
+
+func TestController_LastSyncTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewController(genMockStore(t, ctrl, nil, nil, nil), SyncInterval(time.Millisecond))
+	assert.True(t, c.LastSyncTime().IsZero())
+	assert.NoError(t, c.Start())
+	defer c.Stop()
+	time.Sleep(time.Millisecond * 50)
+	assert.False(t, c.LastSyncTime().IsZero())
+}
+
+func TestController_SetSyncInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewController(genMockStore(t, ctrl, nil, nil, nil), SyncInterval(time.Hour))
+	assert.NoError(t, c.Start())
+	defer c.Stop()
+	time.Sleep(time.Millisecond * 50)
+	lastSync := c.LastSyncTime()
+	assert.False(t, lastSync.IsZero())
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, lastSync, c.LastSyncTime())
+
+	c.SetSyncInterval(time.Millisecond)
+	time.Sleep(time.Millisecond * 50)
+	assert.True(t, c.LastSyncTime().After(lastSync))
+}
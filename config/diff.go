@@ -0,0 +1,137 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+)
+
+// DiffOp is the operation of a field diff.
+type DiffOp string
+
+const (
+	DiffAdd    DiffOp = "add"
+	DiffRemove DiffOp = "remove"
+	DiffChange DiffOp = "change"
+)
+
+// FieldDiff is the difference of a single field.
+type FieldDiff struct {
+	// Field is the path of field in the json form of service.Config.
+	Field string      `json:"field"`
+	Op    DiffOp      `json:"op"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// DiffServiceConfig returns the field-level differences from old to new,
+// the fields with default value are treated as absent.
+func DiffServiceConfig(old, new *service.Config) ([]*FieldDiff, error) {
+	o, err := toGeneric(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := toGeneric(new)
+	if err != nil {
+		return nil, err
+	}
+	diffs := []*FieldDiff{}
+	diffValue("", o, n, &diffs)
+	return diffs, nil
+}
+
+func toGeneric(cfg *service.Config) (interface{}, error) {
+	if cfg == nil {
+		return map[string]interface{}{}, nil
+	}
+	b, err := cfg.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func joinPath(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	return prefix + "." + field
+}
+
+func diffValue(path string, old, new interface{}, diffs *[]*FieldDiff) {
+	switch {
+	case old == nil && new == nil:
+		return
+	case old == nil:
+		*diffs = append(*diffs, &FieldDiff{Field: path, Op: DiffAdd, New: new})
+		return
+	case new == nil:
+		*diffs = append(*diffs, &FieldDiff{Field: path, Op: DiffRemove, Old: old})
+		return
+	}
+
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]struct{}, len(o)+len(n))
+		for k := range o {
+			keys[k] = struct{}{}
+		}
+		for k := range n {
+			keys[k] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValue(joinPath(path, k), o[k], n[k], diffs)
+		}
+		return
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			var ov, nv interface{}
+			if i < len(o) {
+				ov = o[i]
+			}
+			if i < len(n) {
+				nv = n[i]
+			}
+			diffValue(fmt.Sprintf("%s[%d]", path, i), ov, nv, diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*diffs = append(*diffs, &FieldDiff{Field: path, Op: DiffChange, Old: old, New: new})
+	}
+}
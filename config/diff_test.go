@@ -0,0 +1,73 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffServiceConfig(t *testing.T) {
+	timeout := time.Second
+	old := &service.Config{
+		Protocol: protocol.TCP,
+		Listener: &service.Listener{
+			Address: &common.Address{Ip: "0.0.0.0", Port: 80},
+		},
+		ConnectTimeout: &timeout,
+	}
+
+	t.Run("equal", func(t *testing.T) {
+		diffs, err := DiffServiceConfig(old, old)
+		assert.NoError(t, err)
+		assert.Empty(t, diffs)
+	})
+
+	t.Run("from nil", func(t *testing.T) {
+		diffs, err := DiffServiceConfig(nil, &service.Config{Protocol: protocol.TCP})
+		assert.NoError(t, err)
+		assert.Equal(t, []*FieldDiff{{Field: "protocol", Op: DiffAdd, New: "TCP"}}, diffs)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		new := &service.Config{
+			Protocol: protocol.Redis,
+			Listener: &service.Listener{
+				Address: &common.Address{Ip: "0.0.0.0", Port: 8080},
+			},
+		}
+		diffs, err := DiffServiceConfig(old, new)
+		assert.NoError(t, err)
+		assert.Equal(t, []*FieldDiff{
+			{Field: "connectTimeout", Op: DiffRemove, Old: "1s"},
+			{Field: "listener.address.port", Op: DiffChange, Old: float64(80), New: float64(8080)},
+			{Field: "protocol", Op: DiffChange, Old: "TCP", New: "Redis"},
+		}, diffs)
+	})
+}
+
+func TestDiffValueWithSlice(t *testing.T) {
+	var diffs []*FieldDiff
+	diffValue("a", []interface{}{"x", "y"}, []interface{}{"x", "z", "w"}, &diffs)
+	assert.Equal(t, []*FieldDiff{
+		{Field: "a[1]", Op: DiffChange, Old: "y", New: "z"},
+		{Field: "a[2]", Op: DiffAdd, New: "w"},
+	}, diffs)
+}
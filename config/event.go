@@ -14,6 +14,11 @@
 
 package config
 
+import (
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"go.opentelemetry.io/otel/trace"
+)
+
 // EventType indicates the type of event.
 type EventType uint8
 
@@ -24,10 +29,26 @@ const (
 	EventDelete
 )
 
+func (t EventType) String() string {
+	switch t {
+	case EventAdd:
+		return "add"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
 // Event represents a raw config event.
 type Event struct {
 	Type   EventType
 	Config *RawConf
+	// Trace is the span of dispatching the event, it's invalid if the
+	// change is not traced.
+	Trace trace.SpanContext
 }
 
 // DependencyEvent represents a dependency config event.
@@ -35,6 +56,7 @@ type DependencyEvent struct {
 	ServiceName string
 	Add         []string
 	Del         []string
+	Trace       trace.SpanContext
 }
 
 // InstanceEvent represents an instance config event.
@@ -47,6 +69,14 @@ type InstanceEvent struct {
 type ProxyConfigEvent struct {
 	Type        EventType
 	ProxyConfig *ProxyConfig
+	Trace       trace.SpanContext
+}
+
+// DefaultProxyConfigEvent represents a default proxy config event.
+type DefaultProxyConfigEvent struct {
+	Type   EventType
+	Config *service.Config
+	Trace  trace.SpanContext
 }
 
 // NewEvent return a new Event.
@@ -66,4 +96,6 @@ type (
 	InstanceEventHandler func(event *InstanceEvent)
 	// ProxyConfigEventHandler is used to handle proxy config event.
 	ProxyConfigEventHandler func(event *ProxyConfigEvent)
+	// DefaultProxyConfigEventHandler is used to handle default proxy config event.
+	DefaultProxyConfigEventHandler func(event *DefaultProxyConfigEvent)
 )
@@ -0,0 +1,143 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/utils"
+)
+
+// decode converts the yaml content into the json format which is
+// expected by the config controllers, and validates it by type. The
+// partial indicates the proxy config references a template.
+func decode(namespace, typ, key string, b []byte, partial bool) ([]byte, error) {
+	raw, err := utils.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	// empty file
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch {
+	case namespace == config.NamespaceService && typ == config.TypeServiceProxyConfig:
+		if partial {
+			return decodeServiceConfig(raw)
+		}
+		return decodeProxyConfig(key, raw)
+	case namespace == config.NamespaceService && typ == config.TypeServiceProxyConfigTemplate:
+		return decodeTemplateName(raw)
+	case namespace == config.NamespaceService && typ == config.TypeServiceProxyConfigOverride:
+		return decodeOverrides(key, raw)
+	case namespace == config.NamespaceTemplate && typ == config.TypeTemplateProxyConfig:
+		return decodeServiceConfig(raw)
+	case namespace == config.NamespaceGlobal && typ == config.TypeGlobalProxyConfig:
+		return decodeProxyConfig(key, raw)
+	case namespace == config.NamespaceService && typ == config.TypeServiceDependency:
+		return decodeDependency(key, raw)
+	case namespace == config.NamespaceSamaritan && typ == config.TypeSamaritanInstance:
+		return decodeInstance(key, raw)
+	default:
+		return raw, nil
+	}
+}
+
+func decodeProxyConfig(svc string, raw []byte) ([]byte, error) {
+	cfg := new(service.Config)
+	if err := cfg.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	pc := &config.ProxyConfig{
+		ServiceName: svc,
+		Config:      cfg,
+	}
+	if err := pc.Verify(); err != nil {
+		return nil, err
+	}
+	return cfg.MarshalJSON()
+}
+
+// decodeServiceConfig only checks the syntax, it's used by the partial configs.
+func decodeServiceConfig(raw []byte) ([]byte, error) {
+	cfg := new(service.Config)
+	if err := cfg.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return cfg.MarshalJSON()
+}
+
+func decodeTemplateName(raw []byte) ([]byte, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("empty template name")
+	}
+	return raw, nil
+}
+
+func decodeOverrides(svc string, raw []byte) ([]byte, error) {
+	var ovrs []*config.ProxyConfigOverride
+	if err := json.Unmarshal(raw, &ovrs); err != nil {
+		return nil, err
+	}
+	o := &config.ProxyConfigOverrides{
+		ServiceName: svc,
+		Overrides:   ovrs,
+	}
+	if err := o.Verify(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ovrs)
+}
+
+func decodeDependency(svc string, raw []byte) ([]byte, error) {
+	var deps []string
+	if err := json.Unmarshal(raw, &deps); err != nil {
+		return nil, err
+	}
+	dep := &config.Dependency{
+		ServiceName:  svc,
+		Dependencies: deps,
+	}
+	if err := dep.Verify(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(deps)
+}
+
+func decodeInstance(id string, raw []byte) ([]byte, error) {
+	inst := new(config.Instance)
+	if err := json.Unmarshal(raw, inst); err != nil {
+		return nil, err
+	}
+	if inst.ID == "" {
+		inst.ID = id
+	}
+	if inst.ID != id {
+		return nil, fmt.Errorf("id %s mismatches with the file name", inst.ID)
+	}
+	if err := inst.Verify(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(inst)
+}
@@ -0,0 +1,30 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var loadErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sash",
+	Subsystem: "config_file",
+	Name:      "load_errors",
+	Help:      "Files which failed to load in the latest reload, 1 for each.",
+}, []string{"path"})
+
+func init() {
+	prometheus.MustRegister(loadErrors)
+}
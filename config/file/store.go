@@ -0,0 +1,302 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+const defaultReloadInterval = 5 * time.Second
+
+var log = logger.Component("config").With("store", "file")
+
+// Config contains all configurations of the file store.
+type Config struct {
+	// Dir is the root of the directory tree, which is laid out as
+	// <namespace>/<type>/<key>.yaml, e.g. service/proxy-config/foo.yaml
+	// and template/proxy-config/default.yaml.
+	Dir string `yaml:"dir"`
+	// ReloadInterval is the interval to check whether the files have changed.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Verify verifies the config.
+func (c *Config) Verify() error {
+	if c.Dir == "" {
+		return errors.New("dir is empty")
+	}
+	return nil
+}
+
+// Store is a read-only implementation of config.SubscribableStore, which
+// loads all configs from a directory tree, such as a checkout of git repo.
+//
+// Every file is validated before loading, the broken ones are logged,
+// exported by sash_config_file_load_errors and skipped instead of aborting
+// the whole load. If a file was loaded successfully before, the last good
+// value is kept.
+type Store struct {
+	sync.RWMutex
+	cfg *Config
+
+	configs     *config.Cache
+	fingerprint uint64
+
+	evtCh       chan struct{}
+	subscribeNS map[string]struct{}
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a new Store.
+func New(cfg *Config) (*Store, error) {
+	if cfg == nil || cfg.Dir == "" {
+		return nil, errors.New("empty directory")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultReloadInterval
+	}
+	return &Store{
+		cfg:         cfg,
+		configs:     config.NewCache(),
+		evtCh:       make(chan struct{}, 1),
+		subscribeNS: make(map[string]struct{}),
+		stop:        make(chan struct{}),
+	}, nil
+}
+
+func (s *Store) Get(namespace, typ, key string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.configs.Get(namespace, typ, key)
+}
+
+func (s *Store) Add(namespace, typ, key string, value []byte) error {
+	return config.ErrReadOnly
+}
+
+func (s *Store) Update(namespace, typ, key string, value []byte) error {
+	return config.ErrReadOnly
+}
+
+func (s *Store) Del(namespace, typ, key string) error {
+	return config.ErrReadOnly
+}
+
+func (s *Store) Exist(namespace, typ, key string) bool {
+	_, err := s.Get(namespace, typ, key)
+	return err == nil
+}
+
+func (s *Store) GetKeys(namespace, typ string) ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.configs.Keys(namespace, typ)
+}
+
+// ReadOnly implements config.ReadOnlyStore.
+func (s *Store) ReadOnly() bool { return true }
+
+func (s *Store) Subscribe(namespace string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.subscribeNS[namespace] = struct{}{}
+	return nil
+}
+
+func (s *Store) UnSubscribe(namespace string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.subscribeNS, namespace)
+	return nil
+}
+
+func (s *Store) Event() <-chan struct{} {
+	return s.evtCh
+}
+
+// Start loads all configs and watches the changes of directory.
+func (s *Store) Start() error {
+	fi, err := os.Stat(s.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.cfg.Dir)
+	}
+	if err := s.reload(); err != nil {
+		return err
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return nil
+}
+
+// Stop stops watching.
+func (s *Store) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Store) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.reload(); err != nil {
+			log.Warnf("Reload configs from %s failed: %v", s.cfg.Dir, err)
+		}
+	}
+}
+
+type configFile struct {
+	path      string // relative path
+	namespace string
+	typ       string
+	key       string
+}
+
+// scan walks the directory and returns all config files with the
+// fingerprint of the tree, which is used to detect changes.
+func (s *Store) scan() ([]*configFile, uint64, error) {
+	var files []*configFile
+	hash := fnv.New64a()
+	err := filepath.Walk(s.cfg.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.cfg.Dir, path)
+		if err != nil {
+			return err
+		}
+		// skip hidden files and directories, such as .git
+		if rel != "." && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ext := filepath.Ext(rel)
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 3 {
+			return nil
+		}
+		files = append(files, &configFile{
+			path:      rel,
+			namespace: parts[0],
+			typ:       parts[1],
+			key:       strings.TrimSuffix(parts[2], ext),
+		})
+		_, _ = fmt.Fprintf(hash, "%s|%d|%d\n", rel, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, hash.Sum64(), nil
+}
+
+func (s *Store) reload() error {
+	files, fingerprint, err := s.scan()
+	if err != nil {
+		return err
+	}
+	s.RLock()
+	unchanged := fingerprint == s.fingerprint && s.fingerprint != 0
+	old := s.configs
+	s.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	// the proxy configs which reference a template are partial.
+	partial := make(map[string]bool)
+	for _, f := range files {
+		if f.namespace == config.NamespaceService && f.typ == config.TypeServiceProxyConfigTemplate {
+			partial[f.key] = true
+		}
+	}
+
+	configs := config.NewCache()
+	errs := make(map[string]error)
+	for _, f := range files {
+		if configs.Exist(f.namespace) {
+			if _, err := configs.Get(f.namespace, f.typ, f.key); err == nil {
+				errs[f.path] = fmt.Errorf("duplicate key %s", f.key)
+				continue
+			}
+		}
+		value, err := s.load(f, partial[f.key])
+		if err != nil {
+			errs[f.path] = err
+			log.With("file", f.path).Warnf("Load config file failed: %v", err)
+			// keep the last good value.
+			if value, err := old.Get(f.namespace, f.typ, f.key); err == nil {
+				configs.Set(f.namespace, f.typ, f.key, value)
+			}
+			continue
+		}
+		configs.Set(f.namespace, f.typ, f.key, value)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.configs = configs
+	loadErrors.Reset()
+	for path := range errs {
+		loadErrors.WithLabelValues(path).Set(1)
+	}
+	s.fingerprint = fingerprint
+	if len(s.subscribeNS) > 0 {
+		select {
+		case s.evtCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *Store) load(f *configFile, partial bool) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.cfg.Dir, f.path))
+	if err != nil {
+		return nil, err
+	}
+	return decode(f.namespace, f.typ, f.key, b, partial)
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+const validProxyConfig = `
+protocol: TCP
+listener:
+  address:
+    ip: 0.0.0.0
+    port: 6379
+connect_timeout: 3s
+`
+
+func writeFile(t *testing.T, dir, path, content string) {
+	path = filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestStore(t *testing.T, files map[string]string) (*Store, string, func()) {
+	dir, err := ioutil.TempDir("", "sash-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range files {
+		writeFile(t, dir, path, content)
+	}
+	s, err := New(&Config{Dir: dir, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir, func() { os.RemoveAll(dir) }
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+	_, err = New(&Config{})
+	assert.Error(t, err)
+}
+
+func TestStartWithBadDir(t *testing.T) {
+	s, err := New(&Config{Dir: "/path/not/exist"})
+	assert.NoError(t, err)
+	assert.Error(t, s.Start())
+}
+
+func TestLoad(t *testing.T) {
+	s, _, cleanup := newTestStore(t, map[string]string{
+		"service/proxy-config/svc_1.yaml":          validProxyConfig,
+		"service/proxy-config/svc_2.yml":           "protocol: TCP",
+		"service/proxy-config/svc_3.yaml":          "",
+		"service/dependency/svc_1.yaml":            "[dep_1, dep_2]",
+		"service/dependency/svc_2.yaml":            "foo: bar",
+		"samaritan/instance/inst_1.yaml":           "hostname: host_1\nbelong_service: svc_1",
+		"samaritan/instance/inst_2.yaml":           "id: inst_3",
+		"service/proxy-config/svc_4.yaml":          "connect_timeout: 1s",
+		"service/proxy-config-template/svc_4.yaml": "tpl",
+		"template/proxy-config/tpl.yaml":           "protocol: TCP",
+		"service/proxy-config-override/svc_1.yaml": "- name: canary\n  instances: [inst_1]\n  config:\n    connect_timeout: 1s",
+		"service/proxy-config-override/svc_2.yaml": "- name: canary\n  config:\n    connect_timeout: 1s",
+		"service/proxy-config/README.md":           "ignored",
+		"service/proxy-config.yaml":                "ignored",
+		".git/service/dependency/svc.yaml":         "ignored",
+	})
+	defer cleanup()
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	t.Run("proxy config", func(t *testing.T) {
+		b, err := s.Get(config.NamespaceService, config.TypeServiceProxyConfig, "svc_1")
+		assert.NoError(t, err)
+		cfg := new(service.Config)
+		assert.NoError(t, cfg.UnmarshalJSON(b))
+		assert.Equal(t, protocol.TCP, cfg.Protocol)
+		assert.Equal(t, uint32(6379), cfg.Listener.Address.Port)
+		assert.Equal(t, time.Second*3, *cfg.ConnectTimeout)
+
+		b, err = s.Get(config.NamespaceService, config.TypeServiceProxyConfig, "svc_3")
+		assert.NoError(t, err)
+		assert.Nil(t, b)
+
+		keys, err := s.GetKeys(config.NamespaceService, config.TypeServiceProxyConfig)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"svc_1", "svc_3", "svc_4"}, keys)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		b, err := s.Get(config.NamespaceService, config.TypeServiceProxyConfigTemplate, "svc_4")
+		assert.NoError(t, err)
+		assert.Equal(t, `"tpl"`, string(b))
+		b, err = s.Get(config.NamespaceTemplate, config.TypeTemplateProxyConfig, "tpl")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"protocol": "TCP"}`, string(b))
+	})
+
+	t.Run("override", func(t *testing.T) {
+		b, err := s.Get(config.NamespaceService, config.TypeServiceProxyConfigOverride, "svc_1")
+		assert.NoError(t, err)
+		var ovrs []*config.ProxyConfigOverride
+		assert.NoError(t, json.Unmarshal(b, &ovrs))
+		assert.Len(t, ovrs, 1)
+		assert.Equal(t, []string{"inst_1"}, ovrs[0].Instances)
+		assert.Equal(t, time.Second, *ovrs[0].Config.ConnectTimeout)
+	})
+
+	t.Run("dependency", func(t *testing.T) {
+		b, err := s.Get(config.NamespaceService, config.TypeServiceDependency, "svc_1")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `["dep_1", "dep_2"]`, string(b))
+		assert.False(t, s.Exist(config.NamespaceService, config.TypeServiceDependency, "svc"))
+	})
+
+	t.Run("instance", func(t *testing.T) {
+		b, err := s.Get(config.NamespaceSamaritan, config.TypeSamaritanInstance, "inst_1")
+		assert.NoError(t, err)
+		inst := new(config.Instance)
+		assert.NoError(t, json.Unmarshal(b, inst))
+		assert.Equal(t, "inst_1", inst.ID)
+		assert.Equal(t, "svc_1", inst.BelongService)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.Equal(t, 4, countLoadErrors())
+		for _, path := range []string{
+			filepath.Join("service", "proxy-config", "svc_2.yml"),
+			filepath.Join("service", "proxy-config-override", "svc_2.yaml"),
+			filepath.Join("service", "dependency", "svc_2.yaml"),
+			filepath.Join("samaritan", "instance", "inst_2.yaml"),
+		} {
+			assert.Equal(t, float64(1), testutil.ToFloat64(loadErrors.WithLabelValues(path)))
+		}
+	})
+}
+
+func countLoadErrors() int {
+	ch := make(chan prometheus.Metric, 100)
+	loadErrors.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestReadOnly(t *testing.T) {
+	s, _, cleanup := newTestStore(t, nil)
+	defer cleanup()
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	assert.True(t, s.ReadOnly())
+	assert.Equal(t, config.ErrReadOnly, s.Add("a", "b", "c", nil))
+	assert.Equal(t, config.ErrReadOnly, s.Update("a", "b", "c", nil))
+	assert.Equal(t, config.ErrReadOnly, s.Del("a", "b", "c"))
+}
+
+func TestReload(t *testing.T) {
+	s, dir, cleanup := newTestStore(t, map[string]string{
+		"service/dependency/svc_1.yaml": "[dep_1]",
+	})
+	defer cleanup()
+	assert.NoError(t, s.Subscribe(config.NamespaceService))
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+	<-s.Event()
+
+	waitEvent := func() {
+		select {
+		case <-s.Event():
+		case <-time.After(time.Second):
+			t.Fatal("wait event timeout")
+		}
+	}
+
+	t.Run("add", func(t *testing.T) {
+		writeFile(t, dir, "service/dependency/svc_2.yaml", "[dep_2]")
+		waitEvent()
+		assert.True(t, s.Exist(config.NamespaceService, config.TypeServiceDependency, "svc_2"))
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		writeFile(t, dir, "service/dependency/svc_1.yaml", "{")
+		waitEvent()
+		// keep the last good value.
+		b, err := s.Get(config.NamespaceService, config.TypeServiceDependency, "svc_1")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `["dep_1"]`, string(b))
+		assert.Equal(t, 1, countLoadErrors())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, os.Remove(filepath.Join(dir, "service/dependency/svc_1.yaml")))
+		waitEvent()
+		assert.False(t, s.Exist(config.NamespaceService, config.TypeServiceDependency, "svc_1"))
+		assert.Equal(t, 0, countLoadErrors())
+	})
+}
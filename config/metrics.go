@@ -0,0 +1,50 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	fetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "sash",
+		Subsystem: "config",
+		Name:      "fetch_duration_seconds",
+		Help:      "Duration of fetching all the configs from the config store.",
+	})
+	fetchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "config",
+		Name:      "fetch_errors_total",
+		Help:      "Total number of failed fetches.",
+	})
+	lastFetchSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sash",
+		Subsystem: "config",
+		Name:      "last_fetch_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful fetch.",
+	})
+	eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "config",
+		Name:      "events_total",
+		Help:      "Total number of config events.",
+	}, []string{"namespace", "type", "event"})
+)
+
+func init() {
+	prometheus.MustRegister(fetchDuration, fetchErrors, lastFetchSuccess, eventsTotal)
+}
@@ -18,11 +18,16 @@ package config
 
 import (
 	"errors"
+	"io"
 )
 
 var (
 	ErrNotExist = errors.New("config not exist")
 	ErrExist    = errors.New("config is exist")
+
+	ErrNotSupported    = errors.New("operation is not supported by the config store")
+	ErrReadOnly        = errors.New("config store is read-only")
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
 )
 
 // The store is a kv store.
@@ -47,3 +52,20 @@ type SubscribableStore interface {
 	UnSubscribe(namespace string) error
 	Event() <-chan struct{}
 }
+
+// BackupableStore allows you to dump the whole store into a snapshot,
+// and restore from it.
+type BackupableStore interface {
+	Store
+	Backup(w io.Writer) error
+	// Restore returns an error wrapping ErrInvalidSnapshot if the snapshot
+	// couldn't be read or is corrupt.
+	Restore(r io.Reader) error
+}
+
+// ReadOnlyStore is a store which rejects all writes, such as the one
+// syncing configs from an external source of truth.
+type ReadOnlyStore interface {
+	Store
+	ReadOnly() bool
+}
@@ -6,6 +6,7 @@ package config
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	io "io"
 	reflect "reflect"
 )
 
@@ -282,3 +283,277 @@ func (m *MockSubscribableStore) Event() <-chan struct{} {
 func (mr *MockSubscribableStoreMockRecorder) Event() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Event", reflect.TypeOf((*MockSubscribableStore)(nil).Event))
 }
+
+// MockBackupableStore is a mock of BackupableStore interface
+type MockBackupableStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockBackupableStoreMockRecorder
+}
+
+// MockBackupableStoreMockRecorder is the mock recorder for MockBackupableStore
+type MockBackupableStoreMockRecorder struct {
+	mock *MockBackupableStore
+}
+
+// NewMockBackupableStore creates a new mock instance
+func NewMockBackupableStore(ctrl *gomock.Controller) *MockBackupableStore {
+	mock := &MockBackupableStore{ctrl: ctrl}
+	mock.recorder = &MockBackupableStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockBackupableStore) EXPECT() *MockBackupableStoreMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method
+func (m *MockBackupableStore) Get(namespace, typ, key string) ([]byte, error) {
+	ret := m.ctrl.Call(m, "Get", namespace, typ, key)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockBackupableStoreMockRecorder) Get(namespace, typ, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockBackupableStore)(nil).Get), namespace, typ, key)
+}
+
+// Add mocks base method
+func (m *MockBackupableStore) Add(namespace, typ, key string, value []byte) error {
+	ret := m.ctrl.Call(m, "Add", namespace, typ, key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add
+func (mr *MockBackupableStoreMockRecorder) Add(namespace, typ, key, value interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockBackupableStore)(nil).Add), namespace, typ, key, value)
+}
+
+// Update mocks base method
+func (m *MockBackupableStore) Update(namespace, typ, key string, value []byte) error {
+	ret := m.ctrl.Call(m, "Update", namespace, typ, key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update
+func (mr *MockBackupableStoreMockRecorder) Update(namespace, typ, key, value interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockBackupableStore)(nil).Update), namespace, typ, key, value)
+}
+
+// Del mocks base method
+func (m *MockBackupableStore) Del(namespace, typ, key string) error {
+	ret := m.ctrl.Call(m, "Del", namespace, typ, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Del indicates an expected call of Del
+func (mr *MockBackupableStoreMockRecorder) Del(namespace, typ, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Del", reflect.TypeOf((*MockBackupableStore)(nil).Del), namespace, typ, key)
+}
+
+// Exist mocks base method
+func (m *MockBackupableStore) Exist(namespace, typ, key string) bool {
+	ret := m.ctrl.Call(m, "Exist", namespace, typ, key)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Exist indicates an expected call of Exist
+func (mr *MockBackupableStoreMockRecorder) Exist(namespace, typ, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exist", reflect.TypeOf((*MockBackupableStore)(nil).Exist), namespace, typ, key)
+}
+
+// GetKeys mocks base method
+func (m *MockBackupableStore) GetKeys(namespace, typ string) ([]string, error) {
+	ret := m.ctrl.Call(m, "GetKeys", namespace, typ)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetKeys indicates an expected call of GetKeys
+func (mr *MockBackupableStoreMockRecorder) GetKeys(namespace, typ interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKeys", reflect.TypeOf((*MockBackupableStore)(nil).GetKeys), namespace, typ)
+}
+
+// Start mocks base method
+func (m *MockBackupableStore) Start() error {
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockBackupableStoreMockRecorder) Start() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockBackupableStore)(nil).Start))
+}
+
+// Stop mocks base method
+func (m *MockBackupableStore) Stop() {
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockBackupableStoreMockRecorder) Stop() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockBackupableStore)(nil).Stop))
+}
+
+// Backup mocks base method
+func (m *MockBackupableStore) Backup(w io.Writer) error {
+	ret := m.ctrl.Call(m, "Backup", w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Backup indicates an expected call of Backup
+func (mr *MockBackupableStoreMockRecorder) Backup(w interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Backup", reflect.TypeOf((*MockBackupableStore)(nil).Backup), w)
+}
+
+// Restore mocks base method
+func (m *MockBackupableStore) Restore(r io.Reader) error {
+	ret := m.ctrl.Call(m, "Restore", r)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore
+func (mr *MockBackupableStoreMockRecorder) Restore(r interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockBackupableStore)(nil).Restore), r)
+}
+
+// MockReadOnlyStore is a mock of ReadOnlyStore interface
+type MockReadOnlyStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockReadOnlyStoreMockRecorder
+}
+
+// MockReadOnlyStoreMockRecorder is the mock recorder for MockReadOnlyStore
+type MockReadOnlyStoreMockRecorder struct {
+	mock *MockReadOnlyStore
+}
+
+// NewMockReadOnlyStore creates a new mock instance
+func NewMockReadOnlyStore(ctrl *gomock.Controller) *MockReadOnlyStore {
+	mock := &MockReadOnlyStore{ctrl: ctrl}
+	mock.recorder = &MockReadOnlyStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockReadOnlyStore) EXPECT() *MockReadOnlyStoreMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method
+func (m *MockReadOnlyStore) Get(namespace, typ, key string) ([]byte, error) {
+	ret := m.ctrl.Call(m, "Get", namespace, typ, key)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockReadOnlyStoreMockRecorder) Get(namespace, typ, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockReadOnlyStore)(nil).Get), namespace, typ, key)
+}
+
+// Add mocks base method
+func (m *MockReadOnlyStore) Add(namespace, typ, key string, value []byte) error {
+	ret := m.ctrl.Call(m, "Add", namespace, typ, key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add
+func (mr *MockReadOnlyStoreMockRecorder) Add(namespace, typ, key, value interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockReadOnlyStore)(nil).Add), namespace, typ, key, value)
+}
+
+// Update mocks base method
+func (m *MockReadOnlyStore) Update(namespace, typ, key string, value []byte) error {
+	ret := m.ctrl.Call(m, "Update", namespace, typ, key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update
+func (mr *MockReadOnlyStoreMockRecorder) Update(namespace, typ, key, value interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockReadOnlyStore)(nil).Update), namespace, typ, key, value)
+}
+
+// Del mocks base method
+func (m *MockReadOnlyStore) Del(namespace, typ, key string) error {
+	ret := m.ctrl.Call(m, "Del", namespace, typ, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Del indicates an expected call of Del
+func (mr *MockReadOnlyStoreMockRecorder) Del(namespace, typ, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Del", reflect.TypeOf((*MockReadOnlyStore)(nil).Del), namespace, typ, key)
+}
+
+// Exist mocks base method
+func (m *MockReadOnlyStore) Exist(namespace, typ, key string) bool {
+	ret := m.ctrl.Call(m, "Exist", namespace, typ, key)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Exist indicates an expected call of Exist
+func (mr *MockReadOnlyStoreMockRecorder) Exist(namespace, typ, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exist", reflect.TypeOf((*MockReadOnlyStore)(nil).Exist), namespace, typ, key)
+}
+
+// GetKeys mocks base method
+func (m *MockReadOnlyStore) GetKeys(namespace, typ string) ([]string, error) {
+	ret := m.ctrl.Call(m, "GetKeys", namespace, typ)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetKeys indicates an expected call of GetKeys
+func (mr *MockReadOnlyStoreMockRecorder) GetKeys(namespace, typ interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKeys", reflect.TypeOf((*MockReadOnlyStore)(nil).GetKeys), namespace, typ)
+}
+
+// Start mocks base method
+func (m *MockReadOnlyStore) Start() error {
+	ret := m.ctrl.Call(m, "Start")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start
+func (mr *MockReadOnlyStoreMockRecorder) Start() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockReadOnlyStore)(nil).Start))
+}
+
+// Stop mocks base method
+func (m *MockReadOnlyStore) Stop() {
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockReadOnlyStoreMockRecorder) Stop() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockReadOnlyStore)(nil).Stop))
+}
+
+// ReadOnly mocks base method
+func (m *MockReadOnlyStore) ReadOnly() bool {
+	ret := m.ctrl.Call(m, "ReadOnly")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// ReadOnly indicates an expected call of ReadOnly
+func (mr *MockReadOnlyStoreMockRecorder) ReadOnly() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadOnly", reflect.TypeOf((*MockReadOnlyStore)(nil).ReadOnly))
+}
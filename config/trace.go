@@ -0,0 +1,92 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/samaritan-proxy/sash/tracing"
+)
+
+// pendingTraceTTL is how long a traced change waits for its event, the
+// change may produce no event if the value is not changed actually.
+var pendingTraceTTL = time.Minute
+
+// pendingTrace is the span of a change which has been written to the store,
+// but not been observed by the controller yet.
+type pendingTrace struct {
+	sc   trace.SpanContext
+	time time.Time
+}
+
+func traceKey(namespace, typ, key string) string {
+	return namespace + "/" + typ + "/" + key
+}
+
+// traceChange records the span carried by ctx, which is continued when the
+// event of the change is dispatched.
+func (c *Controller) traceChange(ctx context.Context, namespace, typ, key string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	now := time.Now()
+	c.tracesMu.Lock()
+	defer c.tracesMu.Unlock()
+	for k, t := range c.traces {
+		if now.Sub(t.time) > pendingTraceTTL {
+			delete(c.traces, k)
+		}
+	}
+	c.traces[traceKey(namespace, typ, key)] = &pendingTrace{sc: sc, time: now}
+}
+
+func (c *Controller) takeTrace(namespace, typ, key string) *pendingTrace {
+	k := traceKey(namespace, typ, key)
+	c.tracesMu.Lock()
+	defer c.tracesMu.Unlock()
+	t, ok := c.traces[k]
+	if !ok {
+		return nil
+	}
+	delete(c.traces, k)
+	if time.Since(t.time) > pendingTraceTTL {
+		return nil
+	}
+	return t
+}
+
+// startDispatchSpan starts a span of dispatching the event if the change is
+// traced, the span is carried by the event and continued by the handlers.
+func (c *Controller) startDispatchSpan(event *Event) trace.Span {
+	t := c.takeTrace(event.Config.Namespace, event.Config.Type, event.Config.Key)
+	if t == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+	span := tracing.StartWithParent(t.sc, "config.dispatch", trace.WithAttributes(
+		attribute.String("config.namespace", event.Config.Namespace),
+		attribute.String("config.type", event.Config.Type),
+		attribute.String("config.key", event.Config.Key),
+		attribute.String("config.event", event.Type.String()),
+		// how long it takes the controller to observe the change.
+		attribute.Int64("config.delay_ms", int64(time.Since(t.time)/time.Millisecond)),
+	))
+	event.Trace = span.SpanContext()
+	return span
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/samaritan-proxy/sash/tracing"
+)
+
+func TestController_TraceChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	c := NewController(genMockStore(t, ctrl, nil, nil, nil), SyncInterval(time.Millisecond))
+	events := make(chan *DependencyEvent, 1)
+	c.Dependencies().RegisterEventHandler(func(event *DependencyEvent) {
+		events <- event
+	})
+	assert.NoError(t, c.Start())
+	defer c.Stop()
+
+	ctx, span := tracing.Start(context.Background(), "PUT /dependencies/{service}")
+	dep := &Dependency{ServiceName: "foo", Dependencies: []string{"bar"}}
+	assert.NoError(t, c.Dependencies().AddContext(ctx, dep))
+	span.End()
+
+	var event *DependencyEvent
+	select {
+	case event = <-events:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.True(t, event.Trace.IsValid())
+	assert.Equal(t, span.SpanContext().TraceID(), event.Trace.TraceID())
+
+	// wait the dispatch span ended.
+	time.Sleep(time.Millisecond * 10)
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	apiSpan, dispatch := spans[0], spans[1]
+	assert.Equal(t, "config.dispatch", dispatch.Name())
+	assert.Equal(t, span.SpanContext().SpanID(), dispatch.Parent().SpanID())
+	assert.Equal(t, event.Trace.SpanID(), dispatch.SpanContext().SpanID())
+	assert.Equal(t, "PUT /dependencies/{service}", apiSpan.Name())
+	attrs := attribute.NewSet(dispatch.Attributes()...)
+	for key, value := range map[attribute.Key]string{
+		"config.type":  TypeServiceDependency,
+		"config.key":   "foo",
+		"config.event": "add",
+	} {
+		v, _ := attrs.Value(key)
+		assert.Equal(t, value, v.AsString())
+	}
+
+	// the change without span is not traced.
+	dep.Dependencies = []string{"baz"}
+	assert.NoError(t, c.Dependencies().Update(dep))
+	select {
+	case event = <-events:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.False(t, event.Trace.IsValid())
+}
+
+func TestController_TakeTrace(t *testing.T) {
+	c := NewController(nil)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	c.traceChange(context.Background(), NamespaceService, TypeServiceDependency, "foo")
+	assert.Nil(t, c.takeTrace(NamespaceService, TypeServiceDependency, "foo"))
+
+	c.traceChange(ctx, NamespaceService, TypeServiceDependency, "foo")
+	trace := c.takeTrace(NamespaceService, TypeServiceDependency, "foo")
+	assert.NotNil(t, trace)
+	assert.Equal(t, sc, trace.sc)
+	// it's consumed.
+	assert.Nil(t, c.takeTrace(NamespaceService, TypeServiceDependency, "foo"))
+
+	c.traceChange(ctx, NamespaceService, TypeServiceDependency, "foo")
+	c.traces[traceKey(NamespaceService, TypeServiceDependency, "foo")].time = time.Now().Add(-pendingTraceTTL * 2)
+	assert.Nil(t, c.takeTrace(NamespaceService, TypeServiceDependency, "foo"))
+}
@@ -38,3 +38,12 @@ func diffSlice(a, b []string) (add, del []string) {
 	}
 	return
 }
+
+func containsString(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is a validation error of a single field.
+type FieldError struct {
+	// Field is the path of field in the json form of service.Config,
+	// such as "listener.address.port".
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
+
+// validationError is the interface implemented by the errors generated
+// by protoc-gen-validate.
+type validationError interface {
+	error
+	Field() string
+	Reason() string
+	Cause() error
+	Key() bool
+}
+
+// ValidateProxyConfig validates the ProxyConfig, returns the errors with
+// field paths, nil if it's valid.
+func ValidateProxyConfig(cfg *ProxyConfig) []*FieldError {
+	var errs []*FieldError
+	if len(cfg.ServiceName) == 0 {
+		errs = append(errs, &FieldError{Field: "service_name", Reason: "value is required"})
+	}
+	if err := cfg.Config.Validate(); err != nil {
+		errs = append(errs, toFieldError(err))
+	}
+	return errs
+}
+
+// Validate is same as ValidateProxyConfig, but validates the config which
+// is merged with the referenced template.
+func (c *ProxyConfigsController) Validate(cfg *ProxyConfig) []*FieldError {
+	merged, err := c.Effective(cfg)
+	switch err {
+	case nil:
+	case ErrTemplateNotExist:
+		return []*FieldError{{Field: "template", Reason: err.Error()}}
+	default:
+		return []*FieldError{{Reason: err.Error()}}
+	}
+	return ValidateProxyConfig(merged)
+}
+
+// toFieldError unwraps the nested validation errors to build the field path.
+func toFieldError(err error) *FieldError {
+	var (
+		path   []string
+		reason = err.Error()
+	)
+	for err != nil {
+		verr, ok := err.(validationError)
+		if !ok {
+			reason = err.Error()
+			break
+		}
+		field := lowerCamelCase(verr.Field())
+		if verr.Key() {
+			field += "<key>"
+		}
+		path = append(path, field)
+		reason = verr.Reason()
+		err = verr.Cause()
+		if err != nil {
+			if _, ok := err.(validationError); !ok {
+				reason = fmt.Sprintf("%s: %v", reason, err)
+				break
+			}
+		}
+	}
+	return &FieldError{
+		Field:  strings.Join(path, "."),
+		Reason: reason,
+	}
+}
+
+// lowerCamelCase converts the go field name into the json name used by
+// jsonpb, the index suffix like "[0]" is kept.
+func lowerCamelCase(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
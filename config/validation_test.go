@@ -0,0 +1,65 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateProxyConfig(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		errs := ValidateProxyConfig(&ProxyConfig{ServiceName: "svc"})
+		assert.Nil(t, errs)
+	})
+
+	t.Run("empty service name", func(t *testing.T) {
+		errs := ValidateProxyConfig(&ProxyConfig{})
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "service_name", errs[0].Field)
+	})
+
+	t.Run("nested field", func(t *testing.T) {
+		errs := ValidateProxyConfig(&ProxyConfig{
+			ServiceName: "svc",
+			Config: &service.Config{
+				Protocol: protocol.TCP,
+				Listener: &service.Listener{},
+			},
+		})
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "listener.address", errs[0].Field)
+		assert.Equal(t, "value is required", errs[0].Reason)
+	})
+
+	t.Run("deep nested field", func(t *testing.T) {
+		errs := ValidateProxyConfig(&ProxyConfig{
+			ServiceName: "svc",
+			Config: &service.Config{
+				Protocol: protocol.TCP,
+				Listener: &service.Listener{
+					Address: &common.Address{Ip: "foo", Port: 80},
+				},
+			},
+		})
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "listener.address.ip", errs[0].Field)
+		assert.Equal(t, "listener.address.ip: value must be a valid IP address", errs[0].Error())
+	})
+}
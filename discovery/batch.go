@@ -0,0 +1,188 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+type endpointOp uint8
+
+const (
+	endpointAdded endpointOp = iota + 1
+	endpointUpdated
+	endpointRemoved
+)
+
+// mergeEndpointOp returns the net operation of the two successive ones on
+// the same endpoint, zero means they cancel each other out.
+func mergeEndpointOp(prev, next endpointOp) endpointOp {
+	switch {
+	case prev == endpointAdded && next == endpointRemoved:
+		// the proxy never knows it.
+		return 0
+	case prev == endpointAdded:
+		return endpointAdded
+	case prev == endpointRemoved && next != endpointRemoved:
+		// the proxy still has it, but it may have changed.
+		return endpointUpdated
+	default:
+		return next
+	}
+}
+
+func endpointAddr(ep *service.Endpoint) string {
+	return net.JoinHostPort(ep.Address.Ip, strconv.Itoa(int(ep.Address.Port)))
+}
+
+type endpointChange struct {
+	op       endpointOp
+	endpoint *service.Endpoint
+}
+
+// endpointChanges is the merged changes of a service.
+type endpointChanges struct {
+	addrs   []string // in the order of arrival, may contain the cancelled ones.
+	changes map[string]*endpointChange
+	// whether an event without any change is merged, such as the one of
+	// subscribing a service which has no instance. It's still sent to
+	// acknowledge the subscription.
+	empty bool
+}
+
+func (c *endpointChanges) merge(op endpointOp, eps []*service.Endpoint) {
+	for _, ep := range eps {
+		addr := endpointAddr(ep)
+		prev, ok := c.changes[addr]
+		if !ok {
+			c.addrs = append(c.addrs, addr)
+			c.changes[addr] = &endpointChange{op: op, endpoint: ep}
+			continue
+		}
+		if prev.op == 0 {
+			// cancelled before.
+			prev.op = op
+		} else {
+			prev.op = mergeEndpointOp(prev.op, op)
+		}
+		prev.endpoint = ep
+	}
+}
+
+// endpointBatch merges the endpoint events by service during the debounce
+// window, the endpoints which are added and then removed in the same batch
+// are cancelled out.
+type endpointBatch struct {
+	events   int
+	svcNames []string // in the order of arrival
+	services map[string]*endpointChanges
+}
+
+func newEndpointBatch() *endpointBatch {
+	return &endpointBatch{
+		services: make(map[string]*endpointChanges),
+	}
+}
+
+func (b *endpointBatch) len() int {
+	return b.events
+}
+
+func (b *endpointBatch) add(event *endpointEvent) {
+	b.events++
+	c, ok := b.services[event.SvcName]
+	if !ok {
+		c = &endpointChanges{changes: make(map[string]*endpointChange)}
+		b.services[event.SvcName] = c
+		b.svcNames = append(b.svcNames, event.SvcName)
+	}
+	if len(event.Added)+len(event.Updated)+len(event.Removed) == 0 {
+		c.empty = true
+	}
+	c.merge(endpointAdded, event.Added)
+	c.merge(endpointUpdated, event.Updated)
+	c.merge(endpointRemoved, event.Removed)
+}
+
+// take returns the merged events and resets the batch, the services whose
+// changes are all cancelled out are omitted.
+func (b *endpointBatch) take() []*endpointEvent {
+	events := make([]*endpointEvent, 0, len(b.svcNames))
+	for _, svcName := range b.svcNames {
+		c := b.services[svcName]
+		event := &endpointEvent{SvcName: svcName}
+		for _, addr := range c.addrs {
+			change := c.changes[addr]
+			switch change.op {
+			case endpointAdded:
+				event.Added = append(event.Added, change.endpoint)
+			case endpointUpdated:
+				event.Updated = append(event.Updated, change.endpoint)
+			case endpointRemoved:
+				event.Removed = append(event.Removed, change.endpoint)
+			}
+		}
+		if len(event.Added)+len(event.Updated)+len(event.Removed) == 0 && !c.empty {
+			continue
+		}
+		events = append(events, event)
+	}
+	*b = *newEndpointBatch()
+	return events
+}
+
+// configBatch merges the config events during the debounce window, only the
+// latest one of each service is kept.
+type configBatch struct {
+	events   []*config.ProxyConfigEvent // all the events, for tracing.
+	svcNames []string                   // in the order of arrival
+	latest   map[string]*config.ProxyConfigEvent
+}
+
+func newConfigBatch() *configBatch {
+	return &configBatch{
+		latest: make(map[string]*config.ProxyConfigEvent),
+	}
+}
+
+func (b *configBatch) len() int {
+	return len(b.events)
+}
+
+func (b *configBatch) add(event *config.ProxyConfigEvent) {
+	b.events = append(b.events, event)
+	svcName := event.ProxyConfig.ServiceName
+	if _, ok := b.latest[svcName]; !ok {
+		b.svcNames = append(b.svcNames, svcName)
+	}
+	b.latest[svcName] = event
+}
+
+// take returns the latest events of services and all the merged ones, then
+// resets the batch.
+func (b *configBatch) take() (latest, all []*config.ProxyConfigEvent) {
+	latest = make([]*config.ProxyConfigEvent, 0, len(b.svcNames))
+	for _, svcName := range b.svcNames {
+		latest = append(latest, b.latest[svcName])
+	}
+	all = b.events
+	*b = *newConfigBatch()
+	return latest, all
+}
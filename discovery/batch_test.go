@@ -0,0 +1,174 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/api"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestMergeEndpointOp(t *testing.T) {
+	tests := []struct {
+		prev, next, expect endpointOp
+	}{
+		{endpointAdded, endpointAdded, endpointAdded},
+		{endpointAdded, endpointUpdated, endpointAdded},
+		{endpointAdded, endpointRemoved, 0},
+		{endpointUpdated, endpointUpdated, endpointUpdated},
+		{endpointUpdated, endpointRemoved, endpointRemoved},
+		{endpointRemoved, endpointAdded, endpointUpdated},
+		{endpointRemoved, endpointUpdated, endpointUpdated},
+		{endpointRemoved, endpointRemoved, endpointRemoved},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expect, mergeEndpointOp(test.prev, test.next), "%d then %d", test.prev, test.next)
+	}
+}
+
+func TestEndpointBatch(t *testing.T) {
+	ep1, ep2, ep3 := makeEndpoint("10.0.0.1", 80), makeEndpoint("10.0.0.2", 80), makeEndpoint("10.0.0.3", 80)
+	b := newEndpointBatch()
+	b.add(&endpointEvent{SvcName: "foo", Added: []*service.Endpoint{ep1, ep2}})
+	b.add(&endpointEvent{SvcName: "bar", Added: []*service.Endpoint{ep1}})
+	b.add(&endpointEvent{SvcName: "foo", Removed: []*service.Endpoint{ep1}, Added: []*service.Endpoint{ep3}})
+	// cancelled out
+	b.add(&endpointEvent{SvcName: "bar", Removed: []*service.Endpoint{ep1}})
+	// no change but acknowledges the subscription.
+	b.add(&endpointEvent{SvcName: "zoo"})
+	assert.Equal(t, 5, b.len())
+
+	assert.Equal(t, []*endpointEvent{
+		{SvcName: "foo", Added: []*service.Endpoint{ep2, ep3}},
+		{SvcName: "zoo"},
+	}, b.take())
+	assert.Equal(t, 0, b.len())
+	assert.Empty(t, b.take())
+
+	// cancelled out and then added again.
+	b.add(&endpointEvent{SvcName: "foo", Added: []*service.Endpoint{ep1}})
+	b.add(&endpointEvent{SvcName: "foo", Removed: []*service.Endpoint{ep1}})
+	b.add(&endpointEvent{SvcName: "foo", Added: []*service.Endpoint{ep1}})
+	assert.Equal(t, []*endpointEvent{
+		{SvcName: "foo", Added: []*service.Endpoint{ep1}},
+	}, b.take())
+}
+
+func makeConfigEvent(typ config.EventType, svcName string, cfg *service.Config) *config.ProxyConfigEvent {
+	return &config.ProxyConfigEvent{
+		Type:        typ,
+		ProxyConfig: &config.ProxyConfig{ServiceName: svcName, Config: cfg},
+	}
+}
+
+func TestConfigBatch(t *testing.T) {
+	cfg1, cfg2 := &service.Config{}, &service.Config{LbPolicy: service.LoadBalancePolicy_RANDOM}
+	e1 := makeConfigEvent(config.EventAdd, "foo", cfg1)
+	e2 := makeConfigEvent(config.EventAdd, "bar", cfg1)
+	e3 := makeConfigEvent(config.EventUpdate, "foo", cfg2)
+
+	b := newConfigBatch()
+	b.add(e1)
+	b.add(e2)
+	b.add(e3)
+	assert.Equal(t, 3, b.len())
+	latest, all := b.take()
+	assert.Equal(t, []*config.ProxyConfigEvent{e3, e2}, latest)
+	assert.Equal(t, []*config.ProxyConfigEvent{e1, e2, e3}, all)
+	assert.Equal(t, 0, b.len())
+}
+
+func TestEndpointDiscoverySessionDebounce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stream := makeSvcEndpointsStream(ctrl)
+	quit := make(chan struct{})
+	stream.EXPECT().Recv().DoAndReturn(func() (*api.SvcEndpointDiscoveryRequest, error) {
+		<-quit
+		return nil, context.Canceled
+	})
+	ep1, ep2 := makeEndpoint("10.0.0.1", 80), makeEndpoint("10.0.0.2", 80)
+	stream.EXPECT().Send(&api.SvcEndpointDiscoveryResponse{
+		SvcName: "foo",
+		Added:   []*service.Endpoint{ep2},
+	}).DoAndReturn(func(*api.SvcEndpointDiscoveryResponse) error {
+		close(quit)
+		return nil
+	})
+
+	session := newEndpointDiscoverySession(stream)
+	session.SetDebounce(time.Millisecond * 50)
+	session.SendEvent(&endpointEvent{SvcName: "foo", Added: []*service.Endpoint{ep1}})
+	session.SendEvent(&endpointEvent{SvcName: "foo", Added: []*service.Endpoint{ep2}})
+	session.SendEvent(&endpointEvent{SvcName: "foo", Removed: []*service.Endpoint{ep1}})
+	assert.NoError(t, session.Serve())
+}
+
+func TestConfigDiscoverySessionDebounce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stream := makeSvcConfigsStream(ctrl)
+	quit := make(chan struct{})
+	stream.EXPECT().Recv().DoAndReturn(func() (*api.SvcConfigDiscoveryRequest, error) {
+		<-quit
+		return nil, context.Canceled
+	})
+	cfg := &service.Config{LbPolicy: service.LoadBalancePolicy_RANDOM}
+	stream.EXPECT().Send(&api.SvcConfigDiscoveryResponse{
+		Updated: map[string]*service.Config{"foo": cfg, "bar": nil},
+	}).DoAndReturn(func(*api.SvcConfigDiscoveryResponse) error {
+		close(quit)
+		return nil
+	})
+
+	session := newConfigDiscoverySession(stream)
+	session.SetDebounce(time.Millisecond * 50)
+	session.SendEvent(makeConfigEvent(config.EventAdd, "foo", &service.Config{}))
+	session.SendEvent(makeConfigEvent(config.EventDelete, "bar", nil))
+	session.SendEvent(makeConfigEvent(config.EventUpdate, "foo", cfg))
+	assert.NoError(t, session.Serve())
+}
+
+func TestSessionDebounceFlushOnDrain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stream := makeSvcConfigsStream(ctrl)
+	quit := make(chan struct{})
+	defer close(quit)
+	stream.EXPECT().Recv().DoAndReturn(func() (*api.SvcConfigDiscoveryRequest, error) {
+		<-quit
+		return nil, context.Canceled
+	}).AnyTimes()
+	stream.EXPECT().Send(&api.SvcConfigDiscoveryResponse{
+		Updated: map[string]*service.Config{"foo": {}, "bar": {}},
+	})
+
+	session := newConfigDiscoverySession(stream)
+	session.SetDebounce(time.Hour)
+	session.SendEvent(makeConfigEvent(config.EventAdd, "foo", &service.Config{}))
+	session.SendEvent(makeConfigEvent(config.EventAdd, "bar", &service.Config{}))
+	session.drain()
+	assert.Equal(t, errDraining, session.Serve())
+}
@@ -15,14 +15,20 @@
 package discovery
 
 import (
+	"net"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/samaritan-proxy/samaritan-api/go/api"
 	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 
 	"github.com/samaritan-proxy/sash/config"
 	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/tracing"
 )
 
 //go:generate mockgen -package $GOPACKAGE -self_package github.com/samaritan-proxy/sash/$GOPACKAGE --destination ./mock_config_test.go github.com/samaritan-proxy/samaritan-api/go/api DiscoveryService_StreamSvcConfigsServer
@@ -32,26 +38,52 @@ type (
 	configUnsubHandler func(svcName string, session *configDiscoverySession)
 )
 
+// instanceIDMetadataKey is the grpc metadata key which carries the id of
+// samaritan instance, it's used to resolve the proxy config overrides.
+const instanceIDMetadataKey = "x-samaritan-instance-id"
+
 type configDiscoverySession struct {
 	stream api.DiscoveryService_StreamSvcConfigsServer
 	remote *peer.Peer
+	instID string
+	// inst is the identified samaritan instance, it's resolved when the
+	// session starts and refreshed on the instance events. It's guarded
+	// by the server.
+	inst *config.Instance
+	log  *logger.Logger
 
 	subscribed map[string]struct{} // subscribed services.
 	subHdlr    configSubHandler
 	unsubHdlr  configUnsubHandler
 	eventCh    chan *config.ProxyConfigEvent
+	debounce   time.Duration
+	batch      *configBatch
+	limiter    *subscribeLimiter
+	recvErr    error // why the receiving stops, it's set before recvDone is closed.
 
+	*drainSignal
 	quit chan struct{}
 }
 
 func newConfigDiscoverySession(stream api.DiscoveryService_StreamSvcConfigsServer) *configDiscoverySession {
-	remote, _ := peer.FromContext(stream.Context())
+	ctx := stream.Context()
+	remote, _ := peer.FromContext(ctx)
+	var instID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(instanceIDMetadataKey); len(ids) > 0 {
+			instID = ids[0]
+		}
+	}
 	return &configDiscoverySession{
-		stream:     stream,
-		remote:     remote,
-		subscribed: make(map[string]struct{}, 8),
-		eventCh:    make(chan *config.ProxyConfigEvent, 16),
-		quit:       make(chan struct{}),
+		stream:      stream,
+		remote:      remote,
+		instID:      instID,
+		log:         log.With("stream", streamConfig, "remote", remoteAddr(remote), "instance", instID),
+		subscribed:  make(map[string]struct{}, 8),
+		eventCh:     make(chan *config.ProxyConfigEvent, 16),
+		batch:       newConfigBatch(),
+		drainSignal: newDrainSignal(),
+		quit:        make(chan struct{}),
 	}
 }
 
@@ -63,15 +95,39 @@ func (s *configDiscoverySession) SetUnsubscribeHandler(hdlr configUnsubHandler)
 	s.unsubHdlr = hdlr
 }
 
-func (s *configDiscoverySession) Serve() {
+// SetDebounce sets how long to batch the events before sending, zero means
+// sending every event at once.
+func (s *configDiscoverySession) SetDebounce(d time.Duration) {
+	s.debounce = d
+}
+
+// SetSubscribeLimiter sets the limiter of subscribing, nil means unlimited.
+func (s *configDiscoverySession) SetSubscribeLimiter(l *subscribeLimiter) {
+	s.limiter = l
+}
+
+// Serve serves the session until the stream is broken or drained, it returns
+// errDraining if drained.
+func (s *configDiscoverySession) Serve() error {
+	sessions.add(streamConfig, s)
 	recvDone := make(chan struct{})
 	defer func() {
+		sessions.remove(streamConfig, s)
 		close(s.quit)
-		// wait recv goroutine done
-		<-recvDone
-		// unsubscribe all the services.
-		s.unsubscribeAll()
-		logger.Debugf("Config discovery session %s exit", s.remote.Addr)
+		cleanup := func() {
+			// wait recv goroutine done
+			<-recvDone
+			// unsubscribe all the services.
+			s.unsubscribeAll()
+			s.log.Debug("Config discovery session exit")
+		}
+		if s.drained() {
+			// the receiving is stopped by closing the stream, which
+			// happens after returning.
+			go cleanup()
+			return
+		}
+		cleanup()
 	}()
 
 	go func() {
@@ -79,53 +135,151 @@ func (s *configDiscoverySession) Serve() {
 		for {
 			req, err := s.stream.Recv()
 			if err != nil {
-				logger.Warnf("Read from service config stream %s failed: %v", s.remote.Addr, err)
+				s.log.Warnf("Read from service config stream failed: %v", err)
 				return
 			}
 
-			s.handleSubscribe(req.SvcNamesSubscribe...)
+			if err := s.handleSubscribe(req.SvcNamesSubscribe...); err != nil {
+				s.log.Warnf("Subscription rejected: %v", err)
+				s.recvErr = err
+				return
+			}
 			s.handleUnsubscribe(req.SvcNamesUnsubscribe...)
 		}
 	}()
 
-	var event *config.ProxyConfigEvent
+	var (
+		debounce   *time.Timer
+		debounceCh <-chan time.Time
+	)
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+	}()
 	for {
 		select {
-		case event = <-s.eventCh:
+		case event := <-s.eventCh:
+			if s.debounce <= 0 {
+				if err := s.send(event); err != nil {
+					return nil
+				}
+				continue
+			}
+			s.batch.add(event)
+			if debounceCh == nil {
+				debounce = time.NewTimer(s.debounce)
+				debounceCh = debounce.C
+			}
+		case <-debounceCh:
+			debounceCh = nil
+			if err := s.sendBatch(); err != nil {
+				return nil
+			}
+		case <-s.drainCh:
+			s.flush()
+			return errDraining
 		case <-recvDone:
-			return
+			return s.recvErr
 		}
+	}
+}
+
+func (s *configDiscoverySession) send(event *config.ProxyConfigEvent) error {
+	events := []*config.ProxyConfigEvent{event}
+	return s.sendConfigs(events, events)
+}
 
-		var cfg *service.Config
-		switch event.Type {
-		case config.EventAdd, config.EventUpdate:
-			cfg = event.ProxyConfig.Config
+// configOf returns the config of service in the response. A null config
+// means the service has no config, neither its own nor the global default
+// one, so an empty config is sent as a non-null one to be distinguishable.
+func configOf(event *config.ProxyConfigEvent) *service.Config {
+	if event.Type == config.EventDelete {
+		return nil
+	}
+	if event.ProxyConfig.Config == nil {
+		return &service.Config{}
+	}
+	return event.ProxyConfig.Config
+}
+
+// sendBatch sends the batched events in one response.
+func (s *configDiscoverySession) sendBatch() error {
+	latest, all := s.batch.take()
+	if len(latest) == 0 {
+		return nil
+	}
+	eventsMerged.WithLabelValues(streamConfig).Add(float64(len(all) - 1))
+	return s.sendConfigs(latest, all)
+}
+
+// sendConfigs sends the configs carried by the latest events of services in
+// one response, all is the events merged into them which are traced.
+func (s *configDiscoverySession) sendConfigs(latest, all []*config.ProxyConfigEvent) error {
+	resp := &api.SvcConfigDiscoveryResponse{
+		Updated: make(map[string]*service.Config, len(latest)),
+	}
+	svcNames := make([]string, 0, len(latest))
+	for _, event := range latest {
+		resp.Updated[event.ProxyConfig.ServiceName] = configOf(event)
+		svcNames = append(svcNames, event.ProxyConfig.ServiceName)
+	}
+	spans := make([]trace.Span, 0, len(all))
+	for _, event := range all {
+		spans = append(spans, startSendSpan(event.Trace, streamConfig, s.remote, s.instID, event.ProxyConfig.ServiceName))
+	}
+	startTime := time.Now()
+	err := s.stream.Send(resp)
+	observeSend(streamConfig, startTime, err)
+	for _, span := range spans {
+		tracing.RecordError(span, err)
+		span.End()
+	}
+	if err != nil {
+		s.log.With("services", svcNames).Warnf("Send to config stream failed: %v", err)
+	}
+	return err
+}
+
+// flush sends the queued and batched events, it stops at the first failure.
+func (s *configDiscoverySession) flush() {
+	for {
+		select {
+		case event := <-s.eventCh:
+			if s.debounce > 0 {
+				s.batch.add(event)
+				continue
+			}
+			if err := s.send(event); err != nil {
+				return
+			}
 		default:
-		}
-		resp := &api.SvcConfigDiscoveryResponse{
-			Updated: map[string]*service.Config{
-				event.ProxyConfig.ServiceName: cfg,
-			},
-		}
-		if err := s.stream.Send(resp); err != nil {
-			logger.Warnf("Send to config stream %s failed: %v", s.remote.Addr, err)
+			if s.debounce > 0 {
+				s.sendBatch()
+			}
 			return
 		}
 	}
 }
 
-func (s *configDiscoverySession) handleSubscribe(svcNames ...string) {
+// handleSubscribe subscribes the services, it stops at the first one which
+// exceeds the limits.
+func (s *configDiscoverySession) handleSubscribe(svcNames ...string) error {
 	for _, svcName := range svcNames {
 		_, ok := s.subscribed[svcName]
 		if ok {
 			continue
 		}
+		if err := s.limiter.allow(len(s.subscribed)); err != nil {
+			return err
+		}
 
 		if s.subHdlr != nil {
 			s.subHdlr(svcName, s)
 		}
 		s.subscribed[svcName] = struct{}{}
 	}
+	return nil
 }
 
 func (s *configDiscoverySession) handleUnsubscribe(svcNames ...string) {
@@ -151,24 +305,43 @@ func (s *configDiscoverySession) SendEvent(event *config.ProxyConfigEvent) {
 	select {
 	case s.eventCh <- event:
 	case <-s.quit:
+		eventsDropped.WithLabelValues(streamConfig).Inc()
 	}
 }
 
+func (s *configDiscoverySession) queueLen() int {
+	return len(s.eventCh)
+}
+
 type configDiscoverySessions map[*configDiscoverySession]interface{}
 
 type configDiscoveryServer struct {
 	sync.RWMutex
-	cfgCtl *config.ProxyConfigsController
-
+	cfgCtl    *config.ProxyConfigsController
+	defCfgCtl *config.DefaultProxyConfigController
+	ovrCtl    *config.ProxyConfigOverridesController
+	instCtl   *config.InstancesController
+	drainer   *drainer
+	debounce  time.Duration
+	limits    subscribeLimits
+
+	sessions    configDiscoverySessions
 	subscribers map[string]configDiscoverySessions
 }
 
 func newConfigDiscoveryServer(ctl *config.Controller) *configDiscoveryServer {
 	s := &configDiscoveryServer{
 		cfgCtl:      ctl.ProxyConfigs(),
+		defCfgCtl:   ctl.DefaultProxyConfig(),
+		ovrCtl:      ctl.ProxyConfigOverrides(),
+		instCtl:     ctl.Instances(),
+		drainer:     newDrainer(),
+		sessions:    configDiscoverySessions{},
 		subscribers: make(map[string]configDiscoverySessions),
 	}
 	s.cfgCtl.RegisterEventHandler(s.dispatchEvent)
+	s.defCfgCtl.RegisterEventHandler(s.dispatchDefaultEvent)
+	s.instCtl.RegisterEventHandler(s.handleInstanceEvent)
 	return s
 }
 
@@ -177,8 +350,178 @@ func (s *configDiscoveryServer) dispatchEvent(evt *config.ProxyConfigEvent) {
 	defer s.RUnlock()
 	subscribers := s.subscribers[evt.ProxyConfig.ServiceName]
 	for subscriber := range subscribers {
-		subscriber.SendEvent(evt)
+		subscriber.SendEvent(s.resolveEvent(subscriber, evt))
+	}
+}
+
+// instanceOf returns the samaritan instance of session. The instance is
+// identified by the id carried in metadata, or the remote ip if there is
+// exactly one registered instance with it. Returns nil if unknown. All the
+// instances are listed by getAll only if the session carries no id.
+func (s *configDiscoveryServer) instanceOf(c *configDiscoverySession, getAll func() (config.Instances, error)) *config.Instance {
+	if len(c.instID) > 0 {
+		inst, err := s.instCtl.GetCache(c.instID)
+		if err != nil {
+			// the instance may not be registered yet, but it still could
+			// match the overrides by id.
+			return &config.Instance{ID: c.instID}
+		}
+		return inst
+	}
+	if c.remote == nil || c.remote.Addr == nil {
+		return nil
+	}
+	ip, _, err := net.SplitHostPort(c.remote.Addr.String())
+	if err != nil {
+		return nil
+	}
+	insts, err := getAll()
+	if err != nil {
+		return nil
 	}
+	var res *config.Instance
+	for _, inst := range insts {
+		if inst.IP != ip {
+			continue
+		}
+		if res != nil {
+			// ambiguous
+			return nil
+		}
+		res = inst
+	}
+	return res
+}
+
+// sameIdentity reports whether the two instances match the same overrides,
+// that is, they have the same id and labels, see config.Instance.Label.
+func sameIdentity(a, b *config.Instance) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID && a.Version == b.Version && a.Hostname == b.Hostname && a.IP == b.IP &&
+		a.BelongService == b.BelongService && reflect.DeepEqual(a.Labels, b.Labels)
+}
+
+// handleInstanceEvent identifies the instances of the affected sessions again,
+// and pushes the configs of the subscribed services whose applied override is
+// changed.
+func (s *configDiscoveryServer) handleInstanceEvent(evt *config.InstanceEvent) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		insts  config.Instances
+		listed bool
+		err    error
+	)
+	getAll := func() (config.Instances, error) {
+		if !listed {
+			insts, err = s.instCtl.GetAllCache()
+			listed = true
+		}
+		return insts, err
+	}
+	for c := range s.sessions {
+		// the sessions without id are identified by ip, which may become
+		// (un)ambiguous by the changes of any instance.
+		if len(c.instID) > 0 && c.instID != evt.Instance.ID {
+			continue
+		}
+		old := c.inst
+		c.inst = s.instanceOf(c, getAll)
+		if sameIdentity(old, c.inst) {
+			continue
+		}
+		s.pushResolved(c, old)
+	}
+}
+
+// pushResolved pushes the configs of the services subscribed by the session
+// whose most specific override is changed since the session's instance was
+// old.
+func (s *configDiscoveryServer) pushResolved(c *configDiscoverySession, old *config.Instance) {
+	for svcName, subscribers := range s.subscribers {
+		if _, ok := subscribers[c]; !ok {
+			continue
+		}
+		ovrs, err := s.ovrCtl.GetCache(svcName)
+		if err != nil {
+			continue
+		}
+		if ovrs.MostSpecific(old) == ovrs.MostSpecific(c.inst) {
+			continue
+		}
+		cfg, err := s.cfgCtl.GetEffectiveCache(svcName)
+		if err != nil {
+			continue
+		}
+		c.SendEvent(&config.ProxyConfigEvent{
+			Type:        config.EventUpdate,
+			ProxyConfig: ovrs.Resolve(cfg, c.inst),
+		})
+	}
+}
+
+// resolveEvent applies the most specific override of the session's instance
+// on the proxy config carried by event.
+func (s *configDiscoveryServer) resolveEvent(c *configDiscoverySession, evt *config.ProxyConfigEvent) *config.ProxyConfigEvent {
+	if evt.Type == config.EventDelete || evt.ProxyConfig == nil || evt.ProxyConfig.Config == nil {
+		return evt
+	}
+	ovrs, err := s.ovrCtl.GetCache(evt.ProxyConfig.ServiceName)
+	if err != nil {
+		return evt
+	}
+	cfg := ovrs.Resolve(evt.ProxyConfig, c.inst)
+	if cfg == evt.ProxyConfig {
+		return evt
+	}
+	return &config.ProxyConfigEvent{
+		Type:        evt.Type,
+		ProxyConfig: cfg,
+		Trace:       evt.Trace,
+	}
+}
+
+// dispatchDefaultEvent pushes the global default config to the subscribers
+// of the services which have no proxy config.
+func (s *configDiscoveryServer) dispatchDefaultEvent(evt *config.DefaultProxyConfigEvent) {
+	s.RLock()
+	defer s.RUnlock()
+	for svcName, subscribers := range s.subscribers {
+		if len(subscribers) == 0 {
+			continue
+		}
+		if _, err := s.cfgCtl.GetCache(svcName); err != config.ErrNotExist {
+			continue
+		}
+		event := &config.ProxyConfigEvent{
+			Type: evt.Type,
+			ProxyConfig: &config.ProxyConfig{
+				ServiceName: svcName,
+				Config:      evt.Config,
+			},
+			Trace: evt.Trace,
+		}
+		for subscriber := range subscribers {
+			subscriber.SendEvent(s.resolveEvent(subscriber, event))
+		}
+	}
+}
+
+// addSession identifies the instance of session once, then keeps it up to
+// date on the instance events.
+func (s *configDiscoveryServer) addSession(c *configDiscoverySession) {
+	s.Lock()
+	defer s.Unlock()
+	c.inst = s.instanceOf(c, s.instCtl.GetAllCache)
+	s.sessions[c] = struct{}{}
+}
+
+func (s *configDiscoveryServer) removeSession(c *configDiscoverySession) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.sessions, c)
 }
 
 func (s *configDiscoveryServer) handleSubscribe(svcName string, c *configDiscoverySession) {
@@ -197,15 +540,28 @@ func (s *configDiscoveryServer) handleSubscribe(svcName string, c *configDiscove
 
 	subscribers[c] = struct{}{}
 
-	// send config when first subscribe
-	cfg, err := s.cfgCtl.GetCache(svcName)
-	if err != nil {
+	// send the effective config when first subscribe, fallback to the
+	// global default one if the service has no proxy config. If neither
+	// exists, the removal is sent to acknowledge the subscription, and the
+	// stale config kept by the proxy since the last connection is dropped.
+	cfg, err := s.cfgCtl.GetEffectiveCache(svcName)
+	switch err {
+	case nil:
+	case config.ErrNotExist:
+		c.SendEvent(&config.ProxyConfigEvent{
+			Type:        config.EventDelete,
+			ProxyConfig: &config.ProxyConfig{ServiceName: svcName},
+		})
+		return
+	default:
+		// the proxy keeps its config rather than dropping it.
+		c.log.With("service", svcName).Warnf("Failed to get the effective proxy config: %v", err)
 		return
 	}
-	c.SendEvent(&config.ProxyConfigEvent{
+	c.SendEvent(s.resolveEvent(c, &config.ProxyConfigEvent{
 		Type:        config.EventAdd,
 		ProxyConfig: cfg,
-	})
+	}))
 }
 
 func (s *configDiscoveryServer) handleUnsubscribe(svcName string, c *configDiscoverySession) {
@@ -226,8 +582,15 @@ func (s *configDiscoveryServer) Subscribers() map[string]configDiscoverySessions
 
 func (s *configDiscoveryServer) StreamSvcConfigs(stream api.DiscoveryService_StreamSvcConfigsServer) error {
 	session := newConfigDiscoverySession(stream)
+	if err := s.drainer.add(session); err != nil {
+		return err
+	}
+	defer s.drainer.remove(session)
+	s.addSession(session)
+	defer s.removeSession(session)
 	session.SetSubscribeHandler(s.handleSubscribe)
 	session.SetUnsubscribeHandler(s.handleUnsubscribe)
-	session.Serve()
-	return nil
+	session.SetDebounce(s.debounce)
+	session.SetSubscribeLimiter(s.limits.newLimiter(streamConfig, remoteIP(session.remote)))
+	return session.Serve()
 }
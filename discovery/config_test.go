@@ -23,13 +23,33 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/samaritan-proxy/samaritan-api/go/api"
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 
 	"github.com/samaritan-proxy/sash/config"
 	"github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/registry"
+	regmem "github.com/samaritan-proxy/sash/registry/memory"
 )
 
+// identified returns the ids of the instances identified by the sessions.
+func identified(s *configDiscoveryServer, sessions ...*configDiscoverySession) []string {
+	s.RLock()
+	defer s.RUnlock()
+	var ids []string
+	for _, session := range sessions {
+		if session.inst != nil {
+			ids = append(ids, session.inst.ID)
+		}
+	}
+	return ids
+}
+
 func makeSvcConfigsStream(ctrl *gomock.Controller) *MockDiscoveryService_StreamSvcConfigsServer {
 	stream := NewMockDiscoveryService_StreamSvcConfigsServer(ctrl)
 	addr, _ := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
@@ -211,14 +231,23 @@ func TestConfigDiscoveryServerHandleSubscribe(t *testing.T) {
 	s.handleSubscribe("foo", session)
 	s.handleSubscribe("foo", session) // duplicate subscribe
 	s.handleSubscribe("bar", session)
+	s.handleSubscribe("zoo", session)
 
 	// assert subscribers
 	subscribers := s.Subscribers()
-	assert.Equal(t, 2, len(subscribers))
+	assert.Equal(t, 3, len(subscribers))
 	assert.Equal(t, 1, len(subscribers["foo"]))
 	assert.Equal(t, 1, len(subscribers["bar"]))
-	// assert events
-	assert.Equal(t, 1, len(session.eventCh))
+	assert.Equal(t, 1, len(subscribers["zoo"]))
+	// assert events, the broken config of bar is not sent.
+	assert.Equal(t, 2, len(session.eventCh))
+	evt := <-session.eventCh
+	assert.Equal(t, "foo", evt.ProxyConfig.ServiceName)
+	assert.Equal(t, &service.Config{}, configOf(evt))
+	// zoo has no config.
+	evt = <-session.eventCh
+	assert.Equal(t, "zoo", evt.ProxyConfig.ServiceName)
+	assert.Nil(t, configOf(evt))
 }
 
 func TestConfigDiscoveryServerHandleUnsubscribe(t *testing.T) {
@@ -272,3 +301,375 @@ func TestConfigDiscoveryServerStreamSvcConfigs(t *testing.T) {
 	time.AfterFunc(time.Millisecond*100, abortStream)
 	assert.NoError(t, s.StreamSvcConfigs(stream))
 }
+
+func TestConfigDiscoveryServerTemplateChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stream := makeSvcConfigsStream(ctrl)
+	session := newConfigDiscoverySession(stream)
+
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	tpl := &config.ProxyConfigTemplate{
+		Name: "tpl",
+		Config: &service.Config{
+			Protocol: protocol.TCP,
+			Listener: &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+		},
+	}
+	assert.NoError(t, ctl.Templates().Add(tpl))
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "foo",
+		Template:    "tpl",
+		Config:      &service.Config{LbPolicy: service.LoadBalancePolicy_RANDOM},
+	}))
+	time.Sleep(time.Millisecond * 10)
+
+	s := newConfigDiscoveryServer(ctl)
+	s.handleSubscribe("foo", session)
+	evt := <-session.eventCh
+	assert.Equal(t, protocol.TCP, evt.ProxyConfig.Config.Protocol)
+	assert.Equal(t, service.LoadBalancePolicy_RANDOM, evt.ProxyConfig.Config.LbPolicy)
+
+	tpl.Config.Listener.Address.Port = 8080
+	assert.NoError(t, ctl.Templates().Update(tpl))
+	select {
+	case evt = <-session.eventCh:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.Equal(t, config.EventUpdate, evt.Type)
+	assert.Equal(t, uint32(8080), evt.ProxyConfig.Config.Listener.Address.Port)
+	assert.Equal(t, service.LoadBalancePolicy_RANDOM, evt.ProxyConfig.Config.LbPolicy)
+}
+
+func TestConfigDiscoveryServerDefaultConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stream := makeSvcConfigsStream(ctrl)
+	session := newConfigDiscoverySession(stream)
+
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	defCfg := &service.Config{
+		Protocol: protocol.TCP,
+		Listener: &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+	}
+	assert.NoError(t, ctl.DefaultProxyConfig().Set(defCfg))
+	time.Sleep(time.Millisecond * 10)
+
+	s := newConfigDiscoveryServer(ctl)
+	s.handleSubscribe("foo", session)
+	waitEvent := func() *config.ProxyConfigEvent {
+		select {
+		case evt := <-session.eventCh:
+			return evt
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return nil
+	}
+
+	// subscribe a service without proxy config
+	evt := waitEvent()
+	assert.Equal(t, "foo", evt.ProxyConfig.ServiceName)
+	assert.Equal(t, defCfg, evt.ProxyConfig.Config)
+
+	// change the default one
+	defCfg.Listener.Address.Port = 8080
+	assert.NoError(t, ctl.DefaultProxyConfig().Set(defCfg))
+	evt = waitEvent()
+	assert.Equal(t, config.EventUpdate, evt.Type)
+	assert.Equal(t, uint32(8080), evt.ProxyConfig.Config.Listener.Address.Port)
+
+	// add a service-specific one
+	svcCfg := &service.Config{
+		Protocol: protocol.Redis,
+		Listener: &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 6379}},
+	}
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{ServiceName: "foo", Config: svcCfg}))
+	evt = waitEvent()
+	assert.Equal(t, config.EventAdd, evt.Type)
+	assert.Equal(t, svcCfg, evt.ProxyConfig.Config)
+
+	// the default one is ignored now
+	defCfg.Listener.Address.Port = 9090
+	assert.NoError(t, ctl.DefaultProxyConfig().Set(defCfg))
+	time.Sleep(time.Millisecond * 20)
+	assert.Len(t, session.eventCh, 0)
+
+	// delete the service-specific one
+	assert.NoError(t, ctl.ProxyConfigs().Delete("foo"))
+	evt = waitEvent()
+	assert.Equal(t, config.EventUpdate, evt.Type)
+	assert.Equal(t, uint32(9090), evt.ProxyConfig.Config.Listener.Address.Port)
+
+	// delete the default one
+	assert.NoError(t, ctl.DefaultProxyConfig().Delete())
+	evt = waitEvent()
+	assert.Equal(t, config.EventDelete, evt.Type)
+	assert.Nil(t, evt.ProxyConfig.Config)
+}
+
+func TestConfigDiscoveryServerOverrides(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	timeout := time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "foo",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	assert.NoError(t, ctl.Instances().Add(&config.Instance{
+		ID:     "inst_2",
+		IP:     "10.0.0.2",
+		Labels: map[string]string{"zone": "z1"},
+	}))
+	time.Sleep(time.Millisecond * 10)
+	s := newConfigDiscoveryServer(ctl)
+
+	newSession := func(ip, instID string) *configDiscoverySession {
+		stream := NewMockDiscoveryService_StreamSvcConfigsServer(ctrl)
+		ctx := peer.NewContext(context.TODO(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 12345}})
+		if instID != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(instanceIDMetadataKey, instID))
+		}
+		stream.EXPECT().Context().Return(ctx)
+		session := newConfigDiscoverySession(stream)
+		s.addSession(session)
+		return session
+	}
+	waitTimeout := func(session *configDiscoverySession) time.Duration {
+		select {
+		case evt := <-session.eventCh:
+			return *evt.ProxyConfig.Config.ConnectTimeout
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return 0
+	}
+	byID := newSession("10.0.0.1", "inst_1")
+	byIP := newSession("10.0.0.2", "")
+	unknown := newSession("10.0.0.3", "")
+	sessions := []*configDiscoverySession{byID, byIP, unknown}
+	for _, session := range sessions {
+		s.handleSubscribe("foo", session)
+		assert.Equal(t, time.Second, waitTimeout(session))
+	}
+	// the unknown instance is ignored.
+	assert.Equal(t, []string{"inst_1", "inst_2"}, identified(s, sessions...))
+
+	canary, zone := 2*time.Second, 3*time.Second
+	assert.NoError(t, ctl.ProxyConfigOverrides().Set(&config.ProxyConfigOverrides{
+		ServiceName: "foo",
+		Overrides: []*config.ProxyConfigOverride{
+			{Name: "zone", Selector: map[string]string{"zone": "z1"}, Config: &service.Config{ConnectTimeout: &zone}},
+			{Name: "canary", Instances: []string{"inst_1"}, Config: &service.Config{ConnectTimeout: &canary}},
+		},
+	}))
+	assert.Equal(t, canary, waitTimeout(byID))
+	assert.Equal(t, zone, waitTimeout(byIP))
+	assert.Equal(t, time.Second, waitTimeout(unknown))
+
+	// roll out fleet-wide
+	timeout = 2 * time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Update(&config.ProxyConfig{
+		ServiceName: "foo",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	assert.Equal(t, canary, waitTimeout(byID))
+	assert.Equal(t, zone, waitTimeout(byIP))
+	assert.Equal(t, timeout, waitTimeout(unknown))
+
+	assert.NoError(t, ctl.ProxyConfigOverrides().Delete("foo"))
+	for _, session := range sessions {
+		assert.Equal(t, timeout, waitTimeout(session))
+	}
+}
+
+func TestConfigDiscoveryServerInstanceEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	timeout, zone := time.Second, 3*time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "foo",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	assert.NoError(t, ctl.ProxyConfigOverrides().Set(&config.ProxyConfigOverrides{
+		ServiceName: "foo",
+		Overrides: []*config.ProxyConfigOverride{
+			{Name: "zone", Selector: map[string]string{"zone": "z1"}, Config: &service.Config{ConnectTimeout: &zone}},
+		},
+	}))
+	time.Sleep(time.Millisecond * 10)
+	s := newConfigDiscoveryServer(ctl)
+
+	newSession := func(ip, instID string) *configDiscoverySession {
+		stream := NewMockDiscoveryService_StreamSvcConfigsServer(ctrl)
+		ctx := peer.NewContext(context.TODO(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 12345}})
+		if instID != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(instanceIDMetadataKey, instID))
+		}
+		stream.EXPECT().Context().Return(ctx)
+		session := newConfigDiscoverySession(stream)
+		s.addSession(session)
+		s.handleSubscribe("foo", session)
+		return session
+	}
+	waitTimeout := func(session *configDiscoverySession) time.Duration {
+		select {
+		case evt := <-session.eventCh:
+			return *evt.ProxyConfig.Config.ConnectTimeout
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return 0
+	}
+	assertNoEvent := func(session *configDiscoverySession) {
+		time.Sleep(time.Millisecond * 20)
+		assert.Len(t, session.eventCh, 0)
+	}
+
+	// neither instance is registered yet.
+	byID := newSession("10.0.0.1", "inst_1")
+	byIP := newSession("10.0.0.3", "")
+	assert.Equal(t, timeout, waitTimeout(byID))
+	assert.Equal(t, timeout, waitTimeout(byIP))
+
+	inst1 := &config.Instance{ID: "inst_1", IP: "10.0.0.1", Labels: map[string]string{"zone": "z1"}}
+	assert.NoError(t, ctl.Instances().Add(inst1))
+	assert.Equal(t, zone, waitTimeout(byID))
+	assertNoEvent(byIP)
+
+	inst3 := &config.Instance{ID: "inst_3", IP: "10.0.0.3", Labels: map[string]string{"zone": "z1"}}
+	assert.NoError(t, ctl.Instances().Add(inst3))
+	assert.Equal(t, zone, waitTimeout(byIP))
+	assert.Equal(t, []string{"inst_1", "inst_3"}, identified(s, byID, byIP))
+
+	// the labels changed.
+	inst1.Labels["zone"] = "z2"
+	assert.NoError(t, ctl.Instances().Update(inst1))
+	assert.Equal(t, timeout, waitTimeout(byID))
+
+	// the changes irrelevant to the overrides.
+	inst3.Hostname = "host_3"
+	assert.NoError(t, ctl.Instances().Update(inst3))
+	assertNoEvent(byIP)
+
+	// the ip becomes ambiguous.
+	assert.NoError(t, ctl.Instances().Add(&config.Instance{ID: "inst_4", IP: "10.0.0.3"}))
+	assert.Equal(t, timeout, waitTimeout(byIP))
+	assert.Equal(t, []string{"inst_1"}, identified(s, byID, byIP))
+	assertNoEvent(byID)
+}
+
+func TestConfigOf(t *testing.T) {
+	cfg := &service.Config{LbPolicy: service.LoadBalancePolicy_RANDOM}
+	assert.Equal(t, cfg, configOf(makeConfigEvent(config.EventUpdate, "foo", cfg)))
+	assert.Nil(t, configOf(makeConfigEvent(config.EventDelete, "foo", nil)))
+	// the empty config is distinguishable from the removal on the wire.
+	resp := &api.SvcConfigDiscoveryResponse{
+		Updated: map[string]*service.Config{
+			"foo": configOf(makeConfigEvent(config.EventAdd, "foo", nil)),
+			"bar": configOf(makeConfigEvent(config.EventDelete, "bar", nil)),
+		},
+	}
+	b, err := resp.Marshal()
+	assert.NoError(t, err)
+	decoded := new(api.SvcConfigDiscoveryResponse)
+	assert.NoError(t, decoded.Unmarshal(b))
+	assert.NotNil(t, decoded.Updated["foo"])
+	bar, ok := decoded.Updated["bar"]
+	assert.True(t, ok)
+	assert.Nil(t, bar)
+}
+
+func TestConfigDiscoveryServerReconnect(t *testing.T) {
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	cfg := &service.Config{
+		Protocol: protocol.TCP,
+		Listener: &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+	}
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{ServiceName: "foo", Config: cfg}))
+	waitCache := func(exist bool) {
+		assert.Eventually(t, func() bool {
+			_, err := ctl.ProxyConfigs().GetEffectiveCache("foo")
+			return (err == nil) == exist
+		}, time.Second, time.Millisecond*10)
+	}
+	waitCache(true)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(l, registry.NewCache(regmem.NewRegistry()), ctl)
+	go s.Serve() //nolint:errcheck
+	defer s.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewDiscoveryServiceClient(conn)
+	// subscribe returns the configs responded to the subscription.
+	subscribe := func(svcNames ...string) map[string]*service.Config {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		stream, err := client.StreamSvcConfigs(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&api.SvcConfigDiscoveryRequest{SvcNamesSubscribe: svcNames}))
+		configs := make(map[string]*service.Config)
+		for len(configs) < len(svcNames) {
+			resp, err := stream.Recv()
+			if !assert.NoError(t, err) {
+				break
+			}
+			for svcName, cfg := range resp.Updated {
+				configs[svcName] = cfg
+			}
+		}
+		return configs
+	}
+
+	configs := subscribe("foo")
+	assert.Equal(t, protocol.TCP, configs["foo"].Protocol)
+
+	// the config is deleted while the proxy is disconnected, it's told to
+	// drop the stale one after reconnecting.
+	assert.NoError(t, ctl.ProxyConfigs().Delete("foo"))
+	waitCache(false)
+	configs = subscribe("foo", "bar")
+	assert.Equal(t, map[string]*service.Config{"foo": nil, "bar": nil}, configs)
+
+	// fallback to the global default one.
+	assert.NoError(t, ctl.DefaultProxyConfig().Set(cfg))
+	waitCache(true)
+	configs = subscribe("foo")
+	assert.Equal(t, protocol.TCP, configs["foo"].Protocol)
+}
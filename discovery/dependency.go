@@ -19,6 +19,7 @@ package discovery
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/samaritan-proxy/samaritan-api/go/api"
 	"github.com/samaritan-proxy/samaritan-api/go/config/service"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/samaritan-proxy/sash/config"
 	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/tracing"
 )
 
 func buildServices(svcNames ...string) (services []*service.Service) {
@@ -41,42 +43,78 @@ type dependencyDiscoverySession struct {
 	instID string
 	stream api.DiscoveryService_StreamDependenciesServer
 	remote *peer.Peer
+	log    *logger.Logger
 
 	eventCh chan *config.DependencyEvent
 
+	*drainSignal
 	quit chan struct{}
 }
 
 func newDependencyDiscoverySession(instID string, stream api.DiscoveryService_StreamDependenciesServer) *dependencyDiscoverySession {
 	remote, _ := peer.FromContext(stream.Context())
 	return &dependencyDiscoverySession{
-		instID:  instID,
-		stream:  stream,
-		remote:  remote,
-		eventCh: make(chan *config.DependencyEvent, 16),
-		quit:    make(chan struct{}),
+		instID:      instID,
+		stream:      stream,
+		remote:      remote,
+		log:         log.With("stream", streamDependency, "remote", remoteAddr(remote), "instance", instID),
+		eventCh:     make(chan *config.DependencyEvent, 16),
+		drainSignal: newDrainSignal(),
+		quit:        make(chan struct{}),
 	}
 }
 
-func (s *dependencyDiscoverySession) Serve() {
+// Serve serves the session until the stream is broken or drained, it returns
+// errDraining if drained.
+func (s *dependencyDiscoverySession) Serve() error {
+	sessions.add(streamDependency, s)
 	defer func() {
+		sessions.remove(streamDependency, s)
 		close(s.quit)
-		logger.Debugf("Dependency discovery session %s exit", s.remote.Addr)
+		s.log.Debug("Dependency discovery session exit")
 	}()
 
 	for {
 		select {
 		case <-s.stream.Context().Done():
-			return
+			return nil
 		case event := <-s.eventCh:
-			err := s.stream.Send(&api.DependencyDiscoveryResponse{
-				Added:   buildServices(event.Add...),
-				Removed: buildServices(event.Del...),
-			})
-			if err != nil {
-				logger.Warnf("Send to dependency stream %s failed: %v", s.remote.Addr, err)
+			if err := s.send(event); err != nil {
+				return nil
+			}
+		case <-s.drainCh:
+			s.flush()
+			return errDraining
+		}
+	}
+}
+
+func (s *dependencyDiscoverySession) send(event *config.DependencyEvent) error {
+	span := startSendSpan(event.Trace, streamDependency, s.remote, s.instID, event.ServiceName)
+	startTime := time.Now()
+	err := s.stream.Send(&api.DependencyDiscoveryResponse{
+		Added:   buildServices(event.Add...),
+		Removed: buildServices(event.Del...),
+	})
+	observeSend(streamDependency, startTime, err)
+	tracing.RecordError(span, err)
+	span.End()
+	if err != nil {
+		s.log.Warnf("Send to dependency stream failed: %v", err)
+	}
+	return err
+}
+
+// flush sends the queued events, it stops at the first failure.
+func (s *dependencyDiscoverySession) flush() {
+	for {
+		select {
+		case event := <-s.eventCh:
+			if err := s.send(event); err != nil {
 				return
 			}
+		default:
+			return
 		}
 	}
 }
@@ -85,14 +123,20 @@ func (s *dependencyDiscoverySession) SendEvent(event *config.DependencyEvent) {
 	select {
 	case s.eventCh <- event:
 	case <-s.quit:
+		eventsDropped.WithLabelValues(streamDependency).Inc()
 	}
 }
 
+func (s *dependencyDiscoverySession) queueLen() int {
+	return len(s.eventCh)
+}
+
 type dependencyDiscoverySessions map[*dependencyDiscoverySession]interface{}
 
 type dependencyDiscoveryServer struct {
 	sync.RWMutex
-	depCtl *config.DependenciesController
+	depCtl  *config.DependenciesController
+	drainer *drainer
 
 	dependencies map[string][]string // serviceName, dependencies
 	subscribers  map[string]dependencyDiscoverySessions
@@ -101,6 +145,7 @@ type dependencyDiscoveryServer struct {
 func newDependencyDiscoveryServer(ctl *config.Controller) *dependencyDiscoveryServer {
 	s := &dependencyDiscoveryServer{
 		depCtl:       ctl.Dependencies(),
+		drainer:      newDrainer(),
 		dependencies: make(map[string][]string),
 		subscribers:  make(map[string]dependencyDiscoverySessions),
 	}
@@ -154,6 +199,10 @@ func (s *dependencyDiscoveryServer) StreamDependencies(req *api.DependencyDiscov
 	}
 
 	session := newDependencyDiscoverySession(req.Instance.Id, stream)
+	if err := s.drainer.add(session); err != nil {
+		return err
+	}
+	defer s.drainer.remove(session)
 	s.regSession(belongSvc, session)
 	defer s.unRegSession(belongSvc, session)
 
@@ -163,6 +212,5 @@ func (s *dependencyDiscoveryServer) StreamDependencies(req *api.DependencyDiscov
 			Add:         dep.Dependencies,
 		})
 	}
-	session.Serve()
-	return nil
+	return session.Serve()
 }
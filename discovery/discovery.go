@@ -21,14 +21,29 @@ import (
 	"github.com/samaritan-proxy/samaritan-api/go/api"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
 
 	"github.com/samaritan-proxy/sash/config"
 	"github.com/samaritan-proxy/sash/logger"
 	"github.com/samaritan-proxy/sash/registry"
 )
 
+var log = logger.Component("discovery")
+
+// remoteAddr returns the address of peer, empty if unknown.
+func remoteAddr(p *peer.Peer) string {
+	if p == nil || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
 type serverOptions struct {
 	// TODO: add fields, such as credentials.
+	debounce        time.Duration
+	maxStreams      int
+	maxStreamsPerIP int
+	subscribeLimits subscribeLimits
 }
 
 func defaultServerOptions() *serverOptions {
@@ -37,6 +52,45 @@ func defaultServerOptions() *serverOptions {
 
 type ServerOption func(o *serverOptions)
 
+// Debounce sets how long the sessions merge the endpoint events of the same
+// service and batch the config events before sending, zero means sending
+// every event at once.
+func Debounce(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.debounce = d
+	}
+}
+
+// MaxStreams sets the maximum number of concurrent streams overall and per
+// remote ip, zero means unlimited. The streams beyond are rejected with
+// ResourceExhausted.
+func MaxStreams(total, perIP int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxStreams = total
+		o.maxStreamsPerIP = perIP
+	}
+}
+
+// MaxSubscriptions sets the maximum number of services a stream could
+// subscribe, zero means unlimited. The stream which subscribes more is closed
+// with ResourceExhausted.
+func MaxSubscriptions(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.subscribeLimits.max = n
+	}
+}
+
+// SubscribeRate sets the rate of subscribing services per second and the
+// burst of the streams from a remote ip, zero means unlimited. The stream
+// which subscribes faster is closed with ResourceExhausted, and the new
+// streams from the same ip share the remaining tokens.
+func SubscribeRate(rate float64, burst int) ServerOption {
+	return func(o *serverOptions) {
+		o.subscribeLimits.rate = rate
+		o.subscribeLimits.burst = burst
+	}
+}
+
 // Server is an implementation of api.DiscoveryServiceServer.
 type Server struct {
 	l       net.Listener
@@ -57,7 +111,11 @@ func NewServer(l net.Listener, reg registry.Cache, ctl *config.Controller, opts
 	}
 
 	eds := newEndpointDiscoveryServer(reg)
+	eds.debounce = o.debounce
+	eds.limits = o.subscribeLimits.withBuckets()
 	cds := newConfigDiscoveryServer(ctl)
+	cds.debounce = o.debounce
+	cds.limits = o.subscribeLimits.withBuckets()
 	dds := newDependencyDiscoveryServer(ctl)
 	s := &Server{
 		l:       l,
@@ -80,19 +138,63 @@ func (s *Server) grpcOptions() []grpc.ServerOption {
 			Timeout: 10 * time.Second,
 		}),
 	}
+	if s.options.maxStreams > 0 || s.options.maxStreamsPerIP > 0 {
+		l := newStreamLimiter(s.options.maxStreams, s.options.maxStreamsPerIP)
+		options = append(options, grpc.StreamInterceptor(l.interceptor))
+	}
 	return options
 }
 
 func (s *Server) Serve() error {
-	logger.Infof("Discovery server listening on %s...", s.l.Addr())
+	log.Infof("Discovery server listening on %s...", s.l.Addr())
 	return s.g.Serve(s.l)
 }
 
-// Stop stops the server.
+// Stop stops the server, all the streams are closed at once.
 func (s *Server) Stop() {
 	s.g.Stop()
 }
 
+// drainGracePeriod is how long to wait for the drained streams to finish
+// after the drain period, before they are closed forcibly.
+const drainGracePeriod = 5 * time.Second
+
+// Drain stops the server gracefully. The new streams are rejected at once,
+// and the existing ones are closed one by one over the period after their
+// queued events are flushed, so that the proxies don't reconnect to the
+// other replicas at the same moment.
+func (s *Server) Drain(period time.Duration) {
+	var drained []drainable
+	for _, d := range []*drainer{s.eds.drainer, s.cds.drainer, s.dds.drainer} {
+		drained = append(drained, d.start()...)
+	}
+	log.Infof("Draining %d discovery streams in %s", len(drained), period)
+	if len(drained) > 0 {
+		interval := period / time.Duration(len(drained))
+		for i, session := range drained {
+			if i > 0 {
+				time.Sleep(interval)
+			}
+			session.drain()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.g.GracefulStop()
+		close(done)
+	}()
+	timer := time.NewTimer(drainGracePeriod)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Warnf("Discovery streams are not finished in %s after draining, close them forcibly", drainGracePeriod)
+		s.g.Stop()
+		<-done
+	}
+}
+
 // StreamDependencies returns all dependencies of the given instance.
 func (s *Server) StreamDependencies(req *api.DependencyDiscoveryRequest, stream api.DiscoveryService_StreamDependenciesServer) (err error) {
 	return s.dds.StreamDependencies(req, stream)
@@ -16,7 +16,6 @@ package discovery
 
 import (
 	"context"
-	"log"
 	"net"
 	"testing"
 
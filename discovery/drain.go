@@ -0,0 +1,100 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errDraining is returned to the proxies when their streams are closed or
+// rejected because the server is draining, they should reconnect to the
+// other replicas.
+var errDraining = status.Error(codes.Unavailable, "discovery server is draining")
+
+// drainable is a session which could be closed gracefully.
+type drainable interface {
+	// drain makes the session flush the queued events and exit.
+	drain()
+}
+
+// drainer tracks the active sessions, and rejects the new ones once draining.
+type drainer struct {
+	mu       sync.Mutex
+	draining bool
+	sessions map[drainable]struct{}
+}
+
+func newDrainer() *drainer {
+	return &drainer{
+		sessions: make(map[drainable]struct{}),
+	}
+}
+
+// add adds the session, returns errDraining if it's draining.
+func (d *drainer) add(s drainable) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return errDraining
+	}
+	d.sessions[s] = struct{}{}
+	return nil
+}
+
+func (d *drainer) remove(s drainable) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sessions, s)
+}
+
+// start starts draining, and returns the active sessions.
+func (d *drainer) start() []drainable {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = true
+	res := make([]drainable, 0, len(d.sessions))
+	for s := range d.sessions {
+		res = append(res, s)
+	}
+	return res
+}
+
+// drainSignal is embedded by the sessions to implement drainable.
+type drainSignal struct {
+	once    sync.Once
+	drainCh chan struct{}
+}
+
+func newDrainSignal() *drainSignal {
+	return &drainSignal{drainCh: make(chan struct{})}
+}
+
+func (d *drainSignal) drain() {
+	d.once.Do(func() {
+		close(d.drainCh)
+	})
+}
+
+func (d *drainSignal) drained() bool {
+	select {
+	case <-d.drainCh:
+		return true
+	default:
+		return false
+	}
+}
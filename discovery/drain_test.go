@@ -0,0 +1,172 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/samaritan-proxy/sash/config"
+	cfgmem "github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+	regmem "github.com/samaritan-proxy/sash/registry/memory"
+)
+
+func TestDrainer(t *testing.T) {
+	d := newDrainer()
+	s1, s2 := newDrainSignal(), newDrainSignal()
+	assert.NoError(t, d.add(s1))
+	assert.NoError(t, d.add(s2))
+	d.remove(s2)
+
+	assert.Equal(t, []drainable{s1}, d.start())
+	assert.Equal(t, errDraining, d.add(s2))
+}
+
+func TestDrainSignal(t *testing.T) {
+	d := newDrainSignal()
+	assert.False(t, d.drained())
+	d.drain()
+	// drain twice is no-op.
+	d.drain()
+	assert.True(t, d.drained())
+}
+
+func TestEndpointDiscoverySessionDrain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stream := makeSvcEndpointsStream(ctrl)
+	quit := make(chan struct{})
+	defer close(quit)
+	stream.EXPECT().Recv().DoAndReturn(func() (*api.SvcEndpointDiscoveryRequest, error) {
+		// the stream is closed after the session exits.
+		<-quit
+		return nil, context.Canceled
+	}).AnyTimes()
+	var sent []string
+	stream.EXPECT().Send(gomock.Any()).DoAndReturn(func(resp *api.SvcEndpointDiscoveryResponse) error {
+		sent = append(sent, resp.SvcName)
+		return nil
+	}).Times(2)
+
+	session := newEndpointDiscoverySession(stream)
+	session.SendEvent(newEndpointEvent("foo", nil, nil, nil))
+	session.SendEvent(newEndpointEvent("bar", nil, nil, nil))
+	session.drain()
+	// the queued events are flushed.
+	assert.Equal(t, errDraining, session.Serve())
+	assert.Equal(t, []string{"foo", "bar"}, sent)
+}
+
+func TestServerDrain(t *testing.T) {
+	reg := regmem.NewRegistry(
+		model.NewService("foo", model.NewServiceInstance("127.0.0.1", 8888)),
+	)
+	regCache := registry.NewCache(reg)
+	ctrl := config.NewController(cfgmem.NewStore())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := NewServer(l, regCache, ctrl)
+	ctx, stopCache := context.WithCancel(context.TODO())
+	go regCache.Run(ctx)
+	defer stopCache()
+	go s.Serve() //nolint:errcheck
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewDiscoveryServiceClient(conn)
+	newStream := func() api.DiscoveryService_StreamSvcEndpointsClient {
+		stream, err := client.StreamSvcEndpoints(context.TODO())
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&api.SvcEndpointDiscoveryRequest{SvcNamesSubscribe: []string{"foo"}}))
+		return stream
+	}
+
+	streams := []api.DiscoveryService_StreamSvcEndpointsClient{newStream(), newStream()}
+	for _, stream := range streams {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, "foo", resp.SvcName)
+	}
+
+	drainDone := make(chan struct{})
+	start := time.Now()
+	go func() {
+		s.Drain(time.Millisecond * 200)
+		close(drainDone)
+	}()
+
+	closedAt := make([]time.Duration, len(streams))
+	for i, stream := range streams {
+		_, err := stream.Recv()
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		closedAt[i] = time.Since(start)
+	}
+	// the streams are closed one by one.
+	assert.True(t, closedAt[1] >= time.Millisecond*100, "%v", closedAt)
+
+	select {
+	case <-drainDone:
+	case <-time.After(time.Second):
+		t.Fatal("drain timeout")
+	}
+}
+
+func TestServerDrainRejectNewStreams(t *testing.T) {
+	reg := regmem.NewRegistry()
+	regCache := registry.NewCache(reg)
+	ctrl := config.NewController(cfgmem.NewStore())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := NewServer(l, regCache, ctrl)
+	go s.Serve() //nolint:errcheck
+	defer s.Stop()
+
+	// start draining without stopping the grpc server.
+	s.eds.drainer.start()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewDiscoveryServiceClient(conn)
+	stream, err := client.StreamSvcEndpoints(context.TODO())
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, status.Convert(errDraining).Proto(), status.Convert(err).Proto())
+}
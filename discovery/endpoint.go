@@ -16,6 +16,7 @@ package discovery
 
 import (
 	"sync"
+	"time"
 
 	"github.com/samaritan-proxy/samaritan-api/go/api"
 	"github.com/samaritan-proxy/samaritan-api/go/common"
@@ -89,23 +90,32 @@ type (
 type endpointDiscoverySession struct {
 	stream api.DiscoveryService_StreamSvcEndpointsServer
 	remote *peer.Peer
+	log    *logger.Logger
 
 	subscribed map[string]struct{} // subscribed services.
 	subHdlr    endpointSubHandler
 	unsubHdlr  endpointUnsubHandler
 	eventCh    chan *endpointEvent
+	debounce   time.Duration
+	batch      *endpointBatch
+	limiter    *subscribeLimiter
+	recvErr    error // why the receiving stops, it's set before recvDone is closed.
 
+	*drainSignal
 	quit chan struct{}
 }
 
 func newEndpointDiscoverySession(stream api.DiscoveryService_StreamSvcEndpointsServer) *endpointDiscoverySession {
 	remote, _ := peer.FromContext(stream.Context())
 	return &endpointDiscoverySession{
-		stream:     stream,
-		remote:     remote,
-		subscribed: make(map[string]struct{}, 8),
-		eventCh:    make(chan *endpointEvent, 64),
-		quit:       make(chan struct{}),
+		stream:      stream,
+		remote:      remote,
+		log:         log.With("stream", streamEndpoint, "remote", remoteAddr(remote)),
+		subscribed:  make(map[string]struct{}, 8),
+		eventCh:     make(chan *endpointEvent, 64),
+		batch:       newEndpointBatch(),
+		drainSignal: newDrainSignal(),
+		quit:        make(chan struct{}),
 	}
 }
 
@@ -117,16 +127,40 @@ func (session *endpointDiscoverySession) SetUnsubscribeHandler(hdlr endpointUnsu
 	session.unsubHdlr = hdlr
 }
 
-func (session *endpointDiscoverySession) Serve() {
-	logger.Debugf("Serve endpoint discovery session %s", session.remote.Addr)
+// SetDebounce sets how long to merge the events before sending, zero means
+// sending every event at once.
+func (session *endpointDiscoverySession) SetDebounce(d time.Duration) {
+	session.debounce = d
+}
+
+// SetSubscribeLimiter sets the limiter of subscribing, nil means unlimited.
+func (session *endpointDiscoverySession) SetSubscribeLimiter(l *subscribeLimiter) {
+	session.limiter = l
+}
+
+// Serve serves the session until the stream is broken or drained, it returns
+// errDraining if drained.
+func (session *endpointDiscoverySession) Serve() error {
+	session.log.Debug("Serve endpoint discovery session")
+	sessions.add(streamEndpoint, session)
 	recvDone := make(chan struct{})
 	defer func() {
+		sessions.remove(streamEndpoint, session)
 		close(session.quit)
-		// wait recv goroutine done
-		<-recvDone
-		// unsubscribe all the services.
-		session.unsubscribeAll()
-		logger.Debugf("Endpoint discovery session %s exit", session.remote.Addr)
+		cleanup := func() {
+			// wait recv goroutine done
+			<-recvDone
+			// unsubscribe all the services.
+			session.unsubscribeAll()
+			session.log.Debug("Endpoint discovery session exit")
+		}
+		if session.drained() {
+			// the receiving is stopped by closing the stream, which
+			// happens after returning.
+			go cleanup()
+			return
+		}
+		cleanup()
 	}()
 
 	go func() {
@@ -134,48 +168,124 @@ func (session *endpointDiscoverySession) Serve() {
 		for {
 			req, err := session.stream.Recv()
 			if err != nil {
-				logger.Warnf("Read from service endpoints stream %s failed: %v", session.remote.Addr, err)
+				session.log.Warnf("Read from service endpoints stream failed: %v", err)
 				return
 			}
 
-			session.subscribe(req.SvcNamesSubscribe...)
+			if err := session.subscribe(req.SvcNamesSubscribe...); err != nil {
+				session.log.Warnf("Subscription rejected: %v", err)
+				session.recvErr = err
+				return
+			}
 			session.unsubscribe(req.SvcNamesUnsubscribe...)
 		}
 	}()
 
-	var event *endpointEvent
+	var (
+		debounce   *time.Timer
+		debounceCh <-chan time.Time
+	)
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+	}()
 	for {
 		select {
-		case event = <-session.eventCh:
+		case event := <-session.eventCh:
+			if session.debounce <= 0 {
+				if err := session.send(event); err != nil {
+					return nil
+				}
+				continue
+			}
+			session.batch.add(event)
+			if debounceCh == nil {
+				debounce = time.NewTimer(session.debounce)
+				debounceCh = debounce.C
+			}
+		case <-debounceCh:
+			debounceCh = nil
+			if err := session.sendBatch(); err != nil {
+				return nil
+			}
+		case <-session.drainCh:
+			session.flush()
+			return errDraining
 		case <-recvDone:
-			return
+			return session.recvErr
 		}
+	}
+}
 
-		resp := &api.SvcEndpointDiscoveryResponse{
-			SvcName: event.SvcName,
-			Added:   event.Added,
-			Removed: event.Removed,
-			// TODO: attach updated endpoints.
+func (session *endpointDiscoverySession) send(event *endpointEvent) error {
+	resp := &api.SvcEndpointDiscoveryResponse{
+		SvcName: event.SvcName,
+		Added:   event.Added,
+		Removed: event.Removed,
+		// TODO: attach updated endpoints.
+	}
+	startTime := time.Now()
+	err := session.stream.Send(resp)
+	observeSend(streamEndpoint, startTime, err)
+	if err != nil {
+		session.log.With("service", event.SvcName).Warnf("Send to service endpoints stream failed: %v", err)
+	}
+	return err
+}
+
+// sendBatch sends the merged events of batch, it stops at the first failure.
+func (session *endpointDiscoverySession) sendBatch() error {
+	n := session.batch.len()
+	events := session.batch.take()
+	eventsMerged.WithLabelValues(streamEndpoint).Add(float64(n - len(events)))
+	for _, event := range events {
+		if err := session.send(event); err != nil {
+			return err
 		}
-		if err := session.stream.Send(resp); err != nil {
-			logger.Warnf("Send to service endpoints stream %s failed: %v", session.remote.Addr, err)
+	}
+	return nil
+}
+
+// flush sends the queued and batched events, it stops at the first failure.
+func (session *endpointDiscoverySession) flush() {
+	for {
+		select {
+		case event := <-session.eventCh:
+			if session.debounce > 0 {
+				session.batch.add(event)
+				continue
+			}
+			if err := session.send(event); err != nil {
+				return
+			}
+		default:
+			if session.debounce > 0 {
+				session.sendBatch()
+			}
 			return
 		}
 	}
 }
 
-func (session *endpointDiscoverySession) subscribe(svcNames ...string) {
+// subscribe subscribes the services, it stops at the first one which
+// exceeds the limits.
+func (session *endpointDiscoverySession) subscribe(svcNames ...string) error {
 	for _, svcName := range svcNames {
 		_, ok := session.subscribed[svcName]
 		if ok {
 			continue
 		}
+		if err := session.limiter.allow(len(session.subscribed)); err != nil {
+			return err
+		}
 
 		if session.subHdlr != nil {
 			session.subHdlr(svcName, session)
 		}
 		session.subscribed[svcName] = struct{}{}
 	}
+	return nil
 }
 
 func (session *endpointDiscoverySession) unsubscribe(svcNames ...string) {
@@ -201,14 +311,22 @@ func (session *endpointDiscoverySession) SendEvent(event *endpointEvent) {
 	select {
 	case session.eventCh <- event:
 	case <-session.quit:
+		eventsDropped.WithLabelValues(streamEndpoint).Inc()
 	}
 }
 
+func (session *endpointDiscoverySession) queueLen() int {
+	return len(session.eventCh)
+}
+
 type endpointDiscoverySessions map[*endpointDiscoverySession]interface{}
 
 type endpointDiscoveryServer struct {
 	sync.RWMutex
-	reg registry.Cache
+	reg      registry.Cache
+	drainer  *drainer
+	debounce time.Duration
+	limits   subscribeLimits
 
 	subscribers map[string]endpointDiscoverySessions // service: sessions
 }
@@ -216,6 +334,7 @@ type endpointDiscoveryServer struct {
 func newEndpointDiscoveryServer(reg registry.Cache) *endpointDiscoveryServer {
 	s := &endpointDiscoveryServer{
 		reg:         reg,
+		drainer:     newDrainer(),
 		subscribers: make(map[string]endpointDiscoverySessions),
 	}
 
@@ -314,8 +433,13 @@ func (s *endpointDiscoveryServer) Subscribers() map[string]endpointDiscoverySess
 
 func (s *endpointDiscoveryServer) StreamSvcEndpoints(stream api.DiscoveryService_StreamSvcEndpointsServer) (err error) {
 	session := newEndpointDiscoverySession(stream)
+	if err := s.drainer.add(session); err != nil {
+		return err
+	}
+	defer s.drainer.remove(session)
 	session.SetSubscribeHandler(s.handleSubscribe)
 	session.SetUnsubscribeHandler(s.handleUnsubscribe)
-	session.Serve()
-	return
+	session.SetDebounce(s.debounce)
+	session.SetSubscribeLimiter(s.limits.newLimiter(streamEndpoint, remoteIP(session.remote)))
+	return session.Serve()
 }
@@ -0,0 +1,251 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The following shows the limits used as metric labels.
+const (
+	limitStreams       = "streams"
+	limitStreamsPerIP  = "streams_per_ip"
+	limitSubscriptions = "subscriptions"
+	limitSubscribeRate = "subscribe_rate"
+)
+
+// streamOfMethod maps the grpc method to the stream used as metric label.
+var streamOfMethod = map[string]string{
+	"StreamSvcConfigs":   streamConfig,
+	"StreamSvcEndpoints": streamEndpoint,
+	"StreamDependencies": streamDependency,
+}
+
+// remoteIP returns the ip of peer, empty if unknown.
+func remoteIP(p *peer.Peer) string {
+	addr := remoteAddr(p)
+	if addr == "" {
+		return ""
+	}
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return ip
+}
+
+// streamLimiter limits the concurrent streams overall and per remote ip,
+// zero means unlimited.
+type streamLimiter struct {
+	mu       sync.Mutex
+	max      int
+	maxPerIP int
+	total    int
+	perIP    map[string]int
+}
+
+func newStreamLimiter(max, maxPerIP int) *streamLimiter {
+	return &streamLimiter{
+		max:      max,
+		maxPerIP: maxPerIP,
+		perIP:    make(map[string]int),
+	}
+}
+
+// acquire takes a slot for the stream from ip, it returns the violated limit
+// and the error if there is no free one.
+func (l *streamLimiter) acquire(ip string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.total >= l.max {
+		return limitStreams, status.Errorf(codes.ResourceExhausted, "too many discovery streams, the limit is %d", l.max)
+	}
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return limitStreamsPerIP, status.Errorf(codes.ResourceExhausted, "too many discovery streams from %s, the limit is %d", ip, l.maxPerIP)
+	}
+	l.total++
+	l.perIP[ip]++
+	return "", nil
+}
+
+func (l *streamLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	l.perIP[ip]--
+	if l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// interceptor rejects the new streams with ResourceExhausted once the limits
+// are reached.
+func (l *streamLimiter) interceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	p, _ := peer.FromContext(ss.Context())
+	ip := remoteIP(p)
+	if limit, err := l.acquire(ip); err != nil {
+		limited.WithLabelValues(streamOfMethod[path.Base(info.FullMethod)], limit).Inc()
+		log.With("remote", remoteAddr(p)).Warnf("Discovery stream rejected: %v", err)
+		return err
+	}
+	defer l.release(ip)
+	return handler(srv, ss)
+}
+
+// tokenBucket is a token bucket which is refilled at rate per second up to
+// burst, it's not goroutine-safe.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// take takes a token, returns false if there is none.
+func (b *tokenBucket) take() bool {
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// tokenBuckets is the token buckets keyed by the remote ip, the buckets
+// which have been refilled up are removed since they are the same as the
+// new ones.
+type tokenBuckets struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newTokenBuckets(rate float64, burst int) *tokenBuckets {
+	return &tokenBuckets{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// take takes a token from the bucket of key, returns false if there is none.
+func (b *tokenBuckets) take(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune()
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(b.rate, b.burst)
+		bucket.now = b.now
+		b.buckets[key] = bucket
+	}
+	return bucket.take()
+}
+
+func (b *tokenBuckets) prune() {
+	now := b.now()
+	refill := time.Duration(float64(b.burst) / b.rate * float64(time.Second))
+	if now.Sub(b.lastPrune) < refill {
+		return
+	}
+	b.lastPrune = now
+	for key, bucket := range b.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// subscribeLimits is the limits of subscribing, zero means unlimited. The
+// number of subscribed services is limited per session, while the rate is
+// limited per remote ip, so that reconnecting doesn't refill the bucket.
+type subscribeLimits struct {
+	max     int
+	rate    float64
+	burst   int
+	buckets *tokenBuckets
+}
+
+// withBuckets returns a copy of limits with its own buckets, it's used by a
+// kind of stream.
+func (l subscribeLimits) withBuckets() subscribeLimits {
+	if l.rate > 0 {
+		l.buckets = newTokenBuckets(l.rate, l.burst)
+	}
+	return l
+}
+
+// newLimiter creates a limiter for a session from ip, nil if unlimited.
+func (l subscribeLimits) newLimiter(stream, ip string) *subscribeLimiter {
+	if l.max <= 0 && l.buckets == nil {
+		return nil
+	}
+	return &subscribeLimiter{stream: stream, ip: ip, max: l.max, buckets: l.buckets}
+}
+
+// subscribeLimiter limits the number of subscribed services and the rate of
+// subscribing in a session.
+type subscribeLimiter struct {
+	stream  string
+	ip      string
+	max     int
+	buckets *tokenBuckets
+}
+
+// allow checks whether a new service could be subscribed when there are
+// already n ones, the nil limiter allows all.
+func (l *subscribeLimiter) allow(n int) error {
+	if l == nil {
+		return nil
+	}
+	if l.max > 0 && n >= l.max {
+		limited.WithLabelValues(l.stream, limitSubscriptions).Inc()
+		return status.Errorf(codes.ResourceExhausted, "too many subscribed services, the limit is %d", l.max)
+	}
+	if l.buckets != nil && !l.buckets.take(l.ip) {
+		limited.WithLabelValues(l.stream, limitSubscribeRate).Inc()
+		return status.Errorf(codes.ResourceExhausted, "subscribing too fast from %s, the limit is %v per second", l.ip, l.buckets.rate)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/samaritan-proxy/samaritan-api/go/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/samaritan-proxy/sash/config"
+	cfgmem "github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+	regmem "github.com/samaritan-proxy/sash/registry/memory"
+)
+
+func TestRemoteIP(t *testing.T) {
+	assert.Equal(t, "", remoteIP(nil))
+	addr, _ := net.ResolveTCPAddr("tcp", "10.0.0.1:1234")
+	assert.Equal(t, "10.0.0.1", remoteIP(&peer.Peer{Addr: addr}))
+}
+
+func TestStreamLimiter(t *testing.T) {
+	l := newStreamLimiter(3, 2)
+	_, err := l.acquire("10.0.0.1")
+	assert.NoError(t, err)
+	_, err = l.acquire("10.0.0.1")
+	assert.NoError(t, err)
+	limit, err := l.acquire("10.0.0.1")
+	assert.Equal(t, limitStreamsPerIP, limit)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = l.acquire("10.0.0.2")
+	assert.NoError(t, err)
+	limit, err = l.acquire("10.0.0.3")
+	assert.Equal(t, limitStreams, limit)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	l.release("10.0.0.1")
+	_, err = l.acquire("10.0.0.3")
+	assert.NoError(t, err)
+	l.release("10.0.0.2")
+	assert.NotContains(t, l.perIP, "10.0.0.2")
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, 2)
+	b.now = func() time.Time { return now }
+	assert.True(t, b.take())
+	assert.True(t, b.take())
+	assert.False(t, b.take())
+
+	now = now.Add(time.Millisecond * 500)
+	assert.True(t, b.take())
+	assert.False(t, b.take())
+
+	// no more than burst
+	now = now.Add(time.Hour)
+	assert.True(t, b.take())
+	assert.True(t, b.take())
+	assert.False(t, b.take())
+}
+
+func TestSubscribeLimiter(t *testing.T) {
+	var l *subscribeLimiter
+	assert.NoError(t, l.allow(100))
+	assert.Nil(t, subscribeLimits{}.withBuckets().newLimiter(streamConfig, "10.0.0.1"))
+
+	l = subscribeLimits{max: 2}.withBuckets().newLimiter(streamConfig, "10.0.0.1")
+	assert.NoError(t, l.allow(1))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(l.allow(2)))
+
+	limits := subscribeLimits{rate: 1, burst: 1}.withBuckets()
+	l = limits.newLimiter(streamConfig, "10.0.0.1")
+	assert.NoError(t, l.allow(0))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(l.allow(1)))
+
+	// reconnecting doesn't refill the bucket.
+	l = limits.newLimiter(streamConfig, "10.0.0.1")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(l.allow(0)))
+	l = limits.newLimiter(streamConfig, "10.0.0.2")
+	assert.NoError(t, l.allow(0))
+}
+
+func TestTokenBuckets(t *testing.T) {
+	now := time.Now()
+	b := newTokenBuckets(1, 1)
+	b.now = func() time.Time { return now }
+	assert.True(t, b.take("10.0.0.1"))
+	assert.False(t, b.take("10.0.0.1"))
+	assert.True(t, b.take("10.0.0.2"))
+
+	now = now.Add(time.Millisecond * 500)
+	assert.False(t, b.take("10.0.0.1"))
+
+	// the refilled buckets are removed.
+	now = now.Add(time.Second)
+	assert.True(t, b.take("10.0.0.3"))
+	assert.NotContains(t, b.buckets, "10.0.0.1")
+	assert.NotContains(t, b.buckets, "10.0.0.2")
+	assert.Contains(t, b.buckets, "10.0.0.3")
+}
+
+func TestServerLimits(t *testing.T) {
+	reg := regmem.NewRegistry(
+		model.NewService("foo", model.NewServiceInstance("127.0.0.1", 8888)),
+		model.NewService("bar", model.NewServiceInstance("127.0.0.1", 8889)),
+	)
+	regCache := registry.NewCache(reg)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(l, regCache, config.NewController(cfgmem.NewStore()),
+		MaxStreams(0, 1),
+		MaxSubscriptions(1),
+	)
+	ctx, stopCache := context.WithCancel(context.TODO())
+	go regCache.Run(ctx)
+	defer stopCache()
+	go s.Serve() //nolint:errcheck
+	defer s.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewDiscoveryServiceClient(conn)
+
+	stream, err := client.StreamSvcEndpoints(context.TODO())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&api.SvcEndpointDiscoveryRequest{SvcNamesSubscribe: []string{"foo"}}))
+	assert.Eventually(t, func() bool {
+		resp, err := stream.Recv()
+		return err == nil && resp.SvcName == "foo"
+	}, time.Second, time.Millisecond*10)
+
+	// the second stream from the same ip is rejected.
+	another, err := client.StreamSvcEndpoints(context.TODO())
+	assert.NoError(t, err)
+	_, err = another.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// the stream is closed once subscribing too many services.
+	assert.NoError(t, stream.Send(&api.SvcEndpointDiscoveryRequest{SvcNamesSubscribe: []string{"bar"}}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
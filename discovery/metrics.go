@@ -0,0 +1,136 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The following shows the discovery streams used as metric labels.
+const (
+	streamConfig     = "config"
+	streamEndpoint   = "endpoint"
+	streamDependency = "dependency"
+)
+
+var (
+	eventsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "discovery",
+		Name:      "events_sent_total",
+		Help:      "Total number of events sent to the proxies.",
+	}, []string{"stream"})
+	eventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "discovery",
+		Name:      "events_dropped_total",
+		Help:      "Total number of events dropped because the session was closed.",
+	}, []string{"stream"})
+	eventsMerged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "discovery",
+		Name:      "events_merged_total",
+		Help:      "Total number of events merged into the others or cancelled out during the debounce window.",
+	}, []string{"stream"})
+	limited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "discovery",
+		Name:      "limited_total",
+		Help:      "Total number of streams rejected or closed because of exceeding the limits.",
+	}, []string{"stream", "limit"})
+	sendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sash",
+		Subsystem: "discovery",
+		Name:      "send_duration_seconds",
+		Help:      "Duration of sending an event to the proxy.",
+	}, []string{"stream"})
+
+	sessions = newSessionCollector()
+)
+
+func init() {
+	prometheus.MustRegister(eventsSent, eventsDropped, eventsMerged, limited, sendDuration, sessions)
+}
+
+func observeSend(stream string, startTime time.Time, err error) {
+	sendDuration.WithLabelValues(stream).Observe(time.Since(startTime).Seconds())
+	if err == nil {
+		eventsSent.WithLabelValues(stream).Inc()
+	}
+}
+
+// queuedSession is a session with a pending event queue.
+type queuedSession interface {
+	queueLen() int
+}
+
+// sessionCollector collects the active sessions and their queue depth
+// at scrape time.
+type sessionCollector struct {
+	sync.Mutex
+	sessions map[string]map[queuedSession]struct{}
+
+	activeDesc *prometheus.Desc
+	queueDesc  *prometheus.Desc
+}
+
+func newSessionCollector() *sessionCollector {
+	return &sessionCollector{
+		sessions: map[string]map[queuedSession]struct{}{
+			streamConfig:     {},
+			streamEndpoint:   {},
+			streamDependency: {},
+		},
+		activeDesc: prometheus.NewDesc("sash_discovery_sessions_active",
+			"Number of active discovery sessions.", []string{"stream"}, nil),
+		queueDesc: prometheus.NewDesc("sash_discovery_queue_depth",
+			"Number of events pending in the session queues.", []string{"stream"}, nil),
+	}
+}
+
+func (c *sessionCollector) add(stream string, s queuedSession) {
+	c.Lock()
+	c.sessions[stream][s] = struct{}{}
+	c.Unlock()
+}
+
+func (c *sessionCollector) remove(stream string, s queuedSession) {
+	c.Lock()
+	delete(c.sessions[stream], s)
+	c.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (c *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeDesc
+	ch <- c.queueDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+	for stream, sessions := range c.sessions {
+		depth := 0
+		for s := range sessions {
+			depth += s.queueLen()
+		}
+		ch <- prometheus.MustNewConstMetric(c.activeDesc, prometheus.GaugeValue, float64(len(sessions)), stream)
+		ch <- prometheus.MustNewConstMetric(c.queueDesc, prometheus.GaugeValue, float64(depth), stream)
+	}
+}
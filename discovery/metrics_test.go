@@ -0,0 +1,50 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueuedSession int
+
+func (s fakeQueuedSession) queueLen() int { return int(s) }
+
+func TestSessionCollector(t *testing.T) {
+	c := newSessionCollector()
+	s1, s2 := fakeQueuedSession(3), fakeQueuedSession(2)
+	c.add(streamEndpoint, s1)
+	c.add(streamEndpoint, s2)
+	c.add(streamConfig, fakeQueuedSession(0))
+	c.remove(streamConfig, fakeQueuedSession(0))
+
+	expected := `
+# HELP sash_discovery_queue_depth Number of events pending in the session queues.
+# TYPE sash_discovery_queue_depth gauge
+sash_discovery_queue_depth{stream="config"} 0
+sash_discovery_queue_depth{stream="dependency"} 0
+sash_discovery_queue_depth{stream="endpoint"} 5
+# HELP sash_discovery_sessions_active Number of active discovery sessions.
+# TYPE sash_discovery_sessions_active gauge
+sash_discovery_sessions_active{stream="config"} 0
+sash_discovery_sessions_active{stream="dependency"} 0
+sash_discovery_sessions_active{stream="endpoint"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/peer"
+
+	"github.com/samaritan-proxy/sash/tracing"
+)
+
+// startSendSpan starts a span of pushing the traced change to an instance,
+// it's a no-op one if the change is not traced.
+func startSendSpan(parent trace.SpanContext, stream string, remote *peer.Peer, instID, svc string) trace.Span {
+	return tracing.StartWithParent(parent, "discovery.send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("discovery.stream", stream),
+			attribute.String("discovery.remote", remoteAddr(remote)),
+			attribute.String("discovery.instance", instID),
+			attribute.String("discovery.service", svc),
+		),
+	)
+}
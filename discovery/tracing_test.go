@@ -0,0 +1,79 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestDependencyDiscoverySessionTraceSend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var (
+		stream, _ = makeDependenciesStream(ctrl)
+		session   = newDependencyDiscoverySession("inst_0", stream)
+		serveDone = make(chan struct{})
+	)
+	gomock.InOrder(
+		stream.EXPECT().Send(gomock.Any()).Return(nil),
+		stream.EXPECT().Send(gomock.Any()).Return(io.ErrUnexpectedEOF),
+	)
+	go func() {
+		session.Serve()
+		close(serveDone)
+	}()
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled})
+	// the untraced event doesn't produce span.
+	session.SendEvent(&config.DependencyEvent{ServiceName: "foo", Add: []string{"bar"}})
+	session.SendEvent(&config.DependencyEvent{ServiceName: "foo", Add: []string{"baz"}, Trace: parent})
+	select {
+	case <-time.NewTicker(time.Second).C:
+		t.Fatal("close timeout")
+	case <-serveDone:
+	}
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "discovery.send", spans[0].Name())
+	assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind())
+	assert.Equal(t, parent.TraceID(), spans[0].SpanContext().TraceID())
+	assert.Equal(t, parent.SpanID(), spans[0].Parent().SpanID())
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+	inst, _ := attrs.Value("discovery.instance")
+	assert.Equal(t, "inst_0", inst.AsString())
+	svc, _ := attrs.Value("discovery.service")
+	assert.Equal(t, "foo", svc.AsString())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, io.ErrUnexpectedEOF.Error(), spans[0].Status().Description)
+}
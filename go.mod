@@ -4,16 +4,27 @@ go 1.13
 
 require (
 	github.com/cenkalti/backoff/v3 v3.0.0
+	github.com/envoyproxy/go-control-plane v0.9.9
 	github.com/go-yaml/yaml v2.1.0+incompatible
+	github.com/gogo/protobuf v1.3.0
 	github.com/golang/mock v1.3.1
+	github.com/golang/protobuf v1.5.2
 	github.com/gorilla/mux v1.7.3
 	github.com/mesosphere/go-zookeeper v0.0.0-20190724122723-147466065fa4
+	github.com/prometheus/client_golang v1.2.1
 	github.com/rakyll/statik v0.1.6
 	github.com/samaritan-proxy/samaritan-api/go v0.0.0-20191128062029-063b4ce6f250
-	github.com/stretchr/testify v1.3.0
-	github.com/tevino/log v0.0.0-20191011110715-a95875091fd9
+	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.6
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	go.opentelemetry.io/proto/otlp v0.9.0
 	go.uber.org/atomic v1.5.0
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
-	google.golang.org/grpc v1.23.1
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gopkg.in/yaml.v2 v2.2.7 // indirect
 )
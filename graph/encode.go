@@ -0,0 +1,109 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Model is the JSON representation of graph.
+type Model struct {
+	Nodes  []string   `json:"nodes"`
+	Edges  []Edge     `json:"edges"`
+	Cycles [][]string `json:"cycles"`
+}
+
+// Model returns the JSON representation of graph.
+func (g *Graph) Model() *Model {
+	m := &Model{
+		Nodes:  g.nodes,
+		Edges:  g.Edges(),
+		Cycles: g.Cycles(),
+	}
+	if m.Nodes == nil {
+		m.Nodes = []string{}
+	}
+	if m.Edges == nil {
+		m.Edges = []Edge{}
+	}
+	if m.Cycles == nil {
+		m.Cycles = [][]string{}
+	}
+	return m
+}
+
+// cycleEdges returns the edges whose endpoints are in a same cycle.
+func (g *Graph) cycleEdges() map[Edge]bool {
+	res := make(map[Edge]bool)
+	for _, cycle := range g.Cycles() {
+		sub := g.Subgraph(cycle)
+		for _, e := range sub.Edges() {
+			res[e] = true
+		}
+	}
+	return res
+}
+
+// DOT encodes the graph in Graphviz DOT language, the edges in cycles are red.
+func (g *Graph) DOT() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("digraph dependencies {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	for _, n := range g.nodes {
+		fmt.Fprintf(buf, "  %s;\n", strconv.Quote(n))
+	}
+	cycleEdges := g.cycleEdges()
+	for _, e := range g.Edges() {
+		attr := ""
+		if cycleEdges[e] {
+			attr = " [color=red]"
+		}
+		fmt.Fprintf(buf, "  %s -> %s%s;\n", strconv.Quote(e.From), strconv.Quote(e.To), attr)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// mermaidEscaper escapes the labels by the entity codes of Mermaid, which
+// doesn't accept the backslash escapes.
+var mermaidEscaper = strings.NewReplacer(`#`, `#35;`, `"`, `#quot;`)
+
+// Mermaid encodes the graph in Mermaid flowchart syntax, the edges in
+// cycles are red. The services are referenced by generated ids, since
+// the names may contain the characters which are not allowed.
+func (g *Graph) Mermaid() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("graph LR\n")
+	ids := make(map[string]string, len(g.nodes))
+	for i, n := range g.nodes {
+		ids[n] = "n" + strconv.Itoa(i)
+		fmt.Fprintf(buf, "  %s[\"%s\"]\n", ids[n], mermaidEscaper.Replace(n))
+	}
+	cycleEdges := g.cycleEdges()
+	var red []int
+	for i, e := range g.Edges() {
+		fmt.Fprintf(buf, "  %s --> %s\n", ids[e.From], ids[e.To])
+		if cycleEdges[e] {
+			red = append(red, i)
+		}
+	}
+	for _, i := range red {
+		fmt.Fprintf(buf, "  linkStyle %d stroke:red\n", i)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+func TestModel(t *testing.T) {
+	b, err := json.Marshal(New(nil).Model())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"nodes": [], "edges": [], "cycles": []}`, string(b))
+
+	b, err = json.Marshal(newTestGraph().Subgraph([]string{"a", "b"}).Model())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"nodes": ["a", "b"], "edges": [{"from": "a", "to": "b"}], "cycles": []}`, string(b))
+}
+
+func TestDOT(t *testing.T) {
+	g := New(config.Dependencies{
+		{ServiceName: "a", Dependencies: []string{"b"}},
+		{ServiceName: "b", Dependencies: []string{"a", "c"}},
+	})
+	expect := `digraph dependencies {
+  rankdir=LR;
+  "a";
+  "b";
+  "c";
+  "a" -> "b" [color=red];
+  "b" -> "a" [color=red];
+  "b" -> "c";
+}
+`
+	assert.Equal(t, expect, string(g.DOT()))
+}
+
+func TestMermaid(t *testing.T) {
+	g := New(config.Dependencies{
+		{ServiceName: "a", Dependencies: []string{"b"}},
+		{ServiceName: "b", Dependencies: []string{"a", "c"}},
+	})
+	expect := `graph LR
+  n0["a"]
+  n1["b"]
+  n2["c"]
+  n0 --> n1
+  n1 --> n0
+  n1 --> n2
+  linkStyle 0 stroke:red
+  linkStyle 1 stroke:red
+`
+	assert.Equal(t, expect, string(g.Mermaid()))
+}
+
+func TestMermaidEscape(t *testing.T) {
+	g := New(config.Dependencies{
+		{ServiceName: `a"b`, Dependencies: []string{"c#quot;"}},
+	})
+	expect := `graph LR
+  n0["a#quot;b"]
+  n1["c#35;quot;"]
+  n0 --> n1
+`
+	assert.Equal(t, expect, string(g.Mermaid()))
+}
@@ -0,0 +1,221 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"sort"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+// Edge is a dependency from a service to another one.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph is a directed graph of service dependencies, it's immutable
+// once built.
+type Graph struct {
+	nodes   []string
+	edges   map[string][]string // service -> dependencies
+	reverse map[string][]string // service -> dependents
+}
+
+// New builds a graph from the dependencies. The services which are only
+// depended on are also the nodes of graph.
+func New(deps config.Dependencies) *Graph {
+	g := &Graph{
+		edges:   make(map[string][]string),
+		reverse: make(map[string][]string),
+	}
+	nodes := make(map[string]struct{})
+	edges := make(map[Edge]struct{})
+	for _, dep := range deps {
+		nodes[dep.ServiceName] = struct{}{}
+		for _, to := range dep.Dependencies {
+			nodes[to] = struct{}{}
+			edges[Edge{From: dep.ServiceName, To: to}] = struct{}{}
+		}
+	}
+	for node := range nodes {
+		g.nodes = append(g.nodes, node)
+	}
+	sort.Strings(g.nodes)
+	for e := range edges {
+		g.edges[e.From] = append(g.edges[e.From], e.To)
+		g.reverse[e.To] = append(g.reverse[e.To], e.From)
+	}
+	for _, m := range []map[string][]string{g.edges, g.reverse} {
+		for _, v := range m {
+			sort.Strings(v)
+		}
+	}
+	return g
+}
+
+// Nodes returns all the services in ascending order.
+func (g *Graph) Nodes() []string {
+	return g.nodes
+}
+
+// Has returns true if the service is a node of graph.
+func (g *Graph) Has(svc string) bool {
+	i := sort.SearchStrings(g.nodes, svc)
+	return i < len(g.nodes) && g.nodes[i] == svc
+}
+
+// Edges returns all the edges ordered by from and to.
+func (g *Graph) Edges() []Edge {
+	var res []Edge
+	for _, from := range g.nodes {
+		for _, to := range g.edges[from] {
+			res = append(res, Edge{From: from, To: to})
+		}
+	}
+	return res
+}
+
+// Dependencies returns the services which the service depends on directly.
+func (g *Graph) Dependencies(svc string) []string {
+	return g.edges[svc]
+}
+
+// Dependents returns the services which depend on the service directly.
+func (g *Graph) Dependents(svc string) []string {
+	return g.reverse[svc]
+}
+
+// Closure returns the services which the service depends on transitively,
+// or the ones depend on it if reverse is true. The service itself is
+// excluded unless it's in a cycle.
+func (g *Graph) Closure(svc string, reverse bool) []string {
+	next := g.edges
+	if reverse {
+		next = g.reverse
+	}
+	visited := make(map[string]struct{})
+	queue := []string{svc}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, n := range next[cur] {
+			if _, ok := visited[n]; ok {
+				continue
+			}
+			visited[n] = struct{}{}
+			queue = append(queue, n)
+		}
+	}
+	res := make([]string, 0, len(visited))
+	for n := range visited {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Subgraph returns the graph induced by the given services.
+func (g *Graph) Subgraph(svcs []string) *Graph {
+	set := make(map[string]struct{}, len(svcs))
+	for _, svc := range svcs {
+		set[svc] = struct{}{}
+	}
+	sub := &Graph{
+		edges:   make(map[string][]string),
+		reverse: make(map[string][]string),
+	}
+	for _, n := range g.nodes {
+		if _, ok := set[n]; !ok {
+			continue
+		}
+		sub.nodes = append(sub.nodes, n)
+		for _, to := range g.edges[n] {
+			if _, ok := set[to]; ok {
+				sub.edges[n] = append(sub.edges[n], to)
+				sub.reverse[to] = append(sub.reverse[to], n)
+			}
+		}
+	}
+	for _, v := range sub.reverse {
+		sort.Strings(v)
+	}
+	return sub
+}
+
+// Cycles returns the dependency cycles, each one is a strongly connected
+// component with more than one service or a service depending on itself.
+// The services of a cycle are sorted, and the cycles are ordered by their
+// first service.
+func (g *Graph) Cycles() [][]string {
+	// Tarjan's strongly connected components algorithm.
+	var (
+		index   = 0
+		indices = make(map[string]int, len(g.nodes))
+		lowlink = make(map[string]int, len(g.nodes))
+		onStack = make(map[string]bool, len(g.nodes))
+		stack   []string
+		res     [][]string
+	)
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		indices[v], lowlink[v] = index, index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range g.edges[v] {
+			if _, ok := indices[w]; !ok {
+				strongConnect(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && indices[w] < lowlink[v] {
+				lowlink[v] = indices[w]
+			}
+		}
+
+		if lowlink[v] != indices[v] {
+			return
+		}
+		var scc []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		if len(scc) > 1 || g.dependsOn(v, v) {
+			sort.Strings(scc)
+			res = append(res, scc)
+		}
+	}
+	for _, v := range g.nodes {
+		if _, ok := indices[v]; !ok {
+			strongConnect(v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i][0] < res[j][0] })
+	return res
+}
+
+func (g *Graph) dependsOn(from, to string) bool {
+	deps := g.edges[from]
+	i := sort.SearchStrings(deps, to)
+	return i < len(deps) && deps[i] == to
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+)
+
+// a -> b -> c -> a, c -> d, e -> e, f
+func newTestGraph() *Graph {
+	return New(config.Dependencies{
+		{ServiceName: "a", Dependencies: []string{"b"}},
+		{ServiceName: "b", Dependencies: []string{"c", "c"}},
+		{ServiceName: "c", Dependencies: []string{"d", "a"}},
+		{ServiceName: "e", Dependencies: []string{"e"}},
+		{ServiceName: "f"},
+	})
+}
+
+func TestGraph(t *testing.T) {
+	g := newTestGraph()
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, g.Nodes())
+	assert.True(t, g.Has("d"))
+	assert.False(t, g.Has("g"))
+	assert.Equal(t, []Edge{
+		{"a", "b"}, {"b", "c"}, {"c", "a"}, {"c", "d"}, {"e", "e"},
+	}, g.Edges())
+	assert.Equal(t, []string{"a", "d"}, g.Dependencies("c"))
+	assert.Equal(t, []string{"c"}, g.Dependents("a"))
+	assert.Empty(t, g.Dependents("f"))
+}
+
+func TestGraphClosure(t *testing.T) {
+	g := newTestGraph()
+	assert.Equal(t, []string{"a", "b", "c", "d"}, g.Closure("a", false))
+	assert.Equal(t, []string{"a", "b", "c"}, g.Closure("d", true))
+	assert.Empty(t, g.Closure("d", false))
+	assert.Equal(t, []string{"e"}, g.Closure("e", false))
+	assert.Empty(t, g.Closure("foo", true))
+}
+
+func TestGraphSubgraph(t *testing.T) {
+	sub := newTestGraph().Subgraph([]string{"c", "d", "a"})
+	assert.Equal(t, []string{"a", "c", "d"}, sub.Nodes())
+	assert.Equal(t, []Edge{{"c", "a"}, {"c", "d"}}, sub.Edges())
+	assert.Equal(t, []string{"c"}, sub.Dependents("d"))
+}
+
+func TestGraphCycles(t *testing.T) {
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"e"}}, newTestGraph().Cycles())
+	assert.Empty(t, New(config.Dependencies{
+		{ServiceName: "a", Dependencies: []string{"b", "c"}},
+		{ServiceName: "b", Dependencies: []string{"c"}},
+	}).Cycles())
+	assert.Empty(t, New(nil).Cycles())
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Syncer is a component which loads the data from the outside periodically,
+// such as the service registry cache and the config controller.
+type Syncer interface {
+	// LastSyncTime returns the time of the last successful sync, it is zero
+	// if the component has never been synced.
+	LastSyncTime() time.Time
+}
+
+// ComponentStatus represents the status of a component.
+type ComponentStatus struct {
+	Name         string     `json:"name"`
+	Ready        bool       `json:"ready"`
+	LastSyncTime *time.Time `json:"last_sync_time,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+}
+
+// Status represents the status of all the components.
+type Status struct {
+	Ready      bool               `json:"ready"`
+	Draining   bool               `json:"draining,omitempty"`
+	StartTime  time.Time          `json:"start_time"`
+	Components []*ComponentStatus `json:"components"`
+}
+
+type checkerOptions struct {
+	maxStaleness time.Duration
+}
+
+func defaultCheckerOptions() *checkerOptions {
+	return &checkerOptions{
+		maxStaleness: time.Minute,
+	}
+}
+
+type CheckerOption func(o *checkerOptions)
+
+// MaxStaleness sets how long the data of a component could be not synced,
+// zero means no limit.
+func MaxStaleness(d time.Duration) CheckerOption {
+	return func(o *checkerOptions) {
+		o.maxStaleness = d
+	}
+}
+
+type component struct {
+	name   string
+	syncer Syncer
+}
+
+// Checker checks whether all the registered components are ready. A component
+// is ready after the first successful sync, and becomes unready again when its
+// data is staler than the threshold.
+type Checker struct {
+	options   *checkerOptions
+	startTime time.Time
+	now       func() time.Time
+
+	mu         sync.RWMutex
+	components []*component
+	draining   bool
+}
+
+// NewChecker creates a checker.
+func NewChecker(opts ...CheckerOption) *Checker {
+	o := defaultCheckerOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Checker{
+		options:   o,
+		startTime: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Register registers a component with the given name.
+func (c *Checker) Register(name string, s Syncer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.components = append(c.components, &component{name: name, syncer: s})
+}
+
+// Drain marks sash as unready permanently, it's called before shutting down
+// so that no more traffic is routed to it.
+func (c *Checker) Drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.draining = true
+}
+
+func (c *Checker) check(comp *component) *ComponentStatus {
+	status := &ComponentStatus{Name: comp.name}
+	t := comp.syncer.LastSyncTime()
+	if t.IsZero() {
+		status.Reason = "never synced"
+		return status
+	}
+	status.LastSyncTime = &t
+	if maxStaleness := c.options.maxStaleness; maxStaleness > 0 {
+		if elapsed := c.now().Sub(t); elapsed > maxStaleness {
+			status.Reason = fmt.Sprintf("not synced for %s", elapsed.Truncate(time.Second))
+			return status
+		}
+	}
+	status.Ready = true
+	return status
+}
+
+// Status returns the status of all the components.
+func (c *Checker) Status() *Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := &Status{
+		Ready:      !c.draining,
+		Draining:   c.draining,
+		StartTime:  c.startTime,
+		Components: make([]*ComponentStatus, 0, len(c.components)),
+	}
+	for _, comp := range c.components {
+		cs := c.check(comp)
+		if !cs.Ready {
+			s.Ready = false
+		}
+		s.Components = append(s.Components, cs)
+	}
+	return s
+}
+
+// Ready returns an error which describes the first unready component, nil
+// if all the components are ready.
+func (c *Checker) Ready() error {
+	status := c.Status()
+	if status.Draining {
+		return errors.New("draining")
+	}
+	for _, cs := range status.Components {
+		if !cs.Ready {
+			return fmt.Errorf("%s is not ready: %s", cs.Name, cs.Reason)
+		}
+	}
+	return nil
+}
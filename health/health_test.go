@@ -0,0 +1,76 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syncerFunc func() time.Time
+
+func (f syncerFunc) LastSyncTime() time.Time { return f() }
+
+func TestChecker(t *testing.T) {
+	now := time.Now()
+	var regSync, cfgSync time.Time
+	c := NewChecker(MaxStaleness(time.Minute))
+	c.now = func() time.Time { return now }
+	c.Register("registry", syncerFunc(func() time.Time { return regSync }))
+	c.Register("config", syncerFunc(func() time.Time { return cfgSync }))
+
+	// never synced
+	s := c.Status()
+	assert.False(t, s.Ready)
+	assert.Len(t, s.Components, 2)
+	assert.Equal(t, "never synced", s.Components[0].Reason)
+	assert.EqualError(t, c.Ready(), "registry is not ready: never synced")
+
+	// partially synced
+	regSync = now.Add(-time.Second)
+	assert.EqualError(t, c.Ready(), "config is not ready: never synced")
+
+	// all synced
+	cfgSync = now
+	s = c.Status()
+	assert.True(t, s.Ready)
+	assert.Equal(t, regSync, *s.Components[0].LastSyncTime)
+	assert.NoError(t, c.Ready())
+
+	// stale
+	regSync = now.Add(-time.Minute * 2)
+	assert.EqualError(t, c.Ready(), "registry is not ready: not synced for 2m0s")
+}
+
+func TestCheckerNoStalenessLimit(t *testing.T) {
+	c := NewChecker(MaxStaleness(0))
+	c.Register("registry", syncerFunc(func() time.Time { return time.Unix(0, 0) }))
+	assert.NoError(t, c.Ready())
+}
+
+func TestCheckerDrain(t *testing.T) {
+	c := NewChecker()
+	c.Register("registry", syncerFunc(time.Now))
+	assert.NoError(t, c.Ready())
+
+	c.Drain()
+	s := c.Status()
+	assert.False(t, s.Ready)
+	assert.True(t, s.Draining)
+	assert.True(t, s.Components[0].Ready)
+	assert.EqualError(t, c.Ready(), "draining")
+}
@@ -31,6 +31,8 @@ import (
 
 var (
 	errConnectTimeout = errors.New("zk connect timeout")
+
+	log = logger.Component("zk")
 )
 
 func init() {
@@ -53,6 +55,25 @@ type ConnConfig struct {
 	BasePath       string        `yaml:"base_path"`
 }
 
+// Verify verifies the config.
+func (cfg *ConnConfig) Verify() error {
+	if len(cfg.Hosts) == 0 {
+		return errors.New("hosts is empty")
+	}
+	for _, host := range cfg.Hosts {
+		if host == "" {
+			return errors.New("empty host")
+		}
+	}
+	if cfg.BasePath == "" {
+		return errors.New("base_path is empty")
+	}
+	if !path.IsAbs(cfg.BasePath) {
+		return fmt.Errorf("base_path %q is not absolute", cfg.BasePath)
+	}
+	return nil
+}
+
 // auth returns a string of "User:Pwd".
 func (cfg *ConnConfig) auth() string {
 	if cfg.User != "" || cfg.Pwd != "" {
@@ -69,6 +90,8 @@ type Conn interface {
 	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
 	Exists(path string) (bool, *zk.Stat, error)
 	CreateRecursively(p string, data []byte) error
+	CreateEphemeralSequential(p string, data []byte) (string, error)
+	Delete(path string, version int32) error
 	DeleteWithChildren(pathcur string) error
 	Update() <-chan zk.Event
 	Close()
@@ -103,7 +126,7 @@ func createConn(cfg *ConnConfig, waitConnected bool) (*conn, error) {
 	}
 	c.Conn, c.update, err = zk.Connect(cfg.Hosts, cfg.SessionTimeout,
 		func(c *zk.Conn) {
-			c.SetLogger(logger.Get())
+			c.SetLogger(log)
 		},
 		zk.WithDialer(zk.Dialer(func(network, address string, timeout time.Duration) (net.Conn, error) {
 			// a dialer only to override the timeout which is set to 1s inside go-zookeeper
@@ -135,7 +158,7 @@ var addAuth = func(conn *zk.Conn, scheme string, auth []byte) error {
 
 func (c *conn) addAuth() error {
 	if c.cfg.auth() != "" && !c.Authed() {
-		logger.Debug("Authenticating with: ", c.cfg.auth())
+		log.Debug("Authenticating with: ", c.cfg.auth())
 		err := addAuth(c.Conn, "digest", []byte(c.cfg.auth()))
 		if err == nil {
 			c.authAdded.Store(true)
@@ -152,7 +175,7 @@ func (c *conn) waitConnected() error {
 		e := <-c.update
 		switch e.State {
 		case zk.StateConnected, zk.StateHasSession:
-			logger.Info("Zookeeper connection established")
+			log.Info("Zookeeper connection established")
 			return nil
 		case zk.StateConnecting:
 			attempt++
@@ -183,6 +206,17 @@ func (c *conn) CreateRecursively(p string, data []byte) error {
 	return err
 }
 
+// CreateEphemeralSequential creates an ephemeral sequential node with the
+// given prefix and its parents if necessary, returns the path of the created
+// node. The node is found by a protected name if the connection is lost during
+// creating, so it won't be orphaned.
+func (c *conn) CreateEphemeralSequential(p string, data []byte) (string, error) {
+	if err := c.createParentRecursively(p); err != nil {
+		return "", err
+	}
+	return c.CreateProtectedEphemeralSequential(p, data, c.getACL())
+}
+
 // createParentRecursively creates given path's parents if necessary.
 func (c *conn) createParentRecursively(p string) error {
 	var parent = path.Dir(p)
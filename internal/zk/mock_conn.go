@@ -117,6 +117,31 @@ func (mr *MockConnMockRecorder) CreateRecursively(p, data interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRecursively", reflect.TypeOf((*MockConn)(nil).CreateRecursively), p, data)
 }
 
+// CreateEphemeralSequential mocks base method
+func (m *MockConn) CreateEphemeralSequential(p string, data []byte) (string, error) {
+	ret := m.ctrl.Call(m, "CreateEphemeralSequential", p, data)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateEphemeralSequential indicates an expected call of CreateEphemeralSequential
+func (mr *MockConnMockRecorder) CreateEphemeralSequential(p, data interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateEphemeralSequential", reflect.TypeOf((*MockConn)(nil).CreateEphemeralSequential), p, data)
+}
+
+// Delete mocks base method
+func (m *MockConn) Delete(path string, version int32) error {
+	ret := m.ctrl.Call(m, "Delete", path, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockConnMockRecorder) Delete(path, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockConn)(nil).Delete), path, version)
+}
+
 // DeleteWithChildren mocks base method
 func (m *MockConn) DeleteWithChildren(pathcur string) error {
 	ret := m.ctrl.Call(m, "DeleteWithChildren", pathcur)
@@ -0,0 +1,238 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+var (
+	log = logger.Component("leader")
+
+	isLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sash",
+		Subsystem: "leader",
+		Name:      "is_leader",
+		Help:      "Whether the replica is the leader, 1 if it is.",
+	})
+	transitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "leader",
+		Name:      "transitions_total",
+		Help:      "Total number of the leadership changes of the replica.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(isLeader, transitions)
+}
+
+// Lock is the lock which backs the election, the replica holding it is the
+// leader.
+type Lock interface {
+	// Campaign blocks until the lock is acquired by the given id or ctx is
+	// done. The returned channel is closed once the lock is lost.
+	Campaign(ctx context.Context, id string) (<-chan struct{}, error)
+	// Resign releases the lock if it's held by the given id.
+	Resign(id string) error
+	// Leader returns the id of the current holder, empty if none.
+	Leader() (string, error)
+}
+
+// Task is a duty which must run on exactly one replica, it's started when
+// becoming the leader, and stopped when losing the leadership. It may be
+// started again after stopped.
+type Task interface {
+	Start()
+	Stop()
+}
+
+// Status represents the leadership status of the replica.
+type Status struct {
+	ID       string     `json:"id"`
+	Leader   string     `json:"leader"`
+	IsLeader bool       `json:"is_leader"`
+	Since    *time.Time `json:"since,omitempty"`
+	Tasks    []string   `json:"tasks"`
+}
+
+type electorOptions struct {
+	retryInterval time.Duration
+}
+
+func defaultElectorOptions() *electorOptions {
+	return &electorOptions{
+		retryInterval: time.Second * 5,
+	}
+}
+
+type ElectorOption func(o *electorOptions)
+
+// RetryInterval sets how long to wait before campaigning again after failed.
+func RetryInterval(d time.Duration) ElectorOption {
+	return func(o *electorOptions) {
+		o.retryInterval = d
+	}
+}
+
+type namedTask struct {
+	name string
+	task Task
+}
+
+// Elector campaigns for the leadership, and runs the leader-only tasks while
+// being the leader.
+type Elector struct {
+	id      string
+	lock    Lock
+	options *electorOptions
+
+	mu      sync.Mutex
+	tasks   []*namedTask
+	leading bool
+	since   time.Time
+}
+
+// NewElector creates an elector with the id of replica.
+func NewElector(id string, lock Lock, opts ...ElectorOption) *Elector {
+	o := defaultElectorOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Elector{
+		id:      id,
+		lock:    lock,
+		options: o,
+	}
+}
+
+// Register registers a leader-only task, it's started at once if the replica
+// is the leader already.
+func (e *Elector) Register(name string, task Task) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tasks = append(e.tasks, &namedTask{name: name, task: task})
+	if e.leading {
+		log.Infof("Start leader-only task %s", name)
+		task.Start()
+	}
+}
+
+// Run campaigns for the leadership until ctx is done, the tasks are stopped
+// and the leadership is resigned before returning.
+func (e *Elector) Run(ctx context.Context) {
+	for {
+		lost, err := e.lock.Campaign(ctx, e.id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warnf("Campaign for leadership failed: %v, retry after %s", err, e.options.retryInterval)
+			t := time.NewTimer(e.options.retryInterval)
+			select {
+			case <-t.C:
+				continue
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+		}
+
+		e.lead()
+		select {
+		case <-lost:
+			log.Warn("Leadership lost")
+			e.unlead()
+			// clean up the residue, such as the node of an expired session.
+			if err := e.lock.Resign(e.id); err != nil {
+				log.Warnf("Failed to resign: %v", err)
+			}
+		case <-ctx.Done():
+			e.unlead()
+			if err := e.lock.Resign(e.id); err != nil {
+				log.Warnf("Failed to resign: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func (e *Elector) lead() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	log.Infof("Became the leader as %s", e.id)
+	e.leading, e.since = true, time.Now()
+	isLeader.Set(1)
+	transitions.Inc()
+	for _, t := range e.tasks {
+		log.Infof("Start leader-only task %s", t.name)
+		t.task.Start()
+	}
+}
+
+func (e *Elector) unlead() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// stop in the reverse order
+	for i := len(e.tasks) - 1; i >= 0; i-- {
+		log.Infof("Stop leader-only task %s", e.tasks[i].name)
+		e.tasks[i].task.Stop()
+	}
+	e.leading, e.since = false, time.Time{}
+	isLeader.Set(0)
+	transitions.Inc()
+}
+
+// IsLeader returns whether the replica is the leader.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Status returns the leadership status, the leader is empty if unknown.
+func (e *Elector) Status() *Status {
+	e.mu.Lock()
+	s := &Status{
+		ID:       e.id,
+		IsLeader: e.leading,
+		Tasks:    make([]string, 0, len(e.tasks)),
+	}
+	if e.leading {
+		since := e.since
+		s.Since = &since
+	}
+	for _, t := range e.tasks {
+		s.Tasks = append(s.Tasks, t.name)
+	}
+	e.mu.Unlock()
+
+	if s.IsLeader {
+		s.Leader = e.id
+		return s
+	}
+	leader, err := e.lock.Leader()
+	if err != nil {
+		log.Warnf("Failed to get the leader: %v", err)
+	}
+	s.Leader = leader
+	return s
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testTask struct {
+	sync.Mutex
+	running bool
+	starts  int
+}
+
+func (t *testTask) Start() {
+	t.Lock()
+	defer t.Unlock()
+	t.running = true
+	t.starts++
+}
+
+func (t *testTask) Stop() {
+	t.Lock()
+	defer t.Unlock()
+	t.running = false
+}
+
+func (t *testTask) isRunning() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.running
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
+
+func TestElector(t *testing.T) {
+	lock := NewLocalLock()
+	e1 := NewElector("sash-1", lock, RetryInterval(time.Millisecond))
+	e2 := NewElector("sash-2", lock, RetryInterval(time.Millisecond))
+	task1, task2 := new(testTask), new(testTask)
+	e1.Register("task", task1)
+	e2.Register("task", task2)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan struct{})
+	go func() {
+		e1.Run(ctx1)
+		close(done1)
+	}()
+	waitFor(t, e1.IsLeader)
+	assert.True(t, task1.isRunning())
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go e2.Run(ctx2)
+	time.Sleep(time.Millisecond * 20)
+	assert.False(t, e2.IsLeader())
+	assert.False(t, task2.isRunning())
+	s := e2.Status()
+	assert.Equal(t, "sash-2", s.ID)
+	assert.Equal(t, "sash-1", s.Leader)
+	assert.False(t, s.IsLeader)
+	assert.Nil(t, s.Since)
+	assert.Equal(t, []string{"task"}, s.Tasks)
+
+	// the leadership is handed over when the leader exits.
+	cancel1()
+	<-done1
+	assert.False(t, e1.IsLeader())
+	assert.False(t, task1.isRunning())
+	waitFor(t, e2.IsLeader)
+	assert.True(t, task2.isRunning())
+	s = e2.Status()
+	assert.Equal(t, "sash-2", s.Leader)
+	assert.NotNil(t, s.Since)
+}
+
+func TestElectorLost(t *testing.T) {
+	lock := NewLocalLock()
+	e := NewElector("sash-1", lock, RetryInterval(time.Millisecond))
+	task := new(testTask)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	waitFor(t, e.IsLeader)
+
+	// the task registered after leading is started at once.
+	e.Register("task", task)
+	assert.True(t, task.isRunning())
+
+	// campaign again after lost
+	lock.Revoke()
+	waitFor(t, func() bool {
+		task.Lock()
+		defer task.Unlock()
+		return task.starts == 2
+	})
+	assert.True(t, e.IsLeader())
+}
+
+func TestLocalLock(t *testing.T) {
+	l := NewLocalLock()
+	lost, err := l.Campaign(context.Background(), "a")
+	assert.NoError(t, err)
+	leader, _ := l.Leader()
+	assert.Equal(t, "a", leader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = l.Campaign(ctx, "b")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// resigned by the others is no-op.
+	assert.NoError(t, l.Resign("b"))
+	leader, _ = l.Leader()
+	assert.Equal(t, "a", leader)
+
+	assert.NoError(t, l.Resign("a"))
+	select {
+	case <-lost:
+	default:
+		t.Fatal("lost should be closed")
+	}
+	leader, _ = l.Leader()
+	assert.Empty(t, leader)
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"sync"
+)
+
+// LocalLock is a process-local lock, the electors sharing it compete with
+// each other. It stands in for the distributed lock in tests, and makes the
+// only replica the leader.
+type LocalLock struct {
+	mu     sync.Mutex
+	holder string
+	lost   chan struct{}
+	free   chan struct{} // closed when released, to wake up the campaigners.
+}
+
+// NewLocalLock creates a local lock.
+func NewLocalLock() *LocalLock {
+	return &LocalLock{}
+}
+
+// Campaign implements Lock.
+func (l *LocalLock) Campaign(ctx context.Context, id string) (<-chan struct{}, error) {
+	for {
+		l.mu.Lock()
+		if l.holder == "" {
+			l.holder = id
+			l.lost, l.free = make(chan struct{}), make(chan struct{})
+			lost := l.lost
+			l.mu.Unlock()
+			return lost, nil
+		}
+		free := l.free
+		l.mu.Unlock()
+
+		select {
+		case <-free:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Resign implements Lock.
+func (l *LocalLock) Resign(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == id {
+		l.release()
+	}
+	return nil
+}
+
+// Revoke takes the lock away from the holder, just like its session is
+// expired.
+func (l *LocalLock) Revoke() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder != "" {
+		l.release()
+	}
+}
+
+// release must be called with lock held.
+func (l *LocalLock) release() {
+	l.holder = ""
+	close(l.lost)
+	close(l.free)
+}
+
+// Leader implements Lock.
+func (l *LocalLock) Leader() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holder, nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	zkpkg "github.com/mesosphere/go-zookeeper/zk"
+
+	"github.com/samaritan-proxy/sash/internal/zk"
+)
+
+// nodePrefix is the prefix of the election nodes, which is followed by the
+// sequence number assigned by zookeeper.
+const nodePrefix = "n_"
+
+// seqLen is the length of the sequence number suffix of a sequential node.
+const seqLen = 10
+
+var errNodeLost = errors.New("election node lost")
+
+// ZKLock is a lock built on the ephemeral sequential nodes of zookeeper.
+// Every campaigner creates a node under the base path, and the one with the
+// lowest sequence number holds the lock. The others watch their predecessors,
+// so only one of them is woken up when the holder leaves. The node is removed
+// by zookeeper when the session expires, which releases the lock.
+//
+// The holder can't know whether its session has expired while disconnected,
+// another campaigner may hold the lock then, so the lock is considered lost
+// once the connection is lost.
+type ZKLock struct {
+	conn     zk.Conn
+	basePath string
+
+	mu           sync.Mutex
+	node         string        // the path of our node, empty if none.
+	disconnected chan struct{} // closed while the connection is lost.
+}
+
+// NewZKLock creates a lock with the nodes under basePath, the lock consumes
+// the session events of conn, so conn should be used by it only.
+func NewZKLock(conn zk.Conn, basePath string) *ZKLock {
+	l := &ZKLock{
+		conn:         conn,
+		basePath:     basePath,
+		disconnected: make(chan struct{}),
+	}
+	go l.watchSession(conn.Update())
+	return l
+}
+
+// watchSession tracks the connection state until the connection is closed.
+func (l *ZKLock) watchSession(events <-chan zkpkg.Event) {
+	for evt := range events {
+		switch evt.State {
+		case zkpkg.StateDisconnected, zkpkg.StateExpired:
+			l.setConnected(false)
+		case zkpkg.StateHasSession:
+			l.setConnected(true)
+		}
+	}
+	l.setConnected(false)
+}
+
+func (l *ZKLock) setConnected(connected bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.disconnected:
+		if connected {
+			l.disconnected = make(chan struct{})
+		}
+	default:
+		if !connected {
+			close(l.disconnected)
+		}
+	}
+}
+
+func (l *ZKLock) disconnectedCh() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.disconnected
+}
+
+// sortNodes sorts the election nodes by their sequence numbers, the others
+// are dropped.
+func sortNodes(children []string) []string {
+	nodes := make([]string, 0, len(children))
+	for _, child := range children {
+		if len(child) > seqLen && strings.HasSuffix(child[:len(child)-seqLen], nodePrefix) {
+			nodes = append(nodes, child)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i][len(nodes[i])-seqLen:] < nodes[j][len(nodes[j])-seqLen:]
+	})
+	return nodes
+}
+
+func (l *ZKLock) setNode(node string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.node = node
+}
+
+// Campaign implements Lock.
+func (l *ZKLock) Campaign(ctx context.Context, id string) (<-chan struct{}, error) {
+	// the node left by the last term would block us forever if our session
+	// survived the disconnection.
+	if err := l.Resign(id); err != nil {
+		return nil, err
+	}
+	node, err := l.conn.CreateEphemeralSequential(path.Join(l.basePath, nodePrefix), []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	l.setNode(node)
+
+	for {
+		lost, err := l.tryAcquire(ctx, node)
+		if err != nil {
+			if err := l.Resign(id); err != nil {
+				log.Warnf("Failed to delete election node %s: %v", node, err)
+			}
+			return nil, err
+		}
+		if lost != nil {
+			return lost, nil
+		}
+	}
+}
+
+// tryAcquire returns a non-nil channel if acquired, otherwise it waits for
+// the predecessor to leave and returns nil.
+func (l *ZKLock) tryAcquire(ctx context.Context, node string) (<-chan struct{}, error) {
+	children, _, err := l.conn.Children(l.basePath)
+	if err != nil {
+		return nil, err
+	}
+	nodes := sortNodes(children)
+	idx := -1
+	for i, n := range nodes {
+		if n == path.Base(node) {
+			idx = i
+			break
+		}
+	}
+	switch idx {
+	case -1:
+		// the session has expired.
+		return nil, errNodeLost
+	case 0:
+		lost := make(chan struct{})
+		go l.watch(node, l.disconnectedCh(), lost)
+		return lost, nil
+	}
+
+	_, _, ch, err := l.conn.GetW(path.Join(l.basePath, nodes[idx-1]))
+	switch err {
+	case nil:
+	case zkpkg.ErrNoNode:
+		// the predecessor has gone, check again.
+		return nil, nil
+	default:
+		return nil, err
+	}
+	select {
+	case <-ch:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// watch closes lost once the node is deleted, can't be watched any more or
+// the connection is lost.
+func (l *ZKLock) watch(node string, disconnected <-chan struct{}, lost chan struct{}) {
+	defer close(lost)
+	for {
+		_, _, ch, err := l.conn.GetW(node)
+		if err != nil {
+			log.Warnf("Failed to watch election node %s: %v", node, err)
+			return
+		}
+		select {
+		case evt := <-ch:
+			switch evt.Type {
+			case zkpkg.EventNodeDeleted, zkpkg.EventNotWatching:
+				log.Warnf("Election node %s is gone: %v %v", node, evt.Type, evt.Err)
+				return
+			}
+		case <-disconnected:
+			log.Warnf("Connection of election node %s is lost", node)
+			return
+		}
+	}
+}
+
+// Resign implements Lock, the node is deleted. The id is ignored since the
+// lock is used by one campaigner only.
+func (l *ZKLock) Resign(_ string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.node == "" {
+		return nil
+	}
+	err := l.conn.Delete(l.node, -1)
+	if err != nil && err != zkpkg.ErrNoNode {
+		return err
+	}
+	l.node = ""
+	return nil
+}
+
+// Leader implements Lock, it's the id stored in the lowest node.
+func (l *ZKLock) Leader() (string, error) {
+	children, _, err := l.conn.Children(l.basePath)
+	switch err {
+	case nil:
+	case zkpkg.ErrNoNode:
+		return "", nil
+	default:
+		return "", err
+	}
+	for _, node := range sortNodes(children) {
+		data, _, err := l.conn.Get(path.Join(l.basePath, node))
+		switch err {
+		case nil:
+			return string(data), nil
+		case zkpkg.ErrNoNode:
+			// it has just left, try the next one.
+			continue
+		default:
+			return "", err
+		}
+	}
+	return "", nil
+}
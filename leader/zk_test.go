@@ -0,0 +1,214 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	zkpkg "github.com/mesosphere/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/internal/zk"
+)
+
+const (
+	node1 = "_c_1a-n_0000000001"
+	node2 = "_c_2b-n_0000000002"
+)
+
+// newMockConn returns a mock connection and the channel of its session
+// events.
+func newMockConn(ctrl *gomock.Controller) (*zk.MockConn, chan zkpkg.Event) {
+	conn := zk.NewMockConn(ctrl)
+	events := make(chan zkpkg.Event, 1)
+	conn.EXPECT().Update().Return((<-chan zkpkg.Event)(events))
+	return conn, events
+}
+
+func TestSortNodes(t *testing.T) {
+	nodes := sortNodes([]string{"_c_9z-n_0000000010", node2, "foo", node1, "n_0000000003"})
+	assert.Equal(t, []string{node1, node2, "n_0000000003", "_c_9z-n_0000000010"}, nodes)
+}
+
+func TestZKLockCampaign(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn, _ := newMockConn(ctrl)
+	conn.EXPECT().CreateEphemeralSequential("/sash/leader/n_", []byte("sash-1")).Return("/sash/leader/"+node1, nil)
+	conn.EXPECT().Children("/sash/leader").Return([]string{node2, node1}, nil, nil)
+	watchCh := make(chan zkpkg.Event, 1)
+	watched := make(chan struct{})
+	conn.EXPECT().GetW("/sash/leader/" + node1).DoAndReturn(func(string) ([]byte, *zkpkg.Stat, <-chan zkpkg.Event, error) {
+		close(watched)
+		return nil, nil, watchCh, nil
+	})
+
+	l := NewZKLock(conn, "/sash/leader")
+	lost, err := l.Campaign(context.Background(), "sash-1")
+	assert.NoError(t, err)
+	<-watched
+	select {
+	case <-lost:
+		t.Fatal("unexpected lost")
+	default:
+	}
+
+	// the session is expired.
+	watchCh <- zkpkg.Event{Type: zkpkg.EventNotWatching, Err: zkpkg.ErrSessionExpired}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("lost should be closed")
+	}
+
+	conn.EXPECT().Delete("/sash/leader/"+node1, int32(-1)).Return(zkpkg.ErrNoNode)
+	assert.NoError(t, l.Resign("sash-1"))
+	// resign again is no-op.
+	assert.NoError(t, l.Resign("sash-1"))
+}
+
+func TestZKLockDisconnected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn, events := newMockConn(ctrl)
+	gomock.InOrder(
+		conn.EXPECT().CreateEphemeralSequential("/sash/leader/n_", []byte("sash-1")).Return("/sash/leader/"+node1, nil),
+		conn.EXPECT().Children("/sash/leader").Return([]string{node1}, nil, nil),
+		// the node of the last term is deleted before campaigning again.
+		conn.EXPECT().Delete("/sash/leader/"+node1, int32(-1)).Return(nil),
+		conn.EXPECT().CreateEphemeralSequential("/sash/leader/n_", []byte("sash-1")).Return("/sash/leader/"+node2, nil),
+		conn.EXPECT().Children("/sash/leader").Return([]string{node2}, nil, nil),
+	)
+	watched := make(chan struct{}, 2)
+	conn.EXPECT().GetW(gomock.Any()).DoAndReturn(func(string) ([]byte, *zkpkg.Stat, <-chan zkpkg.Event, error) {
+		watched <- struct{}{}
+		return nil, nil, make(chan zkpkg.Event), nil
+	}).Times(2)
+
+	l := NewZKLock(conn, "/sash/leader")
+	lost, err := l.Campaign(context.Background(), "sash-1")
+	assert.NoError(t, err)
+	<-watched
+
+	// the session may expire while disconnected.
+	events <- zkpkg.Event{Type: zkpkg.EventSession, State: zkpkg.StateDisconnected}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("lost should be closed")
+	}
+
+	events <- zkpkg.Event{Type: zkpkg.EventSession, State: zkpkg.StateHasSession}
+	assert.Eventually(t, func() bool {
+		select {
+		case <-l.disconnectedCh():
+			return false
+		default:
+			return true
+		}
+	}, time.Second, time.Millisecond)
+	lost, err = l.Campaign(context.Background(), "sash-1")
+	assert.NoError(t, err)
+	<-watched
+	select {
+	case <-lost:
+		t.Fatal("unexpected lost")
+	case <-time.After(time.Millisecond * 10):
+	}
+}
+
+func TestZKLockCampaignWait(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn, _ := newMockConn(ctrl)
+	conn.EXPECT().CreateEphemeralSequential("/sash/leader/n_", []byte("sash-2")).Return("/sash/leader/"+node2, nil)
+	predCh := make(chan zkpkg.Event, 1)
+	watched := make(chan struct{})
+	gomock.InOrder(
+		conn.EXPECT().Children("/sash/leader").Return([]string{node2, node1}, nil, nil),
+		conn.EXPECT().GetW("/sash/leader/"+node1).Return(nil, nil, (<-chan zkpkg.Event)(predCh), nil),
+		conn.EXPECT().Children("/sash/leader").Return([]string{node2}, nil, nil),
+		conn.EXPECT().GetW("/sash/leader/"+node2).DoAndReturn(func(string) ([]byte, *zkpkg.Stat, <-chan zkpkg.Event, error) {
+			close(watched)
+			return nil, nil, make(chan zkpkg.Event), nil
+		}),
+	)
+
+	l := NewZKLock(conn, "/sash/leader")
+	time.AfterFunc(time.Millisecond*10, func() {
+		predCh <- zkpkg.Event{Type: zkpkg.EventNodeDeleted}
+	})
+	_, err := l.Campaign(context.Background(), "sash-2")
+	assert.NoError(t, err)
+	<-watched
+}
+
+func TestZKLockCampaignCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn, _ := newMockConn(ctrl)
+	conn.EXPECT().CreateEphemeralSequential("/sash/leader/n_", []byte("sash-2")).Return("/sash/leader/"+node2, nil)
+	conn.EXPECT().Children("/sash/leader").Return([]string{node2, node1}, nil, nil)
+	conn.EXPECT().GetW("/sash/leader/"+node1).Return(nil, nil, (<-chan zkpkg.Event)(make(chan zkpkg.Event)), nil)
+	// the node is deleted on failure.
+	conn.EXPECT().Delete("/sash/leader/"+node2, int32(-1)).Return(nil)
+
+	l := NewZKLock(conn, "/sash/leader")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := l.Campaign(ctx, "sash-2")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestZKLockCampaignNodeLost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn, _ := newMockConn(ctrl)
+	conn.EXPECT().CreateEphemeralSequential("/sash/leader/n_", []byte("sash-2")).Return("/sash/leader/"+node2, nil)
+	conn.EXPECT().Children("/sash/leader").Return([]string{node1}, nil, nil)
+	conn.EXPECT().Delete("/sash/leader/"+node2, int32(-1)).Return(zkpkg.ErrNoNode)
+
+	l := NewZKLock(conn, "/sash/leader")
+	_, err := l.Campaign(context.Background(), "sash-2")
+	assert.Equal(t, errNodeLost, err)
+}
+
+func TestZKLockLeader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn, _ := newMockConn(ctrl)
+	l := NewZKLock(conn, "/sash/leader")
+
+	conn.EXPECT().Children("/sash/leader").Return(nil, nil, zkpkg.ErrNoNode)
+	leader, err := l.Leader()
+	assert.NoError(t, err)
+	assert.Empty(t, leader)
+
+	conn.EXPECT().Children("/sash/leader").Return([]string{node2, node1}, nil, nil)
+	conn.EXPECT().Get("/sash/leader/"+node1).Return(nil, nil, zkpkg.ErrNoNode)
+	conn.EXPECT().Get("/sash/leader/"+node2).Return([]byte("sash-2"), nil, nil)
+	leader, err = l.Leader()
+	assert.NoError(t, err)
+	assert.Equal(t, "sash-2", leader)
+}
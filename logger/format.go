@@ -0,0 +1,142 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The following shows the available formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// entry is a log entry.
+type entry struct {
+	Time      time.Time
+	Level     Level
+	Caller    string
+	Component string
+	Msg       string
+	Fields    []interface{} // key/value pairs
+}
+
+type encoder func(e *entry) []byte
+
+func encoderOf(format string) (encoder, error) {
+	switch format {
+	case "", FormatText:
+		return encodeText, nil
+	case FormatJSON:
+		return encodeJSON, nil
+	default:
+		return nil, fmt.Errorf("invalid log format: %q", format)
+	}
+}
+
+// rangeFields calls fn on every key/value pair, a missing value is
+// reported as nil.
+func rangeFields(fields []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{}
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		fn(key, value)
+	}
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// encodeText encodes the entry in the form of
+// "I 2006/01/02 15:04:05.000000 dir/file.go:10: [component] msg key=value".
+func encodeText(e *entry) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(e.Level.abbr())
+	buf.WriteByte(' ')
+	buf.WriteString(e.Time.Format("2006/01/02 15:04:05.000000"))
+	buf.WriteByte(' ')
+	buf.WriteString(e.Caller)
+	buf.WriteString(": ")
+	if e.Component != "" {
+		buf.WriteString("[")
+		buf.WriteString(e.Component)
+		buf.WriteString("] ")
+	}
+	buf.WriteString(strings.TrimSuffix(e.Msg, "\n"))
+	rangeFields(e.Fields, func(key string, value interface{}) {
+		s := formatValue(value)
+		if s == "" || strings.ContainsAny(s, " =\"\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(s)
+	})
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func encodeJSON(e *entry) []byte {
+	buf := new(bytes.Buffer)
+	writeKV := func(key string, value interface{}) {
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		} else {
+			buf.WriteByte('{')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		switch value.(type) {
+		case error, fmt.Stringer:
+			value = formatValue(value)
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.Write(v)
+	}
+	writeKV("time", e.Time.Format(time.RFC3339Nano))
+	writeKV("level", e.Level.String())
+	writeKV("caller", e.Caller)
+	if e.Component != "" {
+		writeKV("component", e.Component)
+	}
+	writeKV("msg", strings.TrimSuffix(e.Msg, "\n"))
+	rangeFields(e.Fields, writeKV)
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
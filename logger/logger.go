@@ -1,4 +1,4 @@
-// Copyright 2019 Samaritan Authors
+// Copyright 2020 Samaritan Authors
 //
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -12,85 +12,305 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package logger provides the leveled and structured logging. A log entry
+// could carry the key/value fields, and be written in text or json format.
+// Every component has its own logger, whose level could be changed
+// separately.
 package logger
 
 import (
-	"log/syslog"
+	"fmt"
 	"os"
-
-	"github.com/tevino/log"
-)
-
-const (
-	defaultFlags    = log.LstdFlags | log.Lshortfile | log.Lmicroseconds
-	defaultPriority = syslog.LOG_INFO | syslog.LOG_USER
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	logger log.Logger
+	mu  sync.Mutex // guards out and enc
+	out output     = newWriterOutput(os.Stdout)
+	enc encoder    = encodeText
+
+	globalLevel = int32(DebugLevel)
+
+	compMu     sync.Mutex
+	components = make(map[string]*Logger)
+
+	std  = &Logger{level: new(int32)}
+	exit = os.Exit
 )
 
-func init() {
-	logger = log.NewLogger(os.Stdout, defaultFlags)
-	logger.SetCallerOffset(1)
-	logger.SetOutputLevel(log.DEBUG)
+// Logger is a leveled and structured logger, it's safe for concurrent use.
+type Logger struct {
+	component string
+	level     *int32 // zero means following the global level
+	fields    []interface{}
+}
+
+// With returns a logger which attaches the key/value pairs to every entry,
+// such as With("service", "foo", "remote", "127.0.0.1:1234").
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+	return &Logger{
+		component: l.component,
+		level:     l.level,
+		fields:    fields,
+	}
+}
+
+// Level returns the effective level of logger.
+func (l *Logger) Level() Level {
+	if lvl := atomic.LoadInt32(l.level); lvl != 0 {
+		return Level(lvl)
+	}
+	return Level(atomic.LoadInt32(&globalLevel))
 }
 
-func InitSyslog(target, tag string) {
-	writer, err := newSysLogWriter(target, defaultPriority, tag)
+// Enabled returns whether the entry at the given level will be written.
+func (l *Logger) Enabled(lvl Level) bool {
+	return lvl >= l.Level()
+}
+
+// log writes the entry, it must be called by the exported methods directly
+// to report the right caller.
+func (l *Logger) log(lvl Level, msg string) {
+	e := &entry{
+		Time:      time.Now(),
+		Level:     lvl,
+		Caller:    "???:0",
+		Component: l.component,
+		Msg:       msg,
+		Fields:    l.fields,
+	}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		e.Caller = fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
+	}
+
+	mu.Lock()
+	b := enc(e)
+	err := out.Write(lvl, b)
+	mu.Unlock()
 	if err != nil {
-		logger.Fatal("Init syslog fail: ", err)
+		fmt.Fprintf(os.Stderr, "failed to write log: %v\n", err)
+	}
+	if lvl == FatalLevel {
+		exit(1)
+	}
+}
+
+// Debug logs at debug level, the arguments are handled in the manner of fmt.Sprint.
+func (l *Logger) Debug(a ...interface{}) {
+	if l.Enabled(DebugLevel) {
+		l.log(DebugLevel, fmt.Sprint(a...))
+	}
+}
+
+// Debugf logs at debug level, the arguments are handled in the manner of fmt.Sprintf.
+func (l *Logger) Debugf(f string, a ...interface{}) {
+	if l.Enabled(DebugLevel) {
+		l.log(DebugLevel, fmt.Sprintf(f, a...))
+	}
+}
+
+// Info logs at info level.
+func (l *Logger) Info(a ...interface{}) {
+	if l.Enabled(InfoLevel) {
+		l.log(InfoLevel, fmt.Sprint(a...))
+	}
+}
+
+// Infof logs at info level.
+func (l *Logger) Infof(f string, a ...interface{}) {
+	if l.Enabled(InfoLevel) {
+		l.log(InfoLevel, fmt.Sprintf(f, a...))
+	}
+}
+
+// Printf logs at info level, it makes the logger could be used by the
+// third-party libraries.
+func (l *Logger) Printf(f string, a ...interface{}) {
+	if l.Enabled(InfoLevel) {
+		l.log(InfoLevel, fmt.Sprintf(f, a...))
+	}
+}
+
+// Warn logs at warn level.
+func (l *Logger) Warn(a ...interface{}) {
+	if l.Enabled(WarnLevel) {
+		l.log(WarnLevel, fmt.Sprint(a...))
+	}
+}
+
+// Warnf logs at warn level.
+func (l *Logger) Warnf(f string, a ...interface{}) {
+	if l.Enabled(WarnLevel) {
+		l.log(WarnLevel, fmt.Sprintf(f, a...))
 	}
-	logger = log.NewLogger(writer, defaultFlags)
-	logger.SetCallerOffset(1)
 }
 
+// Error logs at error level.
+func (l *Logger) Error(a ...interface{}) {
+	if l.Enabled(ErrorLevel) {
+		l.log(ErrorLevel, fmt.Sprint(a...))
+	}
+}
+
+// Errorf logs at error level.
+func (l *Logger) Errorf(f string, a ...interface{}) {
+	if l.Enabled(ErrorLevel) {
+		l.log(ErrorLevel, fmt.Sprintf(f, a...))
+	}
+}
+
+// Fatal logs at fatal level regardless of the level, then exits.
+func (l *Logger) Fatal(a ...interface{}) {
+	l.log(FatalLevel, fmt.Sprint(a...))
+}
+
+// Fatalf logs at fatal level regardless of the level, then exits.
+func (l *Logger) Fatalf(f string, a ...interface{}) {
+	l.log(FatalLevel, fmt.Sprintf(f, a...))
+}
+
+// Component returns the logger of component, the loggers of the same
+// component share the level.
+func Component(name string) *Logger {
+	compMu.Lock()
+	defer compMu.Unlock()
+	l, ok := components[name]
+	if !ok {
+		l = &Logger{component: name, level: new(int32)}
+		components[name] = l
+	}
+	return l
+}
+
+// SetComponentLevel sets the level of component, empty level means following
+// the global level.
+func SetComponentLevel(name, level string) error {
+	var lvl Level
+	if level != "" {
+		var err error
+		if lvl, err = ParseLevel(level); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt32(Component(name).level, int32(lvl))
+	return nil
+}
+
+// ComponentLevels returns the levels of the components which don't follow
+// the global level.
+func ComponentLevels() map[string]string {
+	compMu.Lock()
+	defer compMu.Unlock()
+	levels := make(map[string]string)
+	for name, l := range components {
+		if lvl := atomic.LoadInt32(l.level); lvl != 0 {
+			levels[name] = Level(lvl).String()
+		}
+	}
+	return levels
+}
+
+// SetLevel sets the global level, the invalid level is ignored.
 func SetLevel(level string) {
-	logger.SetOutputLevel(log.LevelFromString(level))
-	logger.Info("Log level: ", logger.OutputLevel())
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		std.log(WarnLevel, err.Error())
+		return
+	}
+	atomic.StoreInt32(&globalLevel, int32(lvl))
+	std.log(InfoLevel, "Log level: "+lvl.String())
+}
+
+// GetLevel returns the global level.
+func GetLevel() string {
+	return std.Level().String()
+}
+
+// IsValidLevel returns whether the level could be set.
+func IsValidLevel(level string) bool {
+	_, err := ParseLevel(level)
+	return err == nil
 }
 
-// Get gets the logger.
-func Get() log.Logger {
-	return logger
+// Get gets the global logger.
+func Get() *Logger {
+	return std
+}
+
+// With returns a global logger with the key/value pairs.
+func With(keysAndValues ...interface{}) *Logger {
+	return std.With(keysAndValues...)
 }
 
 // Debug calls the same method on global logger.
 func Debug(a ...interface{}) {
-	logger.Debug(a...)
+	if std.Enabled(DebugLevel) {
+		std.log(DebugLevel, fmt.Sprint(a...))
+	}
 }
 
 // Debugf calls the same method on global logger.
 func Debugf(f string, a ...interface{}) {
-	logger.Debugf(f, a...)
+	if std.Enabled(DebugLevel) {
+		std.log(DebugLevel, fmt.Sprintf(f, a...))
+	}
 }
 
 // Info calls the same method on global logger.
 func Info(a ...interface{}) {
-	logger.Info(a...)
+	if std.Enabled(InfoLevel) {
+		std.log(InfoLevel, fmt.Sprint(a...))
+	}
 }
 
 // Infof calls the same method on global logger.
 func Infof(f string, a ...interface{}) {
-	logger.Infof(f, a...)
+	if std.Enabled(InfoLevel) {
+		std.log(InfoLevel, fmt.Sprintf(f, a...))
+	}
 }
 
 // Warn calls the same method on global logger.
 func Warn(a ...interface{}) {
-	logger.Warn(a...)
+	if std.Enabled(WarnLevel) {
+		std.log(WarnLevel, fmt.Sprint(a...))
+	}
 }
 
 // Warnf calls the same method on global logger.
 func Warnf(f string, a ...interface{}) {
-	logger.Warnf(f, a...)
+	if std.Enabled(WarnLevel) {
+		std.log(WarnLevel, fmt.Sprintf(f, a...))
+	}
+}
+
+// Error calls the same method on global logger.
+func Error(a ...interface{}) {
+	if std.Enabled(ErrorLevel) {
+		std.log(ErrorLevel, fmt.Sprint(a...))
+	}
+}
+
+// Errorf calls the same method on global logger.
+func Errorf(f string, a ...interface{}) {
+	if std.Enabled(ErrorLevel) {
+		std.log(ErrorLevel, fmt.Sprintf(f, a...))
+	}
 }
 
 // Fatal calls the same method on global logger.
 func Fatal(a ...interface{}) {
-	logger.Fatal(a...)
+	std.log(FatalLevel, fmt.Sprint(a...))
 }
 
 // Fatalf calls the same method on global logger.
 func Fatalf(f string, a ...interface{}) {
-	logger.Fatalf(f, a...)
+	std.log(FatalLevel, fmt.Sprintf(f, a...))
 }
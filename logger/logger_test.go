@@ -0,0 +1,180 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// capture redirects the output to a buffer until the returned function
+// is called.
+func capture(format string) (*bytes.Buffer, func()) {
+	buf := new(bytes.Buffer)
+	mu.Lock()
+	oldOut, oldEnc := out, enc
+	out = newWriterOutput(buf)
+	enc, _ = encoderOf(format)
+	mu.Unlock()
+	oldLevel := GetLevel()
+	return buf, func() {
+		mu.Lock()
+		out, enc = oldOut, oldEnc
+		mu.Unlock()
+		SetLevel(oldLevel)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"debug", "INFO", " warn", "warning", "error", "fatal"} {
+		lvl, err := ParseLevel(s)
+		assert.NoError(t, err)
+		assert.True(t, IsValidLevel(lvl.String()))
+	}
+	_, err := ParseLevel("foo")
+	assert.Error(t, err)
+	assert.False(t, IsValidLevel(""))
+}
+
+func TestTextFormat(t *testing.T) {
+	buf, restore := capture(FormatText)
+	defer restore()
+
+	l := Component("test-text").With("remote", "127.0.0.1:80", "err", errors.New("a b"))
+	l.With("service", "").Infof("hello %s", "world")
+	line := buf.String()
+	assert.True(t, strings.HasPrefix(line, "I "))
+	assert.Contains(t, line, "logger/logger_test.go:")
+	assert.True(t, strings.HasSuffix(line, `: [test-text] hello world remote=127.0.0.1:80 err="a b" service=""`+"\n"), line)
+}
+
+func TestJSONFormat(t *testing.T) {
+	buf, restore := capture(FormatJSON)
+	defer restore()
+
+	With("service", "foo", "count", 2, "odd").Warn("hello")
+	m := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, "warn", m["level"])
+	assert.Equal(t, "hello", m["msg"])
+	assert.Equal(t, "foo", m["service"])
+	assert.Equal(t, float64(2), m["count"])
+	assert.Nil(t, m["odd"])
+	assert.Contains(t, m["caller"], "logger/logger_test.go:")
+	assert.NotContains(t, m, "component")
+}
+
+func TestComponentLevel(t *testing.T) {
+	buf, restore := capture(FormatText)
+	defer restore()
+	defer SetComponentLevel("test-level", "")
+
+	SetLevel("warn")
+	buf.Reset()
+	l := Component("test-level")
+	l.Info("dropped")
+	assert.Empty(t, buf.String())
+
+	assert.NoError(t, SetComponentLevel("test-level", "debug"))
+	assert.Equal(t, "debug", ComponentLevels()["test-level"])
+	l.With("k", "v").Debug("kept")
+	assert.Contains(t, buf.String(), "kept")
+	buf.Reset()
+
+	// the global logger is not affected
+	Info("dropped")
+	assert.Empty(t, buf.String())
+
+	assert.Error(t, SetComponentLevel("test-level", "foo"))
+	assert.NoError(t, SetComponentLevel("test-level", ""))
+	assert.Equal(t, WarnLevel, l.Level())
+}
+
+func TestFatal(t *testing.T) {
+	buf, restore := capture(FormatText)
+	defer restore()
+	defer func(fn func(int)) { exit = fn }(exit)
+	code := 0
+	exit = func(c int) { code = c }
+
+	SetLevel("error")
+	Fatalf("boom: %d", 1)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, buf.String(), "boom: 1")
+}
+
+func TestConfigVerify(t *testing.T) {
+	cases := []struct {
+		Config *Config
+		Valid  bool
+	}{
+		{&Config{}, true},
+		{&Config{Level: "debug", Format: FormatJSON, Output: OutputStderr}, true},
+		{&Config{Level: "foo"}, false},
+		{&Config{Format: "xml"}, false},
+		{&Config{Output: "kafka"}, false},
+		{&Config{Output: OutputFile}, false},
+		{&Config{Components: map[string]string{"api": "foo"}}, false},
+	}
+	for _, c := range cases {
+		err := c.Config.Verify()
+		assert.Equal(t, c.Valid, err == nil, "%+v: %v", c.Config, err)
+	}
+}
+
+func TestInitFileOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sash-logger")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldLevel := GetLevel()
+	mu.Lock()
+	oldOut, oldEnc := out, enc
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		out, enc = oldOut, oldEnc
+		mu.Unlock()
+		SetLevel(oldLevel)
+		_ = SetComponentLevel("test-init", "")
+	}()
+
+	path := filepath.Join(dir, "sash.log")
+	err = Init(&Config{
+		Level:      "info",
+		Format:     FormatJSON,
+		Output:     OutputFile,
+		Components: map[string]string{"test-init": "error"},
+		File:       FileConfig{Path: path, MaxSize: 1},
+	})
+	assert.NoError(t, err)
+	Component("test-init").Warn("dropped")
+	Info("kept")
+
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "dropped")
+	assert.Contains(t, string(b), `"msg":"kept"`)
+
+	assert.Error(t, Init(&Config{Format: "xml"}))
+}
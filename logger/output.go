@@ -0,0 +1,179 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const defaultPriority = syslog.LOG_INFO | syslog.LOG_USER
+
+// The following shows the available outputs.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputSyslog = "syslog"
+	OutputFile   = "file"
+)
+
+// SyslogConfig is the config of syslog output.
+type SyslogConfig struct {
+	// Addr is the udp address of syslog, default is ":514".
+	Addr string `yaml:"addr"`
+	Tag  string `yaml:"tag"`
+}
+
+// FileConfig is the config of file output, the file is rotated when it
+// reaches the max size.
+type FileConfig struct {
+	Path string `yaml:"path"`
+	// MaxSize is the max size in megabytes before rotated, default is 100.
+	MaxSize int `yaml:"max_size"`
+	// MaxBackups is the max number of rotated files to retain, zero means all.
+	MaxBackups int `yaml:"max_backups"`
+	// MaxAge is the max days to retain the rotated files, zero means no limit.
+	MaxAge   int  `yaml:"max_age"`
+	Compress bool `yaml:"compress"`
+}
+
+// Config is the config of logging.
+type Config struct {
+	// Level is the global level, default is info.
+	Level string `yaml:"level"`
+	// Format could be text or json, default is text.
+	Format string `yaml:"format"`
+	// Output could be stdout, stderr, syslog or file, default is stdout.
+	Output string `yaml:"output"`
+	// Components is the levels of components, which override the global level.
+	Components map[string]string `yaml:"components"`
+
+	Syslog SyslogConfig `yaml:"syslog"`
+	File   FileConfig   `yaml:"file"`
+}
+
+// Verify verifies the config.
+func (c *Config) Verify() error {
+	if c.Level != "" {
+		if _, err := ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	if _, err := encoderOf(c.Format); err != nil {
+		return err
+	}
+	switch c.Output {
+	case "", OutputStdout, OutputStderr, OutputSyslog:
+	case OutputFile:
+		if c.File.Path == "" {
+			return errors.New("file path is required")
+		}
+	default:
+		return fmt.Errorf("invalid log output: %q", c.Output)
+	}
+	for name, level := range c.Components {
+		if _, err := ParseLevel(level); err != nil {
+			return fmt.Errorf("component %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// output is the destination of log entries.
+type output interface {
+	Write(lvl Level, p []byte) error
+	Close() error
+}
+
+// writerOutput writes the entries to an io.Writer.
+type writerOutput struct {
+	w io.Writer
+}
+
+func newWriterOutput(w io.Writer) *writerOutput {
+	return &writerOutput{w: w}
+}
+
+func (o *writerOutput) Write(_ Level, p []byte) error {
+	_, err := o.w.Write(p)
+	return err
+}
+
+func (o *writerOutput) Close() error {
+	if c, ok := o.w.(io.Closer); ok && o.w != os.Stdout && o.w != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+func newOutput(c *Config) (output, error) {
+	switch c.Output {
+	case "", OutputStdout:
+		return newWriterOutput(os.Stdout), nil
+	case OutputStderr:
+		return newWriterOutput(os.Stderr), nil
+	case OutputSyslog:
+		return newSyslogOutput(&c.Syslog)
+	case OutputFile:
+		return newWriterOutput(&lumberjack.Logger{
+			Filename:   c.File.Path,
+			MaxSize:    c.File.MaxSize,
+			MaxBackups: c.File.MaxBackups,
+			MaxAge:     c.File.MaxAge,
+			Compress:   c.File.Compress,
+			LocalTime:  true,
+		}), nil
+	default:
+		return nil, fmt.Errorf("invalid log output: %q", c.Output)
+	}
+}
+
+// Init initializes the logging with config.
+func Init(c *Config) error {
+	if err := c.Verify(); err != nil {
+		return err
+	}
+	newEnc, err := encoderOf(c.Format)
+	if err != nil {
+		return err
+	}
+	newOut, err := newOutput(c)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	oldOut := out
+	out, enc = newOut, newEnc
+	mu.Unlock()
+	if err := oldOut.Close(); err != nil {
+		Warnf("Failed to close the log output: %v", err)
+	}
+
+	for name, level := range c.Components {
+		if err := SetComponentLevel(name, level); err != nil {
+			return err
+		}
+	}
+	if c.Level != "" {
+		SetLevel(c.Level)
+	}
+	return nil
+}
@@ -22,3 +22,36 @@ func newSysLogWriter(host string, priority syslog.Priority, tag string) (*syslog
 	}
 	return syslog.Dial("udp", ":514", priority, tag)
 }
+
+// syslogOutput writes the entries to syslog with the severity of level.
+type syslogOutput struct {
+	w *syslog.Writer
+}
+
+func newSyslogOutput(c *SyslogConfig) (*syslogOutput, error) {
+	w, err := newSysLogWriter(c.Addr, defaultPriority, c.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogOutput{w: w}, nil
+}
+
+func (o *syslogOutput) Write(lvl Level, p []byte) error {
+	m := string(p)
+	switch lvl {
+	case DebugLevel:
+		return o.w.Debug(m)
+	case InfoLevel:
+		return o.w.Info(m)
+	case WarnLevel:
+		return o.w.Warning(m)
+	case ErrorLevel:
+		return o.w.Err(m)
+	default:
+		return o.w.Crit(m)
+	}
+}
+
+func (o *syslogOutput) Close() error {
+	return o.w.Close()
+}
@@ -60,6 +60,17 @@ const (
 	StateUnhealthy
 )
 
+func (s ServiceInstanceState) String() string {
+	switch s {
+	case StateHealthy:
+		return "healthy"
+	case StateUnhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
 // ServiceInstance represents an instance of service.
 type ServiceInstance struct {
 	IP    string               `json:"ip"`
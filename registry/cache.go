@@ -18,6 +18,7 @@ import (
 	"context"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v3"
@@ -29,6 +30,8 @@ import (
 //go:generate mockgen -source ../model/service.go -destination mock_registry_test.go -package registry
 //go:generate mockgen -source ./cache.go -destination mock_cache.go -package registry -self_package github.com/samaritan-proxy/sash/registry
 
+var log = logger.Component("registry")
+
 var (
 	defaultBackoffInitialInterval     = 100 * time.Millisecond
 	defaultBackoffRandomizationFactor = 0.2
@@ -87,6 +90,12 @@ type Cache interface {
 	model.ServiceRegistry
 	// Exists returns whether the specified service is in.
 	Exists(name string) bool
+	// LastSyncTime returns the time of the last successful sync, it is zero
+	// if the cache has never been synced.
+	LastSyncTime() time.Time
+	// SetSyncFreq changes the frequency and jitter of syncing, it takes effect
+	// from the next sync.
+	SetSyncFreq(freq time.Duration, jitter float64)
 
 	// RegisterServiceEventHandler registers a handler to handle service event.
 	RegisterServiceEventHandler(handler ServiceEventHandler)
@@ -107,12 +116,15 @@ func NewCache(r model.ServiceRegistry, opts ...CacheOption) Cache {
 // cache is an implementation of Cache.
 type cache struct {
 	rwMu    sync.RWMutex
+	optMu   sync.Mutex
 	options *cacheOptions
 	r       model.ServiceRegistry
 
 	services    map[string]*model.Service
 	svcEvtHdls  []ServiceEventHandler
 	instEvtHdls []InstanceEventHandler
+
+	lastSync atomic.Value // time.Time
 }
 
 func newCache(r model.ServiceRegistry, opts ...CacheOption) *cache {
@@ -155,6 +167,24 @@ func (c *cache) Exists(name string) bool {
 	return ok
 }
 
+func (c *cache) LastSyncTime() time.Time {
+	t, _ := c.lastSync.Load().(time.Time)
+	return t
+}
+
+func (c *cache) SetSyncFreq(freq time.Duration, jitter float64) {
+	c.optMu.Lock()
+	defer c.optMu.Unlock()
+	c.options.syncFreq = freq
+	c.options.syncJitter = jitter
+}
+
+func (c *cache) syncFreq() (time.Duration, float64) {
+	c.optMu.Lock()
+	defer c.optMu.Unlock()
+	return c.options.syncFreq, c.options.syncJitter
+}
+
 // RegisterServiceEventHandler registers a handler to handle service event.
 // It is not goroutine-safe, should call it before execute Run.
 func (c *cache) RegisterServiceEventHandler(handler ServiceEventHandler) {
@@ -169,14 +199,15 @@ func (c *cache) RegisterInstanceEventHandler(handler InstanceEventHandler) {
 
 // Run runs the cache container until the context is canceled or deadline exceeded.
 func (c *cache) Run(ctx context.Context) {
-	maxSyncInterval := time.Duration(float64(c.options.syncFreq) * (1 + c.options.syncJitter))
 	b := defaultBackOff()
-	b.MaxInterval = maxSyncInterval
 	b.Reset()
 
 	for {
+		freq, jitter := c.syncFreq()
+		b.MaxInterval = time.Duration(float64(freq) * (1 + jitter))
 		startTime := time.Now()
 		err := c.Sync(ctx)
+		c.observeSync(startTime, err)
 		select {
 		case <-ctx.Done():
 			return
@@ -187,13 +218,13 @@ func (c *cache) Run(ctx context.Context) {
 		var interval time.Duration
 		if err != nil {
 			interval = b.NextBackOff()
-			logger.Warnf("Sync services failed: %v, retry after %s", err, interval)
+			log.Warnf("Sync services failed: %v, retry after %s", err, interval)
 		} else {
 			// reset the backoff
 			b.Reset()
-			d := float64(c.options.syncFreq) * (1 + c.options.syncJitter*(rand.Float64()*2-1))
+			d := float64(freq) * (1 + jitter*(rand.Float64()*2-1))
 			interval = time.Duration(d)
-			logger.Debugf("Sync services succeed, cost: %s, do it again after %s", time.Since(startTime), interval)
+			log.Debugf("Sync services succeed, cost: %s, do it again after %s", time.Since(startTime), interval)
 		}
 
 		t := time.NewTimer(interval)
@@ -205,6 +236,25 @@ func (c *cache) Run(ctx context.Context) {
 	}
 }
 
+func (c *cache) observeSync(startTime time.Time, err error) {
+	syncDuration.Observe(time.Since(startTime).Seconds())
+	if err != nil {
+		syncErrors.Inc()
+		return
+	}
+	c.lastSync.Store(time.Now())
+	lastSyncSuccess.SetToCurrentTime()
+
+	c.rwMu.RLock()
+	defer c.rwMu.RUnlock()
+	instances := 0
+	for _, svc := range c.services {
+		instances += len(svc.Instances)
+	}
+	servicesCount.Set(float64(len(c.services)))
+	instancesCount.Set(float64(instances))
+}
+
 func (c *cache) Sync(ctx context.Context) error {
 	names, err := c.r.List()
 	if err != nil {
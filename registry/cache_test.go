@@ -46,6 +46,18 @@ func TestSetSyncJitterOption(t *testing.T) {
 	assert.Equal(t, jitter, opts.syncJitter)
 }
 
+func TestCacheSetSyncFreq(t *testing.T) {
+	c := newCache(memory.NewRegistry(), SyncFreq(time.Second), SyncJitter(0.1))
+	freq, jitter := c.syncFreq()
+	assert.Equal(t, time.Second, freq)
+	assert.Equal(t, 0.1, jitter)
+
+	c.SetSyncFreq(time.Minute, 0.3)
+	freq, jitter = c.syncFreq()
+	assert.Equal(t, time.Minute, freq)
+	assert.Equal(t, 0.3, jitter)
+}
+
 func TestCacheSyncFail(t *testing.T) {
 	t.Run("get services", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
@@ -303,6 +315,7 @@ func TestCachePeriodicSync(t *testing.T) {
 	).AnyTimes()
 
 	c := newCache(r, SyncFreq(time.Second))
+	assert.True(t, c.LastSyncTime().IsZero())
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
 
@@ -319,4 +332,5 @@ func TestCachePeriodicSync(t *testing.T) {
 	svc, err := c.Get("foo")
 	assert.NoError(t, err)
 	assert.NotNil(t, svc)
+	assert.False(t, c.LastSyncTime().IsZero())
 }
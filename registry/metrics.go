@@ -0,0 +1,56 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	syncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "sash",
+		Subsystem: "registry",
+		Name:      "sync_duration_seconds",
+		Help:      "Duration of synchronizing the services from the service registry.",
+	})
+	syncErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "registry",
+		Name:      "sync_errors_total",
+		Help:      "Total number of failed synchronizations.",
+	})
+	lastSyncSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sash",
+		Subsystem: "registry",
+		Name:      "last_sync_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful synchronization.",
+	})
+	servicesCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sash",
+		Subsystem: "registry",
+		Name:      "services",
+		Help:      "Number of services in the cache.",
+	})
+	instancesCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sash",
+		Subsystem: "registry",
+		Name:      "instances",
+		Help:      "Number of service instances in the cache.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(syncDuration, syncErrors, lastSyncSuccess, servicesCount, instancesCount)
+}
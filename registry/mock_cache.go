@@ -9,6 +9,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	model "github.com/samaritan-proxy/sash/model"
 	reflect "reflect"
+	time "time"
 )
 
 // MockCache is a mock of Cache interface
@@ -82,6 +83,28 @@ func (mr *MockCacheMockRecorder) Exists(name interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockCache)(nil).Exists), name)
 }
 
+// LastSyncTime mocks base method
+func (m *MockCache) LastSyncTime() time.Time {
+	ret := m.ctrl.Call(m, "LastSyncTime")
+	ret0, _ := ret[0].(time.Time)
+	return ret0
+}
+
+// LastSyncTime indicates an expected call of LastSyncTime
+func (mr *MockCacheMockRecorder) LastSyncTime() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LastSyncTime", reflect.TypeOf((*MockCache)(nil).LastSyncTime))
+}
+
+// SetSyncFreq mocks base method
+func (m *MockCache) SetSyncFreq(freq time.Duration, jitter float64) {
+	m.ctrl.Call(m, "SetSyncFreq", freq, jitter)
+}
+
+// SetSyncFreq indicates an expected call of SetSyncFreq
+func (mr *MockCacheMockRecorder) SetSyncFreq(freq, jitter interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSyncFreq", reflect.TypeOf((*MockCache)(nil).SetSyncFreq), freq, jitter)
+}
+
 // RegisterServiceEventHandler mocks base method
 func (m *MockCache) RegisterServiceEventHandler(handler ServiceEventHandler) {
 	m.ctrl.Call(m, "RegisterServiceEventHandler", handler)
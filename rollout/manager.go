@@ -0,0 +1,560 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+// The rollouts are saved in the config store, but not watched by the
+// config controller, they are the states rather than configs. The ids of
+// unfinished rollouts are indexed by TypeActiveRollout, so that the finished
+// ones are not loaded on every check.
+const (
+	NamespaceRollout  = "rollout"
+	TypeRollout       = "rollout"
+	TypeActiveRollout = "active"
+)
+
+var log = logger.Component("rollout")
+
+// pruneInterval is the interval of pruning the finished rollouts.
+const pruneInterval = time.Hour
+
+// Subscribers is used to get the instances which subscribe the config of service.
+type Subscribers interface {
+	SubscribedInstances(svcName string) []string
+}
+
+// registeredSubscribers picks the subscribers from the registered instances,
+// which are shared by all the replicas, so the waves don't depend on which
+// replica the instances connect to. The instances of the dependents of a
+// service subscribe its config.
+type registeredSubscribers struct {
+	ctl *config.Controller
+}
+
+// SubscribedInstances implements Subscribers, the ids are sorted in
+// ascending order.
+func (s registeredSubscribers) SubscribedInstances(svcName string) []string {
+	dependents := s.ctl.Dependencies().Dependents(svcName)
+	if len(dependents) == 0 {
+		return nil
+	}
+	insts, err := s.ctl.Instances().GetAllCache()
+	if err != nil {
+		log.Warnf("Failed to get the instances: %v", err)
+		return nil
+	}
+	belong := make(map[string]struct{}, len(dependents))
+	for _, svc := range dependents {
+		belong[svc] = struct{}{}
+	}
+	var ids []string
+	for _, inst := range insts {
+		if _, ok := belong[inst.BelongService]; ok {
+			ids = append(ids, inst.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+type managerOptions struct {
+	checkInterval time.Duration
+	retention     time.Duration
+}
+
+func defaultManagerOptions() *managerOptions {
+	return &managerOptions{
+		checkInterval: time.Second,
+		retention:     time.Hour * 24 * 7,
+	}
+}
+
+type ManagerOption func(o *managerOptions)
+
+// CheckInterval sets the interval of checking the progress of rollouts.
+func CheckInterval(interval time.Duration) ManagerOption {
+	return func(o *managerOptions) {
+		o.checkInterval = interval
+	}
+}
+
+// Retention sets how long to keep the finished rollouts, zero means keeping
+// them forever.
+func Retention(d time.Duration) ManagerOption {
+	return func(o *managerOptions) {
+		o.retention = d
+	}
+}
+
+// Manager drives the rollouts wave by wave. The new config is pushed to the
+// instances of a wave through an instance scope proxy config override, and
+// promoted to the proxy config of service after the last wave.
+type Manager struct {
+	sync.Mutex
+	options *managerOptions
+
+	ctl      *config.Controller
+	proxycfg *config.ProxyConfigsController
+	ovr      *config.ProxyConfigOverridesController
+	subs     Subscribers
+
+	lastPrune time.Time
+	triggerCh chan struct{}
+	stop      chan struct{} // nil if not started.
+	wg        sync.WaitGroup
+}
+
+// NewManager creates a rollout manager, the waves pick the registered
+// instances of the dependents of service.
+func NewManager(ctl *config.Controller, opts ...ManagerOption) *Manager {
+	o := defaultManagerOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Manager{
+		options:   o,
+		ctl:       ctl,
+		proxycfg:  ctl.ProxyConfigs(),
+		ovr:       ctl.ProxyConfigOverrides(),
+		subs:      registeredSubscribers{ctl: ctl},
+		triggerCh: make(chan struct{}, 1),
+	}
+}
+
+// Start starts the manager, it could be started again after stopped.
+func (m *Manager) Start() {
+	m.Lock()
+	defer m.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.wg.Add(1)
+	go m.loop(m.stop)
+}
+
+// Stop stops the manager, the running rollouts are resumed after restarting.
+func (m *Manager) Stop() {
+	m.Lock()
+	if m.stop == nil {
+		m.Unlock()
+		return
+	}
+	close(m.stop)
+	m.stop = nil
+	m.Unlock()
+	m.wg.Wait()
+}
+
+func (m *Manager) trigger() {
+	select {
+	case m.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) loop(stop chan struct{}) {
+	ticker := time.NewTicker(m.options.checkInterval)
+	defer func() {
+		ticker.Stop()
+		m.wg.Done()
+	}()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-m.triggerCh:
+		}
+		m.process()
+	}
+}
+
+func (m *Manager) process() {
+	m.Lock()
+	defer m.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastPrune) >= pruneInterval {
+		if err := m.prune(now); err != nil {
+			log.Warnf("Failed to prune rollouts: %v", err)
+		}
+		m.lastPrune = now
+	}
+	rollouts, err := m.listActive()
+	if err != nil {
+		log.Warnf("Failed to load rollouts: %v", err)
+		return
+	}
+	for _, r := range rollouts {
+		if r.State != StateRunning || now.Before(r.NextTime) {
+			continue
+		}
+		if err := m.step(r); err != nil {
+			log.Warnf("Failed to make progress of rollout %s: %v", r.ID, err)
+		}
+	}
+}
+
+// step checks the failures of last wave, and starts the next one or
+// promotes the config if all the waves are done.
+func (m *Manager) step(r *Rollout) error {
+	if m.crossed(r) {
+		return m.halt(r, fmt.Sprintf("failure rate %.2f crosses the threshold %.2f", r.FailureRate(), r.FailureThreshold))
+	}
+	if r.CurrentWave >= len(r.Waves) {
+		return m.promote(r)
+	}
+
+	wave := r.Waves[r.CurrentWave]
+	subs := m.subs.SubscribedInstances(r.ServiceName)
+	target := wave.target(len(subs))
+	if target == 0 {
+		// the wave would complete without updating any instance.
+		return m.wait(r, "waiting for the subscribed instances")
+	}
+	r.Reason = ""
+	updated := make(map[string]struct{}, len(r.Instances))
+	for _, inst := range r.Instances {
+		updated[inst] = struct{}{}
+	}
+	for _, inst := range subs {
+		if len(r.Instances) >= target {
+			break
+		}
+		if _, ok := updated[inst]; ok {
+			continue
+		}
+		r.Instances = append(r.Instances, inst)
+	}
+	if err := m.setOverride(r); err != nil {
+		return err
+	}
+	r.CurrentWave++
+	r.NextTime = time.Now().Add(time.Duration(wave.Delay))
+	log.Infof("Rollout %s of %s: wave %d/%d started, %d instances updated",
+		r.ID, r.ServiceName, r.CurrentWave, len(r.Waves), len(r.Instances))
+	return m.save(r, m.ctl.Update)
+}
+
+func (m *Manager) crossed(r *Rollout) bool {
+	return r.CurrentWave > 0 && r.FailureRate() > r.FailureThreshold
+}
+
+// wait keeps the rollout at the current wave, it's checked again later.
+func (m *Manager) wait(r *Rollout, reason string) error {
+	if r.Reason == reason {
+		return nil
+	}
+	r.Reason = reason
+	log.Infof("Rollout %s of %s: wave %d/%d is %s", r.ID, r.ServiceName, r.CurrentWave+1, len(r.Waves), reason)
+	return m.save(r, m.ctl.Update)
+}
+
+// promote merges the new config into the proxy config of service, then
+// removes the override. The rollout whose waves updated no instance is
+// halted instead, since the new config is never verified.
+func (m *Manager) promote(r *Rollout) error {
+	if len(r.Instances) == 0 {
+		return m.halt(r, "no instance received the new config")
+	}
+	cfg, err := m.proxycfg.Get(r.ServiceName)
+	if err != nil {
+		return err
+	}
+	cfg.Config = config.MergeServiceConfig(cfg.Config, r.Config)
+	if err := m.proxycfg.Update(cfg); err != nil {
+		return err
+	}
+	if err := m.removeOverride(r); err != nil {
+		return err
+	}
+	r.State = StateCompleted
+	log.Infof("Rollout %s of %s completed", r.ID, r.ServiceName)
+	return m.save(r, m.ctl.Update)
+}
+
+// halt reverts the updated instances by removing the override.
+func (m *Manager) halt(r *Rollout, reason string) error {
+	if err := m.removeOverride(r); err != nil {
+		return err
+	}
+	r.State = StateHalted
+	r.Reason = reason
+	log.Warnf("Rollout %s of %s halted: %s", r.ID, r.ServiceName, reason)
+	return m.save(r, m.ctl.Update)
+}
+
+func (m *Manager) setOverride(r *Rollout) error {
+	if len(r.Instances) == 0 {
+		return m.removeOverride(r)
+	}
+	ovrs, err := m.ovr.Get(r.ServiceName)
+	switch err {
+	case nil:
+	case config.ErrNotExist:
+		ovrs = &config.ProxyConfigOverrides{ServiceName: r.ServiceName}
+	default:
+		return err
+	}
+	ovr := &config.ProxyConfigOverride{
+		Name:      r.overrideName(),
+		Instances: r.Instances,
+		Config:    r.Config,
+	}
+	replaced := false
+	for i, o := range ovrs.Overrides {
+		if o.Name == ovr.Name {
+			ovrs.Overrides[i], replaced = ovr, true
+		}
+	}
+	if !replaced {
+		ovrs.Overrides = append(ovrs.Overrides, ovr)
+	}
+	return m.ovr.Set(ovrs)
+}
+
+func (m *Manager) removeOverride(r *Rollout) error {
+	ovrs, err := m.ovr.Get(r.ServiceName)
+	switch err {
+	case nil:
+	case config.ErrNotExist:
+		return nil
+	default:
+		return err
+	}
+	res := ovrs.Overrides[:0]
+	for _, o := range ovrs.Overrides {
+		if o.Name != r.overrideName() {
+			res = append(res, o)
+		}
+	}
+	if len(res) == 0 {
+		return m.ovr.Delete(r.ServiceName)
+	}
+	ovrs.Overrides = res
+	return m.ovr.Set(ovrs)
+}
+
+func (m *Manager) save(r *Rollout, putFn func(ns, typ, key string, value []byte) error) error {
+	r.UpdateTime = time.Now()
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := putFn(NamespaceRollout, TypeRollout, r.ID, b); err != nil {
+		return err
+	}
+	if r.State.Finished() {
+		return m.deactivate(r.ID)
+	}
+	return nil
+}
+
+func (m *Manager) activate(id string) error {
+	return m.ctl.Add(NamespaceRollout, TypeActiveRollout, id, nil)
+}
+
+func (m *Manager) deactivate(id string) error {
+	if err := m.ctl.Del(NamespaceRollout, TypeActiveRollout, id); err != config.ErrNotExist {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) get(id string) (*Rollout, error) {
+	b, err := m.ctl.Get(NamespaceRollout, TypeRollout, id)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Rollout)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (m *Manager) list() (Rollouts, error) {
+	return m.listOf(TypeRollout)
+}
+
+// listActive returns the unfinished rollouts.
+func (m *Manager) listActive() (Rollouts, error) {
+	return m.listOf(TypeActiveRollout)
+}
+
+func (m *Manager) listOf(typ string) (Rollouts, error) {
+	ids, err := m.ctl.Keys(NamespaceRollout, typ)
+	switch err {
+	case nil:
+	case config.ErrNotExist:
+		return Rollouts{}, nil
+	default:
+		return nil, err
+	}
+	rollouts := make(Rollouts, 0, len(ids))
+	for _, id := range ids {
+		r, err := m.get(id)
+		if err == config.ErrNotExist && typ == TypeActiveRollout {
+			// the creation failed after indexing.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rollouts = append(rollouts, r)
+	}
+	sort.Sort(rollouts)
+	return rollouts, nil
+}
+
+// prune deletes the rollouts which are finished longer than the retention.
+func (m *Manager) prune(now time.Time) error {
+	if m.options.retention <= 0 {
+		return nil
+	}
+	rollouts, err := m.list()
+	if err != nil {
+		return err
+	}
+	for _, r := range rollouts {
+		if !r.State.Finished() || now.Sub(r.UpdateTime) < m.options.retention {
+			continue
+		}
+		if err := m.ctl.Del(NamespaceRollout, TypeRollout, r.ID); err != nil {
+			return err
+		}
+		log.Infof("Rollout %s of %s pruned", r.ID, r.ServiceName)
+	}
+	return nil
+}
+
+// Create validates and starts a rollout, returns ErrInProgress if the
+// service has a running one. The service must have its own proxy config.
+func (m *Manager) Create(r *Rollout) (*Rollout, error) {
+	if err := r.Verify(); err != nil {
+		return nil, err
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	rollouts, err := m.listActive()
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range rollouts {
+		if other.ServiceName == r.ServiceName {
+			return nil, ErrInProgress
+		}
+	}
+	if _, err := m.proxycfg.Get(r.ServiceName); err != nil {
+		return nil, err
+	}
+	base, err := m.proxycfg.GetEffective(r.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.MergeServiceConfig(base.Config, r.Config).Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	r.ID = strconv.FormatInt(now.UnixNano(), 36)
+	r.State = StateRunning
+	r.CurrentWave = 0
+	r.Instances, r.Failures, r.Reason = []string{}, []string{}, ""
+	r.CreateTime, r.NextTime = now, now
+	if err := m.activate(r.ID); err != nil {
+		return nil, err
+	}
+	if err := m.save(r, m.ctl.Add); err != nil {
+		_ = m.deactivate(r.ID)
+		return nil, err
+	}
+	m.trigger()
+	return r, nil
+}
+
+// Get returns the rollout by id.
+func (m *Manager) Get(id string) (*Rollout, error) {
+	return m.get(id)
+}
+
+// List returns all the rollouts ordered by the create time.
+func (m *Manager) List() (Rollouts, error) {
+	return m.list()
+}
+
+// Halt halts the rollout manually, and reverts the updated instances.
+func (m *Manager) Halt(id, reason string) (*Rollout, error) {
+	m.Lock()
+	defer m.Unlock()
+	r, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.State.Finished() {
+		return nil, ErrFinished
+	}
+	if err := m.halt(r, reason); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReportFailures records the failed instances reported by an external health
+// signal, the rollout is halted immediately if the failure rate crosses
+// the threshold.
+func (m *Manager) ReportFailures(id string, instances []string) (*Rollout, error) {
+	m.Lock()
+	defer m.Unlock()
+	r, err := m.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if r.State.Finished() {
+		return nil, ErrFinished
+	}
+	failed := make(map[string]struct{}, len(r.Failures))
+	for _, inst := range r.Failures {
+		failed[inst] = struct{}{}
+	}
+	for _, inst := range instances {
+		if _, ok := failed[inst]; ok {
+			continue
+		}
+		failed[inst] = struct{}{}
+		r.Failures = append(r.Failures, inst)
+	}
+	if m.crossed(r) {
+		err = m.halt(r, fmt.Sprintf("failure rate %.2f crosses the threshold %.2f", r.FailureRate(), r.FailureThreshold))
+	} else {
+		err = m.save(r, m.ctl.Update)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
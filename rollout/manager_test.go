@@ -0,0 +1,359 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/hc"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/memory"
+)
+
+type fakeSubscribers []string
+
+func (s fakeSubscribers) SubscribedInstances(string) []string { return s }
+
+func newTestManager(t *testing.T) (*Manager, *config.Controller) {
+	ctl := config.NewController(memory.NewStore())
+	timeout := time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "svc",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	m := NewManager(ctl)
+	m.subs = fakeSubscribers{"inst_0", "inst_1", "inst_2", "inst_3", "inst_4", "inst_5", "inst_6", "inst_7", "inst_8", "inst_9"}
+	return m, ctl
+}
+
+func TestRegisteredSubscribers(t *testing.T) {
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	for _, dep := range []*config.Dependency{
+		{ServiceName: "a", Dependencies: []string{"svc"}},
+		{ServiceName: "b", Dependencies: []string{"svc", "other"}},
+		{ServiceName: "c", Dependencies: []string{"other"}},
+	} {
+		assert.NoError(t, ctl.Dependencies().Add(dep))
+	}
+	for _, inst := range []*config.Instance{
+		{ID: "inst_3", BelongService: "b"},
+		{ID: "inst_1", BelongService: "a"},
+		{ID: "inst_2", BelongService: "c"},
+		{ID: "inst_4"},
+	} {
+		assert.NoError(t, ctl.Instances().Add(inst))
+	}
+
+	subs := registeredSubscribers{ctl: ctl}
+	// wait for the cache to be synced.
+	assert.Eventually(t, func() bool {
+		return len(subs.SubscribedInstances("svc")) == 2 && len(subs.SubscribedInstances("other")) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"inst_1", "inst_3"}, subs.SubscribedInstances("svc"))
+	assert.Equal(t, []string{"inst_2", "inst_3"}, subs.SubscribedInstances("other"))
+	assert.Empty(t, subs.SubscribedInstances("a"))
+}
+
+func newTestRollout() *Rollout {
+	timeout := 2 * time.Second
+	return &Rollout{
+		ServiceName: "svc",
+		Config:      &service.Config{ConnectTimeout: &timeout},
+		Waves: []*Wave{
+			{Count: 1, Delay: Duration(time.Hour)},
+			{Percent: 50, Delay: Duration(time.Hour)},
+			{Percent: 100},
+		},
+		FailureThreshold: 0.2,
+	}
+}
+
+// advance makes the rollout step forward by skipping the delay.
+func advance(t *testing.T, m *Manager, id string) *Rollout {
+	r, err := m.Get(id)
+	assert.NoError(t, err)
+	r.NextTime = time.Time{}
+	assert.NoError(t, m.save(r, m.ctl.Update))
+	m.process()
+	r, err = m.Get(id)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestManagerCreate(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	_, err := m.Create(&Rollout{})
+	assert.Error(t, err)
+
+	r := newTestRollout()
+	r.ServiceName = "foo"
+	_, err = m.Create(r)
+	assert.Equal(t, config.ErrNotExist, err)
+
+	r = newTestRollout()
+	r.Config = &service.Config{Listener: &service.Listener{Address: &common.Address{Ip: "foo"}}}
+	_, err = m.Create(r)
+	assert.Error(t, err)
+
+	r, err = m.Create(newTestRollout())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, r.ID)
+	assert.Equal(t, StateRunning, r.State)
+
+	_, err = m.Create(newTestRollout())
+	assert.Equal(t, ErrInProgress, err)
+
+	rollouts, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, rollouts, 1)
+}
+
+func TestManagerComplete(t *testing.T) {
+	m, ctl := newTestManager(t)
+	r, err := m.Create(newTestRollout())
+	assert.NoError(t, err)
+
+	resolve := func(inst string) time.Duration {
+		cfg, err := ctl.ProxyConfigOverrides().Resolve("svc", &config.Instance{ID: inst})
+		assert.NoError(t, err)
+		return *cfg.Config.ConnectTimeout
+	}
+
+	// wave 1
+	m.process()
+	r, _ = m.Get(r.ID)
+	assert.Equal(t, 1, r.CurrentWave)
+	assert.Equal(t, []string{"inst_0"}, r.Instances)
+	assert.Equal(t, 2*time.Second, resolve("inst_0"))
+	assert.Equal(t, time.Second, resolve("inst_1"))
+
+	// the delay is not reached
+	m.process()
+	r, _ = m.Get(r.ID)
+	assert.Equal(t, 1, r.CurrentWave)
+
+	// wave 2 and 3
+	r = advance(t, m, r.ID)
+	assert.Len(t, r.Instances, 5)
+	assert.Equal(t, 2*time.Second, resolve("inst_4"))
+	assert.Equal(t, time.Second, resolve("inst_5"))
+	r = advance(t, m, r.ID)
+	assert.Len(t, r.Instances, 10)
+	assert.Equal(t, StateRunning, r.State)
+
+	// promote
+	r = advance(t, m, r.ID)
+	assert.Equal(t, StateCompleted, r.State)
+	cfg, err := ctl.ProxyConfigs().Get("svc")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, *cfg.Config.ConnectTimeout)
+	assert.False(t, ctl.ProxyConfigOverrides().Exist("svc"))
+
+	_, err = m.Halt(r.ID, "")
+	assert.Equal(t, ErrFinished, err)
+	// a new rollout could be created now.
+	_, err = m.Create(newTestRollout())
+	assert.NoError(t, err)
+}
+
+func TestManagerHalt(t *testing.T) {
+	m, ctl := newTestManager(t)
+	// the existing overrides are kept.
+	canary := time.Minute
+	assert.NoError(t, ctl.ProxyConfigOverrides().Set(&config.ProxyConfigOverrides{
+		ServiceName: "svc",
+		Overrides: []*config.ProxyConfigOverride{
+			{Name: "zone", Selector: map[string]string{"zone": "z1"}, Config: &service.Config{ConnectTimeout: &canary}},
+		},
+	}))
+
+	t.Run("failure rate crossed", func(t *testing.T) {
+		r, err := m.Create(newTestRollout())
+		assert.NoError(t, err)
+		m.process()
+		r = advance(t, m, r.ID)
+		assert.Len(t, r.Instances, 5)
+		ovrs, err := ctl.ProxyConfigOverrides().Get("svc")
+		assert.NoError(t, err)
+		assert.Len(t, ovrs.Overrides, 2)
+
+		r, err = m.ReportFailures(r.ID, []string{"inst_0", "inst_9"})
+		assert.NoError(t, err)
+		assert.Equal(t, StateRunning, r.State)
+		r, err = m.ReportFailures(r.ID, []string{"inst_1", "inst_2"})
+		assert.NoError(t, err)
+		assert.Equal(t, StateHalted, r.State)
+		assert.Contains(t, r.Reason, "threshold")
+
+		ovrs, err = ctl.ProxyConfigOverrides().Get("svc")
+		assert.NoError(t, err)
+		assert.Len(t, ovrs.Overrides, 1)
+		assert.Equal(t, "zone", ovrs.Overrides[0].Name)
+		cfg, err := ctl.ProxyConfigs().Get("svc")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Second, *cfg.Config.ConnectTimeout)
+
+		_, err = m.ReportFailures(r.ID, nil)
+		assert.Equal(t, ErrFinished, err)
+	})
+
+	t.Run("manually", func(t *testing.T) {
+		r, err := m.Create(newTestRollout())
+		assert.NoError(t, err)
+		m.process()
+		r, err = m.Halt(r.ID, "bad latency")
+		assert.NoError(t, err)
+		assert.Equal(t, StateHalted, r.State)
+		assert.Equal(t, "bad latency", r.Reason)
+		ovrs, err := ctl.ProxyConfigOverrides().Get("svc")
+		assert.NoError(t, err)
+		assert.Len(t, ovrs.Overrides, 1)
+	})
+
+	_, err := m.Halt("foo", "")
+	assert.Equal(t, config.ErrNotExist, err)
+}
+
+func TestManagerWaitSubscribers(t *testing.T) {
+	m, ctl := newTestManager(t)
+	subs := &fakeSubscribers{}
+	m.subs = subs
+	r, err := m.Create(newTestRollout())
+	assert.NoError(t, err)
+
+	// no wave starts without the subscribed instances.
+	for i := 0; i < 3; i++ {
+		r = advance(t, m, r.ID)
+		assert.Equal(t, StateRunning, r.State)
+		assert.Equal(t, 0, r.CurrentWave)
+		assert.Equal(t, "waiting for the subscribed instances", r.Reason)
+		assert.False(t, ctl.ProxyConfigOverrides().Exist("svc"))
+	}
+
+	*subs = fakeSubscribers{"inst_0"}
+	r = advance(t, m, r.ID)
+	assert.Equal(t, 1, r.CurrentWave)
+	assert.Equal(t, []string{"inst_0"}, r.Instances)
+	assert.Empty(t, r.Reason)
+}
+
+func TestManagerPromoteWithoutInstances(t *testing.T) {
+	m, ctl := newTestManager(t)
+	r, err := m.Create(newTestRollout())
+	assert.NoError(t, err)
+	// all the waves are done but no instance is updated.
+	r.CurrentWave = len(r.Waves)
+	assert.NoError(t, m.save(r, ctl.Update))
+
+	r = advance(t, m, r.ID)
+	assert.Equal(t, StateHalted, r.State)
+	assert.Equal(t, "no instance received the new config", r.Reason)
+	cfg, err := ctl.ProxyConfigs().Get("svc")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, *cfg.Config.ConnectTimeout)
+}
+
+func TestManagerPromoteHealthCheck(t *testing.T) {
+	m, ctl := newTestManager(t)
+	checker := func(actions ...*hc.ATCPChecker_Action) *hc.HealthCheck {
+		return &hc.HealthCheck{
+			Interval: time.Second,
+			Timeout:  time.Second,
+			Checker: &hc.HealthCheck_AtcpChecker{
+				AtcpChecker: &hc.ATCPChecker{Action: actions},
+			},
+		}
+	}
+	ping := &hc.ATCPChecker_Action{Send: []byte("ping"), Expect: []byte("pong")}
+	info := &hc.ATCPChecker_Action{Send: []byte("info"), Expect: []byte("ok")}
+	cfg, err := ctl.ProxyConfigs().Get("svc")
+	assert.NoError(t, err)
+	cfg.Config.HealthCheck = checker(ping, info)
+	assert.NoError(t, ctl.ProxyConfigs().Update(cfg))
+
+	r := newTestRollout()
+	r.Config = &service.Config{HealthCheck: checker(ping)}
+	r, err = m.Create(r)
+	assert.NoError(t, err)
+	for i := 0; i <= len(r.Waves); i++ {
+		r = advance(t, m, r.ID)
+	}
+	assert.Equal(t, StateCompleted, r.State)
+	cfg, err = ctl.ProxyConfigs().Get("svc")
+	assert.NoError(t, err)
+	// the actions are replaced rather than appended.
+	assert.Equal(t, checker(ping), cfg.Config.HealthCheck)
+}
+
+func TestManagerPrune(t *testing.T) {
+	m, ctl := newTestManager(t)
+	halted, err := m.Create(newTestRollout())
+	assert.NoError(t, err)
+	_, err = m.Halt(halted.ID, "")
+	assert.NoError(t, err)
+	running, err := m.Create(newTestRollout())
+	assert.NoError(t, err)
+
+	active, err := m.listActive()
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+	assert.Equal(t, running.ID, active[0].ID)
+
+	// the finished one is kept within the retention.
+	assert.NoError(t, m.prune(time.Now()))
+	all, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	assert.NoError(t, m.prune(time.Now().Add(m.options.retention+time.Minute)))
+	all, err = m.List()
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	assert.Equal(t, running.ID, all[0].ID)
+	_, err = m.Get(halted.ID)
+	assert.Equal(t, config.ErrNotExist, err)
+	assert.True(t, ctl.Exist(NamespaceRollout, TypeActiveRollout, running.ID))
+}
+
+func TestManagerStartStop(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.options.checkInterval = time.Millisecond
+	// restart
+	m.Start()
+	m.Start()
+	m.Stop()
+	m.Stop()
+	m.Start()
+	defer m.Stop()
+	r, err := m.Create(newTestRollout())
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 50)
+	r, err = m.Get(r.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.CurrentWave)
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+)
+
+var (
+	// ErrInProgress is returned when creating a rollout for a service
+	// which already has an active one.
+	ErrInProgress = errors.New("another rollout of the service is in progress")
+	// ErrFinished is returned when changing a finished rollout.
+	ErrFinished = errors.New("rollout is finished")
+)
+
+// State indicates the state of rollout.
+type State string
+
+// The following shows the available states.
+const (
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateHalted    State = "halted"
+)
+
+// Finished returns true if the rollout won't make any progress.
+func (s State) Finished() bool {
+	return s == StateCompleted || s == StateHalted
+}
+
+// Duration is a wrapper of time.Duration which is encoded as a string, such as "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Wave is a step of rollout. Either Percent or Count of the subscribed
+// instances receive the new config in total after this wave, and the
+// failures are watched for Delay before the next one.
+type Wave struct {
+	Percent int      `json:"percent,omitempty"`
+	Count   int      `json:"count,omitempty"`
+	Delay   Duration `json:"delay"`
+}
+
+// Verify this Wave.
+func (w *Wave) Verify() error {
+	switch {
+	case w.Percent < 0 || w.Percent > 100:
+		return fmt.Errorf("percent must be in [0, 100]")
+	case w.Count < 0:
+		return fmt.Errorf("count must not be negative")
+	case (w.Percent > 0) == (w.Count > 0):
+		return fmt.Errorf("exactly one of percent and count must be set")
+	case w.Delay < 0:
+		return fmt.Errorf("delay must not be negative")
+	}
+	return nil
+}
+
+// target returns the number of instances which should receive the new
+// config after this wave.
+func (w *Wave) target(total int) int {
+	n := w.Count
+	if w.Percent > 0 {
+		n = int(math.Ceil(float64(total) * float64(w.Percent) / 100))
+	}
+	if n > total {
+		n = total
+	}
+	return n
+}
+
+// Rollout pushes a new config of service to the subscribed instances in
+// waves, and halts automatically if the failure rate crosses the threshold.
+// The config is merged into the effective config of the service like an
+// override, and is promoted to the proxy config after the last wave.
+type Rollout struct {
+	ID          string          `json:"id"`
+	ServiceName string          `json:"service_name"`
+	Config      *service.Config `json:"config"`
+	Waves       []*Wave         `json:"waves"`
+	// FailureThreshold is the max ratio of failed instances to the updated
+	// ones, the rollout is halted and reverted once it's crossed.
+	FailureThreshold float64 `json:"failure_threshold"`
+
+	State State `json:"state"`
+	// CurrentWave is the number of started waves.
+	CurrentWave int `json:"current_wave"`
+	// Instances are the instances which have received the new config.
+	Instances []string `json:"instances"`
+	// Failures are the instances which are reported as failed.
+	Failures []string `json:"failures"`
+	// Reason explains why the rollout is halted.
+	Reason     string    `json:"reason,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+	// NextTime is when the next wave starts.
+	NextTime time.Time `json:"next_time"`
+}
+
+// Verify the spec of this Rollout.
+func (r *Rollout) Verify() error {
+	if len(r.ServiceName) == 0 {
+		return fmt.Errorf("service_name is null")
+	}
+	if r.Config == nil {
+		return fmt.Errorf("config is null")
+	}
+	if len(r.Waves) == 0 {
+		return fmt.Errorf("waves is empty")
+	}
+	for i, w := range r.Waves {
+		if w == nil {
+			return fmt.Errorf("wave %d is null", i)
+		}
+		if err := w.Verify(); err != nil {
+			return fmt.Errorf("wave %d: %v", i, err)
+		}
+	}
+	if r.FailureThreshold < 0 || r.FailureThreshold > 1 {
+		return fmt.Errorf("failure_threshold must be in [0, 1]")
+	}
+	return nil
+}
+
+// FailureRate returns the ratio of failed instances to the updated ones.
+func (r *Rollout) FailureRate() float64 {
+	if len(r.Instances) == 0 {
+		return 0
+	}
+	updated := make(map[string]struct{}, len(r.Instances))
+	for _, inst := range r.Instances {
+		updated[inst] = struct{}{}
+	}
+	failed := 0
+	for _, inst := range r.Failures {
+		if _, ok := updated[inst]; ok {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(r.Instances))
+}
+
+// overrideName returns the name of override which carries the new config.
+func (r *Rollout) overrideName() string {
+	return "rollout-" + r.ID
+}
+
+// Rollouts is a slice of Rollout, impl the sort.Interface.
+type Rollouts []*Rollout
+
+func (r Rollouts) Len() int { return len(r) }
+
+func (r Rollouts) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+func (r Rollouts) Less(i, j int) bool { return r[i].CreateTime.Before(r[j].CreateTime) }
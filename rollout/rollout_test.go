@@ -0,0 +1,88 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWave(t *testing.T) {
+	cases := []struct {
+		wave   Wave
+		valid  bool
+		total  int
+		target int
+	}{
+		{Wave{}, false, 0, 0},
+		{Wave{Percent: 10, Count: 1}, false, 0, 0},
+		{Wave{Percent: 101}, false, 0, 0},
+		{Wave{Count: -1}, false, 0, 0},
+		{Wave{Count: 1, Delay: Duration(-time.Second)}, false, 0, 0},
+		{Wave{Percent: 5}, true, 100, 5},
+		{Wave{Percent: 5}, true, 10, 1},
+		{Wave{Percent: 100}, true, 10, 10},
+		{Wave{Count: 3}, true, 10, 3},
+		{Wave{Count: 3}, true, 2, 2},
+	}
+	for i, c := range cases {
+		err := c.wave.Verify()
+		if !c.valid {
+			assert.Error(t, err, "case %d", i)
+			continue
+		}
+		assert.NoError(t, err, "case %d", i)
+		assert.Equal(t, c.target, c.wave.target(c.total), "case %d", i)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	w := &Wave{Count: 1, Delay: Duration(30 * time.Second)}
+	b, err := json.Marshal(w)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"count": 1, "delay": "30s"}`, string(b))
+
+	w = new(Wave)
+	assert.NoError(t, json.Unmarshal([]byte(`{"count": 1, "delay": "1m"}`), w))
+	assert.Equal(t, Duration(time.Minute), w.Delay)
+	assert.Error(t, json.Unmarshal([]byte(`{"delay": "foo"}`), w))
+}
+
+func TestRolloutVerify(t *testing.T) {
+	r := &Rollout{}
+	assert.Error(t, r.Verify())
+	r.ServiceName = "svc"
+	assert.Error(t, r.Verify())
+	r.Config = &service.Config{}
+	assert.Error(t, r.Verify())
+	r.Waves = []*Wave{{Percent: 10}, nil}
+	assert.Error(t, r.Verify())
+	r.Waves = []*Wave{{Percent: 10}, {Percent: 100}}
+	assert.NoError(t, r.Verify())
+	r.FailureThreshold = 1.5
+	assert.Error(t, r.Verify())
+}
+
+func TestRolloutFailureRate(t *testing.T) {
+	r := &Rollout{}
+	assert.Equal(t, float64(0), r.FailureRate())
+	r.Instances = []string{"inst_1", "inst_2", "inst_3", "inst_4"}
+	r.Failures = []string{"inst_1", "inst_5"}
+	assert.Equal(t, 0.25, r.FailureRate())
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing sets up the OpenTelemetry tracer provider of sash, and
+// starts the spans with the global one.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/samaritan-proxy/sash/logger"
+)
+
+// instrumentationName is the name of tracer which starts all the spans.
+const instrumentationName = "github.com/samaritan-proxy/sash"
+
+var log = logger.Component("tracing")
+
+func init() {
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warnf("Failed to export spans: %v", err)
+	}))
+}
+
+type providerOptions struct {
+	serviceName   string
+	sampleRatio   float64
+	batchSize     int
+	maxQueueSize  int
+	flushInterval time.Duration
+	headers       map[string]string
+	timeout       time.Duration
+}
+
+func defaultProviderOptions() *providerOptions {
+	return &providerOptions{
+		serviceName:   "sash",
+		sampleRatio:   1,
+		batchSize:     512,
+		maxQueueSize:  2048,
+		flushInterval: 5 * time.Second,
+		timeout:       10 * time.Second,
+	}
+}
+
+type ProviderOption func(o *providerOptions)
+
+// ServiceName sets the service.name of resource, default is sash.
+func ServiceName(name string) ProviderOption {
+	return func(o *providerOptions) {
+		o.serviceName = name
+	}
+}
+
+// SampleRatio sets the ratio of the root spans to be sampled, the child
+// spans follow the decision of their parents.
+func SampleRatio(ratio float64) ProviderOption {
+	return func(o *providerOptions) {
+		o.sampleRatio = ratio
+	}
+}
+
+// BatchSize sets the max number of spans exported at a time.
+func BatchSize(n int) ProviderOption {
+	return func(o *providerOptions) {
+		o.batchSize = n
+	}
+}
+
+// MaxQueueSize sets the max number of spans waiting for exporting, the
+// subsequent ones are dropped when it's full.
+func MaxQueueSize(n int) ProviderOption {
+	return func(o *providerOptions) {
+		o.maxQueueSize = n
+	}
+}
+
+// FlushInterval sets the interval of exporting the spans.
+func FlushInterval(d time.Duration) ProviderOption {
+	return func(o *providerOptions) {
+		o.flushInterval = d
+	}
+}
+
+// Headers sets the extra http headers, such as the authorization.
+func Headers(headers map[string]string) ProviderOption {
+	return func(o *providerOptions) {
+		o.headers = headers
+	}
+}
+
+// Timeout sets the timeout of exporting a batch of spans.
+func Timeout(d time.Duration) ProviderOption {
+	return func(o *providerOptions) {
+		o.timeout = d
+	}
+}
+
+// NewProvider creates a tracer provider which exports the spans to an
+// OpenTelemetry collector with the OTLP/HTTP protocol. The endpoint is the
+// base url of collector, such as http://localhost:4318, the spans are sent
+// to <endpoint>/v1/traces.
+func NewProvider(endpoint string, opts ...ProviderOption) (*sdktrace.TracerProvider, error) {
+	o := defaultProviderOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint: %s", endpoint)
+	}
+	exporterOpts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+		otlptracehttp.WithTimeout(o.timeout),
+	}
+	if u.Scheme == "http" {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	}
+	if len(o.headers) > 0 {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithHeaders(o.headers))
+	}
+	// the exporter doesn't connect until the first export.
+	exporter, err := otlptracehttp.New(context.Background(), exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxExportBatchSize(o.batchSize),
+			sdktrace.WithMaxQueueSize(o.maxQueueSize),
+			sdktrace.WithBatchTimeout(o.flushInterval),
+		),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.sampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(o.serviceName))),
+	), nil
+}
+
+// Start starts a span with the global tracer provider, whose parent is the
+// one carried by ctx. The span is not recorded unless the provider has been
+// set by otel.SetTracerProvider.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// StartWithParent starts a span as a child of the remote parent, it's used
+// to continue the trace across the asynchronous boundaries, such as the
+// events. The returned span is a no-op one if the parent is invalid.
+func StartWithParent(parent trace.SpanContext, name string, opts ...trace.SpanStartOption) trace.Span {
+	if !parent.IsValid() {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), name, opts...)
+	return span
+}
+
+// RecordError records the error and marks the span as failed, nil error is
+// ignored.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+)
+
+func TestNewProvider(t *testing.T) {
+	reqs := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- r
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	_, err := NewProvider("localhost:4318")
+	assert.Error(t, err)
+
+	tp, err := NewProvider(srv.URL+"/otlp/",
+		ServiceName("foo"),
+		Headers(map[string]string{"Authorization": "token"}),
+	)
+	assert.NoError(t, err)
+	_, span := tp.Tracer(instrumentationName).Start(context.Background(), "bar")
+	span.End()
+	assert.NoError(t, tp.Shutdown(context.Background()))
+
+	req := <-reqs
+	assert.Equal(t, "/otlp/v1/traces", req.URL.Path)
+	assert.Equal(t, "token", req.Header.Get("Authorization"))
+	assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+	var body coltracepb.ExportTraceServiceRequest
+	assert.NoError(t, proto.Unmarshal(<-bodies, &body))
+	assert.Len(t, body.ResourceSpans, 1)
+	rs := body.ResourceSpans[0]
+	assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	assert.Equal(t, "foo", rs.Resource.Attributes[0].Value.GetStringValue())
+	assert.Equal(t, "bar", rs.InstrumentationLibrarySpans[0].Spans[0].Name)
+}
+
+func TestSampleRatio(t *testing.T) {
+	tp, err := NewProvider("http://localhost:4318", SampleRatio(0))
+	assert.NoError(t, err)
+	defer tp.Shutdown(context.Background()) //nolint:errcheck
+	tracer := tp.Tracer(instrumentationName)
+
+	_, root := tracer.Start(context.Background(), "root")
+	assert.False(t, root.SpanContext().IsSampled())
+	// the children follow the decision of the parent.
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled})
+	_, child := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "child")
+	assert.True(t, child.SpanContext().IsSampled())
+	assert.Equal(t, parent.TraceID(), child.SpanContext().TraceID())
+}
+
+func TestStartWithParent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	// no span is recorded without the parent.
+	span := StartWithParent(trace.SpanContext{}, "foo")
+	assert.False(t, span.SpanContext().IsValid())
+	span.End()
+	assert.Empty(t, recorder.Ended())
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled})
+	span = StartWithParent(parent, "foo")
+	RecordError(span, nil)
+	RecordError(span, errors.New("bar"))
+	span.End()
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, parent.TraceID(), spans[0].SpanContext().TraceID())
+	assert.Equal(t, parent.SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "bar", spans[0].Status().Description)
+	assert.Len(t, spans[0].Events(), 1)
+}
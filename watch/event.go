@@ -0,0 +1,135 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package watch collects the changes of configs and service registry as a
+// stream of events, which could be resumed from the last seen one.
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resource indicates the kind of resource changed.
+type Resource string
+
+// The following shows the available resources.
+const (
+	// ResourceProxyConfig is the effective proxy config of service.
+	ResourceProxyConfig Resource = "proxy-config"
+	// ResourceDependency is the dependencies of service.
+	ResourceDependency Resource = "dependency"
+	// ResourceInstance is the samaritan instance.
+	ResourceInstance Resource = "instance"
+	// ResourceService is the service in the service registry.
+	ResourceService Resource = "service"
+	// ResourceServiceInstance is the instances of service in the service registry.
+	ResourceServiceInstance Resource = "service-instance"
+)
+
+// ParseResource parses the resource from string.
+func ParseResource(s string) (Resource, error) {
+	switch r := Resource(s); r {
+	case ResourceProxyConfig, ResourceDependency, ResourceInstance, ResourceService, ResourceServiceInstance:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown resource: %s", s)
+	}
+}
+
+// EventType indicates the type of event.
+type EventType string
+
+// The following shows the available event types.
+const (
+	EventAdd    EventType = "add"
+	EventUpdate EventType = "update"
+	EventDelete EventType = "delete"
+)
+
+// Event represents a change of resource.
+type Event struct {
+	ID          string      `json:"id"`
+	Time        time.Time   `json:"time"`
+	Type        EventType   `json:"type"`
+	Resource    Resource    `json:"resource"`
+	ServiceName string      `json:"service_name,omitempty"`
+	Key         string      `json:"key"`
+	Data        interface{} `json:"data,omitempty"`
+
+	seq uint64
+}
+
+// eventID composes the event id from the epoch of hub and the sequence,
+// so that the ids from a previous process are never mistaken for ones of
+// the current process.
+func eventID(epoch string, seq uint64) string {
+	return epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+var errInvalidEventID = errors.New("invalid event id")
+
+func parseEventID(id string) (epoch string, seq uint64, err error) {
+	i := strings.LastIndexByte(id, '-')
+	if i <= 0 {
+		return "", 0, errInvalidEventID
+	}
+	seq, err = strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, errInvalidEventID
+	}
+	return id[:i], seq, nil
+}
+
+// Filter is used to filter the events by resource and service, the empty
+// one matches all.
+type Filter struct {
+	Resources []Resource
+	Services  []string
+}
+
+// Match returns whether the event matches the filter.
+func (f *Filter) Match(evt *Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Resources) > 0 && !containsResource(f.Resources, evt.Resource) {
+		return false
+	}
+	if len(f.Services) > 0 && !containsString(f.Services, evt.ServiceName) {
+		return false
+	}
+	return true
+}
+
+func containsResource(rs []Resource, r Resource) bool {
+	for _, item := range rs {
+		if item == r {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
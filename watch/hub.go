@@ -0,0 +1,192 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrEventExpired indicates the last seen event is no longer buffered, or
+// comes from a previous process, the subscriber should list the resources
+// again before watching.
+var ErrEventExpired = errors.New("event expired")
+
+type hubOptions struct {
+	bufferSize    int
+	subBufferSize int
+}
+
+func defaultHubOptions() *hubOptions {
+	return &hubOptions{
+		bufferSize:    1024,
+		subBufferSize: 128,
+	}
+}
+
+type HubOption func(o *hubOptions)
+
+// BufferSize sets how many recent events are kept for resuming.
+func BufferSize(size int) HubOption {
+	return func(o *hubOptions) {
+		o.bufferSize = size
+	}
+}
+
+// SubscriberBufferSize sets the buffer size of subscription, a subscriber
+// which falls behind more than it is closed.
+func SubscriberBufferSize(size int) HubOption {
+	return func(o *hubOptions) {
+		o.subBufferSize = size
+	}
+}
+
+// Hub keeps the recent events in a ring buffer, and fans out the new ones
+// to the subscribers. Publishing never blocks, the subscribers fall behind
+// are closed, and could resume from the last seen event.
+type Hub struct {
+	sync.Mutex
+	options *hubOptions
+	epoch   string
+
+	seq  uint64 // sequence of the latest event
+	ring []*Event
+	subs map[*Subscription]struct{}
+}
+
+// NewHub creates a hub.
+func NewHub(opts ...HubOption) *Hub {
+	o := defaultHubOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Hub{
+		options: o,
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		ring:    make([]*Event, o.bufferSize),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns an id to the event and sends it to the subscribers.
+func (h *Hub) Publish(evt *Event) {
+	h.Lock()
+	defer h.Unlock()
+	h.seq++
+	evt.seq = h.seq
+	evt.ID = eventID(h.epoch, h.seq)
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	h.ring[h.seq%uint64(len(h.ring))] = evt
+	for sub := range h.subs {
+		if !sub.filter.Match(evt) {
+			continue
+		}
+		select {
+		case sub.ch <- evt:
+		default:
+			// falls behind, let it resume from the last seen event.
+			h.unsubscribe(sub)
+		}
+	}
+}
+
+// since returns the buffered events after the given sequence, must be
+// called with lock held.
+func (h *Hub) since(seq uint64) ([]*Event, error) {
+	if seq > h.seq {
+		return nil, ErrEventExpired
+	}
+	// the oldest buffered one is seq+1.
+	if h.seq-seq > uint64(len(h.ring)) {
+		return nil, ErrEventExpired
+	}
+	evts := make([]*Event, 0, h.seq-seq)
+	for i := seq + 1; i <= h.seq; i++ {
+		evts = append(evts, h.ring[i%uint64(len(h.ring))])
+	}
+	return evts, nil
+}
+
+// Subscribe subscribes the events matching the filter. If lastEventID is
+// not empty, the buffered events after it are replayed first, ErrEventExpired
+// is returned if they are not all available.
+func (h *Hub) Subscribe(filter *Filter, lastEventID string) (*Subscription, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	var backlog []*Event
+	if lastEventID != "" {
+		epoch, seq, err := parseEventID(lastEventID)
+		if err != nil {
+			return nil, err
+		}
+		if epoch != h.epoch {
+			return nil, ErrEventExpired
+		}
+		evts, err := h.since(seq)
+		if err != nil {
+			return nil, err
+		}
+		for _, evt := range evts {
+			if filter.Match(evt) {
+				backlog = append(backlog, evt)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		hub:    h,
+		filter: filter,
+		ch:     make(chan *Event, len(backlog)+h.options.subBufferSize),
+	}
+	for _, evt := range backlog {
+		sub.ch <- evt
+	}
+	h.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// unsubscribe must be called with lock held.
+func (h *Hub) unsubscribe(sub *Subscription) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.ch)
+}
+
+// Subscription receives the events from hub.
+type Subscription struct {
+	hub    *Hub
+	filter *Filter
+	ch     chan *Event
+}
+
+// Events returns the channel of events, it is closed when the subscription
+// is closed or falls behind.
+func (s *Subscription) Events() <-chan *Event {
+	return s.ch
+}
+
+// Close closes the subscription.
+func (s *Subscription) Close() {
+	s.hub.Lock()
+	defer s.hub.Unlock()
+	s.hub.unsubscribe(s)
+}
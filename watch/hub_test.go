@@ -0,0 +1,126 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recv(t *testing.T, sub *Subscription, n int) []*Event {
+	evts := make([]*Event, 0, n)
+	for i := 0; i < n; i++ {
+		select {
+		case evt := <-sub.Events():
+			evts = append(evts, evt)
+		default:
+			t.Fatalf("expect %d events, got %d", n, i)
+		}
+	}
+	return evts
+}
+
+func TestParseEventID(t *testing.T) {
+	epoch, seq, err := parseEventID(eventID("abc", 12))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", epoch)
+	assert.Equal(t, uint64(12), seq)
+
+	for _, id := range []string{"", "abc", "-1", "abc-", "abc-x"} {
+		_, _, err = parseEventID(id)
+		assert.Equal(t, errInvalidEventID, err, id)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	evt := &Event{Resource: ResourceProxyConfig, ServiceName: "svc"}
+	var nilFilter *Filter
+	assert.True(t, nilFilter.Match(evt))
+	assert.True(t, (&Filter{}).Match(evt))
+	assert.True(t, (&Filter{Resources: []Resource{ResourceDependency, ResourceProxyConfig}}).Match(evt))
+	assert.False(t, (&Filter{Resources: []Resource{ResourceDependency}}).Match(evt))
+	assert.True(t, (&Filter{Services: []string{"svc"}}).Match(evt))
+	assert.False(t, (&Filter{Resources: []Resource{ResourceProxyConfig}, Services: []string{"foo"}}).Match(evt))
+}
+
+func TestParseResource(t *testing.T) {
+	r, err := ParseResource("service-instance")
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceServiceInstance, r)
+	_, err = ParseResource("foo")
+	assert.Error(t, err)
+}
+
+func TestHub_Subscribe(t *testing.T) {
+	h := NewHub(BufferSize(4))
+	sub, err := h.Subscribe(&Filter{Services: []string{"a"}}, "")
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	h.Publish(&Event{Resource: ResourceDependency, ServiceName: "a"})
+	h.Publish(&Event{Resource: ResourceDependency, ServiceName: "b"})
+	evts := recv(t, sub, 1)
+	assert.Equal(t, eventID(h.epoch, 1), evts[0].ID)
+	assert.False(t, evts[0].Time.IsZero())
+	assert.Empty(t, sub.Events())
+}
+
+func TestHub_Resume(t *testing.T) {
+	h := NewHub(BufferSize(4))
+	for i := 0; i < 6; i++ {
+		h.Publish(&Event{Resource: ResourceDependency, ServiceName: "a"})
+	}
+
+	// the buffered events are 3~6
+	sub, err := h.Subscribe(nil, eventID(h.epoch, 2))
+	assert.NoError(t, err)
+	evts := recv(t, sub, 4)
+	assert.Equal(t, eventID(h.epoch, 3), evts[0].ID)
+	assert.Equal(t, eventID(h.epoch, 6), evts[3].ID)
+	sub.Close()
+
+	sub, err = h.Subscribe(nil, eventID(h.epoch, 6))
+	assert.NoError(t, err)
+	assert.Empty(t, sub.Events())
+	sub.Close()
+
+	for _, id := range []string{eventID(h.epoch, 1), eventID(h.epoch, 7), eventID("foo", 5)} {
+		_, err = h.Subscribe(nil, id)
+		assert.Equal(t, ErrEventExpired, err, id)
+	}
+	_, err = h.Subscribe(nil, "foo")
+	assert.Equal(t, errInvalidEventID, err)
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	h := NewHub(SubscriberBufferSize(1))
+	sub, err := h.Subscribe(nil, "")
+	assert.NoError(t, err)
+
+	h.Publish(&Event{Resource: ResourceDependency})
+	h.Publish(&Event{Resource: ResourceDependency})
+	evt, ok := <-sub.Events()
+	assert.True(t, ok)
+	_, ok = <-sub.Events()
+	assert.False(t, ok)
+	assert.Empty(t, h.subs)
+
+	// resume from the last seen one.
+	sub, err = h.Subscribe(nil, evt.ID)
+	assert.NoError(t, err)
+	defer sub.Close()
+	assert.Len(t, recv(t, sub, 1), 1)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"encoding/json"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+func fromConfigEventType(typ config.EventType) EventType {
+	switch typ {
+	case config.EventAdd:
+		return EventAdd
+	case config.EventDelete:
+		return EventDelete
+	default:
+		return EventUpdate
+	}
+}
+
+func fromRegistryEventType(typ registry.EventType) EventType {
+	switch typ {
+	case registry.EventAdd:
+		return EventAdd
+	case registry.EventDelete:
+		return EventDelete
+	default:
+		return EventUpdate
+	}
+}
+
+// WatchConfig publishes the changes of effective proxy configs, dependencies
+// and instances. It should be called before starting the controller, so that
+// the initial configs are published as add events.
+func (h *Hub) WatchConfig(ctl *config.Controller) {
+	ConfigEvents(ctl, h.Publish)
+}
+
+// ConfigEvents registers the handlers on controller, which translate the
+// changes of effective proxy configs, dependencies and instances to events
+// and pass them to fn.
+func ConfigEvents(ctl *config.Controller, fn func(evt *Event)) {
+	ctl.ProxyConfigs().RegisterEventHandler(func(event *config.ProxyConfigEvent) {
+		fn(fromProxyConfigEvent(event))
+	})
+	ctl.RegisterEventHandler(func(event *config.Event) {
+		if evt := fromRawConfigEvent(event); evt != nil {
+			fn(evt)
+		}
+	})
+}
+
+func fromProxyConfigEvent(event *config.ProxyConfigEvent) *Event {
+	evt := &Event{
+		Type:        fromConfigEventType(event.Type),
+		Resource:    ResourceProxyConfig,
+		ServiceName: event.ProxyConfig.ServiceName,
+		Key:         event.ProxyConfig.ServiceName,
+	}
+	if evt.Type != EventDelete {
+		evt.Data = event.ProxyConfig
+	}
+	return evt
+}
+
+func fromRawConfigEvent(event *config.Event) *Event {
+	var (
+		cfg = event.Config
+		typ = fromConfigEventType(event.Type)
+	)
+	switch {
+	case cfg.Namespace == config.NamespaceService && cfg.Type == config.TypeServiceDependency:
+		evt := &Event{
+			Type:        typ,
+			Resource:    ResourceDependency,
+			ServiceName: cfg.Key,
+			Key:         cfg.Key,
+		}
+		if typ != EventDelete {
+			var deps []string
+			if err := json.Unmarshal(cfg.Value, &deps); err != nil {
+				return nil
+			}
+			evt.Data = &config.Dependency{
+				ServiceName:  cfg.Key,
+				Dependencies: deps,
+			}
+		}
+		return evt
+	case cfg.Namespace == config.NamespaceSamaritan && cfg.Type == config.TypeSamaritanInstance:
+		inst := new(config.Instance)
+		if err := json.Unmarshal(cfg.Value, inst); err != nil {
+			return nil
+		}
+		evt := &Event{
+			Type:        typ,
+			Resource:    ResourceInstance,
+			ServiceName: inst.BelongService,
+			Key:         cfg.Key,
+		}
+		if typ != EventDelete {
+			evt.Data = inst
+		}
+		return evt
+	default:
+		return nil
+	}
+}
+
+// WatchRegistry publishes the changes of services and their instances in
+// the service registry. It must be called before running the registry cache.
+func (h *Hub) WatchRegistry(reg registry.Cache) {
+	RegistryEvents(reg, h.Publish)
+}
+
+// RegistryEvents registers the handlers on registry cache, which translate
+// the changes of services and their instances to events and pass them to fn.
+func RegistryEvents(reg registry.Cache, fn func(evt *Event)) {
+	reg.RegisterServiceEventHandler(func(event *registry.ServiceEvent) {
+		fn(&Event{
+			Type:        fromRegistryEventType(event.Type),
+			Resource:    ResourceService,
+			ServiceName: event.Service.Name,
+			Key:         event.Service.Name,
+		})
+	})
+	reg.RegisterInstanceEventHandler(func(event *registry.InstanceEvent) {
+		fn(&Event{
+			Type:        fromRegistryEventType(event.Type),
+			Resource:    ResourceServiceInstance,
+			ServiceName: event.ServiceName,
+			Key:         event.ServiceName,
+			Data:        event.Instances,
+		})
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+func waitEvent(t *testing.T, sub *Subscription) *Event {
+	select {
+	case evt := <-sub.Events():
+		return evt
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func TestHub_WatchConfig(t *testing.T) {
+	h := NewHub()
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	h.WatchConfig(ctl)
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+
+	sub, err := h.Subscribe(nil, "")
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	assert.NoError(t, ctl.Dependencies().Add(&config.Dependency{ServiceName: "a", Dependencies: []string{"b"}}))
+	evt := waitEvent(t, sub)
+	assert.Equal(t, EventAdd, evt.Type)
+	assert.Equal(t, ResourceDependency, evt.Resource)
+	assert.Equal(t, "a", evt.ServiceName)
+	assert.Equal(t, []string{"b"}, evt.Data.(*config.Dependency).Dependencies)
+
+	assert.NoError(t, ctl.Instances().Add(&config.Instance{ID: "inst", BelongService: "a"}))
+	evt = waitEvent(t, sub)
+	assert.Equal(t, ResourceInstance, evt.Resource)
+	assert.Equal(t, "a", evt.ServiceName)
+	assert.Equal(t, "inst", evt.Key)
+
+	timeout := time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "a",
+		Config: &service.Config{
+			Protocol:       protocol.TCP,
+			Listener:       &service.Listener{Address: &common.Address{Ip: "0.0.0.0", Port: 80}},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	evt = waitEvent(t, sub)
+	assert.Equal(t, ResourceProxyConfig, evt.Resource)
+	assert.Equal(t, EventAdd, evt.Type)
+	assert.NotNil(t, evt.Data)
+
+	assert.NoError(t, ctl.Dependencies().Delete("a"))
+	evt = waitEvent(t, sub)
+	assert.Equal(t, EventDelete, evt.Type)
+	assert.Equal(t, ResourceDependency, evt.Resource)
+	assert.Nil(t, evt.Data)
+}
+
+func TestHub_WatchRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		svcHdl  registry.ServiceEventHandler
+		instHdl registry.InstanceEventHandler
+	)
+	reg := registry.NewMockCache(ctrl)
+	reg.EXPECT().RegisterServiceEventHandler(gomock.Any()).Do(func(hdl registry.ServiceEventHandler) { svcHdl = hdl })
+	reg.EXPECT().RegisterInstanceEventHandler(gomock.Any()).Do(func(hdl registry.InstanceEventHandler) { instHdl = hdl })
+
+	h := NewHub()
+	h.WatchRegistry(reg)
+	sub, err := h.Subscribe(&Filter{Resources: []Resource{ResourceServiceInstance}}, "")
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	inst := model.NewServiceInstance("1.1.1.1", 80)
+	svcHdl(&registry.ServiceEvent{Type: registry.EventAdd, Service: model.NewService("svc", inst)})
+	instHdl(&registry.InstanceEvent{Type: registry.EventDelete, ServiceName: "svc", Instances: []*model.ServiceInstance{inst}})
+
+	evts := recv(t, sub, 1)
+	assert.Equal(t, EventDelete, evts[0].Type)
+	assert.Equal(t, "svc", evts[0].ServiceName)
+	assert.Equal(t, []*model.ServiceInstance{inst}, evts[0].Data)
+	assert.Equal(t, uint64(2), h.seq)
+}
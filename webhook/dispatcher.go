@@ -0,0 +1,681 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+	"github.com/samaritan-proxy/sash/utils"
+	"github.com/samaritan-proxy/sash/watch"
+)
+
+// The targets created through the API are saved in the config store, but
+// not watched by the config controller.
+const (
+	NamespaceWebhook = "webhook"
+	TypeTarget       = "target"
+)
+
+// The following shows the headers of webhook request.
+const (
+	HeaderEvent     = "X-Sash-Event"
+	HeaderDelivery  = "X-Sash-Delivery"
+	HeaderSignature = "X-Sash-Signature"
+)
+
+var (
+	// ErrStatic indicates the target comes from the bootstrap.
+	ErrStatic = errors.New("static target couldn't be changed")
+	// ErrQueueFull indicates the target falls behind too much.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrStopped indicates the dispatcher is stopped, such as on a replica
+	// which is not the leader.
+	ErrStopped = errors.New("webhook dispatcher is stopped")
+)
+
+// Payload is the body of webhook request.
+type Payload struct {
+	ID          string      `json:"id"`
+	Event       string      `json:"event"`
+	Time        time.Time   `json:"time"`
+	ServiceName string      `json:"service_name,omitempty"`
+	Key         string      `json:"key,omitempty"`
+	Data        interface{} `json:"data,omitempty"`
+}
+
+// Sign returns the signature of body, which is sent in the X-Sash-Signature
+// header as "sha256=<hex>".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeadLetter records a delivery failed after all the retries.
+type DeadLetter struct {
+	Target   string    `json:"target"`
+	Payload  *Payload  `json:"payload"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+type dispatcherOptions struct {
+	targets         []*Target
+	client          *http.Client
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	maxRetries      uint64
+	queueSize       int
+	deadLetterSize  int
+	refreshInterval time.Duration
+}
+
+func defaultDispatcherOptions() *dispatcherOptions {
+	return &dispatcherOptions{
+		client:          &http.Client{Timeout: 10 * time.Second},
+		initialInterval: time.Second,
+		maxInterval:     time.Minute,
+		maxRetries:      5,
+		queueSize:       256,
+		deadLetterSize:  100,
+		refreshInterval: 30 * time.Second,
+	}
+}
+
+type DispatcherOption func(o *dispatcherOptions)
+
+// StaticTargets sets the targets from the bootstrap.
+func StaticTargets(targets ...*Target) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.targets = targets
+	}
+}
+
+// Client sets the http client used to deliver the payloads.
+func Client(c *http.Client) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.client = c
+	}
+}
+
+// Retry sets the backoff of retries.
+func Retry(initialInterval, maxInterval time.Duration, maxRetries uint64) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.initialInterval = initialInterval
+		o.maxInterval = maxInterval
+		o.maxRetries = maxRetries
+	}
+}
+
+// QueueSize sets the max pending deliveries of each target.
+func QueueSize(size int) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.queueSize = size
+	}
+}
+
+// DeadLetterSize sets how many dead letters are kept for each target.
+func DeadLetterSize(size int) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.deadLetterSize = size
+	}
+}
+
+// RefreshInterval sets the interval of reloading the targets from the config
+// store, which may be changed by the other sash instances.
+func RefreshInterval(interval time.Duration) DispatcherOption {
+	return func(o *dispatcherOptions) {
+		o.refreshInterval = interval
+	}
+}
+
+// Dispatcher sends the events to the matched targets. Each target has its
+// own queue and worker, so a slow target doesn't delay the others.
+type Dispatcher struct {
+	sync.Mutex
+	options *dispatcherOptions
+	ctl     *config.Controller
+
+	epoch   string
+	seq     uint64
+	targets atomic.Value // Targets
+
+	workers     map[string]*worker
+	deadLetters map[string][]*DeadLetter
+
+	healthMu sync.Mutex
+	healthy  map[string]bool
+
+	stop chan struct{} // nil if not started, the payloads are dropped.
+	wg   sync.WaitGroup
+}
+
+// NewDispatcher creates a webhook dispatcher.
+func NewDispatcher(ctl *config.Controller, opts ...DispatcherOption) *Dispatcher {
+	o := defaultDispatcherOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	for _, t := range o.targets {
+		t.Static = true
+	}
+	d := &Dispatcher{
+		options:     o,
+		ctl:         ctl,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		workers:     make(map[string]*worker),
+		deadLetters: make(map[string][]*DeadLetter),
+		healthy:     make(map[string]bool),
+	}
+	d.targets.Store(Targets(o.targets))
+	return d
+}
+
+// WatchConfig sends the changes of configs, it should be called before
+// starting the controller. The events of the initial load are the snapshot
+// of the store rather than changes, so they are not sent.
+func (d *Dispatcher) WatchConfig(ctl *config.Controller) {
+	watch.ConfigEvents(ctl, func(evt *watch.Event) {
+		if ctl.LastSyncTime().IsZero() {
+			return
+		}
+		d.handleEvent(evt)
+	})
+}
+
+// WatchRegistry sends the changes of service registry and the health of
+// services, it must be called before running the registry cache. The events
+// before the first successful sync only record the health of services.
+func (d *Dispatcher) WatchRegistry(reg registry.Cache) {
+	watch.RegistryEvents(reg, func(evt *watch.Event) {
+		synced := !reg.LastSyncTime().IsZero()
+		if synced {
+			d.handleEvent(evt)
+		}
+		d.checkHealth(reg, evt, synced)
+	})
+}
+
+// Start starts the dispatcher, it could be started again after stopped.
+func (d *Dispatcher) Start() {
+	if err := d.refresh(); err != nil {
+		logger.Warnf("Failed to load webhook targets: %v", err)
+	}
+	d.Lock()
+	defer d.Unlock()
+	if d.stop != nil {
+		return
+	}
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+	go d.loop(d.stop)
+}
+
+// Stop stops the dispatcher, the pending deliveries are dropped.
+func (d *Dispatcher) Stop() {
+	d.Lock()
+	if d.stop == nil {
+		d.Unlock()
+		return
+	}
+	close(d.stop)
+	d.stop = nil
+	for name, w := range d.workers {
+		close(w.stop)
+		delete(d.workers, name)
+	}
+	d.Unlock()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) loop(stop chan struct{}) {
+	ticker := time.NewTicker(d.options.refreshInterval)
+	defer func() {
+		ticker.Stop()
+		d.wg.Done()
+	}()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := d.refresh(); err != nil {
+			logger.Warnf("Failed to load webhook targets: %v", err)
+		}
+	}
+}
+
+func (d *Dispatcher) nextID() string {
+	return d.epoch + "-" + strconv.FormatUint(atomic.AddUint64(&d.seq, 1), 10)
+}
+
+func (d *Dispatcher) handleEvent(evt *watch.Event) {
+	d.Dispatch(&Payload{
+		Event:       string(evt.Resource) + "." + string(evt.Type),
+		ServiceName: evt.ServiceName,
+		Key:         evt.Key,
+		Data:        evt.Data,
+	})
+}
+
+// checkHealth sends an event when the service loses all its healthy
+// instances or recovers. The registry cache is updated before dispatching
+// the events, so it reflects the latest state. The state is only recorded if
+// notify is false.
+func (d *Dispatcher) checkHealth(reg registry.Cache, evt *watch.Event, notify bool) {
+	svc := evt.ServiceName
+	d.healthMu.Lock()
+	defer d.healthMu.Unlock()
+	if evt.Resource == watch.ResourceService && evt.Type == watch.EventDelete {
+		delete(d.healthy, svc)
+		return
+	}
+	service, err := reg.Get(svc)
+	if err != nil || service == nil {
+		return
+	}
+	healthy := false
+	for _, inst := range service.Instances {
+		if inst.State == model.StateHealthy {
+			healthy = true
+			break
+		}
+	}
+	was, known := d.healthy[svc]
+	d.healthy[svc] = healthy
+	if !notify || !known || was == healthy {
+		return
+	}
+	event := EventServiceHealthy
+	if !healthy {
+		event = EventServiceUnhealthy
+	}
+	d.Dispatch(&Payload{
+		Event:       event,
+		ServiceName: svc,
+		Key:         svc,
+	})
+}
+
+// Dispatch sends the payload to all the matched targets asynchronously.
+func (d *Dispatcher) Dispatch(p *Payload) {
+	if p.ID == "" {
+		p.ID = d.nextID()
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	d.Lock()
+	defer d.Unlock()
+	for _, t := range d.loadTargets() {
+		if !t.Match(p.Event, p.ServiceName) {
+			continue
+		}
+		if err := d.enqueue(t.Name, p); err == ErrQueueFull {
+			d.addDeadLetter(&DeadLetter{
+				Target:  t.Name,
+				Payload: p,
+				Error:   err.Error(),
+				Time:    time.Now(),
+			})
+		}
+	}
+}
+
+// enqueue queues the payload to the worker of target, returns ErrStopped if
+// the dispatcher is stopped, and ErrQueueFull if the queue is full. It must
+// be called with lock held.
+func (d *Dispatcher) enqueue(target string, p *Payload) error {
+	if d.stop == nil {
+		return ErrStopped
+	}
+	w, ok := d.workers[target]
+	if !ok {
+		w = &worker{
+			d:      d,
+			target: target,
+			queue:  make(chan *Payload, d.options.queueSize),
+			stop:   make(chan struct{}),
+		}
+		d.workers[target] = w
+		d.wg.Add(1)
+		go w.run()
+	}
+	select {
+	case w.queue <- p:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// addDeadLetter must be called with lock held.
+func (d *Dispatcher) addDeadLetter(dl *DeadLetter) {
+	logger.Warnf("Failed to deliver %s to webhook %s after %d attempts: %s", dl.Payload.ID, dl.Target, dl.Attempts, dl.Error)
+	dls := append(d.deadLetters[dl.Target], dl)
+	if n := len(dls) - d.options.deadLetterSize; n > 0 {
+		dls = dls[n:]
+	}
+	d.deadLetters[dl.Target] = dls
+}
+
+// DeadLetters returns the dead letters of target, the latest one is the last.
+func (d *Dispatcher) DeadLetters(target string) []*DeadLetter {
+	d.Lock()
+	defer d.Unlock()
+	dls := make([]*DeadLetter, len(d.deadLetters[target]))
+	copy(dls, d.deadLetters[target])
+	return dls
+}
+
+// ClearDeadLetters removes all the dead letters of target.
+func (d *Dispatcher) ClearDeadLetters(target string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.deadLetters, target)
+}
+
+// Redeliver sends the dead letter of target again, returns config.ErrNotExist
+// if not found. The dead letter is kept if it couldn't be queued, such as
+// ErrStopped or ErrQueueFull is returned.
+func (d *Dispatcher) Redeliver(target, id string) error {
+	d.Lock()
+	defer d.Unlock()
+	dls := d.deadLetters[target]
+	for i, dl := range dls {
+		if dl.Payload.ID != id {
+			continue
+		}
+		if err := d.enqueue(target, dl.Payload); err != nil {
+			return err
+		}
+		d.deadLetters[target] = append(dls[:i:i], dls[i+1:]...)
+		return nil
+	}
+	return config.ErrNotExist
+}
+
+func (d *Dispatcher) loadTargets() Targets {
+	return d.targets.Load().(Targets)
+}
+
+func (d *Dispatcher) getTarget(name string) *Target {
+	for _, t := range d.loadTargets() {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// refresh reloads the targets, and stops the workers of the deleted ones.
+func (d *Dispatcher) refresh() error {
+	stored, err := d.list()
+	if err != nil {
+		return err
+	}
+	targets := make(Targets, 0, len(d.options.targets)+len(stored))
+	names := make(map[string]struct{}, cap(targets))
+	for _, t := range d.options.targets {
+		targets = append(targets, t)
+		names[t.Name] = struct{}{}
+	}
+	for _, t := range stored {
+		if _, ok := names[t.Name]; ok {
+			continue
+		}
+		targets = append(targets, t)
+		names[t.Name] = struct{}{}
+	}
+	sort.Sort(targets)
+	d.targets.Store(targets)
+
+	d.Lock()
+	defer d.Unlock()
+	for name, w := range d.workers {
+		if _, ok := names[name]; !ok {
+			close(w.stop)
+			delete(d.workers, name)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) list() (Targets, error) {
+	names, err := d.ctl.Keys(NamespaceWebhook, TypeTarget)
+	switch err {
+	case nil:
+	case config.ErrNotExist:
+		return Targets{}, nil
+	default:
+		return nil, err
+	}
+	targets := make(Targets, 0, len(names))
+	for _, name := range names {
+		t, err := d.get(name)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func (d *Dispatcher) get(name string) (*Target, error) {
+	b, err := d.ctl.Get(NamespaceWebhook, TypeTarget, name)
+	if err != nil {
+		return nil, err
+	}
+	t := new(Target)
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (d *Dispatcher) save(t *Target, putFn func(ns, typ, key string, value []byte) error) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := putFn(NamespaceWebhook, TypeTarget, t.Name, b); err != nil {
+		return err
+	}
+	return d.refresh()
+}
+
+// Targets returns all the targets ordered by name.
+func (d *Dispatcher) Targets() Targets {
+	return d.loadTargets()
+}
+
+// Get returns the target by name.
+func (d *Dispatcher) Get(name string) (*Target, error) {
+	if t := d.getTarget(name); t != nil {
+		return t, nil
+	}
+	return d.get(name)
+}
+
+// Add adds a target, returns config.ErrExist if the name is taken.
+func (d *Dispatcher) Add(t *Target) error {
+	if err := t.Verify(); err != nil {
+		return err
+	}
+	if d.getTarget(t.Name) != nil {
+		return config.ErrExist
+	}
+	t.Static = false
+	t.CreateTime = time.Now()
+	t.UpdateTime = t.CreateTime
+	return d.save(t, d.ctl.Add)
+}
+
+// Update updates a target, the secret is kept if not set.
+func (d *Dispatcher) Update(t *Target) error {
+	if err := t.Verify(); err != nil {
+		return err
+	}
+	old, err := d.Get(t.Name)
+	if err != nil {
+		return err
+	}
+	if old.Static {
+		return ErrStatic
+	}
+	if t.Secret == "" {
+		t.Secret = old.Secret
+	}
+	t.Static = false
+	t.CreateTime = old.CreateTime
+	t.UpdateTime = time.Now()
+	return d.save(t, d.ctl.Update)
+}
+
+// Delete deletes a target.
+func (d *Dispatcher) Delete(name string) error {
+	t, err := d.Get(name)
+	if err != nil {
+		return err
+	}
+	if t.Static {
+		return ErrStatic
+	}
+	if err := d.ctl.Del(NamespaceWebhook, TypeTarget, name); err != nil {
+		return err
+	}
+	return d.refresh()
+}
+
+// worker delivers the payloads to a target one by one.
+type worker struct {
+	d      *Dispatcher
+	target string
+	queue  chan *Payload
+	stop   chan struct{}
+}
+
+func (w *worker) run() {
+	defer w.d.wg.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case p := <-w.queue:
+			w.deliver(p)
+		}
+	}
+}
+
+func (w *worker) deliver(p *Payload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		logger.Warnf("Failed to marshal webhook payload %s: %v", p.ID, err)
+		return
+	}
+	o := w.d.options
+	b := utils.NewExponentialBackoffBuilder().
+		InitialInterval(o.initialInterval).
+		MaxInterval(o.maxInterval).
+		MaxElapsedTime(0).
+		MaxRetries(o.maxRetries).
+		Build()
+	for attempts := 1; ; attempts++ {
+		// the target may be changed or deleted in the meantime.
+		t := w.d.getTarget(w.target)
+		if t == nil {
+			return
+		}
+		err = w.send(t, p, body)
+		if err == nil {
+			return
+		}
+		d := b.NextBackOff()
+		if _, ok := err.(permanentError); ok || d == backoff.Stop {
+			w.d.Lock()
+			w.d.addDeadLetter(&DeadLetter{
+				Target:   w.target,
+				Payload:  p,
+				Attempts: attempts,
+				Error:    err.Error(),
+				Time:     time.Now(),
+			})
+			w.d.Unlock()
+			return
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-w.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// permanentError indicates the delivery shouldn't be retried.
+type permanentError struct {
+	error
+}
+
+func (w *worker) send(t *Target, p *Payload, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sash-webhook")
+	req.Header.Set(HeaderEvent, p.Event)
+	req.Header.Set(HeaderDelivery, p.ID)
+	if t.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(t.Secret, body))
+	}
+	resp, err := w.d.options.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return nil
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= 500:
+		return fmt.Errorf("unexpected status code: %d", code)
+	default:
+		return permanentError{fmt.Errorf("unexpected status code: %d", code)}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+	"github.com/samaritan-proxy/sash/watch"
+)
+
+type request struct {
+	header  http.Header
+	body    []byte
+	payload *Payload
+}
+
+// receiver records the requests, and replies with the given status codes
+// in order, the last one is repeated.
+type receiver struct {
+	sync.Mutex
+	codes    []int
+	requests []*request
+	ch       chan *request
+}
+
+func newReceiver(codes ...int) (*receiver, *httptest.Server) {
+	r := &receiver{codes: codes, ch: make(chan *request, 16)}
+	return r, httptest.NewServer(r)
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	p := new(Payload)
+	_ = json.Unmarshal(body, p)
+	r.Lock()
+	code := http.StatusOK
+	if len(r.codes) > 0 {
+		code = r.codes[0]
+		if len(r.codes) > 1 {
+			r.codes = r.codes[1:]
+		}
+	}
+	r.Unlock()
+	w.WriteHeader(code)
+	r.ch <- &request{header: req.Header, body: body, payload: p}
+}
+
+func (r *receiver) wait(t *testing.T) *request {
+	select {
+	case req := <-r.ch:
+		return req
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func newTestDispatcher(t *testing.T, opts ...DispatcherOption) *Dispatcher {
+	ctl := config.NewController(memory.NewStore())
+	opts = append([]DispatcherOption{Retry(time.Millisecond, time.Millisecond*5, 2)}, opts...)
+	d := NewDispatcher(ctl, opts...)
+	d.Start()
+	return d
+}
+
+func waitDeadLetters(t *testing.T, d *Dispatcher, target string, n int) []*DeadLetter {
+	for i := 0; i < 100; i++ {
+		if dls := d.DeadLetters(target); len(dls) >= n {
+			return dls
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatalf("expect %d dead letters", n)
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	// echo -n 'body' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355", Sign("secret", []byte("body")))
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	r, srv := newReceiver()
+	defer srv.Close()
+	d := newTestDispatcher(t, StaticTargets(&Target{
+		Name:     "static",
+		URL:      srv.URL,
+		Secret:   "secret",
+		Events:   []string{"proxy-config.*"},
+		Services: []string{"a"},
+	}))
+	defer d.Stop()
+
+	d.handleEvent(&watch.Event{Type: watch.EventAdd, Resource: watch.ResourceDependency, ServiceName: "a", Key: "a"})
+	d.handleEvent(&watch.Event{Type: watch.EventAdd, Resource: watch.ResourceProxyConfig, ServiceName: "b", Key: "b"})
+	d.handleEvent(&watch.Event{Type: watch.EventUpdate, Resource: watch.ResourceProxyConfig, ServiceName: "a", Key: "a"})
+
+	req := r.wait(t)
+	assert.Equal(t, "proxy-config.update", req.payload.Event)
+	assert.Equal(t, "a", req.payload.ServiceName)
+	assert.Equal(t, "proxy-config.update", req.header.Get(HeaderEvent))
+	assert.Equal(t, req.payload.ID, req.header.Get(HeaderDelivery))
+	assert.Equal(t, Sign("secret", req.body), req.header.Get(HeaderSignature))
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Empty(t, r.ch)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	r, srv := newReceiver(http.StatusServiceUnavailable, http.StatusOK)
+	defer srv.Close()
+	d := newTestDispatcher(t, StaticTargets(&Target{Name: "a", URL: srv.URL, Events: []string{"*"}}))
+	defer d.Stop()
+
+	d.Dispatch(&Payload{Event: "dependency.add"})
+	first, second := r.wait(t), r.wait(t)
+	assert.Equal(t, first.payload.ID, second.payload.ID)
+	assert.Empty(t, first.header.Get(HeaderSignature))
+	assert.Empty(t, d.DeadLetters("a"))
+}
+
+func TestDispatcher_DeadLetters(t *testing.T) {
+	r, srv := newReceiver(http.StatusInternalServerError)
+	defer srv.Close()
+	d := newTestDispatcher(t, StaticTargets(&Target{Name: "a", URL: srv.URL, Events: []string{"*"}}))
+	defer d.Stop()
+
+	// exhausts the retries.
+	d.Dispatch(&Payload{Event: "dependency.add"})
+	for i := 0; i < 3; i++ {
+		r.wait(t)
+	}
+	dls := waitDeadLetters(t, d, "a", 1)
+	assert.Equal(t, 3, dls[0].Attempts)
+	assert.Contains(t, dls[0].Error, "500")
+
+	// permanent error
+	r.Lock()
+	r.codes = []int{http.StatusBadRequest, http.StatusOK}
+	r.Unlock()
+	d.Dispatch(&Payload{Event: "dependency.add"})
+	r.wait(t)
+	dls = waitDeadLetters(t, d, "a", 2)
+	assert.Equal(t, 1, dls[1].Attempts)
+
+	// redeliver
+	assert.Equal(t, config.ErrNotExist, d.Redeliver("a", "foo"))
+	assert.NoError(t, d.Redeliver("a", dls[1].Payload.ID))
+	assert.Equal(t, dls[1].Payload.ID, r.wait(t).payload.ID)
+	assert.Len(t, d.DeadLetters("a"), 1)
+
+	// the dead letter is kept if the dispatcher is stopped.
+	d.Stop()
+	assert.Equal(t, ErrStopped, d.Redeliver("a", dls[0].Payload.ID))
+	assert.Len(t, d.DeadLetters("a"), 1)
+
+	d.ClearDeadLetters("a")
+	assert.Empty(t, d.DeadLetters("a"))
+}
+
+func TestDispatcher_DeadLetterSize(t *testing.T) {
+	d := newTestDispatcher(t, DeadLetterSize(2))
+	defer d.Stop()
+	d.Lock()
+	for _, id := range []string{"1", "2", "3"} {
+		d.addDeadLetter(&DeadLetter{Target: "a", Payload: &Payload{ID: id}})
+	}
+	d.Unlock()
+	dls := d.DeadLetters("a")
+	assert.Len(t, dls, 2)
+	assert.Equal(t, "3", dls[1].Payload.ID)
+}
+
+func TestDispatcher_Targets(t *testing.T) {
+	d := newTestDispatcher(t, StaticTargets(&Target{Name: "static", URL: "http://a", Events: []string{"*"}}))
+	defer d.Stop()
+
+	assert.Error(t, d.Add(&Target{Name: "foo"}))
+	assert.Equal(t, config.ErrExist, d.Add(&Target{Name: "static", URL: "http://b", Events: []string{"*"}}))
+	assert.NoError(t, d.Add(&Target{Name: "b", URL: "http://b", Secret: "s", Events: []string{"*"}}))
+	targets := d.Targets()
+	if assert.Len(t, targets, 2) {
+		assert.Equal(t, "b", targets[0].Name)
+		assert.False(t, targets[0].Static)
+		assert.True(t, targets[1].Static)
+	}
+
+	// the secret is kept if not set.
+	assert.NoError(t, d.Update(&Target{Name: "b", URL: "http://c", Events: []string{"*"}}))
+	b, err := d.Get("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://c", b.URL)
+	assert.Equal(t, "s", b.Secret)
+
+	assert.Equal(t, ErrStatic, d.Update(&Target{Name: "static", URL: "http://c", Events: []string{"*"}}))
+	assert.Equal(t, ErrStatic, d.Delete("static"))
+	assert.Equal(t, config.ErrNotExist, d.Update(&Target{Name: "foo", URL: "http://c", Events: []string{"*"}}))
+	assert.NoError(t, d.Delete("b"))
+	assert.Equal(t, config.ErrNotExist, d.Delete("b"))
+	assert.Len(t, d.Targets(), 1)
+}
+
+func TestDispatcher_WatchRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	r, srv := newReceiver()
+	defer srv.Close()
+	d := newTestDispatcher(t, StaticTargets(&Target{Name: "a", URL: srv.URL, Events: []string{"service.unhealthy", "service.healthy"}}))
+	defer d.Stop()
+
+	var (
+		instHdl registry.InstanceEventHandler
+		svc     = model.NewService("svc", model.NewServiceInstance("1.1.1.1", 80))
+	)
+	var lastSync time.Time
+	reg := registry.NewMockCache(ctrl)
+	reg.EXPECT().RegisterServiceEventHandler(gomock.Any())
+	reg.EXPECT().RegisterInstanceEventHandler(gomock.Any()).Do(func(hdl registry.InstanceEventHandler) { instHdl = hdl })
+	reg.EXPECT().Get("svc").DoAndReturn(func(string) (*model.Service, error) { return svc.DeepCopy(), nil }).AnyTimes()
+	reg.EXPECT().LastSyncTime().DoAndReturn(func() time.Time { return lastSync }).AnyTimes()
+	d.WatchRegistry(reg)
+
+	update := func(state model.ServiceInstanceState) {
+		for _, inst := range svc.Instances {
+			inst.State = state
+		}
+		instHdl(&registry.InstanceEvent{Type: registry.EventUpdate, ServiceName: "svc"})
+	}
+	// the changes in the first sync are not sent.
+	update(model.StateUnhealthy)
+	update(model.StateHealthy)
+	lastSync = time.Now()
+	update(model.StateUnhealthy)
+	assert.Equal(t, EventServiceUnhealthy, r.wait(t).payload.Event)
+	update(model.StateUnhealthy)
+	update(model.StateHealthy)
+	assert.Equal(t, EventServiceHealthy, r.wait(t).payload.Event)
+	assert.Empty(t, r.ch)
+}
+
+func TestDispatcher_WatchConfig(t *testing.T) {
+	r, srv := newReceiver()
+	defer srv.Close()
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond*10))
+	assert.NoError(t, ctl.Dependencies().Add(&config.Dependency{ServiceName: "a", Dependencies: []string{"x"}}))
+	d := NewDispatcher(ctl, StaticTargets(&Target{Name: "a", URL: srv.URL, Events: []string{"dependency.*"}}))
+	d.WatchConfig(ctl)
+	d.Start()
+	defer d.Stop()
+
+	// the existing configs are loaded without events.
+	assert.NoError(t, ctl.Start())
+	defer ctl.Stop()
+	for i := 0; i < 100 && ctl.LastSyncTime().IsZero(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.False(t, ctl.LastSyncTime().IsZero())
+
+	assert.NoError(t, ctl.Dependencies().Add(&config.Dependency{ServiceName: "b", Dependencies: []string{"x"}}))
+	req := r.wait(t)
+	assert.Equal(t, "dependency.add", req.payload.Event)
+	assert.Equal(t, "b", req.payload.Key)
+	assert.Empty(t, r.ch)
+}
+
+func TestDispatcher_Restart(t *testing.T) {
+	r, srv := newReceiver()
+	defer srv.Close()
+	ctl := config.NewController(memory.NewStore())
+	d := NewDispatcher(ctl, StaticTargets(&Target{Name: "a", URL: srv.URL, Events: []string{"*"}}))
+
+	// dropped if not started
+	d.Dispatch(&Payload{ID: "1", Event: "dependency.add"})
+	d.Start()
+	d.Stop()
+	d.Dispatch(&Payload{ID: "2", Event: "dependency.add"})
+
+	d.Start()
+	defer d.Stop()
+	d.Dispatch(&Payload{ID: "3", Event: "dependency.add"})
+	assert.Equal(t, "3", r.wait(t).payload.ID)
+	assert.Empty(t, d.DeadLetters("a"))
+}
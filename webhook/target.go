@@ -0,0 +1,141 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook notifies the external systems, such as chat and CI, of
+// the changes of configs and service registry by POSTing JSON payloads.
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/watch"
+)
+
+// The following shows the event names derived from the health of service
+// in the service registry, besides "<resource>.<type>" of watch events.
+const (
+	// EventServiceUnhealthy is sent when a service loses all its healthy instances.
+	EventServiceUnhealthy = "service.unhealthy"
+	// EventServiceHealthy is sent when an unhealthy service recovers.
+	EventServiceHealthy = "service.healthy"
+)
+
+var validTargetName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Target is the receiver of webhook.
+type Target struct {
+	config.Metadata `yaml:",inline"`
+	Name            string `json:"name" yaml:"name"`
+	URL             string `json:"url" yaml:"url"`
+	// Secret is used to sign the payloads with HMAC-SHA256, never returned by the API.
+	Secret string `json:"secret,omitempty" yaml:"secret"`
+	// Events filters the events by name, such as "proxy-config.update",
+	// "proxy-config.*", "service.unhealthy" and "*".
+	Events []string `json:"events" yaml:"events"`
+	// Services filters the events by service, all if empty.
+	Services []string `json:"services,omitempty" yaml:"services"`
+	// Static indicates the target comes from the bootstrap, which couldn't
+	// be changed through the API.
+	Static bool `json:"static" yaml:"-"`
+}
+
+func verifyEventPattern(pattern string) error {
+	if pattern == "*" {
+		return nil
+	}
+	i := strings.IndexByte(pattern, '.')
+	if i < 0 {
+		return fmt.Errorf("invalid event: %s", pattern)
+	}
+	res, typ := pattern[:i], pattern[i+1:]
+	if _, err := watch.ParseResource(res); err != nil {
+		return fmt.Errorf("invalid event: %s", pattern)
+	}
+	switch typ {
+	case "*", string(watch.EventAdd), string(watch.EventUpdate), string(watch.EventDelete):
+		return nil
+	}
+	if pattern == EventServiceUnhealthy || pattern == EventServiceHealthy {
+		return nil
+	}
+	return fmt.Errorf("invalid event: %s", pattern)
+}
+
+// Verify this target is valid.
+func (t *Target) Verify() error {
+	if !validTargetName.MatchString(t.Name) {
+		return fmt.Errorf("invalid name: %q", t.Name)
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid url: %s", t.URL)
+	}
+	if len(t.Events) == 0 {
+		return errors.New("events is null")
+	}
+	for _, pattern := range t.Events {
+		if err := verifyEventPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns whether the event of service should be sent to this target.
+func (t *Target) Match(event, svc string) bool {
+	if len(t.Services) > 0 && !containsString(t.Services, svc) {
+		return false
+	}
+	for _, pattern := range t.Events {
+		switch {
+		case pattern == "*", pattern == event:
+			return true
+		case strings.HasSuffix(pattern, ".*") && strings.HasPrefix(event, pattern[:len(pattern)-1]):
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of target without the secret.
+func (t *Target) Redacted() *Target {
+	another := *t
+	another.Secret = ""
+	return &another
+}
+
+type Targets []*Target
+
+func (t Targets) Len() int { return len(t) }
+
+func (t Targets) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+
+func (t Targets) Less(i, j int) bool { return t[i].Name < t[j].Name }
+
+func containsString(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarget_Verify(t *testing.T) {
+	cases := []struct {
+		Target  *Target
+		IsError bool
+	}{
+		{Target: &Target{Name: "", URL: "http://a", Events: []string{"*"}}, IsError: true},
+		{Target: &Target{Name: "a b", URL: "http://a", Events: []string{"*"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "ftp://a", Events: []string{"*"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://", Events: []string{"*"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://a"}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://a", Events: []string{"foo"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://a", Events: []string{"foo.add"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://a", Events: []string{"dependency.foo"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://a", Events: []string{"dependency.unhealthy"}}, IsError: true},
+		{Target: &Target{Name: "a", URL: "http://a", Events: []string{"*"}}},
+		{Target: &Target{Name: "chat_1", URL: "https://a/hook", Events: []string{"proxy-config.*", "dependency.delete", "service.unhealthy", "service.healthy"}}},
+	}
+	for idx, c := range cases {
+		t.Run(fmt.Sprintf("case %d", idx+1), func(t *testing.T) {
+			assert.Equal(t, c.IsError, c.Target.Verify() != nil)
+		})
+	}
+}
+
+func TestTarget_Match(t *testing.T) {
+	target := &Target{Events: []string{"proxy-config.*", "service.unhealthy"}}
+	assert.True(t, target.Match("proxy-config.update", "a"))
+	assert.True(t, target.Match("service.unhealthy", "a"))
+	assert.False(t, target.Match("service.healthy", "a"))
+	assert.False(t, target.Match("dependency.add", "a"))
+
+	target.Services = []string{"b"}
+	assert.False(t, target.Match("proxy-config.update", "a"))
+	assert.True(t, target.Match("proxy-config.update", "b"))
+
+	target = &Target{Events: []string{"*"}}
+	assert.True(t, target.Match("dependency.add", "a"))
+}
+
+func TestTarget_Redacted(t *testing.T) {
+	target := &Target{Name: "a", Secret: "foo"}
+	assert.Empty(t, target.Redacted().Secret)
+	assert.Equal(t, "foo", target.Secret)
+}
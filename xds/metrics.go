@@ -0,0 +1,63 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	resourcev3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	streamsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sash",
+		Subsystem: "xds",
+		Name:      "streams_active",
+		Help:      "Number of active xDS streams.",
+	})
+	responsesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "xds",
+		Name:      "responses_sent_total",
+		Help:      "Total number of discovery responses sent to envoy.",
+	}, []string{"type"})
+	nacksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "xds",
+		Name:      "nacks_received_total",
+		Help:      "Total number of discovery responses rejected by envoy.",
+	}, []string{"type"})
+	snapshotsBuilt = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sash",
+		Subsystem: "xds",
+		Name:      "snapshots_built_total",
+		Help:      "Total number of snapshots built from the registry and the proxy configs.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(streamsActive, responsesSent, nacksReceived, snapshotsBuilt)
+}
+
+// typeLabel returns the metric label of resource type.
+func typeLabel(typeURL string) string {
+	switch typeURL {
+	case resourcev3.ClusterType:
+		return "cluster"
+	case resourcev3.EndpointType:
+		return "endpoint"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	protov2 "google.golang.org/protobuf/proto"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+// nodeKey is the key of the snapshot shared by all the envoy nodes, the
+// resources don't vary with the nodes.
+const nodeKey = "sash"
+
+// sharedHash maps all the envoy nodes to the shared snapshot.
+type sharedHash struct{}
+
+func (sharedHash) ID(*corev3.Node) string { return nodeKey }
+
+// snapshotter rebuilds the snapshot from the service registry and the
+// proxy configs when either of them changes. The changes which happen
+// during a rebuild are coalesced into the next one.
+type snapshotter struct {
+	reg    registry.Cache
+	cfgCtl *config.ProxyConfigsController
+	cache  cachev3.SnapshotCache
+
+	updateCh chan struct{}
+	last     cachev3.Snapshot
+}
+
+func newSnapshotter(reg registry.Cache, ctl *config.Controller, cache cachev3.SnapshotCache) *snapshotter {
+	s := &snapshotter{
+		reg:      reg,
+		cfgCtl:   ctl.ProxyConfigs(),
+		cache:    cache,
+		updateCh: make(chan struct{}, 1),
+	}
+	reg.RegisterServiceEventHandler(func(*registry.ServiceEvent) { s.trigger() })
+	reg.RegisterInstanceEventHandler(func(*registry.InstanceEvent) { s.trigger() })
+	s.cfgCtl.RegisterEventHandler(func(*config.ProxyConfigEvent) { s.trigger() })
+	ctl.DefaultProxyConfig().RegisterEventHandler(func(*config.DefaultProxyConfigEvent) { s.trigger() })
+	return s
+}
+
+func (s *snapshotter) trigger() {
+	select {
+	case s.updateCh <- struct{}{}:
+	default:
+	}
+}
+
+// run rebuilds the snapshot once at first, then on every trigger until
+// stop is closed.
+func (s *snapshotter) run(stop <-chan struct{}) {
+	s.update()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-s.updateCh:
+			s.update()
+		}
+	}
+}
+
+func (s *snapshotter) update() {
+	clusters, endpoints, err := s.build()
+	if err != nil {
+		log.Warnf("Failed to build the xDS snapshot: %v", err)
+		return
+	}
+
+	snap := s.last
+	changed := false
+	for typ, items := range map[types.ResponseType][]types.Resource{
+		types.Cluster:  clusters,
+		types.Endpoint: endpoints,
+	} {
+		res := cachev3.NewResources("", items)
+		version, err := versionOf(res.Items)
+		if err != nil {
+			log.Warnf("Failed to hash the xDS resources: %v", err)
+			return
+		}
+		if version == s.last.Resources[typ].Version {
+			continue
+		}
+		res.Version = version
+		snap.Resources[typ] = res
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	if err := s.cache.SetSnapshot(nodeKey, snap); err != nil {
+		log.Warnf("Failed to set the xDS snapshot: %v", err)
+		return
+	}
+	s.last = snap
+	snapshotsBuilt.Inc()
+	log.Debugf("xDS snapshot updated, clusters: %d(%s), endpoints: %d(%s)",
+		len(clusters), snap.Resources[types.Cluster].Version, len(endpoints), snap.Resources[types.Endpoint].Version)
+}
+
+// build generates the clusters and their endpoints for all the registered
+// services, the services which are not in the registry are ignored even if
+// they have proxy configs.
+func (s *snapshotter) build() (clusters, endpoints []types.Resource, err error) {
+	names, err := s.reg.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		svc, err := s.reg.Get(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		// deleted after listing.
+		if svc == nil {
+			continue
+		}
+		clusters = append(clusters, toCluster(name, s.proxyConfigOf(name)))
+		endpoints = append(endpoints, toLoadAssignment(svc))
+	}
+	return clusters, endpoints, nil
+}
+
+// proxyConfigOf returns the effective proxy config of service, nil if there
+// is no one or it's broken.
+func (s *snapshotter) proxyConfigOf(svcName string) *service.Config {
+	cfg, err := s.cfgCtl.GetEffectiveCache(svcName)
+	switch err {
+	case nil:
+		return cfg.Config
+	case config.ErrNotExist:
+	default:
+		log.Warnf("Failed to get the proxy config of %s: %v", svcName, err)
+	}
+	return nil
+}
+
+// versionOf returns the hash of resources as their version. The versions of
+// clusters and endpoints are separate, so that the change of endpoints
+// doesn't make envoy warm up the clusters again. And they are the same on
+// every replica and after restarts for the same resources, so envoy doesn't
+// fetch the resources again when it reconnects to another replica.
+func versionOf(items map[string]types.ResourceWithTtl) (string, error) {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	var size [8]byte
+	for _, name := range names {
+		b, err := protov2.MarshalOptions{Deterministic: true}.Marshal(proto.MessageV2(items[name].Resource))
+		if err != nil {
+			return "", err
+		}
+		binary.BigEndian.PutUint64(size[:], uint64(len(name)))
+		h.Write(size[:])
+		h.Write([]byte(name))
+		binary.BigEndian.PutUint64(size[:], uint64(len(b)))
+		h.Write(size[:])
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
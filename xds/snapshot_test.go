@@ -0,0 +1,186 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/golang/mock/gomock"
+	"github.com/samaritan-proxy/samaritan-api/go/common"
+	"github.com/samaritan-proxy/samaritan-api/go/config/protocol"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/config/memory"
+	"github.com/samaritan-proxy/sash/model"
+	"github.com/samaritan-proxy/sash/registry"
+	regmemory "github.com/samaritan-proxy/sash/registry/memory"
+)
+
+// testRegistry is a registry cache backed by a memory registry, which is
+// safe to be changed while the snapshot is building.
+type testRegistry struct {
+	*registry.MockCache
+
+	mu       sync.Mutex
+	r        *regmemory.Registry
+	instHdlr registry.InstanceEventHandler
+}
+
+func newTestRegistry(ctrl *gomock.Controller, services ...*model.Service) *testRegistry {
+	tr := &testRegistry{
+		MockCache: registry.NewMockCache(ctrl),
+		r:         regmemory.NewRegistry(services...),
+	}
+	tr.EXPECT().RegisterServiceEventHandler(gomock.Any())
+	tr.EXPECT().RegisterInstanceEventHandler(gomock.Any()).Do(func(hdlr registry.InstanceEventHandler) {
+		tr.instHdlr = hdlr
+	})
+	tr.EXPECT().List().DoAndReturn(func() ([]string, error) {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		return tr.r.List()
+	}).AnyTimes()
+	tr.EXPECT().Get(gomock.Any()).DoAndReturn(func(name string) (*model.Service, error) {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		return tr.r.Get(name)
+	}).AnyTimes()
+	return tr
+}
+
+func (tr *testRegistry) addInstance(svcName string, insts ...*model.ServiceInstance) {
+	tr.mu.Lock()
+	tr.r.AddInstance(svcName, insts...)
+	tr.mu.Unlock()
+	tr.instHdlr(&registry.InstanceEvent{
+		Type:        registry.EventAdd,
+		ServiceName: svcName,
+		Instances:   insts,
+	})
+}
+
+func newTestController(t *testing.T) *config.Controller {
+	ctl := config.NewController(memory.NewStore(), config.SyncInterval(time.Millisecond))
+	assert.NoError(t, ctl.Start())
+	return ctl
+}
+
+func snapshotVersions(t *testing.T, cache cachev3.SnapshotCache) (cluster, endpoint string) {
+	snap, err := cache.GetSnapshot(nodeKey)
+	assert.NoError(t, err)
+	return snap.Resources[types.Cluster].Version, snap.Resources[types.Endpoint].Version
+}
+
+func TestSnapshotterUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reg := newTestRegistry(ctrl,
+		model.NewService("foo", model.NewServiceInstance("10.0.0.1", 80)),
+		model.NewService("bar"),
+	)
+	ctl := newTestController(t)
+	defer ctl.Stop()
+	cache := cachev3.NewSnapshotCache(true, sharedHash{}, log)
+	s := newSnapshotter(reg, ctl, cache)
+
+	s.update()
+	snap, err := cache.GetSnapshot(nodeKey)
+	assert.NoError(t, err)
+	assert.NoError(t, snap.Consistent())
+	assert.Len(t, snap.Resources[types.Cluster].Items, 2)
+	assert.Len(t, snap.Resources[types.Endpoint].Items, 2)
+	cv, ev := snapshotVersions(t, cache)
+	assert.NotEmpty(t, cv)
+	assert.NotEqual(t, cv, ev)
+
+	// another replica builds the same versions.
+	another := cachev3.NewSnapshotCache(true, sharedHash{}, log)
+	(&snapshotter{reg: reg, cfgCtl: ctl.ProxyConfigs(), cache: another}).update()
+	acv, aev := snapshotVersions(t, another)
+	assert.Equal(t, cv, acv)
+	assert.Equal(t, ev, aev)
+
+	// nothing changed
+	s.update()
+	cv1, ev1 := snapshotVersions(t, cache)
+	assert.Equal(t, cv, cv1)
+	assert.Equal(t, ev, ev1)
+
+	// only the endpoints changed
+	reg.addInstance("foo", model.NewServiceInstance("10.0.0.2", 80))
+	s.update()
+	cv1, ev1 = snapshotVersions(t, cache)
+	assert.Equal(t, cv, cv1)
+	assert.NotEqual(t, ev, ev1)
+	ev = ev1
+
+	// only the clusters changed
+	timeout := time.Second
+	assert.NoError(t, ctl.ProxyConfigs().Add(&config.ProxyConfig{
+		ServiceName: "bar",
+		Config: &service.Config{
+			Protocol: protocol.TCP,
+			Listener: &service.Listener{
+				Address: &common.Address{Ip: "0.0.0.0", Port: 8080},
+			},
+			ConnectTimeout: &timeout,
+		},
+	}))
+	assert.Eventually(t, func() bool {
+		s.update()
+		cv1, ev1 = snapshotVersions(t, cache)
+		return cv1 != cv
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, ev, ev1)
+}
+
+func TestSnapshotterRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reg := newTestRegistry(ctrl, model.NewService("foo"))
+	ctl := newTestController(t)
+	defer ctl.Stop()
+	cache := cachev3.NewSnapshotCache(true, sharedHash{}, log)
+	s := newSnapshotter(reg, ctl, cache)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.run(stop)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := cache.GetSnapshot(nodeKey)
+		return err == nil
+	}, time.Second, time.Millisecond*10)
+	_, ev := snapshotVersions(t, cache)
+
+	reg.addInstance("foo", model.NewServiceInstance("10.0.0.1", 80))
+	assert.Eventually(t, func() bool {
+		_, ev1 := snapshotVersions(t, cache)
+		return ev1 != ev
+	}, time.Second, time.Millisecond*10)
+
+	close(stop)
+	<-done
+}
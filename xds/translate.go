@@ -0,0 +1,145 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"sort"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/samaritan-proxy/samaritan-api/go/config/hc"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+
+	"github.com/samaritan-proxy/sash/model"
+)
+
+var lbPolicies = map[service.LoadBalancePolicy]clusterv3.Cluster_LbPolicy{
+	service.LoadBalancePolicy_ROUND_ROBIN:      clusterv3.Cluster_ROUND_ROBIN,
+	service.LoadBalancePolicy_LEAST_CONNECTION: clusterv3.Cluster_LEAST_REQUEST,
+	service.LoadBalancePolicy_RANDOM:           clusterv3.Cluster_RANDOM,
+	// the endpoints of an EDS cluster are always provided by sash.
+	service.LoadBalancePolicy_CLUSTER_PROVIDED: clusterv3.Cluster_ROUND_ROBIN,
+}
+
+// toCluster translates the proxy config of service to an EDS cluster whose
+// endpoints are delivered on the same ADS stream. The cfg could be nil if
+// the service has no proxy config.
+func toCluster(svcName string, cfg *service.Config) *clusterv3.Cluster {
+	c := &clusterv3.Cluster{
+		Name:                 svcName,
+		ClusterDiscoveryType: &clusterv3.Cluster_Type{Type: clusterv3.Cluster_EDS},
+		EdsClusterConfig: &clusterv3.Cluster_EdsClusterConfig{
+			EdsConfig: &corev3.ConfigSource{
+				ResourceApiVersion:    corev3.ApiVersion_V3,
+				ConfigSourceSpecifier: &corev3.ConfigSource_Ads{Ads: &corev3.AggregatedConfigSource{}},
+			},
+		},
+	}
+	if cfg == nil {
+		return c
+	}
+
+	if cfg.ConnectTimeout != nil {
+		c.ConnectTimeout = ptypes.DurationProto(*cfg.ConnectTimeout)
+	}
+	if cfg.IdleTimeout != nil {
+		c.CommonHttpProtocolOptions = &corev3.HttpProtocolOptions{
+			IdleTimeout: ptypes.DurationProto(*cfg.IdleTimeout),
+		}
+	}
+	c.LbPolicy = lbPolicies[cfg.LbPolicy]
+	if cfg.HealthCheck != nil {
+		c.HealthChecks = []*corev3.HealthCheck{toHealthCheck(cfg.HealthCheck)}
+	}
+	return c
+}
+
+// toHealthCheck translates the health check to an envoy TCP health check.
+// Only the ATCP checker with exactly one action is translated to a send and
+// receive check, the others fall back to connect-only ones, since envoy
+// can't send more than one payload and has no equivalent MySQL checker.
+func toHealthCheck(c *hc.HealthCheck) *corev3.HealthCheck {
+	tcp := &corev3.HealthCheck_TcpHealthCheck{}
+	if atcp := c.GetAtcpChecker(); atcp != nil && len(atcp.Action) == 1 {
+		action := atcp.Action[0]
+		if len(action.Send) > 0 {
+			tcp.Send = toPayload(action.Send)
+		}
+		if len(action.Expect) > 0 {
+			tcp.Receive = []*corev3.HealthCheck_Payload{toPayload(action.Expect)}
+		}
+	}
+	return &corev3.HealthCheck{
+		Timeout:            ptypes.DurationProto(c.Timeout),
+		Interval:           ptypes.DurationProto(c.Interval),
+		UnhealthyThreshold: &wrappers.UInt32Value{Value: c.FallThreshold},
+		HealthyThreshold:   &wrappers.UInt32Value{Value: c.RiseThreshold},
+		HealthChecker:      &corev3.HealthCheck_TcpHealthCheck_{TcpHealthCheck: tcp},
+	}
+}
+
+func toPayload(b []byte) *corev3.HealthCheck_Payload {
+	return &corev3.HealthCheck_Payload{
+		Payload: &corev3.HealthCheck_Payload_Binary{Binary: b},
+	}
+}
+
+// toLoadAssignment translates the instances of service to the endpoints of
+// cluster, the unhealthy instances are kept but marked as unhealthy.
+func toLoadAssignment(svc *model.Service) *endpointv3.ClusterLoadAssignment {
+	addrs := make([]string, 0, len(svc.Instances))
+	for addr := range svc.Instances {
+		addrs = append(addrs, addr)
+	}
+	// keep the order stable, so that the resource doesn't change if the
+	// instances are same.
+	sort.Strings(addrs)
+
+	endpoints := make([]*endpointv3.LbEndpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, toLbEndpoint(svc.Instances[addr]))
+	}
+	return &endpointv3.ClusterLoadAssignment{
+		ClusterName: svc.Name,
+		Endpoints: []*endpointv3.LocalityLbEndpoints{
+			{LbEndpoints: endpoints},
+		},
+	}
+}
+
+func toLbEndpoint(inst *model.ServiceInstance) *endpointv3.LbEndpoint {
+	status := corev3.HealthStatus_HEALTHY
+	if inst.State == model.StateUnhealthy {
+		status = corev3.HealthStatus_UNHEALTHY
+	}
+	return &endpointv3.LbEndpoint{
+		HostIdentifier: &endpointv3.LbEndpoint_Endpoint{
+			Endpoint: &endpointv3.Endpoint{
+				Address: &corev3.Address{
+					Address: &corev3.Address_SocketAddress{
+						SocketAddress: &corev3.SocketAddress{
+							Address:       inst.IP,
+							PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: uint32(inst.Port)},
+						},
+					},
+				},
+			},
+		},
+		HealthStatus: status,
+	}
+}
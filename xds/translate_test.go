@@ -0,0 +1,117 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"testing"
+	"time"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/samaritan-proxy/samaritan-api/go/config/hc"
+	"github.com/samaritan-proxy/samaritan-api/go/config/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samaritan-proxy/sash/model"
+)
+
+func TestToCluster(t *testing.T) {
+	c := toCluster("foo", nil)
+	assert.Equal(t, "foo", c.Name)
+	assert.Equal(t, clusterv3.Cluster_EDS, c.GetType())
+	assert.NotNil(t, c.EdsClusterConfig.EdsConfig.GetAds())
+	assert.Nil(t, c.ConnectTimeout)
+	assert.Nil(t, c.CommonHttpProtocolOptions)
+	assert.Empty(t, c.HealthChecks)
+
+	connectTimeout, idleTimeout := time.Second, time.Minute
+	c = toCluster("foo", &service.Config{
+		ConnectTimeout: &connectTimeout,
+		IdleTimeout:    &idleTimeout,
+		LbPolicy:       service.LoadBalancePolicy_LEAST_CONNECTION,
+		HealthCheck: &hc.HealthCheck{
+			Interval:      time.Second * 10,
+			Timeout:       time.Second * 3,
+			FallThreshold: 3,
+			RiseThreshold: 2,
+			Checker:       &hc.HealthCheck_TcpChecker{TcpChecker: &hc.TCPChecker{}},
+		},
+	})
+	assert.Equal(t, ptypes.DurationProto(connectTimeout), c.ConnectTimeout)
+	assert.Equal(t, ptypes.DurationProto(idleTimeout), c.CommonHttpProtocolOptions.IdleTimeout)
+	assert.Equal(t, clusterv3.Cluster_LEAST_REQUEST, c.LbPolicy)
+	assert.Len(t, c.HealthChecks, 1)
+	check := c.HealthChecks[0]
+	assert.Equal(t, ptypes.DurationProto(time.Second*10), check.Interval)
+	assert.Equal(t, ptypes.DurationProto(time.Second*3), check.Timeout)
+	assert.Equal(t, uint32(3), check.UnhealthyThreshold.Value)
+	assert.Equal(t, uint32(2), check.HealthyThreshold.Value)
+	assert.NotNil(t, check.GetTcpHealthCheck())
+}
+
+func TestToHealthCheck(t *testing.T) {
+	tests := []struct {
+		check  *hc.HealthCheck
+		expect *corev3.HealthCheck_TcpHealthCheck
+	}{
+		{&hc.HealthCheck{}, &corev3.HealthCheck_TcpHealthCheck{}},
+		{&hc.HealthCheck{Checker: &hc.HealthCheck_RedisChecker{RedisChecker: &hc.RedisChecker{}}}, &corev3.HealthCheck_TcpHealthCheck{}},
+		{
+			&hc.HealthCheck{Checker: &hc.HealthCheck_AtcpChecker{AtcpChecker: &hc.ATCPChecker{
+				Action: []*hc.ATCPChecker_Action{{Send: []byte("ping"), Expect: []byte("pong")}},
+			}}},
+			&corev3.HealthCheck_TcpHealthCheck{
+				Send:    toPayload([]byte("ping")),
+				Receive: []*corev3.HealthCheck_Payload{toPayload([]byte("pong"))},
+			},
+		},
+		{
+			// envoy can't send twice.
+			&hc.HealthCheck{Checker: &hc.HealthCheck_AtcpChecker{AtcpChecker: &hc.ATCPChecker{
+				Action: []*hc.ATCPChecker_Action{
+					{Send: []byte("ping"), Expect: []byte("pong")},
+					{Send: []byte("ping"), Expect: []byte("pong")},
+				},
+			}}},
+			&corev3.HealthCheck_TcpHealthCheck{},
+		},
+	}
+	for i, test := range tests {
+		c := toHealthCheck(test.check)
+		assert.True(t, proto.Equal(test.expect, c.GetTcpHealthCheck()), "case %d", i)
+	}
+}
+
+func TestToLoadAssignment(t *testing.T) {
+	inst1 := model.NewServiceInstance("10.0.0.2", 80)
+	inst2 := model.NewServiceInstance("10.0.0.1", 80)
+	inst2.State = model.StateUnhealthy
+	cla := toLoadAssignment(model.NewService("foo", inst1, inst2))
+
+	assert.Equal(t, "foo", cla.ClusterName)
+	assert.Len(t, cla.Endpoints, 1)
+	endpoints := cla.Endpoints[0].LbEndpoints
+	assert.Len(t, endpoints, 2)
+	// sorted by address
+	addr := endpoints[0].GetEndpoint().Address.GetSocketAddress()
+	assert.Equal(t, "10.0.0.1", addr.Address)
+	assert.Equal(t, uint32(80), addr.GetPortValue())
+	assert.Equal(t, corev3.HealthStatus_UNHEALTHY, endpoints[0].HealthStatus)
+	addr = endpoints[1].GetEndpoint().Address.GetSocketAddress()
+	assert.Equal(t, "10.0.0.2", addr.Address)
+	assert.Equal(t, corev3.HealthStatus_HEALTHY, endpoints[1].HealthStatus)
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xds implements the aggregated discovery service of envoy xDS v3,
+// it delivers the services in the registry as EDS clusters, so that envoy
+// could share the same source of truth with samaritan.
+package xds
+
+import (
+	"context"
+	"net"
+	"time"
+
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+
+	"github.com/samaritan-proxy/sash/config"
+	"github.com/samaritan-proxy/sash/logger"
+	"github.com/samaritan-proxy/sash/registry"
+)
+
+var log = logger.Component("xds")
+
+// Server serves the xDS v3 ADS stream, the resources are generated from the
+// same registry cache and config controller as the discovery server.
+type Server struct {
+	l    net.Listener
+	g    *grpc.Server
+	snap *snapshotter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewServer creates a xDS server, it must be created before starting the
+// registry cache and the config controller to receive all the events.
+func NewServer(l net.Listener, reg registry.Cache, ctl *config.Controller) *Server {
+	cache := cachev3.NewSnapshotCache(true, sharedHash{}, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		l:      l,
+		snap:   newSnapshotter(reg, ctl, cache),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	g := grpc.NewServer(
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    30 * time.Second,
+			Timeout: 10 * time.Second,
+		}),
+	)
+	discoveryv3.RegisterAggregatedDiscoveryServiceServer(g, serverv3.NewServer(ctx, cache, s.callbacks()))
+	s.g = g
+	return s
+}
+
+func (s *Server) callbacks() serverv3.Callbacks {
+	return serverv3.CallbackFuncs{
+		StreamOpenFunc: func(ctx context.Context, id int64, _ string) error {
+			streamsActive.Inc()
+			p, _ := peer.FromContext(ctx)
+			if p != nil && p.Addr != nil {
+				log.Debugf("xDS stream %d opened from %s", id, p.Addr)
+			}
+			return nil
+		},
+		StreamClosedFunc: func(id int64) {
+			streamsActive.Dec()
+			log.Debugf("xDS stream %d closed", id)
+		},
+		StreamRequestFunc: func(id int64, req *discoveryv3.DiscoveryRequest) error {
+			if req.ErrorDetail != nil {
+				nacksReceived.WithLabelValues(typeLabel(req.TypeUrl)).Inc()
+				log.Warnf("xDS stream %d of node %s rejected version %s of %s: %s", id,
+					req.GetNode().GetId(), req.VersionInfo, req.TypeUrl, req.ErrorDetail.Message)
+			}
+			return nil
+		},
+		StreamResponseFunc: func(_ int64, _ *discoveryv3.DiscoveryRequest, resp *discoveryv3.DiscoveryResponse) {
+			responsesSent.WithLabelValues(typeLabel(resp.TypeUrl)).Inc()
+		},
+	}
+}
+
+// Serve serves until stopped, the snapshot is built at first.
+func (s *Server) Serve() error {
+	log.Infof("xDS server listening on %s...", s.l.Addr())
+	go s.snap.run(s.ctx.Done())
+	return s.g.Serve(s.l)
+}
+
+// Stop stops the server, all the streams are closed at once and envoy will
+// reconnect to the other replicas.
+func (s *Server) Stop() {
+	s.cancel()
+	s.g.Stop()
+}
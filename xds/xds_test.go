@@ -0,0 +1,108 @@
+// Copyright 2020 Samaritan Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	resourcev3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/samaritan-proxy/sash/model"
+)
+
+func TestServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reg := newTestRegistry(ctrl, model.NewService("foo", model.NewServiceInstance("10.0.0.1", 80)))
+	ctl := newTestController(t)
+	defer ctl.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := NewServer(l, reg, ctl)
+	go s.Serve()
+	defer s.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+	assert.NoError(t, err)
+
+	node := &corev3.Node{Id: "envoy"}
+	// clusters
+	assert.NoError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		Node:    node,
+		TypeUrl: resourcev3.ClusterType,
+	}))
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, resourcev3.ClusterType, resp.TypeUrl)
+	assert.Len(t, resp.Resources, 1)
+	cluster := new(clusterv3.Cluster)
+	assert.NoError(t, ptypes.UnmarshalAny(resp.Resources[0], cluster))
+	assert.Equal(t, "foo", cluster.Name)
+	assert.NoError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		Node:          node,
+		TypeUrl:       resourcev3.ClusterType,
+		VersionInfo:   resp.VersionInfo,
+		ResponseNonce: resp.Nonce,
+	}))
+
+	// endpoints
+	assert.NoError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		Node:          node,
+		TypeUrl:       resourcev3.EndpointType,
+		ResourceNames: []string{"foo"},
+	}))
+	resp, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, resourcev3.EndpointType, resp.TypeUrl)
+	assert.Len(t, resp.Resources, 1)
+	cla := new(endpointv3.ClusterLoadAssignment)
+	assert.NoError(t, ptypes.UnmarshalAny(resp.Resources[0], cla))
+	assert.Equal(t, "foo", cla.ClusterName)
+	assert.Len(t, cla.Endpoints[0].LbEndpoints, 1)
+	assert.NoError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		Node:          node,
+		TypeUrl:       resourcev3.EndpointType,
+		ResourceNames: []string{"foo"},
+		VersionInfo:   resp.VersionInfo,
+		ResponseNonce: resp.Nonce,
+	}))
+
+	// only the endpoints are pushed after scaling out.
+	reg.addInstance("foo", model.NewServiceInstance("10.0.0.2", 80))
+	resp, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, resourcev3.EndpointType, resp.TypeUrl)
+	cla = new(endpointv3.ClusterLoadAssignment)
+	assert.NoError(t, ptypes.UnmarshalAny(resp.Resources[0], cla))
+	assert.Len(t, cla.Endpoints[0].LbEndpoints, 2)
+}